@@ -0,0 +1,20 @@
+-- Add activity_log table
+-- Records actions on projects and tasks for auditing and /undo (details hold the data to reverse them)
+
+USE teamwork;
+
+-- Create activity_log table
+CREATE TABLE IF NOT EXISTS activity_log (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    project_id INT NOT NULL,
+    task_id INT NULL,
+    action VARCHAR(50) NOT NULL,
+    details TEXT,
+    undone BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (project_id) REFERENCES projects (id) ON DELETE CASCADE,
+    FOREIGN KEY (task_id) REFERENCES tasks (id) ON DELETE CASCADE,
+    INDEX idx_project_created (project_id, created_at)
+);
@@ -0,0 +1,16 @@
+-- Add js_errors table
+-- Failed executions of AI-generated JavaScript, the most common kinds become prompt examples
+
+USE teamwork;
+
+-- Create js_errors table
+CREATE TABLE IF NOT EXISTS js_errors (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    kind VARCHAR(32) NOT NULL,
+    error TEXT NOT NULL,
+    code TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    INDEX idx_kind_created (kind, created_at)
+);
@@ -8,7 +8,7 @@ CREATE TABLE IF NOT EXISTS messages (
     id INT AUTO_INCREMENT PRIMARY KEY,
     user_id INT NOT NULL,
     chat_id BIGINT NOT NULL,
-    role ENUM('user', 'assistant') NOT NULL,
+    role ENUM('user', 'assistant', 'system', 'function') NOT NULL,
     content TEXT NOT NULL,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     INDEX idx_user_chat_created (user_id, chat_id, created_at),
@@ -0,0 +1,17 @@
+-- Add project_notifications table
+-- Stores per-user notification settings for projects (muted projects skip reminders and digests)
+
+USE teamwork;
+
+-- Create project_notifications table
+CREATE TABLE IF NOT EXISTS project_notifications (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    project_id INT NOT NULL,
+    muted BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (project_id) REFERENCES projects (id) ON DELETE CASCADE,
+    UNIQUE KEY unique_user_project (user_id, project_id),
+    INDEX idx_project_id (project_id)
+);
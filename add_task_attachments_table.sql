@@ -0,0 +1,18 @@
+-- Add task_attachments table
+-- Stores references to Telegram files attached to tasks (the file itself stays on Telegram servers)
+
+USE teamwork;
+
+-- Create task_attachments table
+CREATE TABLE IF NOT EXISTS task_attachments (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    task_id INT NOT NULL,
+    user_id INT NOT NULL,
+    file_id VARCHAR(255) NOT NULL,
+    file_name VARCHAR(255) NOT NULL DEFAULT '',
+    file_type ENUM('photo', 'document') NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (task_id) REFERENCES tasks (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    INDEX idx_task_id (task_id)
+);
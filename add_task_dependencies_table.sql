@@ -0,0 +1,16 @@
+-- Add task_dependencies table
+-- A task cannot start until all tasks it depends on are done
+
+USE teamwork;
+
+-- Create task_dependencies table
+CREATE TABLE IF NOT EXISTS task_dependencies (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    task_id INT NOT NULL,
+    depends_on_task_id INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (task_id) REFERENCES tasks (id) ON DELETE CASCADE,
+    FOREIGN KEY (depends_on_task_id) REFERENCES tasks (id) ON DELETE CASCADE,
+    UNIQUE KEY unique_task_dependency (task_id, depends_on_task_id),
+    INDEX idx_depends_on_task_id (depends_on_task_id)
+);
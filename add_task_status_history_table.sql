@@ -0,0 +1,17 @@
+-- Add task_status_history table
+-- Every status change of a task with its time, for task timelines and cycle-time metrics
+
+USE teamwork;
+
+-- Create task_status_history table
+CREATE TABLE IF NOT EXISTS task_status_history (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    task_id INT NOT NULL,
+    user_id INT NOT NULL,
+    from_status VARCHAR(20) NOT NULL,
+    to_status VARCHAR(20) NOT NULL,
+    changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (task_id) REFERENCES tasks (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    INDEX idx_task_changed (task_id, changed_at)
+);
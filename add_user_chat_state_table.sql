@@ -0,0 +1,20 @@
+-- Add user_chat_state table
+-- The current project is kept per chat, so a group chat and the private chat with the bot
+-- can work on different projects
+
+USE teamwork;
+
+-- Create user_chat_state table
+CREATE TABLE IF NOT EXISTS user_chat_state (
+    user_id INT NOT NULL,
+    chat_id BIGINT NOT NULL,
+    current_project_id INT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, chat_id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (current_project_id) REFERENCES projects (id) ON DELETE SET NULL
+);
+
+-- The per-user current project becomes the one of the private chat, whose ID is the user's Telegram ID
+INSERT IGNORE INTO user_chat_state (user_id, chat_id, current_project_id)
+SELECT id, tg_id, current_project_id FROM users WHERE current_project_id IS NOT NULL;
@@ -0,0 +1,14 @@
+-- Add user_preferences table
+-- Stores per-user settings changed via /settings (language, timezone, digest)
+
+USE teamwork;
+
+-- Create user_preferences table
+CREATE TABLE IF NOT EXISTS user_preferences (
+    user_id INT PRIMARY KEY,
+    language VARCHAR(8) NOT NULL DEFAULT 'ru',
+    timezone VARCHAR(64) NOT NULL DEFAULT 'Europe/Moscow',
+    digest_enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"log"
+	"strings"
 	"telegram-bot/internal"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
@@ -19,43 +22,79 @@ func main() {
 	defer db.Close()
 	log.Println("Connected to database successfully")
 
-	// Initialize AI service
+	// Initialize AI service. Every provider with an API key is set up so users can pick
+	// one in /settings, AI_PROVIDER is the default
 	var aiService *internal.AIService
 	if config.AIEnabled {
+		providers := map[string]internal.AIProvider{}
+		if config.OpenAIAPIKey != "" {
+			openAIProvider := internal.NewOpenAIProvider(config.OpenAIAPIKey)
+			openAIProvider.SetFormattingModel(config.FormattingModel)
+			openAIProvider.SetTemperatures(config.Temperatures)
+			providers["openai"] = openAIProvider
+		}
+		if config.AnthropicAPIKey != "" {
+			claudeProvider := internal.NewClaudeProvider(config.AnthropicAPIKey)
+			claudeProvider.SetFormattingModel(config.FormattingModel)
+			claudeProvider.SetTemperatures(config.Temperatures)
+			providers["anthropic"] = claudeProvider
+		}
+
+		defaultProvider := "openai"
 		switch config.AIProvider {
 		case "anthropic", "claude":
-			if config.AnthropicAPIKey != "" {
-				claudeProvider := internal.NewClaudeProvider(config.AnthropicAPIKey)
-				aiService = internal.NewAIService(claudeProvider, true)
-				log.Println("AI service initialized with Anthropic Claude-3 Opus")
-			} else {
-				log.Println("Anthropic API key not provided, AI service disabled")
-				aiService = internal.NewAIService(nil, false)
-			}
+			defaultProvider = "anthropic"
 		case "openai", "":
-			if config.OpenAIAPIKey != "" {
-				openAIProvider := internal.NewOpenAIProvider(config.OpenAIAPIKey)
-				aiService = internal.NewAIService(openAIProvider, true)
-				log.Println("AI service initialized with OpenAI GPT-4o")
-			} else {
-				log.Println("OpenAI API key not provided, AI service disabled")
-				aiService = internal.NewAIService(nil, false)
-			}
 		default:
 			log.Printf("Unknown AI provider '%s', defaulting to OpenAI", config.AIProvider)
-			if config.OpenAIAPIKey != "" {
-				openAIProvider := internal.NewOpenAIProvider(config.OpenAIAPIKey)
-				aiService = internal.NewAIService(openAIProvider, true)
-				log.Println("AI service initialized with OpenAI GPT-4o (fallback)")
-			} else {
-				log.Println("No valid AI provider available, AI service disabled")
-				aiService = internal.NewAIService(nil, false)
+		}
+
+		if provider, ok := providers[defaultProvider]; ok {
+			aiService = internal.NewAIService(provider, true)
+			for name, provider := range providers {
+				aiService.AddProvider(name, provider)
 			}
+			log.Printf("AI service initialized with %s (available: %s)",
+				defaultProvider, strings.Join(aiService.ProviderNames(), ", "))
+		} else {
+			log.Printf("API key for %s not provided, AI service disabled", defaultProvider)
+			aiService = internal.NewAIService(nil, false)
+		}
+
+		// Audio goes to the transcription provider even when another provider answers,
+		// so voice messages work with Claude as long as an OpenAI key is set
+		if provider, ok := providers[config.TranscriptionProvider]; ok {
+			aiService.SetTranscriptionProvider(provider)
+			log.Printf("Audio transcription via %s", config.TranscriptionProvider)
+		} else {
+			log.Println("No transcription provider configured, audio transcription unavailable")
 		}
 	} else {
 		aiService = internal.NewAIService(nil, false)
 		log.Println("AI service disabled")
 	}
+	aiService.SetConcurrencyLimit(config.MaxConcurrentAI)
+	aiService.SetProviderTimeout(time.Duration(config.AITimeoutSeconds) * time.Second)
+	internal.SetAIProviderChoices(aiService.ProviderNames())
+	internal.SetAssistantPersona(config.AssistantPersona)
+
+	// Show the AI its most common recent mistakes in generated code
+	internal.StartJSErrorExamplesRefresher(db, config.JSErrorExamples)
+
+	// Catch a bad API key now instead of on the first user message
+	if config.AISelfTest && aiService.IsEnabled() {
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		if err := aiService.SelfTest(ctx); err != nil {
+			if aiService.IsEnabled() {
+				log.Printf("⚠️ AI self-test failed, keeping AI enabled: %v", err)
+			} else {
+				log.Printf("❌ AI self-test failed, AI service disabled: %v", err)
+			}
+		} else {
+			log.Println("✅ AI self-test passed")
+		}
+		cancel()
+	}
 
 	// Initialize Telegram bot
 	bot, err := tgbotapi.NewBotAPI(config.TelegramAPIToken)
@@ -66,16 +105,58 @@ func main() {
 	bot.Debug = config.DebugMode
 	log.Printf("Authorized on account %s", bot.Self.UserName)
 
+	// Retry Telegram API calls through network blips, 5xx and rate limits
+	bot.Client = internal.NewTelegramRetryClient(bot.Client, config.TelegramRetryAttempts,
+		time.Duration(config.TelegramRetryBackoffMs)*time.Millisecond,
+		time.Duration(config.TelegramTimeoutSeconds)*time.Second)
+
+	// Drop confirmations that were never answered
+	internal.StartPendingOperationsSweeper(time.Duration(config.PendingOperationTTLMinutes) * time.Minute)
+
+	// Let low-impact deletions skip confirmation
+	internal.SetDeleteConfirmationThresholds(config.ConfirmDeleteMinTasks, config.ConfirmDeleteMinMembers)
+
+	// Keep functions away from roles below their configured minimum
+	internal.SetFunctionMinRoles(config.FunctionMinRoles)
+
+	// Remove deleted projects for good once they can no longer be restored
+	internal.StartDeletedProjectsPurger(db, time.Duration(config.DeletedProjectsRetentionDays)*24*time.Hour)
+
+	// Remove rows whose user, project or task is gone
+	internal.StartMaintenance(db, time.Duration(config.MaintenanceIntervalHours)*time.Hour)
+
+	// Cache project lists read on every message and task lists, changes invalidate them
+	internal.SetProjectsCacheTTL(time.Duration(config.ProjectsCacheSeconds) * time.Second)
+	internal.SetProjectTasksCacheTTL(time.Duration(config.ProjectTasksCacheSeconds) * time.Second)
+
+	// New projects get an explicit status instead of the schema default
+	internal.SetDefaultProjectStatus(internal.ProjectStatus(config.DefaultProjectStatus))
+
+	// Retry saving and loading conversation messages through short database outages
+	internal.SetDBRetry(config.DBRetryAttempts, time.Duration(config.DBRetryBackoffMs)*time.Millisecond)
+
+	// Trim stored chat history every few messages instead of after each one
+	internal.SetMessageCleanupEvery(config.MessageCleanupEvery)
+
+	// Throttle edits of streamed replies
+	internal.SetStreamEditInterval(time.Duration(config.StreamEditIntervalMs) * time.Millisecond)
+
+	// Show a "thinking" message when the AI is slow to answer
+	internal.SetThinkingPlaceholderDelay(time.Duration(config.ThinkingPlaceholderMs) * time.Millisecond)
+
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = config.UpdateTimeout
 
-	updates := bot.GetUpdatesChan(u)
+	// The library doesn't decode message reactions, the bot polls updates itself
+	updates := internal.GetUpdatesChan(bot, u)
 
 	for update := range updates {
 		if update.Message != nil {
-			internal.HandleUserMessage(bot, db, aiService, update)
+			internal.HandleUserMessage(bot, db, aiService, config, update.Update)
 		} else if update.CallbackQuery != nil {
 			internal.HandleCallbackQuery(bot, db, update.CallbackQuery)
+		} else if update.MessageReaction != nil {
+			internal.HandleMessageReaction(bot, db, update.MessageReaction)
 		}
 	}
 }
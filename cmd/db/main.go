@@ -1,14 +1,53 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"strings"
 
+	"github.com/go-sql-driver/mysql"
+
 	"telegram-bot/internal"
 )
 
+// alreadyAppliedErrors are MySQL error numbers meaning a schema change is already in place,
+// so re-running a migration skips the statement instead of failing
+var alreadyAppliedErrors = map[uint16]string{
+	1050: "table already exists",
+	1060: "duplicate column",
+	1061: "duplicate index",
+	1091: "column or index already dropped",
+	1826: "duplicate foreign key",
+}
+
+// coreTables are the tables init.sql creates, the rest come from migrations
+var coreTables = []string{"users", "projects", "project_users", "messages"}
+
+// migrationFiles are the add_*/update_* migrations in the order they were introduced.
+// Later files depend on tables and columns of earlier ones
+var migrationFiles = []string{
+	"add_tasks_table.sql",
+	"add_current_project_to_users.sql",
+	"add_messages_table.sql",
+	"update_message_roles.sql",
+	"add_project_notifications_table.sql",
+	"add_task_dependencies_table.sql",
+	"add_user_preferences_table.sql",
+	"add_activity_log_table.sql",
+	"add_task_attachments_table.sql",
+	"update_activity_log_undo.sql",
+	"add_task_status_history_table.sql",
+	"update_user_preferences_provider.sql",
+	"update_project_users_last_viewed.sql",
+	"update_messages_tg_message_id.sql",
+	"add_js_errors_table.sql",
+	"update_project_users_last_used.sql",
+	"update_projects_deleted_at.sql",
+	"add_user_chat_state_table.sql",
+}
+
 func main() {
 	if len(os.Args) < 2 {
 		printUsage()
@@ -22,12 +61,16 @@ func main() {
 		initDatabase()
 	case "migrate":
 		migrateDatabase()
+	case "migrate-all":
+		migrateAll()
 	case "reset":
 		resetDatabase()
 	case "check":
 		checkConnection()
 	case "status":
 		showStatus()
+	case "cleanup":
+		cleanupDatabase(len(os.Args) > 2 && os.Args[2] == "--yes")
 	case "exec":
 		if len(os.Args) < 3 {
 			fmt.Println("Error: exec command requires a SQL file name")
@@ -50,11 +93,13 @@ func printUsage() {
 	fmt.Println("Usage: go run ./cmd/db <command>")
 	fmt.Println()
 	fmt.Println("Commands:")
-	fmt.Println("  init     - Initialize database schema (for new installations)")
+	fmt.Println("  init     - Initialize database schema (for new installations, skips existing tables)")
 	fmt.Println("  migrate  - Run database migration (for existing databases)")
+	fmt.Println("  migrate-all - Apply all add_*/update_* migrations in order (after init or migrate)")
 	fmt.Println("  reset    - Reset database (WARNING: deletes all data!)")
 	fmt.Println("  check    - Check database connection")
 	fmt.Println("  status   - Show database status and record counts")
+	fmt.Println("  cleanup  - Remove orphaned rows, --yes skips the confirmation")
 	fmt.Println("  exec     - Execute a specific SQL file")
 	fmt.Println("  help     - Show this help message")
 }
@@ -63,11 +108,64 @@ func initDatabase() {
 	fmt.Println("Initializing database schema...")
 
 	config := internal.LoadConfigForDB()
+
+	// Preflight: report what init will do, an initialized database is left untouched
+	db, err := internal.ConnectDB(config)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	present, missing, err := inspectSchema(db)
+	db.Close()
+	if err != nil {
+		log.Fatalf("Failed to inspect database schema: %v", err)
+	}
+
+	if len(missing) == 0 {
+		fmt.Println("✅ Database is already initialized, nothing to do")
+		fmt.Println("💡 Use 'make db-migrate' and 'make db-migrate-all' to update an existing database")
+		return
+	}
+	if len(present) > 0 {
+		fmt.Printf("ℹ️  Existing tables are kept: %s\n", strings.Join(present, ", "))
+	}
+	fmt.Printf("📋 Will create: %s\n", strings.Join(missing, ", "))
+
 	if err := executeSQLFile(config, "init.sql"); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
 	fmt.Println("✅ Database initialized successfully")
+	fmt.Println("💡 Run 'make db-migrate-all' to add the remaining tables and columns")
+}
+
+// inspectSchema splits coreTables into the ones present in the database and the ones missing
+func inspectSchema(db *internal.DB) (present, missing []string, err error) {
+	rows, err := db.Query("SELECT table_name FROM information_schema.tables WHERE table_schema = DATABASE()")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list tables: %v", err)
+	}
+	defer rows.Close()
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan table name: %v", err)
+		}
+		existing[strings.ToLower(name)] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to list tables: %v", err)
+	}
+
+	for _, table := range coreTables {
+		if existing[table] {
+			present = append(present, table)
+		} else {
+			missing = append(missing, table)
+		}
+	}
+	return present, missing, nil
 }
 
 func migrateDatabase() {
@@ -79,6 +177,23 @@ func migrateDatabase() {
 	}
 
 	fmt.Println("✅ Migration completed successfully")
+	fmt.Println("💡 Run 'make db-migrate-all' to add the remaining tables and columns")
+}
+
+// migrateAll applies migrationFiles in order. Changes already in place are skipped,
+// so it is safe to run after every update
+func migrateAll() {
+	fmt.Println("Applying all migrations...")
+
+	config := internal.LoadConfigForDB()
+	for _, filename := range migrationFiles {
+		fmt.Printf("📄 %s\n", filename)
+		if err := executeSQLFile(config, filename); err != nil {
+			log.Fatalf("Failed to apply %s: %v", filename, err)
+		}
+	}
+
+	fmt.Println("✅ All migrations applied successfully")
 }
 
 func resetDatabase() {
@@ -115,6 +230,18 @@ func checkConnection() {
 	defer db.Close()
 
 	fmt.Println("✅ Database connection successful")
+
+	present, missing, err := inspectSchema(db)
+	switch {
+	case err != nil:
+		fmt.Printf("❌ Cannot inspect schema: %v\n", err)
+	case len(missing) == 0:
+		fmt.Println("✅ Schema initialized")
+	case len(present) == 0:
+		fmt.Println("⚠️  Schema not initialized, run 'make db-init'")
+	default:
+		fmt.Printf("⚠️  Schema partially initialized, missing: %s. Run 'make db-init' to create them\n", strings.Join(missing, ", "))
+	}
 }
 
 func showStatus() {
@@ -134,7 +261,7 @@ func showStatus() {
 	defer db.Close()
 
 	// Get table counts
-	tables := []string{"users", "projects", "project_users", "messages", "tasks"}
+	tables := []string{"users", "projects", "project_users", "messages", "tasks", "project_notifications", "task_dependencies", "user_preferences", "activity_log", "task_attachments", "task_status_history", "js_errors", "user_chat_state"}
 	for _, table := range tables {
 		var count int
 		err := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", table)).Scan(&count)
@@ -146,6 +273,57 @@ func showStatus() {
 	}
 }
 
+func cleanupDatabase(confirmed bool) {
+	fmt.Println("Looking for orphaned rows...")
+
+	config := internal.LoadConfigForDB()
+	db, err := internal.ConnectDB(config)
+	if err != nil {
+		log.Fatalf("Cannot connect to database: %v", err)
+	}
+	defer db.Close()
+
+	orphans, err := db.CountOrphans()
+	if err != nil {
+		log.Fatalf("Failed to count orphaned rows: %v", err)
+	}
+	total := 0
+	for _, orphan := range orphans {
+		if orphan.Rows > 0 {
+			fmt.Printf("🗑️  %s: %d orphaned rows\n", orphan.Table, orphan.Rows)
+			total += orphan.Rows
+		}
+	}
+	if total == 0 {
+		fmt.Println("✅ No orphaned rows")
+		return
+	}
+
+	if !confirmed {
+		fmt.Printf("⚠️  This will delete %d rows. Type 'yes' to continue: ", total)
+
+		var confirm string
+		fmt.Scanln(&confirm)
+
+		if confirm != "yes" {
+			fmt.Println("Operation cancelled")
+			return
+		}
+	}
+
+	removed, err := db.CleanupOrphans()
+	for _, result := range removed {
+		if result.Rows > 0 {
+			fmt.Printf("🧹 %s: %d rows removed\n", result.Table, result.Rows)
+		}
+	}
+	if err != nil {
+		log.Fatalf("Failed to clean up database: %v", err)
+	}
+
+	fmt.Println("✅ Cleanup completed")
+}
+
 func executeSQLFile(config *internal.Config, filename string) error {
 	// Read SQL file
 	content, err := os.ReadFile(filename)
@@ -164,6 +342,7 @@ func executeSQLFile(config *internal.Config, filename string) error {
 	sqlContent := string(content)
 	statements := strings.Split(sqlContent, ";")
 
+	skipped := 0
 	for _, statement := range statements {
 		statement = strings.TrimSpace(statement)
 		if statement == "" {
@@ -171,14 +350,44 @@ func executeSQLFile(config *internal.Config, filename string) error {
 		}
 
 		_, err := db.Exec(statement)
+		if reason, ok := alreadyApplied(err); ok {
+			fmt.Printf("⏭️  Skipped (%s): %s\n", reason, firstLine(statement))
+			skipped++
+			continue
+		}
 		if err != nil {
 			return fmt.Errorf("failed to execute SQL statement: %v\nStatement: %s", err, statement)
 		}
 	}
 
+	if skipped > 0 {
+		fmt.Printf("ℹ️  %d statements were already applied\n", skipped)
+	}
+
 	return nil
 }
 
+// alreadyApplied reports whether err means the statement's change already exists in the schema
+func alreadyApplied(err error) (string, bool) {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return "", false
+	}
+	reason, ok := alreadyAppliedErrors[mysqlErr.Number]
+	return reason, ok
+}
+
+// firstLine returns the first non-comment line of a SQL statement for log output
+func firstLine(statement string) string {
+	for _, line := range strings.Split(statement, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return line
+		}
+	}
+	return statement
+}
+
 func execSQLFile(filename string) {
 	fmt.Println("Executing SQL file:", filename)
 
@@ -13,6 +13,7 @@ require (
 require (
 	github.com/anthropics/anthropic-sdk-go v1.4.0
 	github.com/sashabaranov/go-openai v1.40.1
+	github.com/unfunco/anthropic-sdk-go v0.1.0
 )
 
 require (
@@ -23,6 +24,5 @@ require (
 	github.com/tidwall/match v1.1.1 // indirect
 	github.com/tidwall/pretty v1.2.1 // indirect
 	github.com/tidwall/sjson v1.2.5 // indirect
-	github.com/unfunco/anthropic-sdk-go v0.1.0 // indirect
 	golang.org/x/text v0.16.0 // indirect
 )
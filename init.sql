@@ -18,7 +18,7 @@ CREATE TABLE IF NOT EXISTS users (
 );
 
 -- Create projects table (without user_id - projects can have multiple users)
-CREATE TABLE projects (
+CREATE TABLE IF NOT EXISTS projects (
     id INT AUTO_INCREMENT PRIMARY KEY,
     title VARCHAR(255) NOT NULL,
     description TEXT,
@@ -36,7 +36,7 @@ CREATE TABLE projects (
 );
 
 -- Create project_users table for many-to-many relationship with roles
-CREATE TABLE project_users (
+CREATE TABLE IF NOT EXISTS project_users (
     id INT AUTO_INCREMENT PRIMARY KEY,
     project_id INT NOT NULL,
     user_id INT NOT NULL,
@@ -60,7 +60,7 @@ CREATE TABLE IF NOT EXISTS messages (
     id INT AUTO_INCREMENT PRIMARY KEY,
     user_id INT NOT NULL,
     chat_id BIGINT NOT NULL,
-    role ENUM('user', 'assistant') NOT NULL,
+    role ENUM('user', 'assistant', 'system', 'function') NOT NULL,
     content TEXT NOT NULL,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     INDEX idx_user_chat_created (user_id, chat_id, created_at),
@@ -0,0 +1,215 @@
+package internal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// ActivityAction identifies an action recorded in the activity log
+type ActivityAction string
+
+const (
+	ActivityTaskCreated       ActivityAction = "task_created"
+	ActivityTaskStatusChanged ActivityAction = "task_status_changed"
+	ActivityTaskDeleted       ActivityAction = "task_deleted"
+	ActivityTaskReopened      ActivityAction = "task_reopened"
+	ActivityProjectReopened   ActivityAction = "project_reopened"
+	ActivityProjectDeleted    ActivityAction = "project_deleted"
+	ActivityTaskMoved         ActivityAction = "task_moved"
+	ActivityRoleChanged       ActivityAction = "role_changed"
+)
+
+// ActivityDetails holds the data needed to reverse an action, stored as JSON
+type ActivityDetails struct {
+	From string `json:"from,omitempty"` // Previous status, or project ID of a moved task
+	To   string `json:"to,omitempty"`   // New status, or project ID of a moved task
+	Task *Task  `json:"task,omitempty"` // Snapshot of a deleted task
+
+	TargetUserID int `json:"target_user_id,omitempty"` // Member whose role was changed
+}
+
+// Activity is an entry of the activity log
+type Activity struct {
+	ID        int
+	UserID    int
+	ProjectID int
+	TaskID    *int
+	Action    ActivityAction
+	Details   ActivityDetails
+	Undone    bool
+	CreatedAt time.Time
+}
+
+// RoleChange is an audit entry of a member's role being changed
+type RoleChange struct {
+	ActorUserID  int         `json:"actor_user_id"`
+	TargetUserID int         `json:"target_user_id"`
+	OldRole      ProjectRole `json:"old_role"`
+	NewRole      ProjectRole `json:"new_role"`
+	CreatedAt    time.Time   `json:"created_at"`
+}
+
+// execer is implemented by both *DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// LogActivity records an action of a user in a project, taskID is nil for project-level actions
+// and for deleted tasks (their log entries would be removed with the task)
+func (db *DB) LogActivity(userID, projectID int, taskID *int, action ActivityAction, details ActivityDetails) error {
+	return insertActivity(db, userID, projectID, taskID, action, details)
+}
+
+// insertActivity writes an activity log entry, inside a transaction when exec is a *sql.Tx
+func insertActivity(exec execer, userID, projectID int, taskID *int, action ActivityAction, details ActivityDetails) error {
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return fmt.Errorf("failed to marshal activity details: %v", err)
+	}
+
+	query := `
+		INSERT INTO activity_log (user_id, project_id, task_id, action, details)
+		VALUES (?, ?, ?, ?, ?)
+	`
+
+	_, err = exec.Exec(query, userID, projectID, taskID, action, string(detailsJSON))
+	if err != nil {
+		return fmt.Errorf("failed to log activity: %v", err)
+	}
+
+	log.Printf("📝 Activity: user %d %s in project %d (%s)", userID, action, projectID, detailsJSON)
+	return nil
+}
+
+// logActivity records an action without failing the caller, the action itself already happened
+func (db *DB) logActivity(userID, projectID int, taskID *int, action ActivityAction, details ActivityDetails) {
+	if err := db.LogActivity(userID, projectID, taskID, action, details); err != nil {
+		log.Printf("Warning: failed to record %s for user %d: %v", action, userID, err)
+	}
+	// Task activity keeps the project among the user's recent projects
+	if taskID != nil {
+		db.touchRecentProject(projectID, userID)
+	}
+}
+
+// undoableActions are the actions /undo can reverse, each has a handler in undoHandlers.
+// Other actions, such as role changes, are an audit trail only
+var undoableActions = []ActivityAction{
+	ActivityTaskCreated,
+	ActivityTaskStatusChanged,
+	ActivityTaskReopened,
+	ActivityTaskDeleted,
+	ActivityProjectReopened,
+	ActivityProjectDeleted,
+	ActivityTaskMoved,
+}
+
+// GetLastActivity returns the user's most recent undoable action that was not undone,
+// nil if there is none
+func (db *DB) GetLastActivity(userID int) (*Activity, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(undoableActions)), ", ")
+	query := fmt.Sprintf(`
+		SELECT id, user_id, project_id, task_id, action, details, undone, created_at
+		FROM activity_log
+		WHERE user_id = ? AND undone = FALSE AND action IN (%s)
+		ORDER BY id DESC
+		LIMIT 1
+	`, placeholders)
+
+	args := []interface{}{userID}
+	for _, action := range undoableActions {
+		args = append(args, action)
+	}
+
+	activity := &Activity{}
+	var taskID sql.NullInt64
+	var details sql.NullString
+	err := db.QueryRow(query, args...).Scan(
+		&activity.ID, &activity.UserID, &activity.ProjectID, &taskID,
+		&activity.Action, &details, &activity.Undone, &activity.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last activity: %v", err)
+	}
+
+	if taskID.Valid {
+		id := int(taskID.Int64)
+		activity.TaskID = &id
+	}
+	// Entries written before details were JSON can't be reversed, they keep empty details
+	if details.Valid {
+		if err := json.Unmarshal([]byte(details.String), &activity.Details); err != nil {
+			log.Printf("⚠️ Activity %d has non-JSON details: %v", activity.ID, err)
+		}
+	}
+
+	return activity, nil
+}
+
+// MarkActivityUndone marks an activity entry as reversed so /undo moves on to the previous one
+func (db *DB) MarkActivityUndone(activityID int) error {
+	_, err := db.Exec("UPDATE activity_log SET undone = TRUE WHERE id = ?", activityID)
+	if err != nil {
+		return fmt.Errorf("failed to mark activity as undone: %v", err)
+	}
+	return nil
+}
+
+// roleChangeHistoryLimit is the maximum number of entries returned by GetRoleChangeHistory
+const roleChangeHistoryLimit = 50
+
+// GetRoleChangeHistory returns the latest role changes in a project, newest first.
+// Only owners and admins of the project may read it
+func (db *DB) GetRoleChangeHistory(projectID, userID int) ([]*RoleChange, error) {
+	role, err := db.GetUserRoleInProject(projectID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if role != RoleOwner && role != RoleAdmin {
+		return nil, fmt.Errorf("insufficient permissions: only owners and admins can view role changes")
+	}
+
+	query := `
+		SELECT user_id, details, created_at
+		FROM activity_log
+		WHERE project_id = ? AND action = ?
+		ORDER BY id DESC
+		LIMIT ?
+	`
+
+	rows, err := db.Query(query, projectID, ActivityRoleChanged, roleChangeHistoryLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role changes: %v", err)
+	}
+	defer rows.Close()
+
+	changes := []*RoleChange{}
+	for rows.Next() {
+		change := &RoleChange{}
+		var details sql.NullString
+		if err := rows.Scan(&change.ActorUserID, &details, &change.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan role change: %v", err)
+		}
+
+		var parsed ActivityDetails
+		if details.Valid {
+			if err := json.Unmarshal([]byte(details.String), &parsed); err != nil {
+				return nil, fmt.Errorf("failed to parse role change details: %v", err)
+			}
+		}
+		change.TargetUserID = parsed.TargetUserID
+		change.OldRole = ProjectRole(parsed.From)
+		change.NewRole = ProjectRole(parsed.To)
+
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Limits of the /activity admin view
+const (
+	activityChats           = 5   // Most recently active chats shown
+	activityMessagesPerChat = 3   // Last messages shown per chat
+	activityPreviewLength   = 100 // Characters of each message shown
+)
+
+// SendRecentActivity sends the latest messages of the most recently active chats.
+// Callers must check Config.IsAdmin first
+func SendRecentActivity(bot *tgbotapi.BotAPI, db *DB, chatID int64) {
+	chatIDs, err := db.GetActiveChatIDs(activityChats)
+	if err != nil {
+		log.Printf("❌ Error getting active chats: %v", err)
+		SendReply(bot, chatID, "❌ Не удалось получить активность")
+		return
+	}
+	if len(chatIDs) == 0 {
+		SendReply(bot, chatID, "📭 Сообщений пока нет")
+		return
+	}
+
+	messages, err := db.GetRecentMessagesForChats(chatIDs, activityMessagesPerChat)
+	if err != nil {
+		log.Printf("❌ Error getting recent messages: %v", err)
+		SendReply(bot, chatID, "❌ Не удалось получить активность")
+		return
+	}
+
+	var sections []string
+	for _, id := range chatIDs {
+		lines := []string{fmt.Sprintf("💬 <b>Чат %d</b>", id)}
+		for _, msg := range messages[id] {
+			preview := []rune(msg.Content)
+			if len(preview) > activityPreviewLength {
+				preview = append(preview[:activityPreviewLength], '…')
+			}
+			lines = append(lines, fmt.Sprintf("%s [%s] #%d: %s",
+				msg.CreatedAt.Format("02.01 15:04"), msg.Role, msg.UserID, html.EscapeString(string(preview))))
+		}
+		sections = append(sections, strings.Join(lines, "\n"))
+	}
+
+	SendReply(bot, chatID, "🛡 <b>Последняя активность</b>\n\n"+strings.Join(sections, "\n\n"))
+}
@@ -2,9 +2,15 @@ package internal
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/sashabaranov/go-openai"
 	anthropic "github.com/unfunco/anthropic-sdk-go"
@@ -16,20 +22,90 @@ type AIProvider interface {
 	GenerateResponseWithContext(ctx context.Context, prompt string, history []*Message) (string, error)
 	GenerateWelcomeMessage(ctx context.Context, userName, status, timestamp string) (string, error)
 	GenerateErrorMessage(ctx context.Context, errorContext string) (string, error)
+	GenerateFormattedText(ctx context.Context, prompt string) (string, error)
 	TranscribeAudio(ctx context.Context, audioData io.Reader, filename string) (string, error)
 	GenerateResponseWithContextAndProject(ctx context.Context, prompt string, history []*Message, currentProject *Project) (string, error)
+	SelfTest(ctx context.Context) error
+}
+
+// ErrAIAuth is returned by SelfTest when the provider rejects the API key
+var ErrAIAuth = errors.New("AI provider rejected the API key")
+
+// isAuthError reports whether a provider error is an authentication failure
+func isAuthError(err error) bool {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode == 401 || apiErr.HTTPStatusCode == 403
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.HTTPStatusCode == 401 || reqErr.HTTPStatusCode == 403
+	}
+	var claudeErr *ClaudeAPIError
+	if errors.As(err, &claudeErr) {
+		return claudeErr.StatusCode == 401 || claudeErr.StatusCode == 403
+	}
+	return false
+}
+
+// ClaudeAPIError is an error status returned by the Anthropic API. The Anthropic SDK returns the
+// HTTP response without an error for these, claudeResponseError turns them into one
+type ClaudeAPIError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *ClaudeAPIError) Error() string {
+	return fmt.Sprintf("Claude API returned %s", e.Status)
+}
+
+// claudeResponseError returns the transport error of a Claude call, or a ClaudeAPIError
+// when the API answered with an error status
+func claudeResponseError(httpResp *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	if httpResp != nil && httpResp.StatusCode >= 400 {
+		return &ClaudeAPIError{StatusCode: httpResp.StatusCode, Status: httpResp.Status}
+	}
+	return nil
+}
+
+// PromptType identifies the kind of AI call, each kind may use its own temperature
+type PromptType string
+
+const (
+	PromptChat       PromptType = "chat"       // Main conversation generating JavaScript
+	PromptFormatting PromptType = "formatting" // Formatting function data for the user
+	PromptWelcome    PromptType = "welcome"    // Welcome messages
+	PromptError      PromptType = "error"      // User-friendly error messages
+)
+
+// defaultTemperature is used for prompt types without a configured temperature
+const defaultTemperature = 0.7
+
+// temperatureFor returns the configured temperature of a prompt type or the default
+func temperatureFor(temperatures map[PromptType]float64, promptType PromptType) float64 {
+	if temperature, ok := temperatures[promptType]; ok {
+		return temperature
+	}
+	return defaultTemperature
 }
 
 // OpenAIProvider implementation for OpenAI ChatGPT
 type OpenAIProvider struct {
-	client *openai.Client
-	model  string
+	client          *openai.Client
+	model           string
+	formattingModel string                 // Cheaper model for formatting and templated messages, empty uses model
+	temperatures    map[PromptType]float64 // Temperature per prompt type, missing types use defaultTemperature
 }
 
 // ClaudeProvider implementation for Anthropic Claude
 type ClaudeProvider struct {
-	client *anthropic.Client
-	model  string
+	client          *anthropic.Client
+	model           string
+	formattingModel string                 // Cheaper model for formatting and templated messages, empty uses model
+	temperatures    map[PromptType]float64 // Temperature per prompt type, missing types use defaultTemperature
 }
 
 // NewOpenAIProvider creates a new OpenAI provider
@@ -51,6 +127,35 @@ func NewClaudeProvider(apiKey string) *ClaudeProvider {
 	}
 }
 
+// SetFormattingModel sets the model used for data formatting, welcome and error messages
+func (p *OpenAIProvider) SetFormattingModel(model string) {
+	p.formattingModel = model
+}
+
+// SetTemperatures sets the temperature per prompt type
+func (p *OpenAIProvider) SetTemperatures(temperatures map[PromptType]float64) {
+	p.temperatures = temperatures
+}
+
+// getFormattingModel returns the formatting model, falling back to the primary model
+func (p *OpenAIProvider) getFormattingModel() string {
+	if p.formattingModel != "" {
+		return p.formattingModel
+	}
+	return p.model
+}
+
+// SelfTest checks the API key by listing models, which costs no tokens
+func (p *OpenAIProvider) SelfTest(ctx context.Context) error {
+	if _, err := p.client.ListModels(ctx); err != nil {
+		if isAuthError(err) {
+			return fmt.Errorf("%w: %v", ErrAIAuth, err)
+		}
+		return fmt.Errorf("OpenAI self-test failed: %v", err)
+	}
+	return nil
+}
+
 // TranscribeAudio transcribes audio using OpenAI Whisper API
 func (p *OpenAIProvider) TranscribeAudio(ctx context.Context, audioData io.Reader, filename string) (string, error) {
 	req := openai.AudioRequest{
@@ -70,17 +175,22 @@ func (p *OpenAIProvider) TranscribeAudio(ctx context.Context, audioData io.Reade
 
 // GenerateResponse generates a response using OpenAI ChatGPT
 func (p *OpenAIProvider) GenerateResponse(ctx context.Context, prompt string) (string, error) {
+	return p.generateResponseWithModel(ctx, p.model, prompt, PromptChat)
+}
+
+// generateResponseWithModel generates a single-prompt response with the given model
+func (p *OpenAIProvider) generateResponseWithModel(ctx context.Context, model, prompt string, promptType PromptType) (string, error) {
 	// Get available functions
-	openAIFunctions := GetGPTFunctions()
+	openAIFunctions := gptFunctionsFor(ctx)
 
 	resp, err := p.client.CreateChatCompletion(
 		ctx,
 		openai.ChatCompletionRequest{
-			Model: p.model,
+			Model: model,
 			Messages: []openai.ChatCompletionMessage{
 				{
 					Role:    openai.ChatMessageRoleSystem,
-					Content: GetSystemPrompt(),
+					Content: systemPromptForType(ctx, promptType),
 				},
 				{
 					Role:    openai.ChatMessageRoleUser,
@@ -89,7 +199,7 @@ func (p *OpenAIProvider) GenerateResponse(ctx context.Context, prompt string) (s
 			},
 			Functions:   openAIFunctions,
 			MaxTokens:   500,
-			Temperature: 0.7,
+			Temperature: float32(temperatureFor(p.temperatures, promptType)),
 		},
 	)
 
@@ -116,40 +226,35 @@ func (p *OpenAIProvider) GenerateResponse(ctx context.Context, prompt string) (s
 // GenerateWelcomeMessage generates a personalized welcome message
 func (p *OpenAIProvider) GenerateWelcomeMessage(ctx context.Context, userName, status, timestamp string) (string, error) {
 	prompt := fmt.Sprintf(WelcomePromptTemplate, userName, status, timestamp)
-	return p.GenerateResponse(ctx, prompt)
+	return p.generateResponseWithModel(ctx, p.getFormattingModel(), prompt, PromptWelcome)
 }
 
 // GenerateErrorMessage generates a user-friendly error message
 func (p *OpenAIProvider) GenerateErrorMessage(ctx context.Context, errorContext string) (string, error) {
 	prompt := fmt.Sprintf(ErrorPromptTemplate, errorContext)
-	return p.GenerateResponse(ctx, prompt)
+	return p.generateResponseWithModel(ctx, p.getFormattingModel(), prompt, PromptError)
+}
+
+// GenerateFormattedText generates text shown to the user as is, e.g. a summary of data in the prompt
+func (p *OpenAIProvider) GenerateFormattedText(ctx context.Context, prompt string) (string, error) {
+	return p.generateResponseWithModel(ctx, p.getFormattingModel(), prompt, PromptFormatting)
 }
 
 // GenerateResponseWithContext generates a response using OpenAI ChatGPT with conversation history
 func (p *OpenAIProvider) GenerateResponseWithContext(ctx context.Context, prompt string, history []*Message) (string, error) {
 	// Get available functions
-	openAIFunctions := GetGPTFunctions()
+	openAIFunctions := gptFunctionsFor(ctx)
 
 	// Build message history
 	messages := []openai.ChatCompletionMessage{
 		{
 			Role:    openai.ChatMessageRoleSystem,
-			Content: GetSystemPrompt(),
+			Content: systemPromptFor(ctx),
 		},
 	}
 
 	// Add conversation history
-	for _, msg := range history {
-		role := openai.ChatMessageRoleUser
-		if msg.Role == "assistant" {
-			role = openai.ChatMessageRoleAssistant
-		}
-
-		messages = append(messages, openai.ChatCompletionMessage{
-			Role:    role,
-			Content: msg.Content,
-		})
-	}
+	messages = append(messages, buildOpenAIHistory(history)...)
 
 	// Add current user message
 	messages = append(messages, openai.ChatCompletionMessage{
@@ -164,7 +269,7 @@ func (p *OpenAIProvider) GenerateResponseWithContext(ctx context.Context, prompt
 			Messages:    messages,
 			Functions:   openAIFunctions,
 			MaxTokens:   500,
-			Temperature: 0.7,
+			Temperature: float32(temperatureFor(p.temperatures, PromptChat)),
 		},
 	)
 
@@ -191,14 +296,12 @@ func (p *OpenAIProvider) GenerateResponseWithContext(ctx context.Context, prompt
 // GenerateResponseWithContextAndProject generates a response using OpenAI ChatGPT with conversation history and current project context
 func (p *OpenAIProvider) GenerateResponseWithContextAndProject(ctx context.Context, prompt string, history []*Message, currentProject *Project) (string, error) {
 	// Get available functions
-	openAIFunctions := GetGPTFunctions()
+	openAIFunctions := gptFunctionsFor(ctx)
 
 	// Build enhanced system prompt with current project info
-	systemPrompt := GetSystemPrompt()
+	systemPrompt := systemPromptFor(ctx)
 	if currentProject != nil {
-		projectInfo := fmt.Sprintf("\n\nТЕКУЩИЙ ПРОЕКТ ПОЛЬЗОВАТЕЛЯ:\n- ID: %d\n- Название: %s\n- Описание: %s\n- Статус: %s\n- Роль пользователя: %s\n\nПри создании задач используй этот проект по умолчанию, если пользователь не указал другой проект явно.",
-			currentProject.ID, currentProject.Title, currentProject.Description, currentProject.Status, currentProject.UserRole)
-		systemPrompt += projectInfo
+		systemPrompt += buildProjectContext(currentProject)
 	}
 
 	// Build message history
@@ -210,17 +313,7 @@ func (p *OpenAIProvider) GenerateResponseWithContextAndProject(ctx context.Conte
 	}
 
 	// Add conversation history
-	for _, msg := range history {
-		role := openai.ChatMessageRoleUser
-		if msg.Role == "assistant" {
-			role = openai.ChatMessageRoleAssistant
-		}
-
-		messages = append(messages, openai.ChatCompletionMessage{
-			Role:    role,
-			Content: msg.Content,
-		})
-	}
+	messages = append(messages, buildOpenAIHistory(history)...)
 
 	// Add current user message
 	messages = append(messages, openai.ChatCompletionMessage{
@@ -235,7 +328,7 @@ func (p *OpenAIProvider) GenerateResponseWithContextAndProject(ctx context.Conte
 			Messages:    messages,
 			Functions:   openAIFunctions,
 			MaxTokens:   500,
-			Temperature: 0.7,
+			Temperature: float32(temperatureFor(p.temperatures, PromptChat)),
 		},
 	)
 
@@ -261,8 +354,14 @@ func (p *OpenAIProvider) GenerateResponseWithContextAndProject(ctx context.Conte
 
 // AIService manages AI providers and provides high-level AI functionality
 type AIService struct {
-	provider AIProvider
-	enabled  bool
+	provider  AIProvider
+	enabled   bool
+	slots     chan struct{}         // Limits in-flight provider calls, nil means unlimited
+	providers map[string]AIProvider // Configured providers users may choose, by name ("openai", "anthropic")
+
+	transcriber AIProvider // Transcribes audio whatever provider answers, nil when transcription is unavailable
+
+	providerTimeout time.Duration // Limit of one chat provider call, 0 leaves only the caller's deadline
 }
 
 // NewAIService creates a new AI service
@@ -273,18 +372,160 @@ func NewAIService(provider AIProvider, enabled bool) *AIService {
 	}
 }
 
+// AddProvider makes a configured provider available to users under name.
+// Must be called before the service is used
+func (s *AIService) AddProvider(name string, provider AIProvider) {
+	if s.providers == nil {
+		s.providers = make(map[string]AIProvider)
+	}
+	s.providers[normalizeProviderName(name)] = provider
+}
+
+// SetTranscriptionProvider routes audio transcription to provider, independent of the chat
+// provider: only OpenAI Whisper transcribes, so Claude users still get voice messages.
+// nil makes transcription unavailable. Must be called before the service is used
+func (s *AIService) SetTranscriptionProvider(provider AIProvider) {
+	s.transcriber = provider
+}
+
+// CanTranscribe returns whether a transcription provider is configured
+func (s *AIService) CanTranscribe() bool {
+	return s.transcriber != nil
+}
+
+// ProviderNames returns the names of the providers users may choose, sorted
+func (s *AIService) ProviderNames() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ForProvider returns the service using the named provider for its calls, sharing the concurrency
+// limit. The service itself is returned when name is empty or not configured
+func (s *AIService) ForProvider(name string) *AIService {
+	provider, ok := s.providers[normalizeProviderName(name)]
+	if !ok || provider == s.provider {
+		return s
+	}
+
+	view := *s
+	view.provider = provider
+	return &view
+}
+
+// normalizeProviderName maps provider aliases to the names providers are registered under
+func normalizeProviderName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "claude" {
+		return "anthropic"
+	}
+	return name
+}
+
 // IsEnabled returns whether AI service is enabled
 func (s *AIService) IsEnabled() bool {
 	return s.enabled && s.provider != nil
 }
 
-// TranscribeAudio transcribes audio if enabled, otherwise returns error
-func (s *AIService) TranscribeAudio(ctx context.Context, audioData io.Reader, filename string) (string, error) {
+// SetConcurrencyLimit limits the number of provider calls in flight, callers wait for a free slot.
+// A non-positive limit removes the cap. Must be called before the service is used
+func (s *AIService) SetConcurrencyLimit(limit int) {
+	if limit <= 0 {
+		s.slots = nil
+		return
+	}
+	s.slots = make(chan struct{}, limit)
+}
+
+// SelfTest makes a minimal provider call to verify the API key. If the key is rejected
+// the service is disabled, so users get fallback responses instead of per-request errors.
+// Other failures (e.g. network) are returned but leave the service enabled
+func (s *AIService) SelfTest(ctx context.Context) error {
 	if !s.IsEnabled() {
-		return "", fmt.Errorf("AI service is disabled")
+		return nil
+	}
+
+	err := s.provider.SelfTest(ctx)
+	if errors.Is(err, ErrAIAuth) {
+		s.enabled = false
+	}
+	return err
+}
+
+// ErrAITimeout is returned when a provider call outlived the provider timeout
+// while the caller still had time left, e.g. to tell the user
+var ErrAITimeout = errors.New("AI provider timed out")
+
+// SetProviderTimeout limits each chat provider call to timeout, so a slow provider leaves the
+// handler time to answer. Keep it below the handler's own timeout, a non-positive timeout
+// removes the limit. Transcription is not limited, long recordings take a while.
+// Must be called before the service is used
+func (s *AIService) SetProviderTimeout(timeout time.Duration) {
+	if timeout < 0 {
+		timeout = 0
+	}
+	s.providerTimeout = timeout
+}
+
+// providerContext returns the context of one provider call, ctx limited to the provider timeout
+func (s *AIService) providerContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.providerTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, s.providerTimeout)
+}
+
+// providerError turns the error of a call made with callCtx into ErrAITimeout when the provider
+// timeout ended it, errors of the caller's own deadline are returned as they are
+func (s *AIService) providerError(ctx, callCtx context.Context, err error) error {
+	if err == nil || ctx.Err() != nil || !errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	log.Printf("⏱️ AI provider call exceeded %v: %v", s.providerTimeout, err)
+	return fmt.Errorf("%w after %v", ErrAITimeout, s.providerTimeout)
+}
+
+// acquire waits for a free provider slot or until ctx is done.
+// The returned function releases the slot
+func (s *AIService) acquire(ctx context.Context) (func(), error) {
+	if s.slots == nil {
+		return func() {}, nil
+	}
+
+	start := time.Now()
+	select {
+	case s.slots <- struct{}{}:
+	case <-ctx.Done():
+		log.Printf("⏳ AI request gave up after waiting %v for a free slot", time.Since(start))
+		return nil, fmt.Errorf("waiting for AI slot: %v", ctx.Err())
+	}
+
+	if wait := time.Since(start); wait > 100*time.Millisecond {
+		log.Printf("⏳ AI request waited %v for a free slot (%d in flight)", wait, len(s.slots))
+	}
+	return func() { <-s.slots }, nil
+}
+
+// ErrTranscriptionUnavailable is returned by TranscribeAudio when no transcription provider is configured
+var ErrTranscriptionUnavailable = errors.New("audio transcription unavailable")
+
+// TranscribeAudio transcribes audio with the transcription provider, which doesn't depend on
+// the chat provider the user picked
+func (s *AIService) TranscribeAudio(ctx context.Context, audioData io.Reader, filename string) (string, error) {
+	if !s.CanTranscribe() {
+		return "", ErrTranscriptionUnavailable
 	}
 
-	return s.provider.TranscribeAudio(ctx, audioData, filename)
+	release, err := s.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	return s.transcriber.TranscribeAudio(ctx, audioData, filename)
 }
 
 // GenerateResponse generates an AI response if enabled, otherwise returns fallback
@@ -294,11 +535,48 @@ func (s *AIService) GenerateResponse(ctx context.Context, prompt string, fallbac
 		return fallback
 	}
 
-	response, err := s.provider.GenerateResponse(ctx, prompt)
+	release, err := s.acquire(ctx)
 	if err != nil {
 		log.Printf("AI generation failed, using fallback: %v", err)
 		return fallback
 	}
+	defer release()
+
+	callCtx, cancel := s.providerContext(ctx)
+	defer cancel()
+
+	response, err := s.provider.GenerateResponse(callCtx, prompt)
+	if err = s.providerError(ctx, callCtx, err); err != nil {
+		log.Printf("AI generation failed, using fallback: %v", err)
+		return fallback
+	}
+
+	return response
+}
+
+// GenerateFormattedText generates text for the user without the JavaScript chat prompt if enabled,
+// otherwise returns fallback
+func (s *AIService) GenerateFormattedText(ctx context.Context, prompt string, fallback string) string {
+	if !s.IsEnabled() {
+		log.Printf("AI service disabled, using fallback response")
+		return fallback
+	}
+
+	release, err := s.acquire(ctx)
+	if err != nil {
+		log.Printf("AI formatting failed, using fallback: %v", err)
+		return fallback
+	}
+	defer release()
+
+	callCtx, cancel := s.providerContext(ctx)
+	defer cancel()
+
+	response, err := s.provider.GenerateFormattedText(callCtx, prompt)
+	if err = s.providerError(ctx, callCtx, err); err != nil {
+		log.Printf("AI formatting failed, using fallback: %v", err)
+		return fallback
+	}
 
 	return response
 }
@@ -309,11 +587,21 @@ func (s *AIService) GenerateWelcomeMessage(ctx context.Context, userName, status
 		return fallback
 	}
 
-	response, err := s.provider.GenerateWelcomeMessage(ctx, userName, status, timestamp)
+	release, err := s.acquire(ctx)
 	if err != nil {
 		log.Printf("AI welcome generation failed, using fallback: %v", err)
 		return fallback
 	}
+	defer release()
+
+	callCtx, cancel := s.providerContext(ctx)
+	defer cancel()
+
+	response, err := s.provider.GenerateWelcomeMessage(callCtx, userName, status, timestamp)
+	if err = s.providerError(ctx, callCtx, err); err != nil {
+		log.Printf("AI welcome generation failed, using fallback: %v", err)
+		return fallback
+	}
 
 	return response
 }
@@ -324,10 +612,19 @@ func (s *AIService) GenerateResponseWithContext(ctx context.Context, prompt stri
 		return fallback, nil
 	}
 
-	response, err := s.provider.GenerateResponseWithContext(ctx, prompt, history)
+	release, err := s.acquire(ctx)
 	if err != nil {
 		return "", err
 	}
+	defer release()
+
+	callCtx, cancel := s.providerContext(ctx)
+	defer cancel()
+
+	response, err := s.provider.GenerateResponseWithContext(callCtx, prompt, history)
+	if err != nil {
+		return "", s.providerError(ctx, callCtx, err)
+	}
 
 	return response, nil
 }
@@ -338,19 +635,28 @@ func (s *AIService) GenerateResponseWithContextAndProject(ctx context.Context, p
 		return fallback, nil
 	}
 
+	release, err := s.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	callCtx, cancel := s.providerContext(ctx)
+	defer cancel()
+
 	// Check if provider supports project context
 	if provider, ok := s.provider.(*OpenAIProvider); ok {
-		response, err := provider.GenerateResponseWithContextAndProject(ctx, prompt, history, currentProject)
+		response, err := provider.GenerateResponseWithContextAndProject(callCtx, prompt, history, currentProject)
 		if err != nil {
-			return "", err
+			return "", s.providerError(ctx, callCtx, err)
 		}
 		return response, nil
 	}
 
 	// Fallback to regular context if provider doesn't support project context
-	response, err := s.provider.GenerateResponseWithContext(ctx, prompt, history)
+	response, err := s.provider.GenerateResponseWithContext(callCtx, prompt, history)
 	if err != nil {
-		return "", err
+		return "", s.providerError(ctx, callCtx, err)
 	}
 
 	return response, nil
@@ -380,16 +686,26 @@ func (s *AIService) FormatDataResponse(ctx context.Context, userQuery string, fu
 Если список пуст, обязательно предложи альтернативные действия через кнопки.`, userQuery, functionType, jsonData)
 
 	// Get available functions
-	openAIFunctions := GetGPTFunctions()
+	openAIFunctions := gptFunctionsFor(ctx)
 
-	resp, err := s.provider.(*OpenAIProvider).client.CreateChatCompletion(
-		ctx,
+	release, err := s.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	callCtx, cancel := s.providerContext(ctx)
+	defer cancel()
+
+	provider := s.provider.(*OpenAIProvider)
+	resp, err := provider.client.CreateChatCompletion(
+		callCtx,
 		openai.ChatCompletionRequest{
-			Model: s.provider.(*OpenAIProvider).model,
+			Model: provider.getFormattingModel(),
 			Messages: []openai.ChatCompletionMessage{
 				{
 					Role:    openai.ChatMessageRoleSystem,
-					Content: GetSystemPrompt(),
+					Content: systemPromptFor(ctx),
 				},
 				{
 					Role:    openai.ChatMessageRoleUser,
@@ -398,11 +714,14 @@ func (s *AIService) FormatDataResponse(ctx context.Context, userQuery string, fu
 			},
 			Functions:   openAIFunctions,
 			MaxTokens:   500,
-			Temperature: 0.7,
+			Temperature: float32(temperatureFor(provider.temperatures, PromptFormatting)),
 		},
 	)
 
 	if err != nil {
+		if err := s.providerError(ctx, callCtx, err); errors.Is(err, ErrAITimeout) {
+			return "", err
+		}
 		return "", fmt.Errorf("ChatGPT API error: %v", err)
 	}
 
@@ -422,23 +741,46 @@ func (s *AIService) FormatDataResponse(ctx context.Context, userQuery string, fu
 	return response, nil
 }
 
+// SetFormattingModel sets the model used for welcome and error messages
+func (p *ClaudeProvider) SetFormattingModel(model string) {
+	p.formattingModel = model
+}
+
+// SetTemperatures sets the temperature per prompt type
+func (p *ClaudeProvider) SetTemperatures(temperatures map[PromptType]float64) {
+	p.temperatures = temperatures
+}
+
+// getFormattingModel returns the formatting model, falling back to the primary model
+func (p *ClaudeProvider) getFormattingModel() string {
+	if p.formattingModel != "" {
+		return p.formattingModel
+	}
+	return p.model
+}
+
 // GenerateResponse generates a response using Anthropic Claude
 func (p *ClaudeProvider) GenerateResponse(ctx context.Context, prompt string) (string, error) {
-	resp, _, err := p.client.Messages.Create(ctx, &anthropic.CreateMessageInput{
-		Model:     anthropic.LanguageModel(p.model),
+	return p.generateResponseWithModel(ctx, p.model, prompt, PromptChat)
+}
+
+// generateResponseWithModel generates a single-prompt response with the given model
+func (p *ClaudeProvider) generateResponseWithModel(ctx context.Context, model, prompt string, promptType PromptType) (string, error) {
+	resp, httpResp, err := p.client.Messages.Create(ctx, &anthropic.CreateMessageInput{
+		Model:     anthropic.LanguageModel(model),
 		MaxTokens: 500,
-		System:    GetSystemPrompt(),
+		System:    systemPromptForType(ctx, promptType),
 		Messages: []anthropic.Message{
 			{
 				Role:    "user",
 				Content: prompt,
 			},
 		},
-		Temperature: &[]float64{0.7}[0],
+		Temperature: &[]float64{temperatureFor(p.temperatures, promptType)}[0],
 	})
 
-	if err != nil {
-		return "", fmt.Errorf("Claude API error: %v", err)
+	if err := claudeResponseError(httpResp, err); err != nil {
+		return "", fmt.Errorf("Claude API error: %w", err)
 	}
 
 	if len(resp.Content) == 0 {
@@ -450,57 +792,68 @@ func (p *ClaudeProvider) GenerateResponse(ctx context.Context, prompt string) (s
 	return response, nil
 }
 
+// SelfTest checks the API key with a one-token completion
+func (p *ClaudeProvider) SelfTest(ctx context.Context) error {
+	_, httpResp, err := p.client.Messages.Create(ctx, &anthropic.CreateMessageInput{
+		Model:     anthropic.LanguageModel(p.getFormattingModel()),
+		MaxTokens: 1,
+		Messages: []anthropic.Message{
+			{
+				Role:    "user",
+				Content: "ping",
+			},
+		},
+	})
+	if err := claudeResponseError(httpResp, err); err != nil {
+		if isAuthError(err) {
+			return fmt.Errorf("%w: %v", ErrAIAuth, err)
+		}
+		return fmt.Errorf("Claude self-test failed: %v", err)
+	}
+	return nil
+}
+
 // GenerateWelcomeMessage generates a personalized welcome message
 func (p *ClaudeProvider) GenerateWelcomeMessage(ctx context.Context, userName, status, timestamp string) (string, error) {
 	prompt := fmt.Sprintf(WelcomePromptTemplate, userName, status, timestamp)
-	return p.GenerateResponse(ctx, prompt)
+	return p.generateResponseWithModel(ctx, p.getFormattingModel(), prompt, PromptWelcome)
 }
 
 // GenerateErrorMessage generates a user-friendly error message
 func (p *ClaudeProvider) GenerateErrorMessage(ctx context.Context, errorContext string) (string, error) {
 	prompt := fmt.Sprintf(ErrorPromptTemplate, errorContext)
-	return p.GenerateResponse(ctx, prompt)
+	return p.generateResponseWithModel(ctx, p.getFormattingModel(), prompt, PromptError)
+}
+
+// GenerateFormattedText generates text shown to the user as is, e.g. a summary of data in the prompt
+func (p *ClaudeProvider) GenerateFormattedText(ctx context.Context, prompt string) (string, error) {
+	return p.generateResponseWithModel(ctx, p.getFormattingModel(), prompt, PromptFormatting)
 }
 
-// TranscribeAudio - Claude doesn't support audio transcription, fallback to OpenAI
+// TranscribeAudio - Claude doesn't support audio transcription, AIService routes audio to the
+// transcription provider instead
 func (p *ClaudeProvider) TranscribeAudio(ctx context.Context, audioData io.Reader, filename string) (string, error) {
 	return "", fmt.Errorf("audio transcription not supported by Claude provider - use OpenAI Whisper")
 }
 
 // GenerateResponseWithContext generates a response using Anthropic Claude with conversation history
 func (p *ClaudeProvider) GenerateResponseWithContext(ctx context.Context, prompt string, history []*Message) (string, error) {
-	// Build message history
-	messages := []anthropic.Message{}
-
-	// Add conversation history
-	for _, msg := range history {
-		role := "user"
-		if msg.Role == "assistant" {
-			role = "assistant"
-		}
+	// Build message history, system messages go to the system prompt
+	systemPrompt, messages := buildClaudeHistory(systemPromptFor(ctx), history)
 
-		messages = append(messages, anthropic.Message{
-			Role:    role,
-			Content: msg.Content,
-		})
-	}
+	// Add current user message, keeping turns alternating
+	messages = addClaudePrompt(messages, prompt)
 
-	// Add current user message
-	messages = append(messages, anthropic.Message{
-		Role:    "user",
-		Content: prompt,
-	})
-
-	resp, _, err := p.client.Messages.Create(ctx, &anthropic.CreateMessageInput{
+	resp, httpResp, err := p.client.Messages.Create(ctx, &anthropic.CreateMessageInput{
 		Model:       anthropic.LanguageModel(p.model),
 		MaxTokens:   500,
-		System:      GetSystemPrompt(),
+		System:      systemPrompt,
 		Messages:    messages,
-		Temperature: &[]float64{0.7}[0],
+		Temperature: &[]float64{temperatureFor(p.temperatures, PromptChat)}[0],
 	})
 
-	if err != nil {
-		return "", fmt.Errorf("Claude API error: %v", err)
+	if err := claudeResponseError(httpResp, err); err != nil {
+		return "", fmt.Errorf("Claude API error: %w", err)
 	}
 
 	if len(resp.Content) == 0 {
@@ -515,45 +868,27 @@ func (p *ClaudeProvider) GenerateResponseWithContext(ctx context.Context, prompt
 // GenerateResponseWithContextAndProject generates a response using Anthropic Claude with conversation history and current project context
 func (p *ClaudeProvider) GenerateResponseWithContextAndProject(ctx context.Context, prompt string, history []*Message, currentProject *Project) (string, error) {
 	// Build enhanced system prompt with current project info
-	systemPrompt := GetSystemPrompt()
+	systemPrompt := systemPromptFor(ctx)
 	if currentProject != nil {
-		projectInfo := fmt.Sprintf("\n\nТЕКУЩИЙ ПРОЕКТ ПОЛЬЗОВАТЕЛЯ:\n- ID: %d\n- Название: %s\n- Описание: %s\n- Статус: %s\n- Роль пользователя: %s\n\nПри создании задач используй этот проект по умолчанию, если пользователь не указал другой проект явно.",
-			currentProject.ID, currentProject.Title, currentProject.Description, currentProject.Status, currentProject.UserRole)
-		systemPrompt += projectInfo
+		systemPrompt += buildProjectContext(currentProject)
 	}
 
-	// Build message history
-	messages := []anthropic.Message{}
+	// Build message history, system messages go to the system prompt
+	systemPrompt, messages := buildClaudeHistory(systemPrompt, history)
 
-	// Add conversation history
-	for _, msg := range history {
-		role := "user"
-		if msg.Role == "assistant" {
-			role = "assistant"
-		}
-
-		messages = append(messages, anthropic.Message{
-			Role:    role,
-			Content: msg.Content,
-		})
-	}
+	// Add current user message, keeping turns alternating
+	messages = addClaudePrompt(messages, prompt)
 
-	// Add current user message
-	messages = append(messages, anthropic.Message{
-		Role:    "user",
-		Content: prompt,
-	})
-
-	resp, _, err := p.client.Messages.Create(ctx, &anthropic.CreateMessageInput{
+	resp, httpResp, err := p.client.Messages.Create(ctx, &anthropic.CreateMessageInput{
 		Model:       anthropic.LanguageModel(p.model),
 		MaxTokens:   500,
 		System:      systemPrompt,
 		Messages:    messages,
-		Temperature: &[]float64{0.7}[0],
+		Temperature: &[]float64{temperatureFor(p.temperatures, PromptChat)}[0],
 	})
 
-	if err != nil {
-		return "", fmt.Errorf("Claude API error: %v", err)
+	if err := claudeResponseError(httpResp, err); err != nil {
+		return "", fmt.Errorf("Claude API error: %w", err)
 	}
 
 	if len(resp.Content) == 0 {
@@ -564,3 +899,129 @@ func (p *ClaudeProvider) GenerateResponseWithContextAndProject(ctx context.Conte
 	log.Printf("Claude Response with context and project generated: %d characters, history: %d messages", len(response), len(history))
 	return response, nil
 }
+
+// javaScriptFunctionName names JavaScript output results replayed as function messages
+const javaScriptFunctionName = "execute_javascript"
+
+// javaScriptOutputMessage is the stored "function" message with the values passed to output(),
+// JSON {"output": [...]} that the history builders replay as the function result
+func javaScriptOutputMessage(output []interface{}) (string, error) {
+	message, err := json.Marshal(map[string]interface{}{"output": output})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode JavaScript output: %v", err)
+	}
+	return string(message), nil
+}
+
+// legacyMessageRoles maps roles found in older stored messages to the current ones
+var legacyMessageRoles = map[string]string{
+	"bot":   "assistant",
+	"ai":    "assistant",
+	"human": "user",
+	"error": "system",
+	"tool":  "function",
+}
+
+// normalizeMessageRole returns the stored role as user, assistant, system or function.
+// Unknown roles are treated as user messages, as they were before roles were checked
+func normalizeMessageRole(role string) string {
+	role = strings.ToLower(strings.TrimSpace(role))
+	switch role {
+	case "user", "assistant", "system", "function":
+		return role
+	}
+	if mapped, ok := legacyMessageRoles[role]; ok {
+		return mapped
+	}
+	log.Printf("⚠️ Unknown message role '%s', treating it as user", role)
+	return "user"
+}
+
+// buildOpenAIHistory converts stored messages to OpenAI chat messages.
+// Internal "system" messages (errors) keep the system role, "function" messages
+// (JavaScript output results as JSON {"output": [...]}) are replayed as function results
+func buildOpenAIHistory(history []*Message) []openai.ChatCompletionMessage {
+	messages := make([]openai.ChatCompletionMessage, 0, len(history))
+	for _, msg := range history {
+		message := openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleUser,
+			Content: msg.Content,
+		}
+		switch normalizeMessageRole(msg.Role) {
+		case "assistant":
+			message.Role = openai.ChatMessageRoleAssistant
+		case "system":
+			message.Role = openai.ChatMessageRoleSystem
+		case "function":
+			message.Role = openai.ChatMessageRoleFunction
+			message.Name = javaScriptFunctionName
+		}
+
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+// buildProjectContext describes the user's current project and what the user may do in it
+func buildProjectContext(project *Project) string {
+	return "\n\nТЕКУЩИЙ ПРОЕКТ ПОЛЬЗОВАТЕЛЯ:\n" + project.ToPromptContext() +
+		"\n\nПри создании задач используй этот проект по умолчанию, если пользователь не указал другой проект явно. Не предлагай и не выполняй запрещённые действия, объясни, что для них нужна другая роль. Если есть просроченные задачи, напомни о них, когда это к месту."
+}
+
+// buildClaudeHistory converts stored messages to Claude messages.
+// Claude accepts only user/assistant turns, so internal "system" messages
+// are folded into the system prompt instead of being sent as user turns
+func buildClaudeHistory(systemPrompt string, history []*Message) (string, []anthropic.Message) {
+	messages := []anthropic.Message{}
+	var systemNotes []string
+
+	for _, msg := range history {
+		switch normalizeMessageRole(msg.Role) {
+		case "system":
+			systemNotes = append(systemNotes, "- "+msg.Content)
+			continue
+		case "assistant":
+			messages = appendClaudeMessage(messages, "assistant", msg.Content)
+		case "function":
+			// Claude expects tool results in user turns, mark them so they aren't read as user text.
+			// The content is JSON {"output": [...]} with the values passed to output()
+			messages = appendClaudeMessage(messages, "user", "[Результат "+javaScriptFunctionName+" в JSON]\n"+msg.Content)
+		default:
+			messages = appendClaudeMessage(messages, "user", msg.Content)
+		}
+	}
+
+	if len(systemNotes) > 0 {
+		systemPrompt += "\n\nСЛУЖЕБНЫЕ СООБЩЕНИЯ ИЗ ИСТОРИИ ДИАЛОГА:\n" + strings.Join(systemNotes, "\n")
+	}
+
+	return systemPrompt, messages
+}
+
+// claudeConversationStart opens the turns when the stored history starts with a bot reply,
+// Claude requires the first turn to be the user's
+const claudeConversationStart = "[Начало диалога]"
+
+// addClaudePrompt appends the current user message and makes the turns valid for Claude:
+// strictly alternating and starting with a user turn. The message is usually already the last
+// stored turn (it is saved before the history is loaded), then it isn't repeated
+func addClaudePrompt(messages []anthropic.Message, prompt string) []anthropic.Message {
+	if last := len(messages) - 1; last < 0 || messages[last].Role != "user" || !strings.HasSuffix(messages[last].Content, prompt) {
+		messages = appendClaudeMessage(messages, "user", prompt)
+	}
+
+	if messages[0].Role != "user" {
+		messages = append([]anthropic.Message{{Role: "user", Content: claudeConversationStart}}, messages...)
+	}
+	return messages
+}
+
+// appendClaudeMessage adds a turn, merging it into the previous one if it has the same role.
+// Claude rejects consecutive turns of one role, e.g. several bot replies in a row
+func appendClaudeMessage(messages []anthropic.Message, role, content string) []anthropic.Message {
+	if last := len(messages) - 1; last >= 0 && messages[last].Role == role {
+		messages[last].Content += "\n\n" + content
+		return messages
+	}
+	return append(messages, anthropic.Message{Role: role, Content: content})
+}
@@ -0,0 +1,425 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	anthropic "github.com/unfunco/anthropic-sdk-go"
+)
+
+func TestIsAuthError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"openai unauthorized", &openai.APIError{HTTPStatusCode: 401}, true},
+		{"openai forbidden", &openai.APIError{HTTPStatusCode: 403}, true},
+		{"openai rate limited", &openai.APIError{HTTPStatusCode: 429}, false},
+		{"openai request unauthorized", &openai.RequestError{HTTPStatusCode: 401}, true},
+		{"claude unauthorized", &ClaudeAPIError{StatusCode: 401, Status: "401 Unauthorized"}, true},
+		{"claude wrapped", fmt.Errorf("Claude API error: %w", &ClaudeAPIError{StatusCode: 403}), true},
+		{"claude overloaded", &ClaudeAPIError{StatusCode: 529}, false},
+		{"status code in text only", errors.New("project 401 not found"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isAuthError(tt.err); got != tt.want {
+				t.Errorf("isAuthError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaudeResponseError(t *testing.T) {
+	transportErr := errors.New("connection reset")
+
+	tests := []struct {
+		name       string
+		httpResp   *http.Response
+		err        error
+		wantStatus int // 0 when no ClaudeAPIError is expected
+		wantErr    bool
+	}{
+		{"success", &http.Response{StatusCode: 200, Status: "200 OK"}, nil, 0, false},
+		{"no response", nil, nil, 0, false},
+		{"transport error", nil, transportErr, 0, true},
+		{"unauthorized", &http.Response{StatusCode: 401, Status: "401 Unauthorized"}, nil, 401, true},
+		{"server error", &http.Response{StatusCode: 500, Status: "500 Internal Server Error"}, nil, 500, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := claudeResponseError(tt.httpResp, tt.err)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("claudeResponseError() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var claudeErr *ClaudeAPIError
+			if errors.As(err, &claudeErr) {
+				if claudeErr.StatusCode != tt.wantStatus {
+					t.Errorf("StatusCode = %d, want %d", claudeErr.StatusCode, tt.wantStatus)
+				}
+			} else if tt.wantStatus != 0 {
+				t.Errorf("claudeResponseError() = %v, want ClaudeAPIError %d", err, tt.wantStatus)
+			}
+		})
+	}
+}
+
+// slowProvider answers after delay unless the call's context ends first
+type slowProvider struct {
+	delay time.Duration
+}
+
+func (p *slowProvider) answer(ctx context.Context) (string, error) {
+	select {
+	case <-time.After(p.delay):
+		return "message('готово')", nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (p *slowProvider) GenerateResponse(ctx context.Context, prompt string) (string, error) {
+	return p.answer(ctx)
+}
+
+func (p *slowProvider) GenerateResponseWithContext(ctx context.Context, prompt string, history []*Message) (string, error) {
+	return p.answer(ctx)
+}
+
+func (p *slowProvider) GenerateWelcomeMessage(ctx context.Context, userName, status, timestamp string) (string, error) {
+	return p.answer(ctx)
+}
+
+func (p *slowProvider) GenerateErrorMessage(ctx context.Context, errorContext string) (string, error) {
+	return p.answer(ctx)
+}
+
+func (p *slowProvider) GenerateFormattedText(ctx context.Context, prompt string) (string, error) {
+	return p.answer(ctx)
+}
+
+func (p *slowProvider) TranscribeAudio(ctx context.Context, audioData io.Reader, filename string) (string, error) {
+	return p.answer(ctx)
+}
+
+func (p *slowProvider) GenerateResponseWithContextAndProject(ctx context.Context, prompt string, history []*Message, currentProject *Project) (string, error) {
+	return p.answer(ctx)
+}
+
+func (p *slowProvider) SelfTest(ctx context.Context) error {
+	_, err := p.answer(ctx)
+	return err
+}
+
+// providerCall is what a scriptedProvider received in one conversation call
+type providerCall struct {
+	prompt         string
+	history        []*Message
+	currentProject *Project
+}
+
+// scriptedProvider answers conversation calls with responses in order and records what it received.
+// The other calls are answered by the embedded slowProvider
+type scriptedProvider struct {
+	slowProvider
+	responses []string
+	calls     []providerCall
+}
+
+func (p *scriptedProvider) next(call providerCall) (string, error) {
+	p.calls = append(p.calls, call)
+	if len(p.calls) > len(p.responses) {
+		return "", fmt.Errorf("unexpected call %d", len(p.calls))
+	}
+	return p.responses[len(p.calls)-1], nil
+}
+
+func (p *scriptedProvider) GenerateResponseWithContext(ctx context.Context, prompt string, history []*Message) (string, error) {
+	return p.next(providerCall{prompt: prompt, history: history})
+}
+
+func (p *scriptedProvider) GenerateResponseWithContextAndProject(ctx context.Context, prompt string, history []*Message, currentProject *Project) (string, error) {
+	return p.next(providerCall{prompt: prompt, history: history, currentProject: currentProject})
+}
+
+func TestProviderTimeout(t *testing.T) {
+	tests := []struct {
+		name            string
+		delay           time.Duration
+		providerTimeout time.Duration
+		handlerTimeout  time.Duration
+		wantTimeout     bool
+		wantErr         bool
+	}{
+		{"fast provider", time.Millisecond, 50 * time.Millisecond, time.Second, false, false},
+		{"slow provider", time.Second, 20 * time.Millisecond, time.Second, true, true},
+		{"no provider limit", 20 * time.Millisecond, 0, time.Second, false, false},
+		// The caller ran out of time, not the provider, there is no time left to tell the user anything
+		{"handler deadline first", time.Second, 500 * time.Millisecond, 20 * time.Millisecond, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewAIService(&slowProvider{delay: tt.delay}, true)
+			service.SetProviderTimeout(tt.providerTimeout)
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.handlerTimeout)
+			defer cancel()
+
+			start := time.Now()
+			_, err := service.GenerateResponseWithContextAndProject(ctx, "задачи", nil, nil, "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GenerateResponseWithContextAndProject() error = %v, want error %v", err, tt.wantErr)
+			}
+			if got := errors.Is(err, ErrAITimeout); got != tt.wantTimeout {
+				t.Errorf("error is ErrAITimeout = %v, want %v (error %v)", got, tt.wantTimeout, err)
+			}
+			if elapsed := time.Since(start); elapsed > tt.delay/2 && tt.wantErr {
+				t.Errorf("call took %v, the slow provider was not cut off", elapsed)
+			}
+		})
+	}
+}
+
+func TestProviderTimeoutFallback(t *testing.T) {
+	service := NewAIService(&slowProvider{delay: time.Second}, true)
+	service.SetProviderTimeout(20 * time.Millisecond)
+
+	if got := service.GenerateFormattedText(context.Background(), "итоги", "запасной ответ"); got != "запасной ответ" {
+		t.Errorf("GenerateFormattedText() = %q, want the fallback", got)
+	}
+}
+
+func TestClampAITimeoutSeconds(t *testing.T) {
+	tests := []struct {
+		seconds int
+		want    int
+	}{
+		{-5, 0},
+		{0, 0},
+		{10, 10},
+		{15, 15},
+		{25, 15},
+	}
+
+	for _, tt := range tests {
+		if got := clampAITimeoutSeconds(tt.seconds); got != tt.want {
+			t.Errorf("clampAITimeoutSeconds(%d) = %d, want %d", tt.seconds, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeMessageRole(t *testing.T) {
+	tests := []struct {
+		role string
+		want string
+	}{
+		{"user", "user"},
+		{"assistant", "assistant"},
+		{"system", "system"},
+		{"function", "function"},
+		{" Assistant ", "assistant"},
+		{"bot", "assistant"},
+		{"AI", "assistant"},
+		{"human", "user"},
+		{"error", "system"},
+		{"tool", "function"},
+		{"moderator", "user"},
+		{"", "user"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.role, func(t *testing.T) {
+			if got := normalizeMessageRole(tt.role); got != tt.want {
+				t.Errorf("normalizeMessageRole(%q) = %q, want %q", tt.role, got, tt.want)
+			}
+		})
+	}
+}
+
+// claudeTurns formats turns as "role: content" for comparison
+func claudeTurns(messages []anthropic.Message) []string {
+	turns := []string{}
+	for _, message := range messages {
+		turns = append(turns, message.Role+": "+message.Content)
+	}
+	return turns
+}
+
+func TestBuildOpenAIHistory(t *testing.T) {
+	tests := []struct {
+		role     string
+		wantRole string
+		wantName string
+	}{
+		{"user", openai.ChatMessageRoleUser, ""},
+		{"assistant", openai.ChatMessageRoleAssistant, ""},
+		{"system", openai.ChatMessageRoleSystem, ""},
+		{"function", openai.ChatMessageRoleFunction, javaScriptFunctionName},
+		{"error", openai.ChatMessageRoleSystem, ""},
+		{"tool", openai.ChatMessageRoleFunction, javaScriptFunctionName},
+		{"bot", openai.ChatMessageRoleAssistant, ""},
+		{"unknown", openai.ChatMessageRoleUser, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.role, func(t *testing.T) {
+			messages := buildOpenAIHistory([]*Message{{Role: tt.role, Content: "содержимое"}})
+			if len(messages) != 1 {
+				t.Fatalf("buildOpenAIHistory() returned %d messages, want 1", len(messages))
+			}
+			got := messages[0]
+			if got.Role != tt.wantRole || got.Name != tt.wantName || got.Content != "содержимое" {
+				t.Errorf("stored %q sent as role %q name %q content %q, want role %q name %q",
+					tt.role, got.Role, got.Name, got.Content, tt.wantRole, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestAppendClaudeMessage(t *testing.T) {
+	tests := []struct {
+		name  string
+		turns [][2]string
+		want  []string
+	}{
+		{"first turn", [][2]string{{"user", "привет"}}, []string{"user: привет"}},
+		{"alternating", [][2]string{{"user", "привет"}, {"assistant", "здравствуйте"}, {"user", "задачи"}},
+			[]string{"user: привет", "assistant: здравствуйте", "user: задачи"}},
+		{"several bot replies", [][2]string{{"user", "задачи"}, {"assistant", "ищу"}, {"assistant", "нашёл 3"}},
+			[]string{"user: задачи", "assistant: ищу\n\nнашёл 3"}},
+		{"several user messages", [][2]string{{"user", "привет"}, {"user", "ты тут?"}, {"user", "?"}},
+			[]string{"user: привет\n\nты тут?\n\n?"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages := []anthropic.Message{}
+			for _, turn := range tt.turns {
+				messages = appendClaudeMessage(messages, turn[0], turn[1])
+			}
+			if got := claudeTurns(messages); fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tt.want) {
+				t.Errorf("turns = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddClaudePrompt(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []anthropic.Message
+		prompt   string
+		want     []string
+	}{
+		{"empty history", nil, "привет", []string{"user: привет"}},
+		{"prompt already stored", []anthropic.Message{{Role: "user", Content: "привет"}}, "привет",
+			[]string{"user: привет"}},
+		{"prompt stored after other user text", []anthropic.Message{{Role: "user", Content: "первое\n\nпривет"}}, "привет",
+			[]string{"user: первое\n\nпривет"}},
+		{"after a bot reply", []anthropic.Message{{Role: "user", Content: "привет"}, {Role: "assistant", Content: "здравствуйте"}}, "задачи",
+			[]string{"user: привет", "assistant: здравствуйте", "user: задачи"}},
+		{"history starts with a bot reply", []anthropic.Message{{Role: "assistant", Content: "напоминание"}}, "ок",
+			[]string{"user: " + claudeConversationStart, "assistant: напоминание", "user: ок"}},
+		{"last user turn is other text", []anthropic.Message{{Role: "user", Content: "привет"}}, "задачи",
+			[]string{"user: привет\n\nзадачи"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := claudeTurns(addClaudePrompt(tt.messages, tt.prompt))
+			if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tt.want) {
+				t.Errorf("addClaudePrompt() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildClaudeHistoryAlternates(t *testing.T) {
+	history := []*Message{
+		{Role: "bot", Content: "⏰ Дедлайн завтра"},
+		{Role: "assistant", Content: "Не забудьте про задачу"},
+		{Role: "error", Content: "AI недоступен"},
+		{Role: "user", Content: "покажи задачи"},
+		{Role: "human", Content: "текущего проекта"},
+		{Role: "assistant", Content: "Ищу задачи"},
+		{Role: "tool", Content: `{"output":[1]}`},
+		{Role: "user", Content: "спасибо"},
+	}
+
+	system, messages := buildClaudeHistory("base", history)
+	messages = addClaudePrompt(messages, "спасибо")
+
+	if !strings.Contains(system, "- AI недоступен") {
+		t.Errorf("system prompt %q has no system note from the history", system)
+	}
+	if messages[0].Role != "user" {
+		t.Errorf("first turn role = %q, want user", messages[0].Role)
+	}
+	for i := 1; i < len(messages); i++ {
+		if messages[i].Role == messages[i-1].Role {
+			t.Errorf("turns %d and %d are both %s: %q", i-1, i, messages[i].Role, claudeTurns(messages))
+		}
+	}
+	if last := messages[len(messages)-1]; last.Role != "user" || !strings.HasSuffix(last.Content, "спасибо") {
+		t.Errorf("last turn = %s: %q, want the user's message", last.Role, last.Content)
+	}
+}
+
+func TestJavaScriptOutputReplay(t *testing.T) {
+	output := []interface{}{"PAGE:<title>Пример</title>", map[string]interface{}{"tasks": float64(3)}}
+	content, err := javaScriptOutputMessage(output)
+	if err != nil {
+		t.Fatalf("javaScriptOutputMessage() error = %v", err)
+	}
+	history := []*Message{
+		{Role: "user", Content: "сколько задач?"},
+		{Role: "assistant", Content: `output(teamwork.listTasks().length);`},
+		{Role: "function", Content: content},
+	}
+
+	t.Run("openai", func(t *testing.T) {
+		messages := buildOpenAIHistory(history)
+		if len(messages) != 3 {
+			t.Fatalf("got %d messages, want 3", len(messages))
+		}
+		result := messages[2]
+		if result.Role != openai.ChatMessageRoleFunction || result.Name != javaScriptFunctionName {
+			t.Errorf("result turn = %s %q, want %s %q", result.Role, result.Name, openai.ChatMessageRoleFunction, javaScriptFunctionName)
+		}
+
+		var decoded struct {
+			Output []interface{} `json:"output"`
+		}
+		if err := json.Unmarshal([]byte(result.Content), &decoded); err != nil {
+			t.Fatalf("result content %q is not JSON: %v", result.Content, err)
+		}
+		if !reflect.DeepEqual(decoded.Output, output) {
+			t.Errorf("replayed output = %v, want %v", decoded.Output, output)
+		}
+	})
+
+	t.Run("claude", func(t *testing.T) {
+		_, messages := buildClaudeHistory("base", history)
+		if len(messages) != 3 {
+			t.Fatalf("got %d turns, want 3: %q", len(messages), claudeTurns(messages))
+		}
+		result := messages[2]
+		want := "[Результат " + javaScriptFunctionName + " в JSON]\n" + content
+		if result.Role != "user" || result.Content != want {
+			t.Errorf("result turn = %s: %q, want user: %q", result.Role, result.Content, want)
+		}
+	})
+}
@@ -0,0 +1,315 @@
+package internal
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// AttachmentType is the kind of Telegram file attached to a task
+type AttachmentType string
+
+const (
+	AttachmentPhoto    AttachmentType = "photo"
+	AttachmentDocument AttachmentType = "document"
+)
+
+// TaskAttachment references a Telegram file attached to a task. Only the file_id is stored,
+// Telegram hosts the file
+type TaskAttachment struct {
+	ID        int            `json:"id"`
+	TaskID    int            `json:"task_id"`
+	UserID    int            `json:"user_id"`
+	FileID    string         `json:"-"`
+	FileName  string         `json:"file_name,omitempty"`
+	Type      AttachmentType `json:"type"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// AddTaskAttachment attaches a Telegram file to a task, the user must be allowed to edit tasks in its project
+func (db *DB) AddTaskAttachment(taskID, userID int, fileID, fileName string, fileType AttachmentType) (*TaskAttachment, error) {
+	task, err := db.GetTaskByID(taskID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if task == nil {
+		return nil, fmt.Errorf("task not found or no access")
+	}
+
+	role, err := db.GetUserRoleInProject(task.ProjectID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check permissions: %v", err)
+	}
+	if !CapabilitiesForRole(role).CanEditTasks {
+		return nil, fmt.Errorf("insufficient permissions: viewers cannot attach files")
+	}
+
+	result, err := db.Exec(
+		"INSERT INTO task_attachments (task_id, user_id, file_id, file_name, file_type) VALUES (?, ?, ?, ?, ?)",
+		taskID, userID, fileID, fileName, fileType,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add task attachment: %v", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attachment ID: %v", err)
+	}
+
+	return &TaskAttachment{
+		ID:        int(id),
+		TaskID:    taskID,
+		UserID:    userID,
+		FileID:    fileID,
+		FileName:  fileName,
+		Type:      fileType,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// GetTaskAttachments returns the files attached to a task, oldest first.
+// Returns nil if the task doesn't exist or the user is not a member of its project
+func (db *DB) GetTaskAttachments(taskID, userID int) ([]*TaskAttachment, error) {
+	task, err := db.GetTaskByID(taskID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if task == nil {
+		return nil, nil
+	}
+
+	query := `
+		SELECT id, task_id, user_id, file_id, file_name, file_type, created_at
+		FROM task_attachments
+		WHERE task_id = ?
+		ORDER BY created_at ASC, id ASC
+	`
+
+	rows, err := db.Query(query, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get task attachments: %v", err)
+	}
+	defer rows.Close()
+
+	var attachments []*TaskAttachment
+	for rows.Next() {
+		attachment := &TaskAttachment{}
+		err := rows.Scan(
+			&attachment.ID, &attachment.TaskID, &attachment.UserID, &attachment.FileID,
+			&attachment.FileName, &attachment.Type, &attachment.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan task attachment: %v", err)
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	return attachments, nil
+}
+
+// attachPrefix is the callback data prefix for attachment buttons
+const attachPrefix = "attach_"
+
+// Callback data of attachment buttons
+const (
+	attachTaskPrefix = attachPrefix + "task_" // attach the pending file to a task
+	attachListPrefix = attachPrefix + "list_" // send all files of a task
+	attachCancel     = attachPrefix + "cancel"
+)
+
+// maxAttachTaskButtons is the number of tasks offered when a file is sent
+const maxAttachTaskButtons = 6
+
+// pendingAttachment is a file sent by the user waiting for a task to be chosen
+type pendingAttachment struct {
+	FileID   string
+	FileName string
+	Type     AttachmentType
+}
+
+// pendingAttachments keeps the last file sent by each user, a newer file replaces it
+var (
+	pendingAttachmentsMu sync.Mutex
+	pendingAttachments   = make(map[int]*pendingAttachment)
+)
+
+// handleFileMessage offers to attach a photo or document to an open task of the current project
+func handleFileMessage(bot *tgbotapi.BotAPI, db *DB, update tgbotapi.Update, user *User) {
+	chatID := update.Message.Chat.ID
+
+	file := &pendingAttachment{}
+	if update.Message.Document != nil {
+		file.FileID = update.Message.Document.FileID
+		file.FileName = update.Message.Document.FileName
+		file.Type = AttachmentDocument
+	} else {
+		// Telegram sends several sizes, the last one is the largest
+		photo := update.Message.Photo[len(update.Message.Photo)-1]
+		file.FileID = photo.FileID
+		file.Type = AttachmentPhoto
+	}
+
+	project, err := db.GetCurrentProject(user.ID, chatID)
+	if err != nil {
+		log.Printf("❌ Error getting current project for user %d: %v", user.ID, err)
+		SendReply(bot, chatID, "❌ Не удалось получить текущий проект")
+		return
+	}
+	if project == nil {
+		SendReply(bot, chatID, "📎 Чтобы прикрепить файл к задаче, сначала выберите текущий проект")
+		return
+	}
+
+	tasks, err := db.GetProjectTasksOrdered(project.ID, user.ID, TaskOrderBoard)
+	if err != nil {
+		log.Printf("❌ Error getting tasks of project %d: %v", project.ID, err)
+		SendReply(bot, chatID, "❌ Не удалось получить задачи проекта")
+		return
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, task := range tasks {
+		if task.Status.IsTerminal() {
+			continue
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("#%d %s", task.ID, task.Title), attachTaskPrefix+strconv.Itoa(task.ID)),
+		))
+		if len(rows) == maxAttachTaskButtons {
+			break
+		}
+	}
+	if len(rows) == 0 {
+		SendReply(bot, chatID, fmt.Sprintf("📎 В проекте «%s» нет открытых задач, к которым можно прикрепить файл", html.EscapeString(project.Title)))
+		return
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("❌ Не прикреплять", attachCancel),
+	))
+
+	pendingAttachmentsMu.Lock()
+	pendingAttachments[user.ID] = file
+	pendingAttachmentsMu.Unlock()
+
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("📎 Прикрепить файл к задаче проекта «%s»?", html.EscapeString(project.Title)))
+	msg.ParseMode = tgbotapi.ModeHTML // Enable HTML formatting
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	if _, err := bot.Send(msg); err != nil {
+		log.Printf("Failed to send attachment prompt: %v", err)
+	}
+}
+
+// HandleAttachmentCallback handles attachment buttons: choosing a task, cancelling and listing files
+func HandleAttachmentCallback(bot *tgbotapi.BotAPI, db *DB, query *tgbotapi.CallbackQuery) {
+	data := query.Data
+	chatID := query.Message.Chat.ID
+
+	user, err := getCallbackUser(db, query)
+	if err != nil {
+		log.Printf("Error getting user by TG ID %d: %v", query.From.ID, err)
+		bot.Send(tgbotapi.NewCallback(query.ID, "Ошибка при получении пользователя"))
+		return
+	}
+
+	switch {
+	case data == attachCancel:
+		pendingAttachmentsMu.Lock()
+		delete(pendingAttachments, user.ID)
+		pendingAttachmentsMu.Unlock()
+
+		editMsg := tgbotapi.NewEditMessageText(chatID, query.Message.MessageID, "📎 Файл не прикреплён")
+		bot.Send(editMsg)
+		bot.Send(tgbotapi.NewCallback(query.ID, ""))
+
+	case strings.HasPrefix(data, attachTaskPrefix):
+		taskID, err := strconv.Atoi(strings.TrimPrefix(data, attachTaskPrefix))
+		if err != nil {
+			bot.Send(tgbotapi.NewCallback(query.ID, "Неизвестная задача"))
+			return
+		}
+
+		pendingAttachmentsMu.Lock()
+		file := pendingAttachments[user.ID]
+		delete(pendingAttachments, user.ID)
+		pendingAttachmentsMu.Unlock()
+		if file == nil {
+			bot.Send(tgbotapi.NewCallback(query.ID, "Файл не найден, отправьте его ещё раз"))
+			return
+		}
+
+		attachment, err := db.AddTaskAttachment(taskID, user.ID, file.FileID, file.FileName, file.Type)
+		if err != nil {
+			log.Printf("❌ Error attaching file to task %d for user %d: %v", taskID, user.ID, err)
+			bot.Send(tgbotapi.NewCallback(query.ID, "Ошибка при прикреплении файла"))
+			return
+		}
+		log.Printf("📎 User %d attached %s to task %d", user.ID, attachment.Type, taskID)
+
+		editMsg := tgbotapi.NewEditMessageTextAndMarkup(chatID, query.Message.MessageID,
+			fmt.Sprintf("📎 Файл прикреплён к задаче #%d", taskID),
+			tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("📂 Все файлы задачи", attachListPrefix+strconv.Itoa(taskID)),
+			)))
+		bot.Send(editMsg)
+		bot.Send(tgbotapi.NewCallback(query.ID, "Прикреплено"))
+
+	case strings.HasPrefix(data, attachListPrefix):
+		taskID, err := strconv.Atoi(strings.TrimPrefix(data, attachListPrefix))
+		if err != nil {
+			bot.Send(tgbotapi.NewCallback(query.ID, "Неизвестная задача"))
+			return
+		}
+		bot.Send(tgbotapi.NewCallback(query.ID, ""))
+		SendTaskAttachments(bot, db, chatID, user.ID, taskID)
+
+	default:
+		log.Printf("Unknown attachment callback: %s", data)
+		bot.Send(tgbotapi.NewCallback(query.ID, "Неизвестное действие"))
+	}
+}
+
+// SendTaskAttachments sends the files attached to a task. Telegram may no longer serve
+// an old file_id, such files are reported so the user can attach them again
+func SendTaskAttachments(bot *tgbotapi.BotAPI, db *DB, chatID int64, userID, taskID int) {
+	attachments, err := db.GetTaskAttachments(taskID, userID)
+	if err != nil {
+		log.Printf("❌ Error getting attachments of task %d: %v", taskID, err)
+		SendReply(bot, chatID, "❌ Не удалось получить файлы задачи")
+		return
+	}
+	if len(attachments) == 0 {
+		SendReply(bot, chatID, fmt.Sprintf("📂 У задачи #%d нет прикреплённых файлов", taskID))
+		return
+	}
+
+	var unavailable []string
+	for _, attachment := range attachments {
+		var msg tgbotapi.Chattable
+		if attachment.Type == AttachmentPhoto {
+			msg = tgbotapi.NewPhoto(chatID, tgbotapi.FileID(attachment.FileID))
+		} else {
+			msg = tgbotapi.NewDocument(chatID, tgbotapi.FileID(attachment.FileID))
+		}
+
+		if _, err := bot.Send(msg); err != nil {
+			log.Printf("⚠️ Attachment %d of task %d is unavailable: %v", attachment.ID, taskID, err)
+			name := attachment.FileName
+			if name == "" {
+				name = fmt.Sprintf("файл #%d", attachment.ID)
+			}
+			unavailable = append(unavailable, html.EscapeString(name))
+		}
+	}
+
+	if len(unavailable) > 0 {
+		SendReply(bot, chatID, fmt.Sprintf("⚠️ Telegram больше не хранит: %s. Прикрепите их к задаче #%d заново",
+			strings.Join(unavailable, ", "), taskID))
+	}
+}
@@ -0,0 +1,164 @@
+package internal
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// The current project is kept per (user, chat) in user_chat_state, so a group chat and the
+// private chat with the bot can work on different projects. Chat ID 0 stands for the private
+// chat, whose ID is the user's Telegram ID: callers without a chat, like the fallback commands,
+// keep working on the project the user picked in private
+
+// stateChatID returns the chat the state of chatID is stored under, the private chat for 0
+func (db *DB) stateChatID(userID int, chatID int64) (int64, error) {
+	if chatID != 0 {
+		return chatID, nil
+	}
+
+	var tgID int64
+	err := db.QueryRow("SELECT tg_id FROM users WHERE id = ?", userID).Scan(&tgID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get private chat of user %d: %v", userID, err)
+	}
+	return tgID, nil
+}
+
+// currentProjectID returns the ID of the current project stored for the user in the chat,
+// 0 when none is set. The project is not checked, it may be deleted or left since
+func (db *DB) currentProjectID(userID int, chatID int64) (int, error) {
+	var projectID sql.NullInt64
+	err := db.QueryRow(
+		"SELECT current_project_id FROM user_chat_state WHERE user_id = ? AND chat_id = ?",
+		userID, chatID,
+	).Scan(&projectID)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("failed to get current project: %v", err)
+	}
+	return int(projectID.Int64), nil
+}
+
+// GetCurrentProject gets the user's current project in the chat with details,
+// nil when none is set or it can no longer be resolved
+func (db *DB) GetCurrentProject(userID int, chatID int64) (*Project, error) {
+	chatID, err := db.stateChatID(userID, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT ` + projectColumns + `
+		FROM user_chat_state s
+		JOIN projects p ON s.current_project_id = p.id
+		JOIN project_users pu ON p.id = pu.project_id AND pu.user_id = s.user_id
+		WHERE s.user_id = ? AND s.chat_id = ? AND p.deleted_at IS NULL
+	`
+
+	project, err := scanProject(db.QueryRow(query, userID, chatID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current project: %v", err)
+	}
+
+	return project, nil
+}
+
+// SetCurrentProject makes the project current for the user in the chat
+func (db *DB) SetCurrentProject(userID int, chatID int64, projectID int) error {
+	chatID, err := db.stateChatID(userID, chatID)
+	if err != nil {
+		return err
+	}
+
+	// Nothing to do if the project is already current, the AI often re-selects it
+	currentID, err := db.currentProjectID(userID, chatID)
+	if err != nil {
+		return err
+	}
+	if currentID == projectID {
+		db.touchRecentProject(projectID, userID)
+		return nil
+	}
+
+	// Access is checked by the upsert itself, so membership can't change between check and update
+	result, err := db.Exec(`
+		INSERT INTO user_chat_state (user_id, chat_id, current_project_id)
+		SELECT ?, ?, ? FROM DUAL
+		WHERE EXISTS (
+			SELECT 1 FROM project_users pu
+			JOIN projects p ON p.id = pu.project_id
+			WHERE pu.project_id = ? AND pu.user_id = ? AND p.deleted_at IS NULL
+		)
+		ON DUPLICATE KEY UPDATE current_project_id = VALUES(current_project_id)
+	`, userID, chatID, projectID, projectID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to set current project: %v", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to set current project: %v", err)
+	}
+	if affected > 0 {
+		db.touchRecentProject(projectID, userID)
+		return nil
+	}
+
+	// Unchanged rows aren't counted, a concurrent switch to the same project is not an error
+	currentID, err = db.currentProjectID(userID, chatID)
+	if err != nil {
+		return err
+	}
+	if currentID == projectID {
+		db.touchRecentProject(projectID, userID)
+		return nil
+	}
+	return fmt.Errorf("user does not have access to this project")
+}
+
+// ClearCurrentProject clears the user's current project in the chat
+func (db *DB) ClearCurrentProject(userID int, chatID int64) error {
+	chatID, err := db.stateChatID(userID, chatID)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(
+		"UPDATE user_chat_state SET current_project_id = NULL WHERE user_id = ? AND chat_id = ?",
+		userID, chatID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to clear current project: %v", err)
+	}
+	return nil
+}
+
+// LoadCurrentProject gets the user's current project in the chat like GetCurrentProject and clears
+// a stored project that can no longer be resolved (deleted or the user is no longer a member).
+// Returns true if the project was cleared. Message handling calls it once and passes the project on
+func (db *DB) LoadCurrentProject(userID int, chatID int64) (*Project, bool, error) {
+	chatID, err := db.stateChatID(userID, chatID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	project, err := db.GetCurrentProject(userID, chatID)
+	if err != nil || project != nil {
+		return project, false, err
+	}
+
+	// Nothing resolved, a stored ID is stale
+	currentID, err := db.currentProjectID(userID, chatID)
+	if err != nil || currentID == 0 {
+		return nil, false, err
+	}
+
+	if err := db.ClearCurrentProject(userID, chatID); err != nil {
+		return nil, false, err
+	}
+	log.Printf("🧹 Cleared stale current project %d for user %d in chat %d", currentID, userID, chatID)
+
+	return nil, true, nil
+}
@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestCurrentProjectPerChat(t *testing.T) {
+	db := openTestDB(t)
+	user := createTestUser(t, db, "member")
+	groupChatID := -user.TgID // Group chat IDs are negative
+
+	// Each project becomes current in the chat it is created from
+	private, err := db.CreateProject(user.ID, 0, "Личный проект", "")
+	if err != nil {
+		t.Fatalf("CreateProject() in private error = %v", err)
+	}
+	group, err := db.CreateProject(user.ID, groupChatID, "Проект группы", "")
+	if err != nil {
+		t.Fatalf("CreateProject() in group error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		chatID int64
+		want   int
+	}{
+		{"private chat by 0", 0, private.ID},
+		{"private chat by its ID", user.TgID, private.ID},
+		{"group chat", groupChatID, group.ID},
+	}
+
+	check := func() {
+		t.Helper()
+		for _, tt := range tests {
+			current, err := db.GetCurrentProject(user.ID, tt.chatID)
+			if err != nil {
+				t.Fatalf("%s: GetCurrentProject() error = %v", tt.name, err)
+			}
+			if current == nil || current.ID != tt.want {
+				t.Errorf("%s: current project = %v, want #%d", tt.name, current, tt.want)
+			}
+		}
+	}
+	check()
+
+	// Switching the group's project leaves the private chat alone
+	if err := db.SetCurrentProject(user.ID, groupChatID, private.ID); err != nil {
+		t.Fatalf("SetCurrentProject() error = %v", err)
+	}
+	tests[2].want = private.ID
+	check()
+}
+
+func TestSetCurrentProjectConcurrent(t *testing.T) {
+	db := openTestDB(t)
+	user := createTestUser(t, db, "member")
+	other := createTestUser(t, db, "other")
+
+	var own []*Project
+	for _, title := range []string{"Первый", "Второй", "Третий"} {
+		project, err := db.CreateProject(user.ID, 0, title, "")
+		if err != nil {
+			t.Fatalf("CreateProject() error = %v", err)
+		}
+		own = append(own, project)
+	}
+	foreign, err := db.CreateProject(other.ID, 0, "Чужой", "")
+	if err != nil {
+		t.Fatalf("CreateProject() error = %v", err)
+	}
+
+	const switches = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, switches*len(own))
+	foreignAllowed := make(chan bool, switches)
+	for i := 0; i < switches; i++ {
+		for _, project := range own {
+			wg.Add(1)
+			go func(projectID int) {
+				defer wg.Done()
+				if err := db.SetCurrentProject(user.ID, 0, projectID); err != nil {
+					errs <- err
+				}
+			}(project.ID)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			foreignAllowed <- db.SetCurrentProject(user.ID, 0, foreign.ID) == nil
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	close(foreignAllowed)
+
+	for err := range errs {
+		t.Errorf("SetCurrentProject() to an own project error = %v", err)
+	}
+	for allowed := range foreignAllowed {
+		if allowed {
+			t.Errorf("SetCurrentProject() to a project of another user succeeded")
+			break
+		}
+	}
+
+	current, err := db.GetCurrentProject(user.ID, 0)
+	if err != nil {
+		t.Fatalf("GetCurrentProject() error = %v", err)
+	}
+	if current == nil || current.ID == foreign.ID {
+		t.Fatalf("current project = %v, want one of the user's projects", current)
+	}
+}
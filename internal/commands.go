@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// Fallback command patterns used when AI is disabled.
+// Supported phrases (case-insensitive):
+//   - "создай проект <название>" / "создать проект <название>"
+//   - "список проектов" / "мои проекты" / "проекты"
+//   - "добавь задачу <название>" / "создай задачу <название>" (в текущий проект)
+//   - "список задач" / "мои задачи" / "задачи"
+var (
+	fallbackCreateProjectRe = regexp.MustCompile(`(?i)^(?:создай|создать|новый)\s+проект\s+(.+)$`)
+	fallbackListProjectsRe  = regexp.MustCompile(`(?i)^(?:(?:список|мои|покажи)\s+)?проект(?:ы|ов)$`)
+	fallbackCreateTaskRe    = regexp.MustCompile(`(?i)^(?:добавь|добавить|создай|создать|новая)\s+задач[уа]\s+(.+)$`)
+	fallbackListTasksRe     = regexp.MustCompile(`(?i)^(?:(?:список|мои|покажи)\s+)?задач(?:и)?$`)
+)
+
+// fallbackHelpText lists the commands understood without AI
+const fallbackHelpText = `🤖 AI сейчас недоступен, но я понимаю простые команды:
+
+• <b>создай проект [название]</b> - создать проект
+• <b>список проектов</b> - показать ваши проекты
+• <b>добавь задачу [название]</b> - добавить задачу в текущий проект
+• <b>список задач</b> - показать задачи текущего проекта`
+
+// HandleFallbackCommand handles a text message without AI using simple patterns
+// and returns the reply for the user
+func HandleFallbackCommand(db Store, user *User, chatID int64, text string) string {
+	text = strings.TrimSpace(text)
+	log.Printf("🧩 FALLBACK COMMAND from user %d: %s", user.ID, text)
+
+	if match := fallbackCreateProjectRe.FindStringSubmatch(text); match != nil {
+		title := strings.TrimSpace(match[1])
+		project, err := db.CreateProject(user.ID, chatID, title, "")
+		if err != nil {
+			log.Printf("❌ Fallback create project failed: %v", err)
+			return "❌ Не удалось создать проект"
+		}
+		return fmt.Sprintf("✅ Проект <b>%s</b> создан и выбран текущим", html.EscapeString(project.Title))
+	}
+
+	if fallbackListProjectsRe.MatchString(text) {
+		owned, sharedWith, err := db.GetUserProjectsSplit(user.ID)
+		if err != nil {
+			log.Printf("❌ Fallback list projects failed: %v", err)
+			return "❌ Не удалось получить список проектов"
+		}
+		if len(owned) == 0 && len(sharedWith) == 0 {
+			return "📋 У вас пока нет проектов\n\n" + NoProjectsHint
+		}
+
+		var sections []string
+		if len(owned) > 0 {
+			sections = append(sections, "📋 Ваши проекты:\n\n"+fallbackProjectLines(owned))
+		}
+		if len(sharedWith) > 0 {
+			sections = append(sections, "🤝 Проекты, куда вас добавили:\n\n"+fallbackProjectLines(sharedWith))
+		}
+		return strings.Join(sections, "\n\n")
+	}
+
+	if match := fallbackCreateTaskRe.FindStringSubmatch(text); match != nil {
+		project, err := db.GetCurrentProject(user.ID, chatID)
+		if err != nil {
+			log.Printf("❌ Fallback get current project failed: %v", err)
+			return "❌ Не удалось определить текущий проект"
+		}
+		if project == nil {
+			return "📁 Текущий проект не выбран. Сначала создайте проект: создай проект [название]"
+		}
+
+		title := strings.TrimSpace(match[1])
+		if _, err := db.CreateTask(project.ID, user.ID, title, "", PriorityMedium, nil); err != nil {
+			log.Printf("❌ Fallback create task failed: %v", err)
+			return "❌ Не удалось создать задачу"
+		}
+		return fmt.Sprintf("✅ Задача <b>%s</b> добавлена в проект <b>%s</b>", html.EscapeString(title), html.EscapeString(project.Title))
+	}
+
+	if fallbackListTasksRe.MatchString(text) {
+		tasks, err := db.GetCurrentProjectTasks(user.ID, chatID)
+		if err == ErrNoCurrentProject {
+			return "📁 Текущий проект не выбран. Сначала создайте проект: создай проект [название]"
+		}
+		if err != nil {
+			log.Printf("❌ Fallback list tasks failed: %v", err)
+			return "❌ Не удалось получить список задач"
+		}
+		if len(tasks) == 0 {
+			return "📝 В текущем проекте пока нет задач\n\n" + NoTasksHint
+		}
+
+		var lines []string
+		for _, task := range tasks {
+			lines = append(lines, fmt.Sprintf("%s %s #%d %s", TaskStatusEmoji(task.Status), TaskPriorityEmoji(task.Priority), task.ID, html.EscapeString(task.Title)))
+		}
+		return "📝 Задачи текущего проекта:\n\n" + strings.Join(lines, "\n")
+	}
+
+	return fallbackHelpText
+}
+
+// fallbackProjectLines lists projects one per line with their status emoji
+func fallbackProjectLines(projects []*Project) string {
+	var lines []string
+	for _, project := range projects {
+		lines = append(lines, fmt.Sprintf("%s #%d <b>%s</b>", StatusEmoji(project.Status), project.ID, html.EscapeString(project.Title)))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,153 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHandleFallbackCommand(t *testing.T) {
+	const chatID = 7
+	user := &User{ID: 1, TgID: chatID}
+
+	withProject := func(s *fakeStore) {
+		s.projects = []*Project{{ID: 1, Title: "Сайт", Status: StatusActive, UserRole: RoleOwner}}
+		s.current[chatID] = 1
+	}
+
+	tests := []struct {
+		name  string
+		setup func(s *fakeStore)
+		text  string
+		want  []string
+		check func(t *testing.T, s *fakeStore)
+	}{
+		{
+			name: "create project",
+			text: "Создай проект Сайт <b>компании</b>",
+			want: []string{"✅ Проект <b>Сайт &lt;b&gt;компании&lt;/b&gt;</b> создан и выбран текущим"},
+			check: func(t *testing.T, s *fakeStore) {
+				if len(s.projects) != 1 || s.current[chatID] != s.projects[0].ID {
+					t.Errorf("project not created and made current in the chat: %v, current %v", s.projects, s.current)
+				}
+			},
+		},
+		{
+			name:  "create project fails",
+			setup: func(s *fakeStore) { s.failing["CreateProject"] = true },
+			text:  "новый проект Сайт",
+			want:  []string{"❌ Не удалось создать проект"},
+		},
+		{
+			name: "list without projects",
+			text: "мои проекты",
+			want: []string{"📋 У вас пока нет проектов", NoProjectsHint},
+		},
+		{
+			name:  "list projects",
+			setup: withProject,
+			text:  "Проекты",
+			want:  []string{"📋 Ваши проекты:", "🚀 #1 <b>Сайт</b>"},
+			check: func(t *testing.T, s *fakeStore) {
+				if s.calls["GetUserProjectsSplit"] != 1 {
+					t.Errorf("GetUserProjectsSplit called %d times, want 1", s.calls["GetUserProjectsSplit"])
+				}
+			},
+		},
+		{
+			name: "list owned and shared projects",
+			setup: func(s *fakeStore) {
+				s.projects = []*Project{
+					{ID: 1, Title: "Сайт", Status: StatusActive, UserRole: RoleOwner},
+					{ID: 2, Title: "Чужой", Status: StatusPlanning, UserRole: RoleMember},
+				}
+			},
+			text: "список проектов",
+			want: []string{"📋 Ваши проекты:\n\n🚀 #1 <b>Сайт</b>\n\n🤝 Проекты, куда вас добавили:\n\n📝 #2 <b>Чужой</b>"},
+		},
+		{
+			name: "list only shared projects",
+			setup: func(s *fakeStore) {
+				s.projects = []*Project{{ID: 2, Title: "Чужой", Status: StatusActive, UserRole: RoleViewer}}
+			},
+			text: "проекты",
+			want: []string{"🤝 Проекты, куда вас добавили:\n\n🚀 #2 <b>Чужой</b>"},
+		},
+		{
+			name:  "list projects fails",
+			setup: func(s *fakeStore) { s.failing["GetUserProjectsSplit"] = true },
+			text:  "мои проекты",
+			want:  []string{"❌ Не удалось получить список проектов"},
+		},
+		{
+			name: "create task without a current project",
+			text: "добавь задачу Макет",
+			want: []string{"📁 Текущий проект не выбран"},
+			check: func(t *testing.T, s *fakeStore) {
+				if len(s.tasks) != 0 {
+					t.Errorf("task created without a project: %v", s.tasks)
+				}
+			},
+		},
+		{
+			name:  "create task",
+			setup: withProject,
+			text:  "Добавь задачу Макет главной",
+			want:  []string{"✅ Задача <b>Макет главной</b> добавлена в проект <b>Сайт</b>"},
+			check: func(t *testing.T, s *fakeStore) {
+				if len(s.tasks) != 1 || s.tasks[0].ProjectID != 1 || s.tasks[0].Priority != PriorityMedium {
+					t.Errorf("task not created in the current project with medium priority: %+v", s.tasks)
+				}
+			},
+		},
+		{
+			name: "list tasks without a current project",
+			text: "задачи",
+			want: []string{"📁 Текущий проект не выбран"},
+		},
+		{
+			name:  "list no tasks",
+			setup: withProject,
+			text:  "список задач",
+			want:  []string{"📝 В текущем проекте пока нет задач", NoTasksHint},
+		},
+		{
+			name: "list tasks",
+			setup: func(s *fakeStore) {
+				withProject(s)
+				s.tasks = []*Task{{ID: 3, ProjectID: 1, Title: "Макет", Status: TaskInProgress, Priority: PriorityHigh}}
+			},
+			text: "мои задачи",
+			want: []string{"📝 Задачи текущего проекта:", "🚀 🟠 #3 Макет"},
+		},
+		{
+			name:  "list tasks fails",
+			setup: func(s *fakeStore) { withProject(s); s.failing["GetCurrentProjectTasks"] = true },
+			text:  "задачи",
+			want:  []string{"❌ Не удалось получить список задач"},
+		},
+		{
+			name: "unknown text",
+			text: "как дела?",
+			want: []string{fallbackHelpText},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeStore()
+			if tt.setup != nil {
+				tt.setup(store)
+			}
+
+			reply := HandleFallbackCommand(store, user, chatID, "  "+tt.text+" ")
+			for _, want := range tt.want {
+				if !strings.Contains(reply, want) {
+					t.Errorf("HandleFallbackCommand(%q) = %q, want it to contain %q", tt.text, reply, want)
+				}
+			}
+			if tt.check != nil {
+				tt.check(t, store)
+			}
+		})
+	}
+}
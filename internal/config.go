@@ -1,11 +1,18 @@
 package internal
 
+import "time"
+
 // Config represents application configuration
 type Config struct {
 	// Telegram settings
 	TelegramAPIToken string
 	DebugMode        bool
 	UpdateTimeout    int
+	AdminTgIDs       []int64 // Telegram IDs allowed to use admin commands
+
+	TelegramRetryAttempts  int // Attempts of a Telegram API call failing with a network error, 5xx or 429; 1 disables retries
+	TelegramRetryBackoffMs int // Milliseconds before the first retry, doubled for each next one; a 429 waits retry_after instead
+	TelegramTimeoutSeconds int // Seconds one Telegram API call may take, long polling excluded; 0 is no limit
 
 	// Database settings
 	DBHost     string
@@ -14,9 +21,70 @@ type Config struct {
 	DBPassword string
 	DBName     string
 
+	ProjectsCacheSeconds     int // Seconds a user's project list is cached, 0 disables the cache
+	ProjectTasksCacheSeconds int // Seconds a project's task list is cached, 0 disables the cache
+
+	DefaultProjectStatus string // Status of new projects created without one (planning, active, ...)
+
+	DBRetryAttempts  int // Attempts of critical reads/writes of a conversation before giving up, 1 disables retries
+	DBRetryBackoffMs int // Milliseconds before the first retry, doubled for each next one
+
 	// AI settings
-	OpenAIAPIKey    string
-	AnthropicAPIKey string
-	AIProvider      string // "openai" or "anthropic"
-	AIEnabled       bool
+	OpenAIAPIKey          string
+	AnthropicAPIKey       string
+	AIProvider            string // "openai" or "anthropic"
+	TranscriptionProvider string // Provider of audio transcription whatever the chat provider is: "openai" or "none"
+	AIEnabled             bool
+	AISelfTest            bool                   // Verify the API key with a minimal provider call at startup
+	FormattingModel       string                 // Cheaper model for data formatting, welcome and error messages; empty uses the primary model
+	Temperatures          map[PromptType]float64 // Temperature per prompt type (chat, formatting, welcome, error)
+	MaxAudioSeconds       int                    // Maximum voice/audio duration accepted for transcription
+	MaxJSOutputSize       int                    // Maximum total bytes of message()/output() data kept from one script run
+	MaxConcurrentAI       int                    // Maximum provider calls in flight, further requests wait; 0 is unlimited
+	AITimeoutSeconds      int                    // Seconds one chat provider call may take, at most half the 30s of a message; 0 is no limit
+	JSErrorExamples       int                    // Most common JavaScript mistakes shown to the AI as examples; 0 keeps the default examples
+
+	AssistantPersona string // Optional tone of the bot's replies appended to the system prompt, at most 500 characters
+
+	// Conversation settings
+	ContextWindowMessages        int      // Number of recent messages sent to the AI as context, 1 to 50
+	ContextMaxAgeHours           int      // Older messages are not sent to the AI as context; 0 is no age limit
+	MaxUserMessageLength         int      // Longer messages are truncated before they are stored and sent to the AI; 0 is no limit
+	PreviewActions               bool     // Announce and run non-destructive operations without confirmation
+	PendingOperationTTLMinutes   int      // Minutes a pending operation waits for confirmation before it expires
+	ConfirmDeleteMinTasks        int      // A project with at least this many tasks needs confirmation to delete; 0 always confirms
+	ConfirmDeleteMinMembers      int      // A project with at least this many members needs confirmation to delete; 0 always confirms
+	DeletedProjectsRetentionDays int      // Days a deleted project can be restored before it is purged; 0 keeps deleted projects forever
+	MaintenanceIntervalHours     int      // Hours between removals of orphaned rows and old JavaScript errors; 0 disables the job
+	FunctionMinRoles             []string // "function=role" entries: the AI offers and runs a function only for users with at least the role
+	MessageCleanupEvery          int      // Trim a chat's stored messages every N messages instead of after each one
+	StreamEditIntervalMs         int      // Minimum milliseconds between edits of a streamed reply
+	ThinkingPlaceholderMs        int      // Milliseconds without an AI answer before a "thinking" message is shown; 0 disables it
+
+	UnsupportedMessageReply string // Reply to messages without text (stickers, locations, polls, contacts)
+	StickerEmojiReply       bool   // Answer stickers with their emoji instead of UnsupportedMessageReply
+	GroupMentionOnly        bool   // In groups only handle commands, mentions of the bot and replies to it; false handles every message
+
+	// Onboarding settings
+	WelcomeActions            []string // Onboarding buttons offered to users without projects: create_project, examples, import, help
+	WelcomeProjectSuggestions []string // Project names offered as buttons to users without projects
+	ReturningUserCatchUpDays  int      // Days of inactivity after which /start shows a catch-up summary
+
+	// Retrospective settings
+	RetroLookbackDays int // Days covered by the /retro summary
+}
+
+// IsAdmin reports whether the Telegram user may use admin commands
+func (c *Config) IsAdmin(tgID int64) bool {
+	for _, id := range c.AdminTgIDs {
+		if id == tgID {
+			return true
+		}
+	}
+	return false
+}
+
+// ContextMaxAge returns the maximum age of messages sent to the AI, 0 means no limit
+func (c *Config) ContextMaxAge() time.Duration {
+	return time.Duration(c.ContextMaxAgeHours) * time.Hour
 }
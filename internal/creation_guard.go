@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// repeatedCreationWindow is how long creating the same task or project again counts as a repeat:
+// a double tap on a button, a retried request or the AI calling the same create twice.
+// The guard is keyed on the title, not on the operation or the message: the AI proposing the
+// same create twice gives two operations. So within the window a deliberate second project or
+// task with the same title is refused too, the user is told to wait and try again
+const repeatedCreationWindow = 30 * time.Second
+
+// recentCreations holds when each creation key was last claimed
+var recentCreations = struct {
+	sync.Mutex
+	claimed map[string]time.Time
+}{claimed: make(map[string]time.Time)}
+
+// creationKey identifies a creation by user, kind ("task" or "project"), the project a task
+// goes to (0 for projects) and the title, compared case-insensitively
+func creationKey(userID int, kind string, projectID int, title string) string {
+	return fmt.Sprintf("%d:%s:%d:%s", userID, kind, projectID, strings.ToLower(strings.TrimSpace(title)))
+}
+
+// claimCreation reserves a creation before it is made. Returns false if the same creation was
+// claimed within repeatedCreationWindow, the caller must not create it again
+func claimCreation(key string) bool {
+	recentCreations.Lock()
+	defer recentCreations.Unlock()
+
+	now := time.Now()
+	for k, at := range recentCreations.claimed {
+		if now.Sub(at) > repeatedCreationWindow {
+			delete(recentCreations.claimed, k)
+		}
+	}
+
+	if _, exists := recentCreations.claimed[key]; exists {
+		return false
+	}
+	recentCreations.claimed[key] = now
+	return true
+}
+
+// releaseCreation frees the claim of a creation that failed, so trying again is not a repeat
+func releaseCreation(key string) {
+	recentCreations.Lock()
+	defer recentCreations.Unlock()
+	delete(recentCreations.claimed, key)
+}
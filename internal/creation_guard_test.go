@@ -0,0 +1,74 @@
+package internal
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestCreationKey(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		same bool
+	}{
+		{"case and spaces", creationKey(1, "task", 5, "Макет"), creationKey(1, "task", 5, "  макет "), true},
+		{"other user", creationKey(1, "task", 5, "Макет"), creationKey(2, "task", 5, "Макет"), false},
+		{"other project", creationKey(1, "task", 5, "Макет"), creationKey(1, "task", 6, "Макет"), false},
+		{"task and project", creationKey(1, "task", 0, "Макет"), creationKey(1, "project", 0, "Макет"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a == tt.b; got != tt.same {
+				t.Errorf("creationKey() %q == %q is %v, want %v", tt.a, tt.b, got, tt.same)
+			}
+		})
+	}
+}
+
+func TestClaimCreationDoubleClick(t *testing.T) {
+	key := creationKey(-1, "project", 0, "Двойной клик")
+	t.Cleanup(func() { releaseCreation(key) })
+
+	// Both taps arrive before either created the project
+	const taps = 2
+	var wg sync.WaitGroup
+	claimed := make(chan bool, taps)
+	for i := 0; i < taps; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			claimed <- claimCreation(key)
+		}()
+	}
+	wg.Wait()
+	close(claimed)
+
+	wins := 0
+	for ok := range claimed {
+		if ok {
+			wins++
+		}
+	}
+	if wins != 1 {
+		t.Fatalf("%d of %d taps claimed the creation, want 1", wins, taps)
+	}
+
+	if claimCreation(key) {
+		t.Errorf("a later tap within the window claimed the creation again")
+	}
+}
+
+func TestReleaseCreationAllowsRetry(t *testing.T) {
+	key := creationKey(-1, "task", 1, "Не создалась")
+	t.Cleanup(func() { releaseCreation(key) })
+
+	if !claimCreation(key) {
+		t.Fatalf("first claim failed")
+	}
+	// Creation failed, trying again is not a repeat
+	releaseCreation(key)
+	if !claimCreation(key) {
+		t.Errorf("claim after release failed")
+	}
+}
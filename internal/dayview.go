@@ -0,0 +1,153 @@
+package internal
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// dayViewSoonDays is how many days after today count as "due soon" in the day view
+const dayViewSoonDays = 3
+
+// DayView is the user's personal agenda: open tasks with deadlines from all projects,
+// grouped relative to today in the user's timezone
+type DayView struct {
+	Overdue  []*Task `json:"overdue"`   // Deadline before today
+	DueToday []*Task `json:"due_today"` // Deadline today
+	DueSoon  []*Task `json:"due_soon"`  // Deadline within dayViewSoonDays after today
+}
+
+// Total returns the number of tasks in the day view
+func (v *DayView) Total() int {
+	return len(v.Overdue) + len(v.DueToday) + len(v.DueSoon)
+}
+
+// Tasks returns all tasks of the day view, overdue first
+func (v *DayView) Tasks() []*Task {
+	tasks := make([]*Task, 0, v.Total())
+	tasks = append(tasks, v.Overdue...)
+	tasks = append(tasks, v.DueToday...)
+	return append(tasks, v.DueSoon...)
+}
+
+// GetUserDayView returns the user's open tasks that are overdue, due today or due soon, ordered by
+// deadline. Day boundaries are taken in loc, deadlines are stored as wall-clock time like the cutoff
+func (db *DB) GetUserDayView(userID int, loc *time.Location) (*DayView, error) {
+	return db.getUserDayViewAt(userID, time.Now(), loc)
+}
+
+// getUserDayViewAt builds the day view for the given moment, tasks are loaded in one query
+func (db *DB) getUserDayViewAt(userID int, now time.Time, loc *time.Location) (*DayView, error) {
+	endOfToday := deadlineCutoff(now, 0, loc)
+	startOfToday := time.Date(endOfToday.Year(), endOfToday.Month(), endOfToday.Day(), 0, 0, 0, 0, time.UTC)
+
+	query := `
+		SELECT t.id, t.project_id, t.user_id, t.title, t.description,
+		       t.status, t.priority, t.deadline, t.created_at, t.updated_at,
+		       t.completed_at, p.title, ` + taskBlockedColumn + `
+		FROM tasks t
+		JOIN projects p ON t.project_id = p.id
+		JOIN project_users pu ON p.id = pu.project_id
+		WHERE pu.user_id = ? AND t.deadline IS NOT NULL AND p.deleted_at IS NULL
+		      AND t.deadline <= ?
+		      AND t.status NOT IN ('done', 'cancelled')
+		ORDER BY t.deadline ASC, t.id ASC
+	`
+
+	rows, err := db.Query(query, userID, deadlineCutoff(now, dayViewSoonDays, loc))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get day view tasks: %v", err)
+	}
+	defer rows.Close()
+
+	view := &DayView{}
+	for rows.Next() {
+		task := &Task{}
+		var deadline, completedAt sql.NullTime
+
+		err := rows.Scan(
+			&task.ID, &task.ProjectID, &task.UserID, &task.Title, &task.Description,
+			&task.Status, &task.Priority, &deadline, &task.CreatedAt, &task.UpdatedAt,
+			&completedAt, &task.ProjectTitle, &task.Blocked,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan task: %v", err)
+		}
+
+		if completedAt.Valid {
+			task.CompletedAt = &completedAt.Time
+		}
+		task.Deadline = &deadline.Time
+
+		switch {
+		case deadline.Time.Before(startOfToday):
+			view.Overdue = append(view.Overdue, task)
+		case !deadline.Time.After(endOfToday):
+			view.DueToday = append(view.DueToday, task)
+		default:
+			view.DueSoon = append(view.DueSoon, task)
+		}
+	}
+
+	return view, nil
+}
+
+// SendDayView handles the /today command
+func SendDayView(bot *tgbotapi.BotAPI, db *DB, chatID int64, userID int) {
+	prefs, err := db.GetUserPreferences(userID)
+	if err != nil {
+		log.Printf("❌ Error getting preferences for user %d: %v", userID, err)
+		SendReply(bot, chatID, "❌ Не удалось получить ваши настройки")
+		return
+	}
+
+	view, err := db.GetUserDayView(userID, prefs.Location())
+	if err != nil {
+		log.Printf("❌ Error getting day view for user %d: %v", userID, err)
+		SendReply(bot, chatID, "❌ Не удалось получить задачи на сегодня")
+		return
+	}
+	if view.Total() == 0 {
+		SendReply(bot, chatID, fmt.Sprintf("☀️ <b>Мой день</b>\n\nНа сегодня и ближайшие %d дня задач с дедлайном нет", dayViewSoonDays))
+		return
+	}
+
+	// Project status marks tasks of paused projects, loaded for all tasks at once
+	if err := db.AttachProjects(view.Tasks()); err != nil {
+		log.Printf("⚠️ Failed to attach projects to day view of user %d: %v", userID, err)
+	}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "☀️ <b>Мой день</b>\n\nПросрочено: %d • Сегодня: %d • Скоро: %d",
+		len(view.Overdue), len(view.DueToday), len(view.DueSoon))
+
+	sections := []struct {
+		title string
+		tasks []*Task
+	}{
+		{"🔥 Просрочено", view.Overdue},
+		{"📅 Сегодня", view.DueToday},
+		{"⏳ Скоро", view.DueSoon},
+	}
+	for _, section := range sections {
+		if len(section.tasks) == 0 {
+			continue
+		}
+		fmt.Fprintf(&text, "\n\n<b>%s</b>", section.title)
+		for _, task := range section.tasks {
+			project := html.EscapeString(task.ProjectTitle)
+			if task.ProjectStatus != "" {
+				project = StatusEmoji(task.ProjectStatus) + " " + project
+			}
+			fmt.Fprintf(&text, "\n%s #%d %s — %s, до %s", TaskPriorityEmoji(task.Priority), task.ID,
+				html.EscapeString(task.Title), project, task.Deadline.Format("02.01 15:04"))
+		}
+	}
+
+	SendReply(bot, chatID, text.String())
+}
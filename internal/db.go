@@ -6,6 +6,8 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -23,18 +25,19 @@ type User struct {
 	TgName           string
 	Email            string
 	Name             string
-	CurrentProjectID *int // Pointer to allow NULL values
+	CurrentProjectID *int // Current project in the private chat, pointer to allow NULL values
 	TS               time.Time
 }
 
 // Message represents a conversation message in the database
 type Message struct {
-	ID        int
-	UserID    int
-	ChatID    int64
-	Role      string // 'user' or 'assistant'
-	Content   string
-	CreatedAt time.Time
+	ID          int
+	UserID      int
+	ChatID      int64
+	TgMessageID int    // Telegram message ID of a sent bot message, 0 if unknown or not sent
+	Role        string // 'user', 'assistant', 'system' (internal notes) or 'function' (JavaScript output results)
+	Content     string
+	CreatedAt   time.Time
 }
 
 // ConnectDB establishes a connection to the database
@@ -55,11 +58,42 @@ func ConnectDB(config *Config) (*DB, error) {
 	return &DB{db}, nil
 }
 
+// WithTx runs fn in a transaction. The transaction is committed if fn returns nil and rolled
+// back if it returns an error or panics, the panic is re-raised after the rollback
+func (db *DB) WithTx(fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
 // GetUserByTgID retrieves a user by their Telegram ID
 func (db *DB) GetUserByTgID(tgID int64) (*User, error) {
 	user := &User{}
 	var currentProjectID sql.NullInt64
-	err := db.QueryRow("SELECT id, tg_id, tg_name, email, name, current_project_id, ts FROM users WHERE tg_id = ?", tgID).Scan(
+	err := db.QueryRow(`
+		SELECT u.id, u.tg_id, u.tg_name, u.email, u.name, s.current_project_id, u.ts
+		FROM users u
+		LEFT JOIN user_chat_state s ON s.user_id = u.id AND s.chat_id = u.tg_id
+		WHERE u.tg_id = ?
+	`, tgID).Scan(
 		&user.ID, &user.TgID, &user.TgName, &user.Email, &user.Name, &currentProjectID, &user.TS,
 	)
 	if err == sql.ErrNoRows {
@@ -104,8 +138,9 @@ func (db *DB) CreateUser(tgID int64, tgName, email, name string) (*User, error)
 
 // UpdateUser updates an existing user
 func (db *DB) UpdateUser(user *User) error {
-	_, err := db.Exec("UPDATE users SET tg_name = ?, email = ?, name = ?, current_project_id = ? WHERE tg_id = ?",
-		user.TgName, user.Email, user.Name, user.CurrentProjectID, user.TgID)
+	// The current project is kept in user_chat_state, SetCurrentProject changes it
+	_, err := db.Exec("UPDATE users SET tg_name = ?, email = ?, name = ? WHERE tg_id = ?",
+		user.TgName, user.Email, user.Name, user.TgID)
 	if err != nil {
 		return fmt.Errorf("failed to update user: %v", err)
 	}
@@ -156,6 +191,11 @@ func LoadConfig() *Config {
 		TelegramAPIToken: token,
 		DebugMode:        getEnvBool("DEBUG_MODE", true),
 		UpdateTimeout:    getEnvInt("UPDATE_TIMEOUT", 60),
+		AdminTgIDs:       getEnvIDList("ADMIN_TG_IDS"),
+
+		TelegramRetryAttempts:  getEnvInt("TELEGRAM_RETRY_ATTEMPTS", 3),
+		TelegramRetryBackoffMs: getEnvInt("TELEGRAM_RETRY_BACKOFF_MS", 500),
+		TelegramTimeoutSeconds: getEnvInt("TELEGRAM_TIMEOUT_SECONDS", 30),
 
 		// Database settings (defaults for local development)
 		DBHost:     getEnvStr("DB_HOST", "localhost"),
@@ -164,16 +204,104 @@ func LoadConfig() *Config {
 		DBPassword: getEnvStr("DB_PASSWORD", ""),
 		DBName:     getEnvStr("DB_NAME", "teamwork"),
 
+		ProjectsCacheSeconds:     getEnvInt("PROJECTS_CACHE_SECONDS", 60),
+		ProjectTasksCacheSeconds: getEnvInt("PROJECT_TASKS_CACHE_SECONDS", 30),
+
+		DefaultProjectStatus: getEnvStr("DEFAULT_PROJECT_STATUS", string(StatusPlanning)),
+
+		DBRetryAttempts:  getEnvInt("DB_RETRY_ATTEMPTS", 3),
+		DBRetryBackoffMs: getEnvInt("DB_RETRY_BACKOFF_MS", 200),
+
 		// AI settings
-		OpenAIAPIKey:    openAIKey,
-		AnthropicAPIKey: getEnvStr("ANTHROPIC_API_KEY", ""),
-		AIProvider:      getEnvStr("AI_PROVIDER", "openai"),
-		AIEnabled:       aiEnabled,
+		OpenAIAPIKey:          openAIKey,
+		AnthropicAPIKey:       getEnvStr("ANTHROPIC_API_KEY", ""),
+		AIProvider:            getEnvStr("AI_PROVIDER", "openai"),
+		TranscriptionProvider: getEnvStr("TRANSCRIPTION_PROVIDER", "openai"),
+		AIEnabled:             aiEnabled,
+		AISelfTest:            getEnvBool("AI_SELF_TEST", true),
+		FormattingModel:       getEnvStr("FORMATTING_MODEL", ""),
+		Temperatures: map[PromptType]float64{
+			PromptChat:       getEnvFloat("AI_TEMPERATURE_CHAT", defaultTemperature),
+			PromptFormatting: getEnvFloat("AI_TEMPERATURE_FORMATTING", defaultTemperature),
+			PromptWelcome:    getEnvFloat("AI_TEMPERATURE_WELCOME", defaultTemperature),
+			PromptError:      getEnvFloat("AI_TEMPERATURE_ERROR", defaultTemperature),
+		},
+		MaxAudioSeconds:  getEnvInt("MAX_AUDIO_SECONDS", 300),
+		MaxJSOutputSize:  getEnvInt("MAX_JS_OUTPUT_SIZE", 16384),
+		MaxConcurrentAI:  getEnvInt("AI_MAX_CONCURRENT_REQUESTS", 8),
+		AITimeoutSeconds: clampAITimeoutSeconds(getEnvInt("AI_PROVIDER_TIMEOUT_SECONDS", 15)),
+		JSErrorExamples:  getEnvInt("JS_ERROR_EXAMPLES", 3),
+
+		AssistantPersona: getEnvStr("AI_ASSISTANT_PERSONA", ""),
+
+		// Conversation settings
+		ContextWindowMessages:        clampContextWindowMessages(getEnvInt("CONTEXT_WINDOW_MESSAGES", maxContextWindowMessages)),
+		ContextMaxAgeHours:           getEnvInt("CONTEXT_MAX_AGE_HOURS", 0),
+		MaxUserMessageLength:         getEnvInt("MAX_USER_MESSAGE_LENGTH", 8000),
+		PreviewActions:               getEnvBool("PREVIEW_ACTIONS", false),
+		PendingOperationTTLMinutes:   getEnvInt("PENDING_OPERATION_TTL_MINUTES", 30),
+		ConfirmDeleteMinTasks:        getEnvInt("CONFIRM_DELETE_MIN_TASKS", 1),
+		ConfirmDeleteMinMembers:      getEnvInt("CONFIRM_DELETE_MIN_MEMBERS", 2),
+		DeletedProjectsRetentionDays: getEnvInt("DELETED_PROJECTS_RETENTION_DAYS", 30),
+		MaintenanceIntervalHours:     getEnvInt("MAINTENANCE_INTERVAL_HOURS", 24),
+		FunctionMinRoles:             getEnvList("FUNCTION_MIN_ROLES", nil),
+		MessageCleanupEvery:          getEnvInt("MESSAGE_CLEANUP_EVERY", 10),
+		StreamEditIntervalMs:         getEnvInt("STREAM_EDIT_INTERVAL_MS", 1000),
+		ThinkingPlaceholderMs:        getEnvInt("THINKING_PLACEHOLDER_MS", 0),
+
+		UnsupportedMessageReply: getEnvStr("UNSUPPORTED_MESSAGE_REPLY", defaultUnsupportedMessageReply),
+		StickerEmojiReply:       getEnvBool("STICKER_EMOJI_REPLY", true),
+		GroupMentionOnly:        getEnvBool("GROUP_MENTION_ONLY", true),
+
+		// Onboarding settings
+		WelcomeActions:            getEnvList("WELCOME_ACTIONS", defaultWelcomeActions),
+		WelcomeProjectSuggestions: getEnvList("WELCOME_PROJECT_SUGGESTIONS", defaultWelcomeProjectSuggestions),
+		ReturningUserCatchUpDays:  getEnvInt("RETURNING_USER_CATCHUP_DAYS", 7),
+
+		// Retrospective settings
+		RetroLookbackDays: getEnvInt("RETRO_LOOKBACK_DAYS", 7),
 	}
 
 	return config
 }
 
+// maxAITimeout is the longest allowed provider call, half the time of a message so the retry of
+// generated code that doesn't compile still fits
+const maxAITimeout = messageHandlerTimeout / 2
+
+// clampAITimeoutSeconds limits AI_PROVIDER_TIMEOUT_SECONDS to maxAITimeout. Zero, no limit, is kept,
+// negative values are treated as zero
+func clampAITimeoutSeconds(seconds int) int {
+	maxSeconds := int(maxAITimeout / time.Second)
+	switch {
+	case seconds < 0:
+		log.Printf("Warning: AI_PROVIDER_TIMEOUT_SECONDS=%d is negative, provider calls are not limited", seconds)
+		return 0
+	case seconds > maxSeconds:
+		log.Printf("Warning: AI_PROVIDER_TIMEOUT_SECONDS=%d leaves no time to retry within a message, using %d", seconds, maxSeconds)
+		return maxSeconds
+	}
+	return seconds
+}
+
+// maxContextWindowMessages is the default and the largest context window, each chat keeps
+// only that many messages
+const maxContextWindowMessages = 50
+
+// clampContextWindowMessages limits CONTEXT_WINDOW_MESSAGES to 1..maxContextWindowMessages.
+// Zero or negative values would leave the AI without history, the default is used instead
+func clampContextWindowMessages(messages int) int {
+	switch {
+	case messages <= 0:
+		log.Printf("Warning: CONTEXT_WINDOW_MESSAGES=%d leaves the AI without history, using %d", messages, maxContextWindowMessages)
+		return maxContextWindowMessages
+	case messages > maxContextWindowMessages:
+		log.Printf("Warning: CONTEXT_WINDOW_MESSAGES=%d is more than the %d stored messages, using %d", messages, maxContextWindowMessages, maxContextWindowMessages)
+		return maxContextWindowMessages
+	}
+	return messages
+}
+
 // LoadConfigForBot loads configuration for bot with validation
 func LoadConfigForBot() *Config {
 	config := LoadConfig()
@@ -199,6 +327,18 @@ func LoadConfigForBot() *Config {
 				log.Println("Warning: OPENAI_API_KEY not set, AI features will be disabled")
 			}
 		}
+
+		// Only OpenAI Whisper transcribes audio
+		switch config.TranscriptionProvider {
+		case "openai":
+			if config.OpenAIAPIKey == "" {
+				log.Println("Warning: OPENAI_API_KEY not set, audio transcription will be unavailable")
+			}
+		case "none":
+		default:
+			log.Printf("Warning: Unsupported transcription provider '%s', audio transcription disabled", config.TranscriptionProvider)
+			config.TranscriptionProvider = "none"
+		}
 	}
 
 	return config
@@ -227,6 +367,22 @@ func getEnvBool(key string, defaultValue bool) bool {
 	return value == "true" || value == "1" || value == "yes"
 }
 
+// getEnvFloat reads float environment variable with a default value
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	floatValue, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("Warning: could not parse %s=%s as float, using default %v", key, value, defaultValue)
+		return defaultValue
+	}
+
+	return floatValue
+}
+
 // getEnvInt reads integer environment variable with a default value
 func getEnvInt(key string, defaultValue int) int {
 	value := os.Getenv(key)
@@ -243,11 +399,52 @@ func getEnvInt(key string, defaultValue int) int {
 	return intValue
 }
 
+// getEnvList reads comma-separated environment variable with a default value
+func getEnvList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// getEnvIDList reads comma-separated Telegram IDs, invalid entries are skipped
+func getEnvIDList(key string) []int64 {
+	var ids []int64
+	for _, item := range getEnvList(key, nil) {
+		id, err := strconv.ParseInt(item, 10, 64)
+		if err != nil {
+			log.Printf("Warning: could not parse %s entry %s as ID, skipping", key, item)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
 // SaveMessage saves a message to the database
 func (db *DB) SaveMessage(userID int, chatID int64, role, content string) error {
+	return db.SaveSentMessage(userID, chatID, role, content, 0)
+}
+
+// SaveSentMessage saves a bot message with the Telegram message ID it was sent as, so it can be
+// edited or deleted later. A tgMessageID of 0 (sending failed) is stored as NULL
+func (db *DB) SaveSentMessage(userID int, chatID int64, role, content string, tgMessageID int) error {
+	var messageID sql.NullInt64
+	if tgMessageID != 0 {
+		messageID = sql.NullInt64{Int64: int64(tgMessageID), Valid: true}
+	}
+
 	_, err := db.Exec(
-		"INSERT INTO messages (user_id, chat_id, role, content) VALUES (?, ?, ?, ?)",
-		userID, chatID, role, content,
+		"INSERT INTO messages (user_id, chat_id, tg_message_id, role, content) VALUES (?, ?, ?, ?, ?)",
+		userID, chatID, messageID, role, content,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to save message: %v", err)
@@ -255,17 +452,69 @@ func (db *DB) SaveMessage(userID int, chatID int64, role, content string) error
 	return nil
 }
 
-// GetRecentMessages retrieves the last N messages for a chat
+// GetMessageByTgID returns the stored message sent as tgMessageID in the chat, nil if there is none
+func (db *DB) GetMessageByTgID(chatID int64, tgMessageID int) (*Message, error) {
+	msg := &Message{}
+	err := db.QueryRow(`
+		SELECT id, user_id, chat_id, tg_message_id, role, content, created_at
+		FROM messages
+		WHERE chat_id = ? AND tg_message_id = ?
+		ORDER BY id DESC
+		LIMIT 1
+	`, chatID, tgMessageID).Scan(&msg.ID, &msg.UserID, &msg.ChatID, &msg.TgMessageID, &msg.Role, &msg.Content, &msg.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message by Telegram ID: %v", err)
+	}
+	return msg, nil
+}
+
+// GetUserLastActivity returns the time of the user's last message,
+// falling back to the account timestamp if the user has never written
+func (db *DB) GetUserLastActivity(userID int) (time.Time, error) {
+	var lastMessage sql.NullTime
+	err := db.QueryRow("SELECT MAX(created_at) FROM messages WHERE user_id = ? AND role = 'user'", userID).Scan(&lastMessage)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get last user message: %v", err)
+	}
+	if lastMessage.Valid {
+		return lastMessage.Time, nil
+	}
+
+	var ts time.Time
+	if err := db.QueryRow("SELECT ts FROM users WHERE id = ?", userID).Scan(&ts); err != nil {
+		return time.Time{}, fmt.Errorf("failed to get user timestamp: %v", err)
+	}
+	return ts, nil
+}
+
+// GetRecentMessages retrieves the last N messages for a chat. Sent bot messages carry their
+// Telegram message ID so the bot's previous answer can be edited instead of sent again
 func (db *DB) GetRecentMessages(chatID int64, limit int) ([]*Message, error) {
+	return db.GetRecentMessagesWithin(chatID, limit, 0)
+}
+
+// GetRecentMessagesWithin retrieves the last N messages for a chat that are not older than maxAge.
+// A non-positive maxAge disables the age limit
+func (db *DB) GetRecentMessagesWithin(chatID int64, limit int, maxAge time.Duration) ([]*Message, error) {
+	maxAgeSeconds := int64(maxAge / time.Second)
+	if maxAgeSeconds < 0 {
+		maxAgeSeconds = 0
+	}
+
+	// The cutoff is computed by MySQL so it matches the time zone created_at is stored in
 	query := `
-		SELECT id, user_id, chat_id, role, content, created_at 
+		SELECT id, user_id, chat_id, tg_message_id, role, content, created_at 
 		FROM messages 
 		WHERE chat_id = ? 
-		ORDER BY created_at DESC 
+		  AND (? = 0 OR created_at >= NOW() - INTERVAL ? SECOND)
+		ORDER BY created_at DESC, id DESC 
 		LIMIT ?
 	`
 
-	rows, err := db.Query(query, chatID, limit)
+	rows, err := db.Query(query, chatID, maxAgeSeconds, maxAgeSeconds, limit)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get recent messages: %v", err)
 	}
@@ -274,10 +523,13 @@ func (db *DB) GetRecentMessages(chatID int64, limit int) ([]*Message, error) {
 	var messages []*Message
 	for rows.Next() {
 		msg := &Message{}
-		err := rows.Scan(&msg.ID, &msg.UserID, &msg.ChatID, &msg.Role, &msg.Content, &msg.CreatedAt)
+		var tgMessageID sql.NullInt64
+		err := rows.Scan(&msg.ID, &msg.UserID, &msg.ChatID, &tgMessageID, &msg.Role, &msg.Content, &msg.CreatedAt)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan message: %v", err)
 		}
+		// User messages and rows saved before IDs were stored have none
+		msg.TgMessageID = int(tgMessageID.Int64)
 		messages = append(messages, msg)
 	}
 
@@ -289,79 +541,177 @@ func (db *DB) GetRecentMessages(chatID int64, limit int) ([]*Message, error) {
 	return messages, nil
 }
 
-// CleanupOldMessages removes old messages beyond the limit for a chat
-func (db *DB) CleanupOldMessages(chatID int64, keepCount int) error {
+// GetRecentMessagesForChats retrieves the last perChat messages of each chat in one query.
+// Messages of every chat are in chronological order. Intended for admin tools only
+func (db *DB) GetRecentMessagesForChats(chatIDs []int64, perChat int) (map[int64][]*Message, error) {
+	result := make(map[int64][]*Message)
+	if len(chatIDs) == 0 {
+		return result, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(chatIDs)), ", ")
 	query := `
-		DELETE FROM messages 
-		WHERE chat_id = ? 
-		AND id NOT IN (
-			SELECT id FROM (
-				SELECT id FROM messages 
-				WHERE chat_id = ? 
-				ORDER BY created_at DESC 
-				LIMIT ?
-			) AS recent_messages
-		)
+		SELECT id, user_id, chat_id, tg_message_id, role, content, created_at
+		FROM (
+			SELECT id, user_id, chat_id, tg_message_id, role, content, created_at,
+			       ROW_NUMBER() OVER (PARTITION BY chat_id ORDER BY created_at DESC, id DESC) AS rn
+			FROM messages
+			WHERE chat_id IN (` + placeholders + `)
+		) AS recent
+		WHERE rn <= ?
+		ORDER BY chat_id, created_at ASC, id ASC
 	`
 
-	_, err := db.Exec(query, chatID, chatID, keepCount)
+	args := make([]interface{}, 0, len(chatIDs)+1)
+	for _, chatID := range chatIDs {
+		args = append(args, chatID)
+	}
+	args = append(args, perChat)
+
+	rows, err := db.Query(query, args...)
 	if err != nil {
-		return fmt.Errorf("failed to cleanup old messages: %v", err)
+		return nil, fmt.Errorf("failed to get recent messages for chats: %v", err)
 	}
-	return nil
+	defer rows.Close()
+
+	for rows.Next() {
+		msg := &Message{}
+		var tgMessageID sql.NullInt64
+		err := rows.Scan(&msg.ID, &msg.UserID, &msg.ChatID, &tgMessageID, &msg.Role, &msg.Content, &msg.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan message: %v", err)
+		}
+		msg.TgMessageID = int(tgMessageID.Int64)
+		result[msg.ChatID] = append(result[msg.ChatID], msg)
+	}
+
+	return result, nil
 }
 
-// SetUserCurrentProject sets the current project for a user
-func (db *DB) SetUserCurrentProject(userID, projectID int) error {
-	// First verify that the user has access to this project
-	userRole, err := db.GetUserRoleInProject(projectID, userID)
+// GetActiveChatIDs returns chats ordered by their latest message, most recent first
+func (db *DB) GetActiveChatIDs(limit int) ([]int64, error) {
+	query := `
+		SELECT chat_id
+		FROM messages
+		GROUP BY chat_id
+		ORDER BY MAX(created_at) DESC
+		LIMIT ?
+	`
+
+	rows, err := db.Query(query, limit)
 	if err != nil {
-		return fmt.Errorf("failed to check project access: %v", err)
+		return nil, fmt.Errorf("failed to get active chats: %v", err)
 	}
-	if userRole == "" {
-		return fmt.Errorf("user does not have access to this project")
+	defer rows.Close()
+
+	var chatIDs []int64
+	for rows.Next() {
+		var chatID int64
+		if err := rows.Scan(&chatID); err != nil {
+			return nil, fmt.Errorf("failed to scan chat ID: %v", err)
+		}
+		chatIDs = append(chatIDs, chatID)
 	}
 
-	_, err = db.Exec("UPDATE users SET current_project_id = ? WHERE id = ?", projectID, userID)
-	if err != nil {
-		return fmt.Errorf("failed to set current project: %v", err)
+	return chatIDs, nil
+}
+
+// Retries of critical database calls, see WithRetry
+var (
+	dbRetryAttempts = 1
+	dbRetryBackoff  time.Duration
+)
+
+// SetDBRetry makes WithRetry try a call up to attempts times, waiting backoff before the first
+// retry and doubling it for each next one. Values below 1 mean a single attempt
+func SetDBRetry(attempts int, backoff time.Duration) {
+	if attempts < 1 {
+		attempts = 1
 	}
-	return nil
+	dbRetryAttempts = attempts
+	dbRetryBackoff = backoff
 }
 
-// ClearUserCurrentProject clears the current project for a user
-func (db *DB) ClearUserCurrentProject(userID int) error {
-	_, err := db.Exec("UPDATE users SET current_project_id = NULL WHERE id = ?", userID)
-	if err != nil {
-		return fmt.Errorf("failed to clear current project: %v", err)
+// WithRetry runs fn until it succeeds or the attempts set by SetDBRetry are used up and
+// returns the last error. It rides out short database outages such as a MySQL restart
+func WithRetry(operation string, fn func() error) error {
+	backoff := dbRetryBackoff
+	var err error
+	for attempt := 1; attempt <= dbRetryAttempts; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		if attempt < dbRetryAttempts {
+			log.Printf("⚠️ %s failed (attempt %d/%d), retrying in %v: %v", operation, attempt, dbRetryAttempts, backoff, err)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
 	}
-	return nil
+	return err
 }
 
-// GetUserCurrentProject gets the current project for a user with details
-func (db *DB) GetUserCurrentProject(userID int) (*Project, error) {
-	query := `
-		SELECT p.id, p.title, p.description, p.status, 
-		       p.created_at, p.updated_at, pu.role
-		FROM users u
-		JOIN projects p ON u.current_project_id = p.id
-		JOIN project_users pu ON p.id = pu.project_id AND pu.user_id = u.id
-		WHERE u.id = ? AND u.current_project_id IS NOT NULL
-	`
+// messageCleanupEvery runs message cleanup for a chat on every Nth saved message
+var messageCleanupEvery = 1
 
-	project := &Project{}
-	err := db.QueryRow(query, userID).Scan(
-		&project.ID, &project.Title, &project.Description,
-		&project.Status, &project.CreatedAt, &project.UpdatedAt,
-		&project.UserRole,
-	)
+// messageCleanupCounts counts messages per chat since the last cleanup
+var (
+	messageCleanupMu     sync.Mutex
+	messageCleanupCounts = make(map[int64]int)
+)
 
-	if err == sql.ErrNoRows {
-		return nil, nil
+// SetMessageCleanupEvery makes MaybeCleanupOldMessages trim a chat every n messages, values below 1 mean every message
+func SetMessageCleanupEvery(n int) {
+	if n < 1 {
+		n = 1
 	}
-	if err != nil {
-		return nil, fmt.Errorf("failed to get current project: %v", err)
+	messageCleanupEvery = n
+}
+
+// MaybeCleanupOldMessages trims a chat to keepCount messages on every Nth call for the chat
+// (see SetMessageCleanupEvery) and only when it holds more than keepCount messages.
+// Older messages may stay a little longer, the last keepCount are always kept
+func (db *DB) MaybeCleanupOldMessages(chatID int64, keepCount int) error {
+	messageCleanupMu.Lock()
+	messageCleanupCounts[chatID]++
+	due := messageCleanupCounts[chatID] >= messageCleanupEvery
+	if due {
+		delete(messageCleanupCounts, chatID)
+	}
+	messageCleanupMu.Unlock()
+
+	if !due {
+		return nil
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM messages WHERE chat_id = ?", chatID).Scan(&count); err != nil {
+		return fmt.Errorf("failed to count messages: %v", err)
+	}
+	if count <= keepCount {
+		return nil
 	}
 
-	return project, nil
+	return db.CleanupOldMessages(chatID, keepCount)
+}
+
+// CleanupOldMessages removes old messages beyond the limit for a chat
+func (db *DB) CleanupOldMessages(chatID int64, keepCount int) error {
+	query := `
+		DELETE FROM messages 
+		WHERE chat_id = ? 
+		AND id NOT IN (
+			SELECT id FROM (
+				SELECT id FROM messages 
+				WHERE chat_id = ? 
+				ORDER BY created_at DESC 
+				LIMIT ?
+			) AS recent_messages
+		)
+	`
+
+	_, err := db.Exec(query, chatID, chatID, keepCount)
+	if err != nil {
+		return fmt.Errorf("failed to cleanup old messages: %v", err)
+	}
+	return nil
 }
@@ -0,0 +1,158 @@
+package internal
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// openTestDB connects to the MySQL database in TEST_DB_DSN, e.g.
+// "root:@tcp(localhost:3306)/teamwork_test?parseTime=true", with the current schema applied.
+// Tests that need a database are skipped without it
+func openTestDB(t *testing.T) *DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DB_DSN is not set")
+	}
+
+	conn, err := sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	if err := conn.Ping(); err != nil {
+		t.Fatalf("failed to ping test database: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &DB{conn}
+}
+
+// createTestUser creates a user with a Telegram ID no other test run uses, removed after the test
+func createTestUser(t *testing.T, db *DB, name string) *User {
+	t.Helper()
+	user, _, err := db.GetOrCreateUser(time.Now().UnixNano(), name)
+	if err != nil {
+		t.Fatalf("failed to create user %s: %v", name, err)
+	}
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM projects WHERE id IN (SELECT project_id FROM project_users WHERE user_id = ? AND role = 'owner')", user.ID)
+		db.Exec("DELETE FROM users WHERE id = ?", user.ID)
+	})
+	return user
+}
+
+func TestGetMessageByTgID(t *testing.T) {
+	db := openTestDB(t)
+	user := createTestUser(t, db, "writer")
+	chatID := time.Now().UnixNano()
+
+	if err := db.SaveSentMessage(user.ID, chatID, "assistant", "Ответ бота", 501); err != nil {
+		t.Fatalf("SaveSentMessage() error = %v", err)
+	}
+	// Sending failed, there is no Telegram ID to store
+	if err := db.SaveSentMessage(user.ID, chatID, "assistant", "Не отправлено", 0); err != nil {
+		t.Fatalf("SaveSentMessage() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		chatID      int64
+		tgMessageID int
+		want        string // "" when no message is expected
+	}{
+		{"sent message", chatID, 501, "Ответ бота"},
+		{"unknown ID", chatID, 502, ""},
+		{"failed send has no ID", chatID, 0, ""},
+		{"same ID in another chat", chatID + 1, 501, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := db.GetMessageByTgID(tt.chatID, tt.tgMessageID)
+			if err != nil {
+				t.Fatalf("GetMessageByTgID() error = %v", err)
+			}
+			switch {
+			case tt.want == "" && msg != nil:
+				t.Errorf("GetMessageByTgID() = %q, want none", msg.Content)
+			case tt.want != "" && (msg == nil || msg.Content != tt.want || msg.TgMessageID != tt.tgMessageID):
+				t.Errorf("GetMessageByTgID() = %+v, want %q with ID %d", msg, tt.want, tt.tgMessageID)
+			}
+		})
+	}
+}
+
+func TestGetRecentMessagesTgMessageID(t *testing.T) {
+	db := openTestDB(t)
+	user := createTestUser(t, db, "writer")
+	chatID := time.Now().UnixNano()
+
+	saved := []struct {
+		role        string
+		content     string
+		tgMessageID int
+	}{
+		{"user", "покажи задачи", 0},
+		{"assistant", "Вот ваши задачи", 701},
+		{"assistant", "Не отправлено", 0},
+		{"user", "нет, я имел в виду проекты", 0},
+	}
+	for _, msg := range saved {
+		var err error
+		if msg.role == "user" {
+			err = db.SaveMessage(user.ID, chatID, msg.role, msg.content)
+		} else {
+			err = db.SaveSentMessage(user.ID, chatID, msg.role, msg.content, msg.tgMessageID)
+		}
+		if err != nil {
+			t.Fatalf("failed to save %q: %v", msg.content, err)
+		}
+	}
+
+	messages, err := db.GetRecentMessages(chatID, 10)
+	if err != nil {
+		t.Fatalf("GetRecentMessages() error = %v", err)
+	}
+	if len(messages) != len(saved) {
+		t.Fatalf("GetRecentMessages() returned %d messages, want %d", len(messages), len(saved))
+	}
+	for i, want := range saved {
+		t.Run(want.content, func(t *testing.T) {
+			if got := messages[i]; got.Content != want.content || got.TgMessageID != want.tgMessageID {
+				t.Errorf("message %d = %q with ID %d, want %q with ID %d", i, got.Content, got.TgMessageID, want.content, want.tgMessageID)
+			}
+		})
+	}
+
+	// Rows saved before IDs were stored have NULL, like a failed send
+	chats, err := db.GetRecentMessagesForChats([]int64{chatID}, 10)
+	if err != nil {
+		t.Fatalf("GetRecentMessagesForChats() error = %v", err)
+	}
+	if got := chats[chatID]; len(got) != len(saved) || got[1].TgMessageID != 701 || got[2].TgMessageID != 0 {
+		t.Errorf("GetRecentMessagesForChats() = %+v, want the stored IDs", got)
+	}
+}
+
+func TestClampContextWindowMessages(t *testing.T) {
+	tests := []struct {
+		messages int
+		want     int
+	}{
+		{-1, maxContextWindowMessages},
+		{0, maxContextWindowMessages},
+		{1, 1},
+		{20, 20},
+		{maxContextWindowMessages, maxContextWindowMessages},
+		{200, maxContextWindowMessages},
+	}
+
+	for _, tt := range tests {
+		if got := clampContextWindowMessages(tt.messages); got != tt.want {
+			t.Errorf("clampContextWindowMessages(%d) = %d, want %d", tt.messages, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// deadlineClearWords remove a deadline instead of setting one
+var deadlineClearWords = map[string]bool{
+	"":             true,
+	"нет":          true,
+	"без дедлайна": true,
+	"убрать":       true,
+	"none":         true,
+	"no":           true,
+}
+
+// deadlineDayWords are days relative to today
+var deadlineDayWords = map[string]int{
+	"сегодня":     0,
+	"today":       0,
+	"завтра":      1,
+	"tomorrow":    1,
+	"послезавтра": 2,
+}
+
+// deadlineAbsoluteLayouts are the accepted date formats, the first one is what the AI is asked for
+var deadlineAbsoluteLayouts = []struct {
+	layout  string
+	hasTime bool
+}{
+	{"2006-01-02 15:04", true},
+	{"2006-01-02", false},
+	{"02.01.2006 15:04", true},
+	{"02.01.2006", false},
+}
+
+var (
+	// deadlineTimePattern is an optional time of day at the end, "завтра 15:00"
+	deadlineTimePattern = regexp.MustCompile(`^(.*?)\s*(\d{1,2}):(\d{2})$`)
+	// deadlineInPattern is a relative offset, "через 3 дня", "через неделю", "in 2 weeks"
+	deadlineInPattern = regexp.MustCompile(`^(?:через|in)\s+(\d+\s+)?(д|н|day|week)`)
+	// deadlineDayMonthPattern is a date without year, "15.03"
+	deadlineDayMonthPattern = regexp.MustCompile(`^(\d{1,2})\.(\d{1,2})$`)
+)
+
+// ParseTaskDeadline converts a deadline like "2024-05-01 18:00", "15.03", "завтра 15:00" or
+// "через неделю" into the user's wall-clock time, which is how deadlines are stored. Dates
+// without a time mean the end of the day. Returns nil for words that clear the deadline ("нет")
+func ParseTaskDeadline(s string, now time.Time, loc *time.Location) (*time.Time, error) {
+	text := strings.ToLower(strings.Join(strings.Fields(s), " "))
+	if deadlineClearWords[text] {
+		return nil, nil
+	}
+
+	for _, format := range deadlineAbsoluteLayouts {
+		if t, err := time.Parse(format.layout, text); err == nil {
+			if !format.hasTime {
+				t = t.Add(23*time.Hour + 59*time.Minute)
+			}
+			return &t, nil
+		}
+	}
+
+	// Split off the time of day, relative dates and dates without year may carry one
+	hour, minute := 23, 59
+	if match := deadlineTimePattern.FindStringSubmatch(text); match != nil {
+		hour, _ = strconv.Atoi(match[2])
+		minute, _ = strconv.Atoi(match[3])
+		if hour > 23 || minute > 59 {
+			return nil, fmt.Errorf("invalid time in deadline %q", s)
+		}
+		text = match[1]
+	}
+
+	if loc == nil {
+		loc = time.Local
+	}
+	today := now.In(loc)
+	at := func(year int, month time.Month, day int) *time.Time {
+		t := time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+		return &t
+	}
+
+	if days, ok := deadlineDayWords[text]; ok {
+		day := today.AddDate(0, 0, days)
+		return at(day.Year(), day.Month(), day.Day()), nil
+	}
+
+	if match := deadlineInPattern.FindStringSubmatch(text); match != nil {
+		count := 1
+		if match[1] != "" {
+			count, _ = strconv.Atoi(strings.TrimSpace(match[1]))
+		}
+		if match[2] == "н" || match[2] == "week" {
+			count *= 7
+		}
+		day := today.AddDate(0, 0, count)
+		return at(day.Year(), day.Month(), day.Day()), nil
+	}
+
+	if match := deadlineDayMonthPattern.FindStringSubmatch(text); match != nil {
+		day, _ := strconv.Atoi(match[1])
+		month, _ := strconv.Atoi(match[2])
+		if month < 1 || month > 12 || day < 1 || day > 31 {
+			return nil, fmt.Errorf("invalid date in deadline %q", s)
+		}
+		// A date that already passed this year means next year
+		deadline := at(today.Year(), time.Month(month), day)
+		if deadline.Before(time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)) {
+			deadline = at(today.Year()+1, time.Month(month), day)
+		}
+		return deadline, nil
+	}
+
+	return nil, fmt.Errorf("unrecognized deadline %q, use YYYY-MM-DD HH:MM", s)
+}
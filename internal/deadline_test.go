@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTaskDeadline(t *testing.T) {
+	moscow := time.FixedZone("MSK", 3*60*60)
+	// 2024-06-10 22:30 UTC is already 2024-06-11 01:30 in Moscow
+	now := time.Date(2024, 6, 10, 22, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		input string
+		want  string // "" for no deadline
+	}{
+		{"date and time", "2024-07-01 18:00", "2024-07-01 18:00"},
+		{"date only is end of day", "2024-07-01", "2024-07-01 23:59"},
+		{"dotted date and time", "01.07.2024 09:15", "2024-07-01 09:15"},
+		{"dotted date", "01.07.2024", "2024-07-01 23:59"},
+		{"today in user timezone", "сегодня", "2024-06-11 23:59"},
+		{"tomorrow with time", "Завтра 15:00", "2024-06-12 15:00"},
+		{"english tomorrow", "tomorrow", "2024-06-12 23:59"},
+		{"day after tomorrow", "послезавтра", "2024-06-13 23:59"},
+		{"in days", "через 3 дня", "2024-06-14 23:59"},
+		{"in a week", "через неделю", "2024-06-18 23:59"},
+		{"in weeks with time", "через 2 недели 10:00", "2024-06-25 10:00"},
+		{"english in days", "in 5 days", "2024-06-16 23:59"},
+		{"day and month", "15.07", "2024-07-15 23:59"},
+		{"day and month today", "11.06", "2024-06-11 23:59"},
+		{"passed day and month is next year", "10.06 12:00", "2025-06-10 12:00"},
+		{"extra spaces", "  завтра   15:00 ", "2024-06-12 15:00"},
+		{"no", "нет", ""},
+		{"without deadline", "без дедлайна", ""},
+		{"empty", "", ""},
+		{"english none", "None", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTaskDeadline(tt.input, now, moscow)
+			if err != nil {
+				t.Fatalf("ParseTaskDeadline(%q) error: %v", tt.input, err)
+			}
+			if tt.want == "" {
+				if got != nil {
+					t.Errorf("ParseTaskDeadline(%q) = %v, want no deadline", tt.input, got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatalf("ParseTaskDeadline(%q) = nil, want %s", tt.input, tt.want)
+			}
+			if formatted := got.Format("2006-01-02 15:04"); formatted != tt.want {
+				t.Errorf("ParseTaskDeadline(%q) = %s, want %s", tt.input, formatted, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTaskDeadlineInvalid(t *testing.T) {
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"invalid hour", "завтра 25:00"},
+		{"invalid minute", "завтра 10:60"},
+		{"invalid month", "15.13"},
+		{"invalid day", "32.01"},
+		{"zero day", "00.05"},
+		{"unknown word", "когда-нибудь"},
+		{"invalid absolute date", "2024-02-30 10:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := ParseTaskDeadline(tt.input, now, time.UTC); err == nil {
+				t.Errorf("ParseTaskDeadline(%q) = %v, want error", tt.input, got)
+			}
+		})
+	}
+}
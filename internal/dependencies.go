@@ -0,0 +1,292 @@
+package internal
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// AddTaskDependency makes taskID depend on dependsOnTaskID (taskID is blocked until it is done).
+// Both tasks must belong to the same project the user can access, cycles are rejected
+func (db *DB) AddTaskDependency(taskID, dependsOnTaskID, userID int) error {
+	if taskID == dependsOnTaskID {
+		return fmt.Errorf("task cannot depend on itself")
+	}
+
+	task, err := db.GetTaskByID(taskID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get task: %v", err)
+	}
+	if task == nil {
+		return fmt.Errorf("task not found or no access")
+	}
+
+	dependsOn, err := db.GetTaskByID(dependsOnTaskID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get dependency task: %v", err)
+	}
+	if dependsOn == nil {
+		return fmt.Errorf("dependency task not found or no access")
+	}
+
+	if task.ProjectID != dependsOn.ProjectID {
+		return fmt.Errorf("tasks must belong to the same project")
+	}
+	if err := db.requireCapability(task.ProjectID, userID, func(c *Capabilities) bool { return c.CanEditTasks }, "edit tasks"); err != nil {
+		return err
+	}
+
+	// Adding the edge creates a cycle if taskID is already reachable from dependsOnTaskID
+	reachable, err := db.taskDependsOn(dependsOnTaskID, taskID)
+	if err != nil {
+		return err
+	}
+	if reachable {
+		return fmt.Errorf("dependency would create a cycle")
+	}
+
+	_, err = db.Exec(
+		"INSERT IGNORE INTO task_dependencies (task_id, depends_on_task_id) VALUES (?, ?)",
+		taskID, dependsOnTaskID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to add task dependency: %v", err)
+	}
+	InvalidateProjectTasks(task.ProjectID)
+
+	return nil
+}
+
+// RemoveTaskDependency removes the dependency of taskID on dependsOnTaskID
+func (db *DB) RemoveTaskDependency(taskID, dependsOnTaskID, userID int) error {
+	task, err := db.GetTaskByID(taskID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get task: %v", err)
+	}
+	if task == nil {
+		return fmt.Errorf("task not found or no access")
+	}
+	if err := db.requireCapability(task.ProjectID, userID, func(c *Capabilities) bool { return c.CanEditTasks }, "edit tasks"); err != nil {
+		return err
+	}
+
+	_, err = db.Exec(
+		"DELETE FROM task_dependencies WHERE task_id = ? AND depends_on_task_id = ?",
+		taskID, dependsOnTaskID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to remove task dependency: %v", err)
+	}
+	InvalidateProjectTasks(task.ProjectID)
+
+	return nil
+}
+
+// GetTaskDependencies returns the tasks that taskID depends on
+func (db *DB) GetTaskDependencies(taskID, userID int) ([]*Task, error) {
+	task, err := db.GetTaskByID(taskID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get task: %v", err)
+	}
+	if task == nil {
+		return nil, fmt.Errorf("task not found or no access")
+	}
+
+	query := `
+		SELECT t.id, t.project_id, t.user_id, t.title, t.description,
+		       t.status, t.priority, t.deadline, t.created_at, t.updated_at,
+		       t.completed_at, p.title, ` + taskBlockedColumn + `
+		FROM task_dependencies td
+		JOIN tasks t ON td.depends_on_task_id = t.id
+		JOIN projects p ON t.project_id = p.id
+		WHERE td.task_id = ? AND p.deleted_at IS NULL
+		ORDER BY t.id ASC
+	`
+
+	rows, err := db.Query(query, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get task dependencies: %v", err)
+	}
+	defer rows.Close()
+
+	var tasks []*Task
+	for rows.Next() {
+		task := &Task{}
+		var deadline, completedAt sql.NullTime
+
+		err := rows.Scan(
+			&task.ID, &task.ProjectID, &task.UserID, &task.Title, &task.Description,
+			&task.Status, &task.Priority, &deadline, &task.CreatedAt, &task.UpdatedAt,
+			&completedAt, &task.ProjectTitle, &task.Blocked,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan task: %v", err)
+		}
+
+		if deadline.Valid {
+			task.Deadline = &deadline.Time
+		}
+		if completedAt.Valid {
+			task.CompletedAt = &completedAt.Time
+		}
+
+		tasks = append(tasks, task)
+	}
+
+	return tasks, nil
+}
+
+// GetUnblockedTasks returns open tasks that depend on taskID and have no other
+// incomplete dependencies left, i.e. tasks unblocked by finishing taskID
+func (db *DB) GetUnblockedTasks(taskID int) ([]*Task, error) {
+	query := `
+		SELECT t.id, t.project_id, t.user_id, t.title, t.description,
+		       t.status, t.priority, t.deadline, t.created_at, t.updated_at,
+		       t.completed_at, p.title
+		FROM task_dependencies td
+		JOIN tasks t ON td.task_id = t.id
+		JOIN projects p ON t.project_id = p.id
+		WHERE td.depends_on_task_id = ? AND p.deleted_at IS NULL
+		      AND t.status NOT IN ('done', 'cancelled')
+		      AND NOT EXISTS (
+		          SELECT 1
+		          FROM task_dependencies other
+		          JOIN tasks blocker ON other.depends_on_task_id = blocker.id
+		          WHERE other.task_id = t.id AND blocker.status NOT IN ('done', 'cancelled')
+		      )
+		ORDER BY t.id ASC
+	`
+
+	rows, err := db.Query(query, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unblocked tasks: %v", err)
+	}
+	defer rows.Close()
+
+	var tasks []*Task
+	for rows.Next() {
+		task := &Task{}
+		var deadline, completedAt sql.NullTime
+
+		err := rows.Scan(
+			&task.ID, &task.ProjectID, &task.UserID, &task.Title, &task.Description,
+			&task.Status, &task.Priority, &deadline, &task.CreatedAt, &task.UpdatedAt,
+			&completedAt, &task.ProjectTitle,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan task: %v", err)
+		}
+
+		if deadline.Valid {
+			task.Deadline = &deadline.Time
+		}
+		if completedAt.Valid {
+			task.CompletedAt = &completedAt.Time
+		}
+
+		tasks = append(tasks, task)
+	}
+
+	return tasks, nil
+}
+
+// GetBlockedTasks returns the user's open tasks that have at least one incomplete dependency.
+// Each task lists its blocking tasks in BlockedBy
+func (db *DB) GetBlockedTasks(userID int) ([]*Task, error) {
+	query := `
+		SELECT t.id, t.project_id, t.user_id, t.title, t.description,
+		       t.status, t.priority, t.deadline, t.created_at, t.updated_at,
+		       t.completed_at, p.title,
+		       b.id, b.title, b.status
+		FROM tasks t
+		JOIN projects p ON t.project_id = p.id
+		JOIN project_users pu ON p.id = pu.project_id
+		JOIN task_dependencies td ON td.task_id = t.id
+		JOIN tasks b ON td.depends_on_task_id = b.id
+		WHERE pu.user_id = ? AND p.deleted_at IS NULL
+		      AND t.status NOT IN ('done', 'cancelled')
+		      AND b.status NOT IN ('done', 'cancelled')
+		ORDER BY t.id ASC, b.id ASC
+	`
+
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get blocked tasks: %v", err)
+	}
+	defer rows.Close()
+
+	var tasks []*Task
+	byID := make(map[int]*Task)
+	for rows.Next() {
+		task := &Task{}
+		blocker := &TaskRef{}
+		var deadline, completedAt sql.NullTime
+
+		err := rows.Scan(
+			&task.ID, &task.ProjectID, &task.UserID, &task.Title, &task.Description,
+			&task.Status, &task.Priority, &deadline, &task.CreatedAt, &task.UpdatedAt,
+			&completedAt, &task.ProjectTitle,
+			&blocker.ID, &blocker.Title, &blocker.Status,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan blocked task: %v", err)
+		}
+
+		// One row per (task, blocker) pair, collect blockers on the same task
+		if existing, ok := byID[task.ID]; ok {
+			existing.BlockedBy = append(existing.BlockedBy, blocker)
+			continue
+		}
+
+		if deadline.Valid {
+			task.Deadline = &deadline.Time
+		}
+		if completedAt.Valid {
+			task.CompletedAt = &completedAt.Time
+		}
+		task.BlockedBy = []*TaskRef{blocker}
+
+		byID[task.ID] = task
+		tasks = append(tasks, task)
+	}
+
+	return tasks, nil
+}
+
+// taskDependsOn reports whether targetID is reachable from taskID by following dependencies
+func (db *DB) taskDependsOn(taskID, targetID int) (bool, error) {
+	visited := map[int]bool{taskID: true}
+	queue := []int{taskID}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		rows, err := db.Query("SELECT depends_on_task_id FROM task_dependencies WHERE task_id = ?", current)
+		if err != nil {
+			return false, fmt.Errorf("failed to check task dependencies: %v", err)
+		}
+
+		var next []int
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return false, fmt.Errorf("failed to scan task dependency: %v", err)
+			}
+			next = append(next, id)
+		}
+		rows.Close()
+
+		for _, id := range next {
+			if id == targetID {
+				return true, nil
+			}
+			if !visited[id] {
+				visited[id] = true
+				queue = append(queue, id)
+			}
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The emoji of statuses and priorities are defined here only: the deterministic renderers use
+// them and the system prompt lists them, so the AI marks items the same way
+
+// projectStatusEmoji maps each project status to its emoji, in the order the legend lists them
+var projectStatusEmoji = []struct {
+	status ProjectStatus
+	emoji  string
+}{
+	{StatusPlanning, "📝"},
+	{StatusActive, "🚀"},
+	{StatusPaused, "⏸️"},
+	{StatusCompleted, "✅"},
+	{StatusCancelled, "❌"},
+}
+
+// taskStatusEmoji maps each task status to its emoji, in the order the legend lists them
+var taskStatusEmoji = []struct {
+	status TaskStatus
+	emoji  string
+}{
+	{TaskTodo, "📝"},
+	{TaskInProgress, "🚀"},
+	{TaskReview, "👀"},
+	{TaskDone, "✅"},
+	{TaskCancelled, "❌"},
+}
+
+// taskPriorityEmoji maps each task priority to its emoji, from low to urgent
+var taskPriorityEmoji = []struct {
+	priority TaskPriority
+	emoji    string
+}{
+	{PriorityLow, "🟢"},
+	{PriorityMedium, "🟡"},
+	{PriorityHigh, "🟠"},
+	{PriorityUrgent, "🔴"},
+}
+
+// StatusEmoji returns the emoji of a project status, ❓ for unknown statuses
+func StatusEmoji(status ProjectStatus) string {
+	for _, entry := range projectStatusEmoji {
+		if entry.status == status {
+			return entry.emoji
+		}
+	}
+	return "❓"
+}
+
+// TaskStatusEmoji returns the emoji of a task status, ❓ for unknown statuses
+func TaskStatusEmoji(status TaskStatus) string {
+	for _, entry := range taskStatusEmoji {
+		if entry.status == status {
+			return entry.emoji
+		}
+	}
+	return "❓"
+}
+
+// TaskPriorityEmoji returns the emoji of a task priority, ⚪ for unknown priorities
+func TaskPriorityEmoji(priority TaskPriority) string {
+	for _, entry := range taskPriorityEmoji {
+		if entry.priority == priority {
+			return entry.emoji
+		}
+	}
+	return "⚪"
+}
+
+// emojiLegendPrompt is the system prompt section listing the emoji of statuses and priorities
+func emojiLegendPrompt() string {
+	var projectStatuses, taskStatuses, priorities []string
+	for _, entry := range projectStatusEmoji {
+		projectStatuses = append(projectStatuses, fmt.Sprintf("%s %s", entry.emoji, entry.status))
+	}
+	for _, entry := range taskStatusEmoji {
+		taskStatuses = append(taskStatuses, fmt.Sprintf("%s %s", entry.emoji, entry.status))
+	}
+	for _, entry := range taskPriorityEmoji {
+		priorities = append(priorities, fmt.Sprintf("%s %s", entry.emoji, entry.priority))
+	}
+
+	return `🎨 ЭМОДЗИ (те же, что в сообщениях и кнопках бота):
+- статусы проектов: ` + strings.Join(projectStatuses, ", ") + `
+- статусы задач: ` + strings.Join(taskStatuses, ", ") + `
+- приоритеты задач: ` + strings.Join(priorities, ", ") + `
+
+`
+}
@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStatusEmoji(t *testing.T) {
+	tests := []struct {
+		status ProjectStatus
+		want   string
+	}{
+		{StatusPlanning, "📝"},
+		{StatusActive, "🚀"},
+		{StatusPaused, "⏸️"},
+		{StatusCompleted, "✅"},
+		{StatusCancelled, "❌"},
+		{"archived", "❓"},
+	}
+
+	for _, tt := range tests {
+		if got := StatusEmoji(tt.status); got != tt.want {
+			t.Errorf("StatusEmoji(%q) = %s, want %s", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestTaskStatusEmoji(t *testing.T) {
+	tests := []struct {
+		status TaskStatus
+		want   string
+	}{
+		{TaskTodo, "📝"},
+		{TaskInProgress, "🚀"},
+		{TaskReview, "👀"},
+		{TaskDone, "✅"},
+		{TaskCancelled, "❌"},
+		{"blocked", "❓"},
+	}
+
+	for _, tt := range tests {
+		if got := TaskStatusEmoji(tt.status); got != tt.want {
+			t.Errorf("TaskStatusEmoji(%q) = %s, want %s", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestTaskPriorityEmoji(t *testing.T) {
+	tests := []struct {
+		priority TaskPriority
+		want     string
+	}{
+		{PriorityLow, "🟢"},
+		{PriorityMedium, "🟡"},
+		{PriorityHigh, "🟠"},
+		{PriorityUrgent, "🔴"},
+		{"critical", "⚪"},
+	}
+
+	for _, tt := range tests {
+		if got := TaskPriorityEmoji(tt.priority); got != tt.want {
+			t.Errorf("TaskPriorityEmoji(%q) = %s, want %s", tt.priority, got, tt.want)
+		}
+	}
+}
+
+// Every value the GPT functions accept must have its own emoji, a new status without one would
+// silently render as unknown
+func TestEmojiTablesCoverEveryValue(t *testing.T) {
+	for _, status := range projectStatuses {
+		if StatusEmoji(ProjectStatus(status)) == "❓" {
+			t.Errorf("project status %q has no emoji", status)
+		}
+	}
+	for _, status := range taskStatuses {
+		if TaskStatusEmoji(TaskStatus(status)) == "❓" {
+			t.Errorf("task status %q has no emoji", status)
+		}
+	}
+	for _, priority := range taskPriorities {
+		if TaskPriorityEmoji(TaskPriority(priority)) == "⚪" {
+			t.Errorf("task priority %q has no emoji", priority)
+		}
+	}
+}
+
+func TestEmojiLegendPrompt(t *testing.T) {
+	legend := emojiLegendPrompt()
+	for _, want := range []string{"🚀 active", "👀 review", "🔴 urgent", "⏸️ paused"} {
+		if !strings.Contains(legend, want) {
+			t.Errorf("emojiLegendPrompt() has no %q", want)
+		}
+	}
+}
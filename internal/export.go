@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ProjectExportVersion is the format version of ProjectExport, bump it on incompatible changes
+const ProjectExportVersion = 1
+
+// ProjectExport is a single project as the user sees it, sent as a JSON document by /export
+type ProjectExport struct {
+	Version    int              `json:"version"`
+	ExportedAt time.Time        `json:"exported_at"`
+	Project    *Project         `json:"project"`
+	Members    []*ProjectMember `json:"members"`
+	Tasks      []*Task          `json:"tasks"`
+}
+
+// ExportProject assembles the project, its members and tasks for a member of the project.
+// Any role may export, the export holds only what the member can already read in the bot
+func (db *DB) ExportProject(projectID, userID int) (*ProjectExport, error) {
+	project, err := db.GetProjectByIDForUser(projectID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if project == nil {
+		return nil, ErrProjectAccessDenied
+	}
+
+	members, err := db.GetProjectMembersWithDetails(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	tasks, err := db.GetProjectTasksOrdered(projectID, userID, TaskOrderCreated)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ProjectExport{
+		Version:    ProjectExportVersion,
+		ExportedAt: time.Now().UTC(),
+		Project:    project,
+		Members:    members,
+		Tasks:      tasks,
+	}, nil
+}
+
+// SendProjectExport handles the /export command: the project given as argument, the current
+// project without one, is sent as a JSON document
+func SendProjectExport(bot *tgbotapi.BotAPI, db *DB, chatID int64, userID int, arg string) {
+	var projectID int
+	if arg = strings.TrimPrefix(strings.TrimSpace(arg), "#"); arg != "" {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			SendReply(bot, chatID, "❌ Укажите номер проекта: /export 12")
+			return
+		}
+		projectID = id
+	} else {
+		project, err := db.GetCurrentProject(userID, chatID)
+		if err != nil {
+			log.Printf("❌ Error getting current project for user %d: %v", userID, err)
+			SendReply(bot, chatID, "❌ Не удалось определить текущий проект")
+			return
+		}
+		if project == nil {
+			SendReply(bot, chatID, "🤷 Текущий проект не выбран. Укажите номер проекта: /export 12")
+			return
+		}
+		projectID = project.ID
+	}
+
+	export, err := db.ExportProject(projectID, userID)
+	if err == ErrProjectAccessDenied {
+		SendReply(bot, chatID, fmt.Sprintf("❌ Проект #%d не найден среди ваших проектов", projectID))
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Error exporting project %d for user %d: %v", projectID, userID, err)
+		SendReply(bot, chatID, "❌ Не удалось выгрузить проект")
+		return
+	}
+
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		log.Printf("❌ Error marshalling export of project %d: %v", projectID, err)
+		SendReply(bot, chatID, "❌ Не удалось выгрузить проект")
+		return
+	}
+
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{
+		Name:  fmt.Sprintf("project-%d.json", projectID),
+		Bytes: data,
+	})
+	doc.Caption = fmt.Sprintf("📦 %s: задач %d, участников %d", export.Project.Title, len(export.Tasks), len(export.Members))
+	if _, err := bot.Send(doc); err != nil {
+		log.Printf("Failed to send export of project %d: %v", projectID, err)
+		SendReply(bot, chatID, "❌ Не удалось отправить файл")
+	}
+}
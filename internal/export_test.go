@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestExportProject(t *testing.T) {
+	db := openTestDB(t)
+	owner := createTestUser(t, db, "owner")
+	viewer := createTestUser(t, db, "viewer")
+	stranger := createTestUser(t, db, "stranger")
+
+	project, err := db.CreateProject(owner.ID, 0, "Экспорт", "Общий проект")
+	if err != nil {
+		t.Fatalf("CreateProject() error = %v", err)
+	}
+	if err := db.AddUserToProject(project.ID, viewer.ID, owner.ID, RoleViewer); err != nil {
+		t.Fatalf("AddUserToProject() error = %v", err)
+	}
+	task, err := db.CreateTask(project.ID, owner.ID, "Задача проекта", "", PriorityMedium, nil)
+	if err != nil {
+		t.Fatalf("CreateTask() error = %v", err)
+	}
+
+	// The owner's other project must not leak into the viewer's export
+	private, err := db.CreateProject(owner.ID, 0, "Личный", "")
+	if err != nil {
+		t.Fatalf("CreateProject() error = %v", err)
+	}
+	if _, err := db.CreateTask(private.ID, owner.ID, "Личная задача", "", PriorityMedium, nil); err != nil {
+		t.Fatalf("CreateTask() error = %v", err)
+	}
+
+	export, err := db.ExportProject(project.ID, viewer.ID)
+	if err != nil {
+		t.Fatalf("ExportProject() by a viewer error = %v", err)
+	}
+	if export.Version != ProjectExportVersion || export.Project.ID != project.ID {
+		t.Errorf("export version %d of project %d, want version %d of project %d", export.Version, export.Project.ID, ProjectExportVersion, project.ID)
+	}
+	if export.Project.UserRole != RoleViewer {
+		t.Errorf("exported role = %s, want the viewer's role", export.Project.UserRole)
+	}
+	if len(export.Tasks) != 1 || export.Tasks[0].ID != task.ID {
+		t.Errorf("exported tasks = %+v, want only task %d", export.Tasks, task.ID)
+	}
+	if len(export.Members) != 2 {
+		t.Errorf("exported %d members, want 2", len(export.Members))
+	}
+	for _, member := range export.Members {
+		if member.UserID == stranger.ID {
+			t.Errorf("export lists user %d who is not a member", stranger.ID)
+		}
+	}
+
+	data, err := json.Marshal(export)
+	if err != nil {
+		t.Fatalf("failed to marshal export: %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("export is not valid JSON: %v", err)
+	}
+	for _, key := range []string{"version", "exported_at", "project", "members", "tasks"} {
+		if _, ok := decoded[key]; !ok {
+			t.Errorf("export JSON has no %q", key)
+		}
+	}
+
+	if _, err := db.ExportProject(project.ID, stranger.ID); !errors.Is(err, ErrProjectAccessDenied) {
+		t.Errorf("ExportProject() by a non-member error = %v, want ErrProjectAccessDenied", err)
+	}
+}
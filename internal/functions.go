@@ -3,17 +3,20 @@ package internal
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
 	"io"
 	"log"
 	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/dop251/goja"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-	"github.com/sashabaranov/go-openai"
 )
 
 // PendingOperation represents an operation waiting for user confirmation
@@ -25,6 +28,7 @@ type PendingOperation struct {
 	Parameters  map[string]interface{} `json:"parameters"`
 	Description string                 `json:"description"`
 	CreatedAt   time.Time              `json:"created_at"`
+	MessageID   int                    `json:"message_id,omitempty"` // Confirmation message, 0 until it is sent
 }
 
 // OperationResult represents the result of executing an operation
@@ -35,18 +39,6 @@ type OperationResult struct {
 	ProjectName *string // For operations that involve projects
 }
 
-// PendingOperations stores pending operations in memory
-// In production, this should be stored in database
-var pendingOperations = make(map[string]*PendingOperation)
-
-// GetGPTFunctions returns all available functions for GPT
-
-// GetGPTFunctions returns all available functions for GPT
-// Now returns empty list since all responses are treated as JavaScript code
-func GetGPTFunctions() []openai.FunctionDefinition {
-	return []openai.FunctionDefinition{}
-}
-
 // generateOperationID generates a unique ID for the operation
 func generateOperationID() string {
 	return fmt.Sprintf("op_%d", time.Now().UnixNano())
@@ -67,9 +59,9 @@ func handleCreateProject(userID int, chatID int64, parameters map[string]interfa
 
 	var operationDesc string
 	if description != "" {
-		operationDesc = fmt.Sprintf("Создать проект '%s'\nОписание: %s", title, description)
+		operationDesc = fmt.Sprintf("Создать проект '%s'\nОписание: %s", html.EscapeString(title), html.EscapeString(description))
 	} else {
-		operationDesc = fmt.Sprintf("Создать проект '%s'", title)
+		operationDesc = fmt.Sprintf("Создать проект '%s'", html.EscapeString(title))
 	}
 
 	operation := &PendingOperation{
@@ -82,7 +74,7 @@ func handleCreateProject(userID int, chatID int64, parameters map[string]interfa
 		CreatedAt:   time.Now(),
 	}
 
-	pendingOperations[operation.ID] = operation
+	pendingOperations.Put(operation)
 	return operation, nil
 }
 
@@ -96,10 +88,10 @@ func handleUpdateProject(userID int, chatID int64, parameters map[string]interfa
 
 	var updates []string
 	if title, ok := parameters["title"].(string); ok {
-		updates = append(updates, fmt.Sprintf("название: '%s'", title))
+		updates = append(updates, fmt.Sprintf("название: '%s'", html.EscapeString(title)))
 	}
 	if description, ok := parameters["description"].(string); ok {
-		updates = append(updates, fmt.Sprintf("описание: '%s'", description))
+		updates = append(updates, fmt.Sprintf("описание: '%s'", html.EscapeString(description)))
 	}
 	if status, ok := parameters["status"].(string); ok {
 		updates = append(updates, fmt.Sprintf("статус: %s", status))
@@ -115,7 +107,7 @@ func handleUpdateProject(userID int, chatID int64, parameters map[string]interfa
 		CreatedAt:   time.Now(),
 	}
 
-	pendingOperations[operation.ID] = operation
+	pendingOperations.Put(operation)
 	return operation, nil
 }
 
@@ -137,7 +129,28 @@ func handleDeleteProject(userID int, chatID int64, parameters map[string]interfa
 		CreatedAt:   time.Now(),
 	}
 
-	pendingOperations[operation.ID] = operation
+	pendingOperations.Put(operation)
+	return operation, nil
+}
+
+// handleRestoreProject handles the restore project function call
+func handleRestoreProject(userID int, chatID int64, parameters map[string]interface{}) (*PendingOperation, error) {
+	projectID, ok := intParam(parameters, "project_id")
+	if !ok {
+		return nil, fmt.Errorf("invalid project_id parameter")
+	}
+
+	operation := &PendingOperation{
+		ID:          generateOperationID(),
+		UserID:      userID,
+		ChatID:      chatID,
+		Type:        "restore_project",
+		Parameters:  parameters,
+		Description: fmt.Sprintf("Восстановить удалённый проект #%d", projectID),
+		CreatedAt:   time.Now(),
+	}
+
+	pendingOperations.Put(operation)
 	return operation, nil
 }
 
@@ -150,9 +163,11 @@ func handleListProjects(userID int, chatID int64, parameters map[string]interfac
 
 // handleCreateTask handles the create task function call
 func handleCreateTask(userID int, chatID int64, parameters map[string]interface{}) (*PendingOperation, error) {
-	// Validate project_id parameter
-	if _, ok := parameters["project_id"].(float64); !ok {
-		return nil, fmt.Errorf("invalid project_id parameter")
+	// Validate project_id parameter, without one the user picks the project when confirming
+	if value, exists := parameters["project_id"]; exists {
+		if _, ok := value.(float64); !ok {
+			return nil, fmt.Errorf("invalid project_id parameter")
+		}
 	}
 
 	// Validate title parameter
@@ -161,8 +176,15 @@ func handleCreateTask(userID int, chatID int64, parameters map[string]interface{
 		return nil, fmt.Errorf("invalid title parameter")
 	}
 
+	// Reject an unparseable deadline before asking for confirmation
+	if deadlineStr, ok := parameters["deadline"].(string); ok {
+		if _, err := ParseTaskDeadline(deadlineStr, time.Now(), time.Local); err != nil {
+			return nil, err
+		}
+	}
+
 	// Create brief description for now, detailed description will be created in executeCreateTask
-	operationDesc := fmt.Sprintf("Создать задачу '%s'", title)
+	operationDesc := fmt.Sprintf("Создать задачу '%s'", html.EscapeString(title))
 
 	operation := &PendingOperation{
 		ID:          generateOperationID(),
@@ -174,10 +196,144 @@ func handleCreateTask(userID int, chatID int64, parameters map[string]interface{
 		CreatedAt:   time.Now(),
 	}
 
-	pendingOperations[operation.ID] = operation
+	pendingOperations.Put(operation)
 	return operation, nil
 }
 
+// resolveTaskProject picks the project of a task created without project_id: the current project,
+// otherwise the only open project of the user. Returns 0 when the user has to choose between several
+func resolveTaskProject(db *DB, userID int, chatID int64) (int, error) {
+	current, err := db.GetCurrentProject(userID, chatID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get current project: %v", err)
+	}
+	if current != nil {
+		return current.ID, nil
+	}
+
+	projects, err := taskProjectChoices(db, userID)
+	if err != nil {
+		return 0, err
+	}
+	projectID, err := onlyTaskProject(projects)
+	if projectID != 0 {
+		log.Printf("📁 No current project for user %d, using the only project %d", userID, projectID)
+	}
+	return projectID, err
+}
+
+// onlyTaskProject returns the ID of the only project a new task can go to, 0 when the user has
+// to choose between several and an error when there is none
+func onlyTaskProject(choices []*Project) (int, error) {
+	switch len(choices) {
+	case 0:
+		return 0, fmt.Errorf("user has no open projects to create tasks in, create a project first")
+	case 1:
+		return choices[0].ID, nil
+	}
+	return 0, nil
+}
+
+// maxTaskProjectChoices limits the project buttons of a task created without a project
+const maxTaskProjectChoices = 8
+
+// taskProjectChoices returns the user's open projects a new task can go to
+func taskProjectChoices(db *DB, userID int) ([]*Project, error) {
+	projects, err := db.GetUserProjects(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get projects: %v", err)
+	}
+	return filterTaskProjects(projects), nil
+}
+
+// filterTaskProjects keeps the open projects the user's role allows creating tasks in, at most
+// maxTaskProjectChoices of them
+func filterTaskProjects(projects []*Project) []*Project {
+	var choices []*Project
+	for _, project := range projects {
+		if project.Status == StatusCompleted || project.Status == StatusCancelled {
+			continue
+		}
+		if !functionAllowedFor("create_task", project.UserRole) {
+			continue
+		}
+		choices = append(choices, project)
+		if len(choices) == maxTaskProjectChoices {
+			break
+		}
+	}
+	return choices
+}
+
+// needsProjectChoice reports whether a pending task creation still waits for the user to pick a project
+func needsProjectChoice(operation *PendingOperation) bool {
+	if operation.Type != "create_task" {
+		return false
+	}
+	_, ok := intParam(operation.Parameters, "project_id")
+	return !ok
+}
+
+// taskProjectPrefix is the callback data prefix of the project buttons of a task created without
+// a project: taskproject_<projectID>_<operationID>
+const taskProjectPrefix = "taskproject_"
+
+// chooseTaskProject sets the project picked with a button on the pending task creation and returns
+// the callback data that confirms it, false if the choice is invalid and was already answered
+func chooseTaskProject(bot *tgbotapi.BotAPI, db *DB, query *tgbotapi.CallbackQuery) (string, bool) {
+	parts := strings.SplitN(strings.TrimPrefix(query.Data, taskProjectPrefix), "_", 2)
+	if len(parts) != 2 {
+		log.Printf("Invalid callback data format: %s", query.Data)
+		return "", false
+	}
+	projectID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		bot.Send(tgbotapi.NewCallback(query.ID, "Неизвестный проект"))
+		return "", false
+	}
+	operationID := parts[1]
+
+	// Read under the lock, another click may be picking a project for the same operation
+	var needsChoice bool
+	var ownerID int
+	exists := pendingOperations.Update(operationID, func(operation *PendingOperation) {
+		needsChoice = needsProjectChoice(operation)
+		ownerID = operation.UserID
+	})
+	if !exists || !needsChoice {
+		// The confirmation path reports expired and processed operations
+		return "confirm_" + operationID, true
+	}
+
+	user, err := getCallbackUser(db, query)
+	if err != nil {
+		log.Printf("Error getting user by TG ID %d: %v", query.From.ID, err)
+		bot.Send(tgbotapi.NewCallback(query.ID, "Ошибка при проверке пользователя"))
+		return "", false
+	}
+	if user.ID != ownerID {
+		bot.Send(tgbotapi.NewCallback(query.ID, "Вы не можете подтвердить эту операцию"))
+		return "", false
+	}
+
+	// Access was checked when the task was proposed without a project, check the chosen one
+	access := map[string]interface{}{"project_id": float64(projectID)}
+	if err := checkProjectAccess(db, user.ID, access, gptFunctions["create_task"]); err != nil {
+		log.Printf("⛔ User %d may not create tasks in project %d: %v", user.ID, projectID, err)
+		bot.Send(tgbotapi.NewCallback(query.ID, "У вас нет прав создавать задачи в этом проекте"))
+		return "", false
+	}
+
+	pendingOperations.Update(operationID, func(operation *PendingOperation) {
+		if needsProjectChoice(operation) {
+			operation.Parameters["project_id"] = access["project_id"]
+			operation.Parameters["user_role"] = access["user_role"]
+		}
+	})
+	log.Printf("📁 User %d picked project %d for operation %s", user.ID, projectID, operationID)
+	return "confirm_" + operationID, true
+}
+
 // handleListTasks handles the list tasks function call
 func handleListTasks(userID int, chatID int64, parameters map[string]interface{}) (*PendingOperation, error) {
 	// List tasks doesn't need confirmation, we'll handle it differently
@@ -194,10 +350,10 @@ func handleUpdateTask(userID int, chatID int64, parameters map[string]interface{
 
 	var updates []string
 	if title, ok := parameters["title"].(string); ok {
-		updates = append(updates, fmt.Sprintf("название: '%s'", title))
+		updates = append(updates, fmt.Sprintf("название: '%s'", html.EscapeString(title)))
 	}
 	if description, ok := parameters["description"].(string); ok {
-		updates = append(updates, fmt.Sprintf("описание: '%s'", description))
+		updates = append(updates, fmt.Sprintf("описание: '%s'", html.EscapeString(description)))
 	}
 	if status, ok := parameters["status"].(string); ok {
 		updates = append(updates, fmt.Sprintf("статус: %s", status))
@@ -205,6 +361,12 @@ func handleUpdateTask(userID int, chatID int64, parameters map[string]interface{
 	if priority, ok := parameters["priority"].(string); ok {
 		updates = append(updates, fmt.Sprintf("приоритет: %s", priority))
 	}
+	if deadlineStr, ok := parameters["deadline"].(string); ok && deadlineStr != "" {
+		if _, err := ParseTaskDeadline(deadlineStr, time.Now(), time.Local); err != nil {
+			return nil, err
+		}
+		updates = append(updates, fmt.Sprintf("дедлайн: %s", html.EscapeString(deadlineStr)))
+	}
 
 	operation := &PendingOperation{
 		ID:          generateOperationID(),
@@ -216,7 +378,7 @@ func handleUpdateTask(userID int, chatID int64, parameters map[string]interface{
 		CreatedAt:   time.Now(),
 	}
 
-	pendingOperations[operation.ID] = operation
+	pendingOperations.Put(operation)
 	return operation, nil
 }
 
@@ -238,12 +400,285 @@ func handleDeleteTask(userID int, chatID int64, parameters map[string]interface{
 		CreatedAt:   time.Now(),
 	}
 
-	pendingOperations[operation.ID] = operation
+	pendingOperations.Put(operation)
+	return operation, nil
+}
+
+// handleAddTaskDependency handles the add task dependency function call
+func handleAddTaskDependency(userID int, chatID int64, parameters map[string]interface{}) (*PendingOperation, error) {
+	taskIDFloat, ok := parameters["task_id"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("invalid task_id parameter")
+	}
+	dependsOnFloat, ok := parameters["depends_on_task_id"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("invalid depends_on_task_id parameter")
+	}
+	if taskIDFloat == dependsOnFloat {
+		return nil, fmt.Errorf("task cannot depend on itself")
+	}
+
+	operation := &PendingOperation{
+		ID:          generateOperationID(),
+		UserID:      userID,
+		ChatID:      chatID,
+		Type:        "add_task_dependency",
+		Parameters:  parameters,
+		Description: fmt.Sprintf("Задача #%d будет ждать выполнения задачи #%d", int(taskIDFloat), int(dependsOnFloat)),
+		CreatedAt:   time.Now(),
+	}
+
+	pendingOperations.Put(operation)
+	return operation, nil
+}
+
+// handleMoveTask handles the move task function call
+func handleMoveTask(userID int, chatID int64, parameters map[string]interface{}) (*PendingOperation, error) {
+	taskID, ok := intParam(parameters, "task_id")
+	if !ok {
+		return nil, fmt.Errorf("invalid task_id parameter")
+	}
+	newProjectID, ok := intParam(parameters, "new_project_id")
+	if !ok {
+		return nil, fmt.Errorf("invalid new_project_id parameter")
+	}
+
+	operation := &PendingOperation{
+		ID:          generateOperationID(),
+		UserID:      userID,
+		ChatID:      chatID,
+		Type:        "move_task",
+		Parameters:  parameters,
+		Description: fmt.Sprintf("Перенести задачу #%d в проект #%d", taskID, newProjectID),
+		CreatedAt:   time.Now(),
+	}
+
+	pendingOperations.Put(operation)
+	return operation, nil
+}
+
+// handleSetTaskDeadline handles the set task deadline function call. The deadline is parsed
+// again on execution in the user's timezone, here it is only checked to fail early
+func handleSetTaskDeadline(userID int, chatID int64, parameters map[string]interface{}) (*PendingOperation, error) {
+	taskID, ok := intParam(parameters, "task_id")
+	if !ok {
+		return nil, fmt.Errorf("invalid task_id parameter")
+	}
+	deadlineStr, _ := parameters["deadline"].(string)
+	deadline, err := ParseTaskDeadline(deadlineStr, time.Now(), time.Local)
+	if err != nil {
+		return nil, err
+	}
+
+	description := fmt.Sprintf("Установить дедлайн задачи #%d: %s", taskID, deadlineStr)
+	if deadline == nil {
+		description = fmt.Sprintf("Убрать дедлайн задачи #%d", taskID)
+	}
+
+	operation := &PendingOperation{
+		ID:          generateOperationID(),
+		UserID:      userID,
+		ChatID:      chatID,
+		Type:        "set_task_deadline",
+		Parameters:  parameters,
+		Description: description,
+		CreatedAt:   time.Now(),
+	}
+
+	pendingOperations.Put(operation)
+	return operation, nil
+}
+
+// handleSetTaskPriority handles the set task priority function call
+func handleSetTaskPriority(userID int, chatID int64, parameters map[string]interface{}) (*PendingOperation, error) {
+	taskID, ok := intParam(parameters, "task_id")
+	if !ok {
+		return nil, fmt.Errorf("invalid task_id parameter")
+	}
+	priorityStr, _ := parameters["priority"].(string)
+	priority, recognized := ParseTaskPriority(priorityStr)
+	if !recognized {
+		return nil, fmt.Errorf("unrecognized priority %q, use low, medium, high or urgent", priorityStr)
+	}
+	// Store the parsed value so execution doesn't depend on the free text
+	parameters["priority"] = string(priority)
+
+	operation := &PendingOperation{
+		ID:          generateOperationID(),
+		UserID:      userID,
+		ChatID:      chatID,
+		Type:        "set_task_priority",
+		Parameters:  parameters,
+		Description: fmt.Sprintf("Установить приоритет задачи #%d: %s %s", taskID, TaskPriorityEmoji(priority), priority),
+		CreatedAt:   time.Now(),
+	}
+
+	pendingOperations.Put(operation)
+	return operation, nil
+}
+
+// handleSetProjectDescription handles the set project description function call
+func handleSetProjectDescription(userID int, chatID int64, parameters map[string]interface{}) (*PendingOperation, error) {
+	projectID, ok := intParam(parameters, "project_id")
+	if !ok {
+		return nil, fmt.Errorf("invalid project_id parameter")
+	}
+	description, ok := parameters["description"].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid description parameter")
+	}
+	// Store the sanitized value so the confirmation shows what will be saved
+	description = sanitizeDescription(description)
+	parameters["description"] = description
+
+	operation := &PendingOperation{
+		ID:          generateOperationID(),
+		UserID:      userID,
+		ChatID:      chatID,
+		Type:        "set_project_description",
+		Parameters:  parameters,
+		Description: fmt.Sprintf("Изменить описание проекта #%d: '%s'", projectID, html.EscapeString(description)),
+		CreatedAt:   time.Now(),
+	}
+
+	pendingOperations.Put(operation)
+	return operation, nil
+}
+
+// handleShiftDeadlines handles the shift deadlines function call
+func handleShiftDeadlines(userID int, chatID int64, parameters map[string]interface{}) (*PendingOperation, error) {
+	projectID, ok := intParam(parameters, "project_id")
+	if !ok {
+		return nil, fmt.Errorf("invalid project_id parameter")
+	}
+	days, ok := intParam(parameters, "days")
+	if !ok || days == 0 {
+		return nil, fmt.Errorf("invalid days parameter")
+	}
+
+	description := fmt.Sprintf("Сдвинуть все дедлайны проекта #%d на %d дн. вперёд", projectID, days)
+	if days < 0 {
+		description = fmt.Sprintf("Сдвинуть все дедлайны проекта #%d на %d дн. назад", projectID, -days)
+	}
+
+	operation := &PendingOperation{
+		ID:          generateOperationID(),
+		UserID:      userID,
+		ChatID:      chatID,
+		Type:        "shift_deadlines",
+		Parameters:  parameters,
+		Description: description,
+		CreatedAt:   time.Now(),
+	}
+
+	pendingOperations.Put(operation)
 	return operation, nil
 }
 
+// previewableOperations are non-destructive operations that preview mode runs right away
+// after announcing them. Everything else (deletions, messages with buttons) still needs confirmation
+var previewableOperations = map[string]bool{
+	"create_project":          true,
+	"update_project":          true,
+	"create_task":             true,
+	"update_task":             true,
+	"add_task_dependency":     true,
+	"move_task":               true,
+	"set_task_deadline":       true,
+	"set_task_priority":       true,
+	"set_current_project":     true,
+	"set_project_description": true,
+	"restore_project":         true,
+}
+
+// RunPreviewedOperation announces a pending operation and executes it without confirmation.
+// Returns false if the operation is destructive and must go through confirmation buttons
+func RunPreviewedOperation(bot *tgbotapi.BotAPI, db *DB, operation *PendingOperation) bool {
+	if !previewableOperations[operation.Type] || needsProjectChoice(operation) {
+		return false
+	}
+
+	runAnnouncedOperation(bot, db, operation)
+	return true
+}
+
+// Project deletions below both thresholds are low-impact and run without confirmation.
+// A threshold of 0 makes every deletion need confirmation
+var (
+	confirmDeleteMinTasks   = 1
+	confirmDeleteMinMembers = 2
+)
+
+// SetDeleteConfirmationThresholds sets from how many tasks or members a project deletion needs
+// confirmation, negative values are ignored
+func SetDeleteConfirmationThresholds(minTasks, minMembers int) {
+	if minTasks >= 0 {
+		confirmDeleteMinTasks = minTasks
+	}
+	if minMembers >= 0 {
+		confirmDeleteMinMembers = minMembers
+	}
+}
+
+// RunLowImpactOperation announces and executes a project deletion without confirmation when the
+// project has fewer tasks and members than the thresholds, e.g. an empty project of one user.
+// Returns false if the operation must go through confirmation buttons
+func RunLowImpactOperation(bot *tgbotapi.BotAPI, db *DB, operation *PendingOperation) bool {
+	if operation.Type != "delete_project" {
+		return false
+	}
+	projectID, ok := intParam(operation.Parameters, "project_id")
+	if !ok {
+		return false
+	}
+
+	// Any error means the impact is unknown, confirmation is the safe choice
+	taskCount, err := db.GetProjectTaskCount(projectID)
+	if err != nil {
+		log.Printf("⚠️ Failed to count tasks of project %d, asking for confirmation: %v", projectID, err)
+		return false
+	}
+	members, err := db.GetProjectUsers(projectID)
+	if err != nil {
+		log.Printf("⚠️ Failed to get members of project %d, asking for confirmation: %v", projectID, err)
+		return false
+	}
+	if taskCount >= confirmDeleteMinTasks || len(members) >= confirmDeleteMinMembers {
+		return false
+	}
+
+	log.Printf("🪶 Deleting project %d without confirmation: %d tasks, %d members", projectID, taskCount, len(members))
+	runAnnouncedOperation(bot, db, operation)
+	return true
+}
+
+// runAnnouncedOperation tells the user what is about to happen, executes the operation and reports the result
+func runAnnouncedOperation(bot *tgbotapi.BotAPI, db *DB, operation *PendingOperation) {
+	pendingOperations.Delete(operation.ID)
+
+	SendReply(bot, operation.ChatID, fmt.Sprintf("🔍 Я собираюсь: %s", operation.Description))
+
+	result := executeOperation(db, operation)
+	var messageID int
+	if result.Success {
+		messageID = SendReply(bot, operation.ChatID, fmt.Sprintf("✅ %s", result.Message))
+	} else {
+		messageID = SendReply(bot, operation.ChatID, fmt.Sprintf("❌ %s", result.Message))
+	}
+
+	// Save result to conversation history
+	if err := db.SaveSentMessage(operation.UserID, operation.ChatID, "assistant", result.Message, messageID); err != nil {
+		log.Printf("Error saving previewed operation message: %v", err)
+	}
+}
+
 // CreateConfirmationMessage creates a message with confirmation buttons
 func CreateConfirmationMessage(db *DB, operation *PendingOperation) tgbotapi.MessageConfig {
+	// A task without a project is confirmed by picking one
+	if needsProjectChoice(operation) {
+		return createProjectChoiceMessage(db, operation)
+	}
+
 	// For create_task operations, build detailed description
 	description := operation.Description
 	if operation.Type == "create_task" {
@@ -265,6 +700,34 @@ func CreateConfirmationMessage(db *DB, operation *PendingOperation) tgbotapi.Mes
 	return msg
 }
 
+// createProjectChoiceMessage asks which project a task created without a project goes to,
+// one button per open project of the user
+func createProjectChoiceMessage(db *DB, operation *PendingOperation) tgbotapi.MessageConfig {
+	title, _ := operation.Parameters["title"].(string)
+
+	projects, err := taskProjectChoices(db, operation.UserID)
+	if err != nil {
+		log.Printf("❌ Failed to get project choices for user %d: %v", operation.UserID, err)
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, project := range projects {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(StatusEmoji(project.Status)+" "+project.Title,
+				fmt.Sprintf("%s%d_%s", taskProjectPrefix, project.ID, operation.ID)),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", fmt.Sprintf("cancel_%s", operation.ID)),
+	))
+
+	msg := tgbotapi.NewMessage(operation.ChatID,
+		fmt.Sprintf("📁 В какой проект добавить задачу <b>%s</b>?\n\nТекущий проект не выбран, выберите проект:", html.EscapeString(title)))
+	msg.ParseMode = tgbotapi.ModeHTML
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return msg
+}
+
 // buildDetailedTaskDescription builds detailed description for task creation
 func buildDetailedTaskDescription(db *DB, operation *PendingOperation) string {
 	title := operation.Parameters["title"].(string)
@@ -278,13 +741,13 @@ func buildDetailedTaskDescription(db *DB, operation *PendingOperation) string {
 	}
 
 	// Get priority (default to medium)
-	priority := "medium"
+	priority := PriorityMedium
 	if prio, ok := operation.Parameters["priority"].(string); ok {
-		priority = prio
+		priority, _ = ParseTaskPriority(prio)
 	}
 
 	// Build description
-	description := fmt.Sprintf("Создать задачу '%s'\n📁 Проект: %s\n⚡ Приоритет: %s", title, projectName, priority)
+	description := fmt.Sprintf("Создать задачу '%s'\n📁 Проект: %s\n⚡ Приоритет: %s", html.EscapeString(title), html.EscapeString(projectName), priority)
 
 	// Add deadline if specified
 	if deadlineStr, ok := operation.Parameters["deadline"].(string); ok && deadlineStr != "" {
@@ -306,66 +769,126 @@ func HandleCallbackQuery(bot *tgbotapi.BotAPI, db *DB, query *tgbotapi.CallbackQ
 	data := query.Data
 	log.Printf("🔘 CALLBACK QUERY: '%s' from user %d", data, query.From.ID)
 
-	// Handle special create project button
-	if data == "create_project_button" {
-		log.Printf("🆕 CREATE PROJECT BUTTON clicked by user %d", query.From.ID)
-		// Edit the original message to remove the button and show instruction
+	// Handle onboarding buttons of the welcome message
+	if isWelcomeActionData(data) {
+		HandleWelcomeActionCallback(bot, query)
+		return
+	}
+
+	// Handle add task button shown after project creation
+	if data == "add_task_button" {
+		log.Printf("📝 ADD TASK BUTTON clicked by user %d", query.From.ID)
 		editMsg := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID,
-			"📋 У вас пока нет проектов\n\n💡 Для создания проекта отправьте сообщение в формате:\n\"Создать проект [название]\" или \"Создать проект [название] с описанием [описание]\"")
+			"📝 Добавим первую задачу\n\n💡 Отправьте сообщение в формате:\n\"Создать задачу [название]\" или \"Создать задачу [название] до [дедлайн]\"")
 		editMsg.ParseMode = tgbotapi.ModeHTML // Enable HTML formatting
 		editMsg.ReplyMarkup = nil
 		bot.Send(editMsg)
-		bot.Send(tgbotapi.NewCallback(query.ID, "Отправьте название проекта!"))
+		bot.Send(tgbotapi.NewCallback(query.ID, "Отправьте название задачи!"))
+		return
+	}
+
+	// A project picked for a task created without one confirms the task creation
+	if strings.HasPrefix(data, taskProjectPrefix) {
+		var ok bool
+		if data, ok = chooseTaskProject(bot, db, query); !ok {
+			return
+		}
+	}
+
+	// Handle /settings buttons
+	if strings.HasPrefix(data, settingsPrefix) {
+		HandleSettingsCallback(bot, db, query)
+		return
+	}
+
+	// Handle task attachment buttons
+	if strings.HasPrefix(data, attachPrefix) {
+		HandleAttachmentCallback(bot, db, query)
+		return
+	}
+
+	// Handle /recent quick-switch buttons
+	if strings.HasPrefix(data, recentProjectPrefix) {
+		HandleRecentProjectCallback(bot, db, query)
 		return
 	}
 
 	// Handle suggested project name buttons
-	if strings.HasPrefix(data, "suggest_project_") {
-		projectName := strings.TrimPrefix(data, "suggest_project_")
+	if strings.HasPrefix(data, suggestProjectPrefix) {
+		projectName := strings.TrimPrefix(data, suggestProjectPrefix)
 
 		// Get user from database
-		user, err := db.GetUserByTgID(query.From.ID)
+		user, err := getCallbackUser(db, query)
 		if err != nil {
 			log.Printf("Error getting user by TG ID %d: %v", query.From.ID, err)
 			bot.Send(tgbotapi.NewCallback(query.ID, "Ошибка при создании проекта"))
 			return
 		}
-		if user == nil {
-			log.Printf("User not found for TG ID %d", query.From.ID)
-			bot.Send(tgbotapi.NewCallback(query.ID, "Пользователь не найден"))
+
+		// A second tap arrives before the first one removed the buttons
+		key := creationKey(user.ID, "project", 0, projectName)
+		if !claimCreation(key) {
+			log.Printf("⚠️ Skipping repeated creation of suggested project '%s' for user %d", projectName, user.ID)
+			bot.Send(tgbotapi.NewCallback(query.ID, "Проект уже создан, такой же можно создать через 30 секунд"))
 			return
 		}
 
 		// Create project directly (since it's a quick suggestion)
-		_, err = db.CreateProject(user.ID, projectName, "")
-		if err != nil {
+		previous := findUserProjectByTitle(db, user.ID, projectName)
+		project, err := db.CreateProject(user.ID, query.Message.Chat.ID, projectName, "")
+		if err != nil || project == nil {
+			// The transaction may have been committed even if reading the project back failed
+			existing := findUserProjectByTitle(db, user.ID, projectName)
+			if existing != nil && (previous == nil || existing.ID > previous.ID) {
+				log.Printf("⚠️ Suggested project '%s' was created despite error: %v", projectName, err)
+				project = existing
+				err = nil
+			}
+		}
+		if err != nil || project == nil {
+			releaseCreation(key)
 			log.Printf("Error creating suggested project: %v", err)
 			bot.Send(tgbotapi.NewCallback(query.ID, "Ошибка при создании проекта"))
 
 			// Edit message to show error
 			editMsg := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID,
-				fmt.Sprintf("❌ Ошибка при создании проекта '%s': %v", projectName, err))
+				fmt.Sprintf("❌ Ошибка при создании проекта '%s': %v", html.EscapeString(projectName), err))
 			editMsg.ParseMode = tgbotapi.ModeHTML // Enable HTML formatting
 			editMsg.ReplyMarkup = nil
 			bot.Send(editMsg)
 			return
 		}
 
-		// Success - edit message and save to history
-		successMsg := fmt.Sprintf("✅ Проект '%s' успешно создан!\nМожно добавить в него участников, а также добавлять задачи в этот проект я прослежу чтобы задачи были выполнены.", projectName)
+		// CreateProject only logs a failure to switch the current project, so make sure it is set
+		madeCurrent := true
+		current, err := db.GetCurrentProject(user.ID, query.Message.Chat.ID)
+		if err != nil || current == nil || current.ID != project.ID {
+			if err := db.SetCurrentProject(user.ID, query.Message.Chat.ID, project.ID); err != nil {
+				log.Printf("Error setting current project %d for user %d: %v", project.ID, user.ID, err)
+				madeCurrent = false
+			}
+		}
+
+		// Success - show project card with next steps and save to history
+		successMsg := projectCreatedMessage(project, madeCurrent)
 		editMsg := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, successMsg)
 		editMsg.ParseMode = tgbotapi.ModeHTML // Enable HTML formatting
-		editMsg.ReplyMarkup = nil
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("📝 Добавить первую задачу", "add_task_button"),
+			),
+		)
+		editMsg.ReplyMarkup = &keyboard
 		bot.Send(editMsg)
 		bot.Send(tgbotapi.NewCallback(query.ID, "Проект создан!"))
 
 		// Save success message to conversation history
-		if err := db.SaveMessage(user.ID, query.Message.Chat.ID, "assistant", successMsg); err != nil {
+		if err := db.SaveSentMessage(user.ID, query.Message.Chat.ID, "assistant", successMsg, query.Message.MessageID); err != nil {
 			log.Printf("Error saving project creation message: %v", err)
 		}
 
 		// Cleanup old messages (keep last 50)
-		if err := db.CleanupOldMessages(query.Message.Chat.ID, 50); err != nil {
+		if err := db.MaybeCleanupOldMessages(query.Message.Chat.ID, 50); err != nil {
 			log.Printf("Error cleaning up old messages: %v", err)
 		}
 
@@ -374,22 +897,17 @@ func HandleCallbackQuery(bot *tgbotapi.BotAPI, db *DB, query *tgbotapi.CallbackQ
 	}
 
 	// Handle custom buttons
-	if strings.HasPrefix(data, "custom_button_") {
-		action := strings.TrimPrefix(data, "custom_button_")
+	if strings.HasPrefix(data, customButtonPrefix) {
+		action := strings.TrimPrefix(data, customButtonPrefix)
 		log.Printf("🔘 CUSTOM BUTTON pressed by user %d: %s", query.From.ID, action)
 
 		// Get user from database
-		user, err := db.GetUserByTgID(query.From.ID)
+		user, err := getCallbackUser(db, query)
 		if err != nil {
 			log.Printf("Error getting user by TG ID %d: %v", query.From.ID, err)
 			bot.Send(tgbotapi.NewCallback(query.ID, "Ошибка при получении пользователя"))
 			return
 		}
-		if user == nil {
-			log.Printf("User not found for TG ID %d", query.From.ID)
-			bot.Send(tgbotapi.NewCallback(query.ID, "Пользователь не найден"))
-			return
-		}
 
 		// Save button action as user message to conversation history
 		// This way GPT will see the button press in context
@@ -397,8 +915,12 @@ func HandleCallbackQuery(bot *tgbotapi.BotAPI, db *DB, query *tgbotapi.CallbackQ
 			log.Printf("Error saving button action message: %v", err)
 		}
 
+		// The choice is made, remove the buttons so they aren't pressed twice
+		bot.Send(tgbotapi.NewEditMessageReplyMarkup(query.Message.Chat.ID, query.Message.MessageID,
+			tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}))
+
 		// Answer the callback query
-		bot.Send(tgbotapi.NewCallback(query.ID, ""))
+		bot.Send(tgbotapi.NewCallback(query.ID, "👉 "+action))
 
 		log.Printf("✅ Custom button action '%s' saved as user message for user %d", action, user.ID)
 		return
@@ -422,25 +944,25 @@ func HandleCallbackQuery(bot *tgbotapi.BotAPI, db *DB, query *tgbotapi.CallbackQ
 	log.Printf("Callback received: action=%s, operationID=%s", action, operationID)
 
 	// Get pending operation
-	operation, exists := pendingOperations[operationID]
+	operation, exists := pendingOperations.Get(operationID)
 	if !exists {
+		if isPendingOperationExpired(operationID) {
+			log.Printf("⌛ Pending operation %s expired", operationID)
+			bot.Send(tgbotapi.NewCallback(query.ID, "Срок истёк, повторите запрос"))
+			return
+		}
 		log.Printf("❌ Pending operation %s not found or already processed", operationID)
 		bot.Send(tgbotapi.NewCallback(query.ID, "Операция не найдена или уже выполнена"))
 		return
 	}
 
 	// Check if user has permission
-	user, err := db.GetUserByTgID(query.From.ID)
+	user, err := getCallbackUser(db, query)
 	if err != nil {
 		log.Printf("Error getting user by TG ID %d: %v", query.From.ID, err)
 		bot.Send(tgbotapi.NewCallback(query.ID, "Ошибка при проверке пользователя"))
 		return
 	}
-	if user == nil {
-		log.Printf("User not found for TG ID %d", query.From.ID)
-		bot.Send(tgbotapi.NewCallback(query.ID, "Пользователь не найден"))
-		return
-	}
 	if user.ID != operation.UserID {
 		log.Printf("Permission denied: user.ID=%d, operation.UserID=%d", user.ID, operation.UserID)
 		bot.Send(tgbotapi.NewCallback(query.ID, "Вы не можете подтвердить эту операцию"))
@@ -449,24 +971,38 @@ func HandleCallbackQuery(bot *tgbotapi.BotAPI, db *DB, query *tgbotapi.CallbackQ
 
 	log.Printf("User %s (ID=%d) processing operation %s with action '%s'", user.TgName, user.ID, operationID, action)
 
-	// Delete the operation from pending
-	delete(pendingOperations, operationID)
+	notice := resolvePendingOperation(bot, db, operation, action, query.Message.Chat.ID, query.Message.MessageID, query.Message.Text)
+	if notice != "" {
+		bot.Send(tgbotapi.NewCallback(query.ID, notice))
+	}
+}
+
+// resolvePendingOperation confirms or cancels a pending operation from its confirmation message,
+// replacing the message with the outcome. text is kept for unknown actions.
+// Returns the short notice for the user, empty for unknown actions
+func resolvePendingOperation(bot *tgbotapi.BotAPI, db *DB, operation *PendingOperation, action string, chatID int64, messageID int, text string) string {
+	// Taking the operation out makes sure it is resolved once, by a button or a reaction
+	if _, taken := pendingOperations.Take(operation.ID); !taken {
+		log.Printf("❌ Pending operation %s was already processed", operation.ID)
+		return "Операция не найдена или уже выполнена"
+	}
 
 	// Edit the original message to remove buttons
-	editMsg := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, query.Message.Text)
+	editMsg := tgbotapi.NewEditMessageText(chatID, messageID, text)
 	editMsg.ParseMode = tgbotapi.ModeHTML // Enable HTML formatting
 
 	log.Printf("Processing action: '%s' (should be 'confirm' or 'cancel')", action)
 
+	notice := ""
 	if action == "confirm" {
-		log.Printf("✅ CONFIRMING OPERATION: %s for user %d", operation.Type, user.ID)
+		log.Printf("✅ CONFIRMING OPERATION: %s for user %d", operation.Type, operation.UserID)
 		// Execute the operation
 		result := executeOperation(db, operation)
 		if result.Success {
 			// Handle special case for send_message_with_buttons
 			if operation.Type == "send_message_with_buttons" {
-				buttons := operation.Parameters["buttons"].([]interface{})
-				if err := SendMessageWithCustomButtons(bot, query.Message.Chat.ID, result.Message, buttons); err != nil {
+				_, buttons, _ := parseMessageButtons(operation.Parameters)
+				if _, err := SendMessageWithCustomButtons(bot, chatID, result.Message, buttons); err != nil {
 					log.Printf("Error sending message with custom buttons: %v", err)
 					editMsg.Text = fmt.Sprintf("❌ Ошибка при отправке сообщения с кнопками: %v", err)
 				} else {
@@ -475,50 +1011,51 @@ func HandleCallbackQuery(bot *tgbotapi.BotAPI, db *DB, query *tgbotapi.CallbackQ
 			} else {
 				editMsg.Text = fmt.Sprintf("✅ %s", result.Message)
 			}
-			bot.Send(tgbotapi.NewCallback(query.ID, "Операция выполнена!"))
+			notice = "Операция выполнена!"
 
 			// Save success message to conversation history
-			if err := db.SaveMessage(operation.UserID, operation.ChatID, "assistant", result.Message); err != nil {
+			if err := db.SaveSentMessage(operation.UserID, operation.ChatID, "assistant", result.Message, messageID); err != nil {
 				log.Printf("Error saving operation success message: %v", err)
 			}
 
 			// Cleanup old messages (keep last 50)
-			if err := db.CleanupOldMessages(operation.ChatID, 50); err != nil {
+			if err := db.MaybeCleanupOldMessages(operation.ChatID, 50); err != nil {
 				log.Printf("Error cleaning up old messages: %v", err)
 			}
 		} else {
 			editMsg.Text = fmt.Sprintf("❌ %s", result.Message)
-			bot.Send(tgbotapi.NewCallback(query.ID, "Ошибка выполнения операции"))
+			notice = "Ошибка выполнения операции"
 
 			// Save error message to conversation history
-			if err := db.SaveMessage(operation.UserID, operation.ChatID, "assistant", result.Message); err != nil {
+			if err := db.SaveSentMessage(operation.UserID, operation.ChatID, "assistant", result.Message, messageID); err != nil {
 				log.Printf("Error saving operation error message: %v", err)
 			}
 
 			// Cleanup old messages (keep last 50)
-			if err := db.CleanupOldMessages(operation.ChatID, 50); err != nil {
+			if err := db.MaybeCleanupOldMessages(operation.ChatID, 50); err != nil {
 				log.Printf("Error cleaning up old messages: %v", err)
 			}
 		}
 	} else if action == "cancel" {
-		log.Printf("❌ CANCELLING OPERATION: %s for user %d", operation.Type, user.ID)
+		log.Printf("❌ CANCELLING OPERATION: %s for user %d", operation.Type, operation.UserID)
 		cancelMessage := "Операция отменена"
 		editMsg.Text = fmt.Sprintf("%s\n\n❌ %s", operation.Description, cancelMessage)
-		bot.Send(tgbotapi.NewCallback(query.ID, "Операция отменена"))
+		notice = "Операция отменена"
 
 		// Save cancellation message to conversation history
-		if err := db.SaveMessage(operation.UserID, operation.ChatID, "assistant", cancelMessage); err != nil {
+		if err := db.SaveSentMessage(operation.UserID, operation.ChatID, "assistant", cancelMessage, messageID); err != nil {
 			log.Printf("Error saving operation cancellation message: %v", err)
 		}
 
 		// Cleanup old messages (keep last 50)
-		if err := db.CleanupOldMessages(operation.ChatID, 50); err != nil {
+		if err := db.MaybeCleanupOldMessages(operation.ChatID, 50); err != nil {
 			log.Printf("Error cleaning up old messages: %v", err)
 		}
 	}
 
 	editMsg.ReplyMarkup = nil
 	bot.Send(editMsg)
+	return notice
 }
 
 // executeOperation executes the confirmed operation
@@ -532,12 +1069,26 @@ func executeOperation(db *DB, operation *PendingOperation) *OperationResult {
 		return executeUpdateProject(db, operation)
 	case "delete_project":
 		return executeDeleteProject(db, operation)
+	case "restore_project":
+		return executeRestoreProject(db, operation)
 	case "create_task":
 		return executeCreateTask(db, operation)
 	case "update_task":
 		return executeUpdateTask(db, operation)
 	case "delete_task":
 		return executeDeleteTask(db, operation)
+	case "add_task_dependency":
+		return executeAddTaskDependency(db, operation)
+	case "move_task":
+		return executeMoveTask(db, operation)
+	case "shift_deadlines":
+		return executeShiftDeadlines(db, operation)
+	case "set_task_deadline":
+		return executeSetTaskDeadline(db, operation)
+	case "set_task_priority":
+		return executeSetTaskPriority(db, operation)
+	case "set_project_description":
+		return executeSetProjectDescription(db, operation)
 	case "set_current_project":
 		return executeSetCurrentProject(db, operation)
 	case "send_message_with_buttons":
@@ -564,8 +1115,21 @@ func executeCreateProject(db *DB, operation *PendingOperation) *OperationResult
 		description = desc
 	}
 
-	_, err := db.CreateProject(operation.UserID, title, description)
+	// Status is optional, the configured default is used without it
+	status, _ := operation.Parameters["status"].(string)
+
+	key := creationKey(operation.UserID, "project", 0, title)
+	if !claimCreation(key) {
+		log.Printf("⚠️ Skipping repeated creation of project '%s' for user %d", title, operation.UserID)
+		return &OperationResult{
+			Success: false,
+			Message: fmt.Sprintf("Проект '%s' только что создан. Если нужен ещё один с тем же названием, повторите через 30 секунд", html.EscapeString(title)),
+		}
+	}
+
+	project, err := db.CreateProjectWithStatus(operation.UserID, operation.ChatID, title, description, ProjectStatus(status))
 	if err != nil {
+		releaseCreation(key)
 		log.Printf("❌ Failed to create project '%s' for user %d: %v", title, operation.UserID, err)
 		return &OperationResult{
 			Success: false,
@@ -573,10 +1137,15 @@ func executeCreateProject(db *DB, operation *PendingOperation) *OperationResult
 		}
 	}
 
+	// CreateProject makes the project current in the private chat, a group chat switches to it too
+	if err := db.SetCurrentProject(operation.UserID, operation.ChatID, project.ID); err != nil {
+		log.Printf("Warning: failed to set current project %d for user %d in chat %d: %v", project.ID, operation.UserID, operation.ChatID, err)
+	}
+
 	log.Printf("✅ Successfully created project '%s' for user %d", title, operation.UserID)
 	return &OperationResult{
 		Success: true,
-		Message: fmt.Sprintf("Проект '%s' успешно создан!", title),
+		Message: fmt.Sprintf("Проект '%s' успешно создан!", html.EscapeString(title)),
 	}
 }
 
@@ -585,7 +1154,17 @@ func executeUpdateProject(db *DB, operation *PendingOperation) *OperationResult
 	projectID := int(operation.Parameters["project_id"].(float64))
 	log.Printf("✏️ EXECUTING UPDATE_PROJECT: project %d for user %d", projectID, operation.UserID)
 
-	var title, description, status string
+	project, err := db.GetProjectByIDForUser(projectID, operation.UserID)
+	if err != nil || project == nil {
+		log.Printf("❌ Failed to get project %d for user %d: %v", projectID, operation.UserID, err)
+		return &OperationResult{
+			Success: false,
+			Message: "Проект не найден",
+		}
+	}
+
+	// Update fields if provided, otherwise keep current values
+	title, description, status := project.Title, project.Description, string(project.Status)
 	if t, ok := operation.Parameters["title"].(string); ok {
 		title = t
 	}
@@ -596,7 +1175,7 @@ func executeUpdateProject(db *DB, operation *PendingOperation) *OperationResult
 		status = s
 	}
 
-	err := db.UpdateProject(projectID, operation.UserID, title, description, ProjectStatus(status))
+	err = db.UpdateProject(projectID, operation.UserID, title, description, ProjectStatus(status))
 	if err != nil {
 		log.Printf("❌ Failed to update project %d for user %d: %v", projectID, operation.UserID, err)
 		return &OperationResult{
@@ -629,13 +1208,40 @@ func executeDeleteProject(db *DB, operation *PendingOperation) *OperationResult
 	log.Printf("✅ Successfully deleted project %d for user %d", projectID, operation.UserID)
 	return &OperationResult{
 		Success: true,
-		Message: fmt.Sprintf("Проект #%d успешно удален!", projectID),
+		Message: fmt.Sprintf("Проект #%d успешно удален! Передумали - отправьте /undo", projectID),
+	}
+}
+
+// executeRestoreProject executes the restore project operation
+func executeRestoreProject(db *DB, operation *PendingOperation) *OperationResult {
+	projectID, _ := intParam(operation.Parameters, "project_id")
+	log.Printf("♻️ EXECUTING RESTORE_PROJECT: project %d for user %d", projectID, operation.UserID)
+
+	if err := db.RestoreProject(projectID, operation.UserID); err != nil {
+		log.Printf("❌ Failed to restore project %d for user %d: %v", projectID, operation.UserID, err)
+		return &OperationResult{
+			Success: false,
+			Message: fmt.Sprintf("Ошибка при восстановлении проекта: %v", err),
+		}
+	}
+
+	log.Printf("✅ Successfully restored project %d for user %d", projectID, operation.UserID)
+	return &OperationResult{
+		Success:   true,
+		Message:   fmt.Sprintf("Проект #%d восстановлен вместе с задачами", projectID),
+		ProjectID: &projectID,
 	}
 }
 
 // executeCreateTask executes the create task operation
 func executeCreateTask(db *DB, operation *PendingOperation) *OperationResult {
-	projectID := int(operation.Parameters["project_id"].(float64))
+	projectID, ok := intParam(operation.Parameters, "project_id")
+	if !ok {
+		return &OperationResult{
+			Success: false,
+			Message: "Не выбран проект для задачи",
+		}
+	}
 	title := operation.Parameters["title"].(string)
 	log.Printf("📝 EXECUTING CREATE_TASK: '%s' in project %d for user %d", title, projectID, operation.UserID)
 
@@ -650,9 +1256,13 @@ func executeCreateTask(db *DB, operation *PendingOperation) *OperationResult {
 	}
 	if project == nil {
 		log.Printf("❌ Project %d not found for user %d", projectID, operation.UserID)
+		message := fmt.Sprintf("Проект #%d не существует. Выберите один из ваших проектов", projectID)
+		if exists, err := db.ProjectExists(projectID); err == nil && exists {
+			message = fmt.Sprintf("У вас нет доступа к проекту #%d. Выберите один из ваших проектов", projectID)
+		}
 		return &OperationResult{
 			Success: false,
-			Message: "Проект не найден",
+			Message: message,
 		}
 	}
 
@@ -665,20 +1275,38 @@ func executeCreateTask(db *DB, operation *PendingOperation) *OperationResult {
 	// Priority is optional, default to medium
 	priority := PriorityMedium
 	if prio, ok := operation.Parameters["priority"].(string); ok {
-		priority = TaskPriority(prio)
+		var recognized bool
+		if priority, recognized = ParseTaskPriority(prio); !recognized {
+			log.Printf("⚠️ Unrecognized priority '%s', using medium", prio)
+		}
 	}
 
-	// Deadline is optional
+	// Deadline is optional, "нет" means none like an empty one
 	var deadline *time.Time
 	if deadlineStr, ok := operation.Parameters["deadline"].(string); ok && deadlineStr != "" {
-		if t, err := time.Parse("2006-01-02 15:04", deadlineStr); err == nil {
-			deadline = &t
+		deadline, err = parseUserDeadline(db, operation.UserID, deadlineStr)
+		if err != nil {
+			log.Printf("❌ Invalid deadline '%s' for new task: %v", deadlineStr, err)
+			return &OperationResult{
+				Success: false,
+				Message: fmt.Sprintf("Не удалось разобрать дедлайн: %v", err),
+			}
+		}
+	}
+
+	key := creationKey(operation.UserID, "task", projectID, title)
+	if !claimCreation(key) {
+		log.Printf("⚠️ Skipping repeated creation of task '%s' in project %d for user %d", title, projectID, operation.UserID)
+		return &OperationResult{
+			Success: false,
+			Message: fmt.Sprintf("Задача '%s' только что создана в проекте %s. Если нужна ещё одна с тем же названием, повторите через 30 секунд", html.EscapeString(title), html.EscapeString(project.Title)),
 		}
 	}
 
 	// Create task
 	_, err = db.CreateTask(projectID, operation.UserID, title, description, priority, deadline)
 	if err != nil {
+		releaseCreation(key)
 		log.Printf("❌ Failed to create task '%s' in project %d for user %d: %v", title, projectID, operation.UserID, err)
 		return &OperationResult{
 			Success: false,
@@ -689,8 +1317,8 @@ func executeCreateTask(db *DB, operation *PendingOperation) *OperationResult {
 	log.Printf("✅ Successfully created task '%s' in project '%s' (ID: %d) for user %d", title, project.Title, projectID, operation.UserID)
 
 	// Build detailed success message
-	message := fmt.Sprintf("✅ Задача '%s' успешно создана!\n", title)
-	message += fmt.Sprintf("📁 Проект: %s\n", project.Title)
+	message := fmt.Sprintf("✅ Задача '%s' успешно создана!\n", html.EscapeString(title))
+	message += fmt.Sprintf("📁 Проект: %s\n", html.EscapeString(project.Title))
 	message += fmt.Sprintf("⚡ Приоритет: %s\n", priority)
 
 	if deadline != nil {
@@ -706,24 +1334,49 @@ func executeCreateTask(db *DB, operation *PendingOperation) *OperationResult {
 }
 
 // executeListTasks executes list tasks directly (no confirmation needed)
-func executeListTasks(db *DB, userID int, parameters map[string]interface{}) (string, error) {
+func executeListTasks(db *DB, userID int, chatID int64, parameters map[string]interface{}) (string, error) {
 	log.Printf("📝 EXECUTING LIST_TASKS for user %d with params: %v", userID, parameters)
 
 	var tasks []*Task
 	var err error
+	projectScoped := false // all tasks of one project were requested, so an empty list means an empty project
+	viewedProjectID := 0   // project whose task list the user sees, clears its new activity badge
 
 	// Check if project ID filter is provided
-	if projectIDFloat, ok := parameters["project_id"].(float64); ok {
+	if currentOnly, ok := parameters["current_project"].(bool); ok && currentOnly {
+		projectScoped = true
+		log.Printf("📝 Filtering tasks by current project")
+		tasks, err = db.GetCurrentProjectTasks(userID, chatID)
+		if len(tasks) > 0 {
+			viewedProjectID = tasks[0].ProjectID
+		}
+	} else if projectIDFloat, ok := parameters["project_id"].(float64); ok {
 		projectID := int(projectIDFloat)
-		log.Printf("📝 Filtering tasks by project ID: %d", projectID)
-		tasks, err = db.GetProjectTasks(projectID, userID)
+		if days, ok := intParam(parameters, "due_within_days"); ok {
+			log.Printf("📝 Filtering tasks of project %d due within %d days", projectID, days)
+			tasks, err = db.GetProjectTasksWithDeadline(projectID, userID, days)
+		} else {
+			projectScoped = true
+			order := TaskOrderCreated
+			if orderStr, ok := parameters["order"].(string); ok && orderStr != "" {
+				order = TaskOrder(orderStr)
+			}
+			log.Printf("📝 Filtering tasks by project ID: %d, order: %s", projectID, order)
+			tasks, err = db.GetProjectTasksOrdered(projectID, userID, order)
+			viewedProjectID = projectID
+		}
 	} else if statusStr, ok := parameters["status"].(string); ok {
 		log.Printf("📝 Filtering tasks by status: %s", statusStr)
 		status := TaskStatus(statusStr)
-		tasks, err = db.GetTasksByStatus(userID, status)
+		if orderStr, ok := parameters["order"].(string); ok && orderStr != "" {
+			tasks, err = db.GetTasksByStatusOrdered(userID, status, TaskOrder(orderStr))
+		} else {
+			tasks, err = db.GetTasksByStatus(userID, status)
+		}
 	} else {
-		log.Printf("📝 Getting all tasks for user")
-		tasks, err = db.GetUserTasks(userID)
+		activeOnly, _ := parameters["active_projects_only"].(bool)
+		log.Printf("📝 Getting all tasks for user, active projects only: %v", activeOnly)
+		tasks, err = db.GetUserTasksFiltered(userID, activeOnly)
 	}
 
 	if err != nil {
@@ -732,6 +1385,14 @@ func executeListTasks(db *DB, userID int, parameters map[string]interface{}) (st
 	}
 
 	log.Printf("✅ Found %d tasks for user %d", len(tasks), userID)
+	if viewedProjectID != 0 {
+		if err := db.MarkProjectViewed(viewedProjectID, userID); err != nil {
+			log.Printf("⚠️ %v", err)
+		}
+	}
+	if tasks == nil {
+		tasks = []*Task{} // Marshal as [] so scripts get an empty array, not null
+	}
 
 	// Return JSON data for GPT to format
 	result := map[string]interface{}{
@@ -740,6 +1401,13 @@ func executeListTasks(db *DB, userID int, parameters map[string]interface{}) (st
 		"filters": parameters,
 	}
 
+	// An accessible project without tasks, same as the empty projects list suggest creating the first one.
+	// Missing access is an error above, never an empty list
+	if len(tasks) == 0 && projectScoped {
+		result["empty_project"] = true
+		result["next_action"] = NoTasksHint
+	}
+
 	jsonData, err := json.Marshal(result)
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal tasks data: %v", err)
@@ -748,40 +1416,6 @@ func executeListTasks(db *DB, userID int, parameters map[string]interface{}) (st
 	return string(jsonData), nil
 }
 
-// getTaskStatusEmoji returns emoji for task status
-func getTaskStatusEmoji(status TaskStatus) string {
-	switch status {
-	case TaskTodo:
-		return "📝"
-	case TaskInProgress:
-		return "🚀"
-	case TaskReview:
-		return "👀"
-	case TaskDone:
-		return "✅"
-	case TaskCancelled:
-		return "❌"
-	default:
-		return "❓"
-	}
-}
-
-// getPriorityEmoji returns emoji for task priority
-func getPriorityEmoji(priority TaskPriority) string {
-	switch priority {
-	case PriorityLow:
-		return "🟢"
-	case PriorityMedium:
-		return "🟡"
-	case PriorityHigh:
-		return "🟠"
-	case PriorityUrgent:
-		return "🔴"
-	default:
-		return "⚪"
-	}
-}
-
 // executeUpdateTask executes the update task operation
 func executeUpdateTask(db *DB, operation *PendingOperation) *OperationResult {
 	taskID := int(operation.Parameters["task_id"].(float64))
@@ -821,11 +1455,21 @@ func executeUpdateTask(db *DB, operation *PendingOperation) *OperationResult {
 		status = TaskStatus(newStatus)
 	}
 	if newPriority, ok := operation.Parameters["priority"].(string); ok {
-		priority = TaskPriority(newPriority)
+		if parsed, recognized := ParseTaskPriority(newPriority); recognized {
+			priority = parsed
+		} else {
+			log.Printf("⚠️ Unrecognized priority '%s', keeping %s", newPriority, priority)
+		}
 	}
+	// "нет" clears the deadline
 	if deadlineStr, ok := operation.Parameters["deadline"].(string); ok && deadlineStr != "" {
-		if t, err := time.Parse("2006-01-02 15:04", deadlineStr); err == nil {
-			deadline = &t
+		deadline, err = parseUserDeadline(db, operation.UserID, deadlineStr)
+		if err != nil {
+			log.Printf("❌ Invalid deadline '%s' for task %d: %v", deadlineStr, taskID, err)
+			return &OperationResult{
+				Success: false,
+				Message: fmt.Sprintf("Не удалось разобрать дедлайн: %v", err),
+			}
 		}
 	}
 
@@ -839,9 +1483,179 @@ func executeUpdateTask(db *DB, operation *PendingOperation) *OperationResult {
 	}
 
 	log.Printf("✅ Successfully updated task %d for user %d", taskID, operation.UserID)
+	message := fmt.Sprintf("Задача #%d успешно обновлена!", taskID)
+
+	// Let the user know which tasks can be started now
+	if status == TaskDone && task.Status != TaskDone {
+		unblocked, err := db.GetUnblockedTasks(taskID)
+		if err != nil {
+			log.Printf("Error getting unblocked tasks for task %d: %v", taskID, err)
+		}
+		if len(unblocked) > 0 {
+			message += "\n\n🔓 Теперь можно начинать:"
+			for _, t := range unblocked {
+				message += fmt.Sprintf("\n• #%d %s", t.ID, html.EscapeString(t.Title))
+			}
+		}
+	}
+
+	return &OperationResult{
+		Success: true,
+		Message: message,
+	}
+}
+
+// executeAddTaskDependency executes the add task dependency operation
+func executeAddTaskDependency(db *DB, operation *PendingOperation) *OperationResult {
+	taskID := int(operation.Parameters["task_id"].(float64))
+	dependsOnTaskID := int(operation.Parameters["depends_on_task_id"].(float64))
+	log.Printf("🔗 EXECUTING ADD_TASK_DEPENDENCY: task %d depends on %d for user %d", taskID, dependsOnTaskID, operation.UserID)
+
+	err := db.AddTaskDependency(taskID, dependsOnTaskID, operation.UserID)
+	if err != nil {
+		log.Printf("❌ Failed to add dependency %d -> %d for user %d: %v", taskID, dependsOnTaskID, operation.UserID, err)
+		return &OperationResult{
+			Success: false,
+			Message: fmt.Sprintf("Ошибка при добавлении зависимости: %v", err),
+		}
+	}
+
+	log.Printf("✅ Successfully added dependency %d -> %d", taskID, dependsOnTaskID)
+	return &OperationResult{
+		Success: true,
+		Message: fmt.Sprintf("🔗 Задача #%d теперь ждёт выполнения задачи #%d", taskID, dependsOnTaskID),
+	}
+}
+
+// executeMoveTask executes the move task operation
+func executeMoveTask(db *DB, operation *PendingOperation) *OperationResult {
+	taskID, _ := intParam(operation.Parameters, "task_id")
+	newProjectID, _ := intParam(operation.Parameters, "new_project_id")
+	log.Printf("📦 EXECUTING MOVE_TASK: task %d to project %d for user %d", taskID, newProjectID, operation.UserID)
+
+	err := db.MoveTask(taskID, operation.UserID, newProjectID)
+	if err != nil {
+		log.Printf("❌ Failed to move task %d to project %d for user %d: %v", taskID, newProjectID, operation.UserID, err)
+		return &OperationResult{
+			Success: false,
+			Message: fmt.Sprintf("Ошибка при переносе задачи: %v", err),
+		}
+	}
+
+	log.Printf("✅ Successfully moved task %d to project %d", taskID, newProjectID)
+	return &OperationResult{
+		Success: true,
+		Message: fmt.Sprintf("📦 Задача #%d перенесена в проект #%d", taskID, newProjectID),
+	}
+}
+
+// parseUserDeadline parses a deadline of a task function with ParseTaskDeadline in the user's timezone
+func parseUserDeadline(db *DB, userID int, deadline string) (*time.Time, error) {
+	loc := time.Local
+	if prefs, err := db.GetUserPreferences(userID); err == nil {
+		loc = prefs.Location()
+	}
+	return ParseTaskDeadline(deadline, time.Now(), loc)
+}
+
+// executeSetTaskDeadline executes the set task deadline operation
+func executeSetTaskDeadline(db *DB, operation *PendingOperation) *OperationResult {
+	taskID, _ := intParam(operation.Parameters, "task_id")
+	deadlineStr, _ := operation.Parameters["deadline"].(string)
+	log.Printf("⏰ EXECUTING SET_TASK_DEADLINE: task %d to '%s' for user %d", taskID, deadlineStr, operation.UserID)
+
+	deadline, err := parseUserDeadline(db, operation.UserID, deadlineStr)
+	if err == nil {
+		err = db.SetTaskDeadline(taskID, operation.UserID, deadline)
+	}
+	if err != nil {
+		log.Printf("❌ Failed to set deadline of task %d for user %d: %v", taskID, operation.UserID, err)
+		return &OperationResult{
+			Success: false,
+			Message: fmt.Sprintf("Ошибка при установке дедлайна: %v", err),
+		}
+	}
+
+	if deadline == nil {
+		return &OperationResult{
+			Success: true,
+			Message: fmt.Sprintf("⏰ Дедлайн задачи #%d убран", taskID),
+		}
+	}
+	return &OperationResult{
+		Success: true,
+		Message: fmt.Sprintf("⏰ Дедлайн задачи #%d: %s", taskID, deadline.Format("02.01.2006 15:04")),
+	}
+}
+
+// executeSetTaskPriority executes the set task priority operation
+func executeSetTaskPriority(db *DB, operation *PendingOperation) *OperationResult {
+	taskID, _ := intParam(operation.Parameters, "task_id")
+	priority := TaskPriority(operation.Parameters["priority"].(string))
+	log.Printf("⚡ EXECUTING SET_TASK_PRIORITY: task %d to %s for user %d", taskID, priority, operation.UserID)
+
+	err := db.SetTaskPriority(taskID, operation.UserID, priority)
+	if err != nil {
+		log.Printf("❌ Failed to set priority of task %d for user %d: %v", taskID, operation.UserID, err)
+		return &OperationResult{
+			Success: false,
+			Message: fmt.Sprintf("Ошибка при изменении приоритета: %v", err),
+		}
+	}
+
+	return &OperationResult{
+		Success: true,
+		Message: fmt.Sprintf("%s Приоритет задачи #%d: %s", TaskPriorityEmoji(priority), taskID, priority),
+	}
+}
+
+// executeSetProjectDescription executes the set project description operation
+func executeSetProjectDescription(db *DB, operation *PendingOperation) *OperationResult {
+	projectID, _ := intParam(operation.Parameters, "project_id")
+	description, _ := operation.Parameters["description"].(string)
+	log.Printf("📝 EXECUTING SET_PROJECT_DESCRIPTION: project %d for user %d", projectID, operation.UserID)
+
+	err := db.SetProjectDescription(projectID, operation.UserID, description)
+	if err != nil {
+		log.Printf("❌ Failed to set description of project %d for user %d: %v", projectID, operation.UserID, err)
+		return &OperationResult{
+			Success: false,
+			Message: fmt.Sprintf("Ошибка при изменении описания проекта: %v", err),
+		}
+	}
+
+	return &OperationResult{
+		Success: true,
+		Message: fmt.Sprintf("📝 Описание проекта #%d обновлено", projectID),
+	}
+}
+
+// executeShiftDeadlines executes the shift deadlines operation
+func executeShiftDeadlines(db *DB, operation *PendingOperation) *OperationResult {
+	projectID, _ := intParam(operation.Parameters, "project_id")
+	days, _ := intParam(operation.Parameters, "days")
+	log.Printf("📅 EXECUTING SHIFT_DEADLINES: project %d by %d days for user %d", projectID, days, operation.UserID)
+
+	shifted, err := db.ShiftProjectDeadlines(projectID, operation.UserID, time.Duration(days)*24*time.Hour)
+	if err != nil {
+		log.Printf("❌ Failed to shift deadlines of project %d for user %d: %v", projectID, operation.UserID, err)
+		return &OperationResult{
+			Success: false,
+			Message: fmt.Sprintf("Ошибка при сдвиге дедлайнов: %v", err),
+		}
+	}
+
+	if shifted == 0 {
+		return &OperationResult{
+			Success: true,
+			Message: fmt.Sprintf("📅 В проекте #%d нет задач с дедлайнами", projectID),
+		}
+	}
+
+	log.Printf("✅ Successfully shifted %d deadlines in project %d", shifted, projectID)
 	return &OperationResult{
 		Success: true,
-		Message: fmt.Sprintf("Задача #%d успешно обновлена!", taskID),
+		Message: fmt.Sprintf("📅 Сдвинуто дедлайнов: %d (на %+d дн.)", shifted, days),
 	}
 }
 
@@ -888,93 +1702,378 @@ func executeSetCurrentProject(db *DB, operation *PendingOperation) *OperationRes
 		}
 	}
 
-	// Set as current project
-	err = db.SetUserCurrentProject(operation.UserID, projectID)
+	// Set as current project of the chat the user asked in
+	err = db.SetCurrentProject(operation.UserID, operation.ChatID, projectID)
+	if err != nil {
+		log.Printf("❌ Failed to set current project %d for user %d: %v", projectID, operation.UserID, err)
+		return &OperationResult{
+			Success: false,
+			Message: fmt.Sprintf("Ошибка при установке текущего проекта: %v", err),
+		}
+	}
+
+	if err := db.MarkProjectViewed(projectID, operation.UserID); err != nil {
+		log.Printf("⚠️ %v", err)
+	}
+
+	log.Printf("✅ Successfully set current project '%s' (ID: %d) for user %d", project.Title, projectID, operation.UserID)
+	return &OperationResult{
+		Success: true,
+		Message: fmt.Sprintf("Проект '%s' установлен как текущий рабочий проект!", html.EscapeString(project.Title)),
+	}
+}
+
+// executeGetCurrentProject executes get current project directly (no confirmation needed)
+func executeGetCurrentProject(db *DB, userID int, chatID int64, parameters map[string]interface{}) (string, error) {
+	log.Printf("📁 EXECUTING GET_CURRENT_PROJECT for user %d", userID)
+
+	currentProject, err := db.GetCurrentProject(userID, chatID)
+	if err != nil {
+		log.Printf("❌ Failed to get current project for user %d: %v", userID, err)
+		return "", fmt.Errorf("failed to get current project: %v", err)
+	}
+
+	log.Printf("✅ Found current project for user %d: %v", userID, currentProject != nil)
+
+	// Return JSON data for GPT to format
+	result := map[string]interface{}{
+		"current_project": currentProject,
+		"has_current":     currentProject != nil,
+	}
+	if currentProject != nil {
+		result["capabilities"] = CapabilitiesForRole(currentProject.UserRole)
+	}
+
+	jsonData, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal current project data: %v", err)
+	}
+
+	return string(jsonData), nil
+}
+
+// executeProjectDetail executes project detail directly (no confirmation needed)
+func executeProjectDetail(db *DB, userID int, chatID int64, parameters map[string]interface{}) (string, error) {
+	log.Printf("🗂️ EXECUTING PROJECT_DETAIL for user %d with params: %v", userID, parameters)
+
+	var projectID int
+	if projectIDFloat, ok := parameters["project_id"].(float64); ok {
+		projectID = int(projectIDFloat)
+	} else {
+		// Fall back to the user's current project
+		currentProject, err := db.GetCurrentProject(userID, chatID)
+		if err != nil {
+			return "", fmt.Errorf("failed to get current project: %v", err)
+		}
+		if currentProject == nil {
+			return "", fmt.Errorf("project_id is required when no current project is set")
+		}
+		projectID = currentProject.ID
+	}
+
+	detail, err := db.GetProjectDetail(projectID, userID)
+	if err != nil {
+		log.Printf("❌ Failed to get project detail %d for user %d: %v", projectID, userID, err)
+		return "", fmt.Errorf("failed to get project detail: %v", err)
+	}
+	if detail == nil {
+		return "", fmt.Errorf("project not found or no access")
+	}
+
+	log.Printf("✅ Found project %d for user %d: %d members, %d open tasks", projectID, userID, len(detail.Members), len(detail.OpenTasks))
+
+	jsonData, err := json.Marshal(detail)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal project detail: %v", err)
+	}
+
+	return string(jsonData), nil
+}
+
+// executeSetProjectMuted mutes or unmutes project notifications directly (no confirmation needed)
+func executeSetProjectMuted(db *DB, userID int, chatID int64, parameters map[string]interface{}, muted bool) (string, error) {
+	log.Printf("🔕 EXECUTING SET_PROJECT_MUTED=%t for user %d with params: %v", muted, userID, parameters)
+
+	var projectID int
+	if projectIDFloat, ok := parameters["project_id"].(float64); ok {
+		projectID = int(projectIDFloat)
+	} else {
+		// Fall back to the user's current project
+		currentProject, err := db.GetCurrentProject(userID, chatID)
+		if err != nil {
+			return "", fmt.Errorf("failed to get current project: %v", err)
+		}
+		if currentProject == nil {
+			return "", fmt.Errorf("project_id is required when no current project is set")
+		}
+		projectID = currentProject.ID
+	}
+
+	if err := db.SetProjectMuted(userID, projectID, muted); err != nil {
+		log.Printf("❌ Failed to set muted=%t for project %d, user %d: %v", muted, projectID, userID, err)
+		return "", fmt.Errorf("failed to update notifications: %v", err)
+	}
+
+	result := map[string]interface{}{
+		"project_id": projectID,
+		"muted":      muted,
+	}
+
+	jsonData, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal notifications data: %v", err)
+	}
+
+	return string(jsonData), nil
+}
+
+// executeListTaskAttachments executes task attachments lookup directly (no confirmation needed)
+func executeListTaskAttachments(db *DB, userID int, parameters map[string]interface{}) (string, error) {
+	taskID, ok := intParam(parameters, "task_id")
+	if !ok {
+		return "", fmt.Errorf("task_id is required")
+	}
+
+	log.Printf("📎 EXECUTING LIST_TASK_ATTACHMENTS for user %d, task %d", userID, taskID)
+
+	attachments, err := db.GetTaskAttachments(taskID, userID)
+	if err != nil {
+		log.Printf("❌ Failed to get attachments of task %d for user %d: %v", taskID, userID, err)
+		return "", fmt.Errorf("failed to get task attachments: %v", err)
+	}
+	if attachments == nil {
+		attachments = []*TaskAttachment{}
+	}
+
+	result := map[string]interface{}{
+		"task_id":     taskID,
+		"attachments": attachments,
+		"count":       len(attachments),
+	}
+
+	jsonData, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal task attachments data: %v", err)
+	}
+
+	return string(jsonData), nil
+}
+
+// executeBlockedTasks executes blocked tasks lookup directly (no confirmation needed)
+func executeBlockedTasks(db *DB, userID int, parameters map[string]interface{}) (string, error) {
+	log.Printf("⛔ EXECUTING BLOCKED_TASKS for user %d", userID)
+
+	tasks, err := db.GetBlockedTasks(userID)
+	if err != nil {
+		log.Printf("❌ Failed to get blocked tasks for user %d: %v", userID, err)
+		return "", fmt.Errorf("failed to get blocked tasks: %v", err)
+	}
+
+	log.Printf("✅ Found %d blocked tasks for user %d", len(tasks), userID)
+
+	result := map[string]interface{}{
+		"tasks": tasks,
+		"count": len(tasks),
+	}
+
+	jsonData, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal blocked tasks data: %v", err)
+	}
+
+	return string(jsonData), nil
+}
+
+// maxUpcomingTaskDays bounds the deadline window of list_upcoming_tasks
+const maxUpcomingTaskDays = 90
+
+// executeListUpcomingTasks executes the upcoming tasks lookup directly (no confirmation needed).
+// Open tasks due by the end of the day days days from today in the user's timezone are returned
+// ordered by deadline, overdue ones included and flagged. Muted projects are included, muting only
+// silences notifications
+func executeListUpcomingTasks(db *DB, userID int, parameters map[string]interface{}) (string, error) {
+	log.Printf("⏰ EXECUTING LIST_UPCOMING_TASKS for user %d with params: %v", userID, parameters)
+
+	days, err := daysParam(parameters, maxUpcomingTaskDays)
+	if err != nil {
+		return "", err
+	}
+
+	loc := time.Local
+	if prefs, err := db.GetUserPreferences(userID); err == nil {
+		loc = prefs.Location()
+	}
+	now := time.Now()
+
+	tasks, err := db.GetUpcomingTasksAt(userID, days, now, loc)
+	if err != nil {
+		log.Printf("❌ Failed to get upcoming tasks for user %d: %v", userID, err)
+		return "", fmt.Errorf("failed to get upcoming tasks: %v", err)
+	}
+	if tasks == nil {
+		tasks = []*Task{}
+	}
+	// Project status tells the AI which tasks belong to paused projects
+	if err := db.AttachProjects(tasks); err != nil {
+		log.Printf("⚠️ Failed to attach projects to upcoming tasks: %v", err)
+	}
+
+	// Deadlines are wall-clock time, so is the start of today
+	endOfToday := deadlineCutoff(now, 0, loc)
+	startOfToday := time.Date(endOfToday.Year(), endOfToday.Month(), endOfToday.Day(), 0, 0, 0, 0, time.UTC)
+	overdue := 0
+	for _, task := range tasks {
+		if task.Deadline.Before(startOfToday) {
+			task.Overdue = true
+			overdue++
+		}
+	}
+
+	log.Printf("✅ Found %d upcoming tasks (%d overdue) for user %d", len(tasks), overdue, userID)
+
+	result := map[string]interface{}{
+		"days":    days,
+		"tasks":   tasks,
+		"count":   len(tasks),
+		"overdue": overdue,
+	}
+
+	jsonData, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal upcoming tasks data: %v", err)
+	}
+
+	return string(jsonData), nil
+}
+
+// maxRecentlyCompletedDays bounds the lookback of recently_completed
+const maxRecentlyCompletedDays = 90
+
+// executeRecentlyCompleted executes the recently completed tasks lookup directly (no confirmation
+// needed). Done tasks completed in the last days days are returned, most recent first
+func executeRecentlyCompleted(db *DB, userID int, parameters map[string]interface{}) (string, error) {
+	log.Printf("🏁 EXECUTING RECENTLY_COMPLETED for user %d with params: %v", userID, parameters)
+
+	days, err := daysParam(parameters, maxRecentlyCompletedDays)
+	if err != nil {
+		return "", err
+	}
+
+	tasks, err := db.GetRecentlyCompletedTasks(userID, days)
+	if err != nil {
+		log.Printf("❌ Failed to get recently completed tasks for user %d: %v", userID, err)
+		return "", fmt.Errorf("failed to get recently completed tasks: %v", err)
+	}
+
+	log.Printf("✅ Found %d tasks completed in %d days for user %d", len(tasks), days, userID)
+
+	result := map[string]interface{}{
+		"days":  days,
+		"tasks": tasks,
+		"count": len(tasks),
+	}
+
+	jsonData, err := json.Marshal(result)
 	if err != nil {
-		log.Printf("❌ Failed to set current project %d for user %d: %v", projectID, operation.UserID, err)
-		return &OperationResult{
-			Success: false,
-			Message: fmt.Sprintf("Ошибка при установке текущего проекта: %v", err),
-		}
+		return "", fmt.Errorf("failed to marshal recently completed tasks data: %v", err)
 	}
 
-	log.Printf("✅ Successfully set current project '%s' (ID: %d) for user %d", project.Title, projectID, operation.UserID)
-	return &OperationResult{
-		Success: true,
-		Message: fmt.Sprintf("Проект '%s' установлен как текущий рабочий проект!", project.Title),
-	}
+	return string(jsonData), nil
 }
 
-// executeGetCurrentProject executes get current project directly (no confirmation needed)
-func executeGetCurrentProject(db *DB, userID int, parameters map[string]interface{}) (string, error) {
-	log.Printf("📁 EXECUTING GET_CURRENT_PROJECT for user %d", userID)
+// executeStaleProjects executes stale projects lookup directly (no confirmation needed)
+func executeStaleProjects(db *DB, userID int, parameters map[string]interface{}) (string, error) {
+	log.Printf("💤 EXECUTING STALE_PROJECTS for user %d with params: %v", userID, parameters)
+
+	// Inactivity period in days, defaults to two weeks
+	days := 14
+	if value, ok := intParam(parameters, "days"); ok && value > 0 {
+		days = value
+	}
 
-	currentProject, err := db.GetUserCurrentProject(userID)
+	projects, err := db.GetStaleProjects(userID, time.Duration(days)*24*time.Hour)
 	if err != nil {
-		log.Printf("❌ Failed to get current project for user %d: %v", userID, err)
-		return "", fmt.Errorf("failed to get current project: %v", err)
+		log.Printf("❌ Failed to get stale projects for user %d: %v", userID, err)
+		return "", fmt.Errorf("failed to get stale projects: %v", err)
 	}
 
-	log.Printf("✅ Found current project for user %d: %v", userID, currentProject != nil)
+	log.Printf("✅ Found %d stale projects for user %d", len(projects), userID)
 
-	// Return JSON data for GPT to format
 	result := map[string]interface{}{
-		"current_project": currentProject,
-		"has_current":     currentProject != nil,
+		"projects":      projects,
+		"count":         len(projects),
+		"inactive_days": days,
 	}
 
 	jsonData, err := json.Marshal(result)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal current project data: %v", err)
+		return "", fmt.Errorf("failed to marshal stale projects data: %v", err)
 	}
 
 	return string(jsonData), nil
 }
 
-// ProcessGPTFunctionCall processes a function call from GPT
-func ProcessGPTFunctionCall(userID int, chatID int64, functionCall *openai.FunctionCall) (*PendingOperation, error) {
-	log.Printf("🔧 GPT FUNCTION CALL: %s for user %d with args: %s", functionCall.Name, userID, functionCall.Arguments)
+// executeProjectMetrics executes the project metrics lookup directly (no confirmation needed)
+func executeProjectMetrics(db *DB, userID int, parameters map[string]interface{}) (string, error) {
+	projectID, ok := intParam(parameters, "project_id")
+	if !ok {
+		return "", fmt.Errorf("invalid project_id parameter")
+	}
+	log.Printf("📈 EXECUTING PROJECT_METRICS: project %d for user %d", projectID, userID)
 
-	// Now we only support execute_javascript function
-	if functionCall.Name != "execute_javascript" {
-		log.Printf("❌ Unknown function: %s", functionCall.Name)
-		return nil, fmt.Errorf("unknown function: %s", functionCall.Name)
+	metrics, err := db.GetProjectCycleTimes(projectID, userID)
+	if err != nil {
+		log.Printf("❌ Failed to get metrics of project %d for user %d: %v", projectID, userID, err)
+		return "", fmt.Errorf("failed to get project metrics: %v", err)
 	}
 
-	// Parse parameters
-	var parameters map[string]interface{}
-	if err := json.Unmarshal([]byte(functionCall.Arguments), &parameters); err != nil {
-		log.Printf("❌ Failed to parse function arguments for %s: %v", functionCall.Name, err)
-		return nil, fmt.Errorf("failed to parse function arguments: %v", err)
+	jsonData, err := json.Marshal(metrics)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal project metrics: %v", err)
 	}
 
-	log.Printf("✅ Calling handler for function: %s", functionCall.Name)
-	// Call the handler for execute_javascript
-	return handleExecuteJavaScript(userID, chatID, parameters)
+	return string(jsonData), nil
 }
 
 // executeListProjects executes list projects directly (no confirmation needed)
 func executeListProjects(db *DB, userID int, parameters map[string]interface{}) (string, error) {
 	log.Printf("📋 EXECUTING LIST_PROJECTS for user %d with params: %v", userID, parameters)
 
-	var projects []*Project
-	var err error
-
 	// Check if status filter is provided
+	var status ProjectStatus
 	if statusStr, ok := parameters["status"].(string); ok {
 		log.Printf("📋 Filtering projects by status: %s", statusStr)
-		status := ProjectStatus(statusStr)
-		projects, err = db.GetUserProjectsByStatus(userID, status)
-	} else {
-		log.Printf("📋 Getting all projects for user")
-		projects, err = db.GetUserProjects(userID)
+		status = ProjectStatus(statusStr)
+	}
+
+	// Sorting is optional: sort_by (created, updated, title, status) and direction (asc, desc)
+	sortBy := "created"
+	if value, ok := parameters["sort_by"].(string); ok && value != "" {
+		sortBy = value
+	}
+	direction := "desc"
+	if value, ok := parameters["direction"].(string); ok && value != "" {
+		direction = value
 	}
 
+	projects, err := db.GetUserProjectsSorted(userID, status, sortBy, direction)
+
 	if err != nil {
 		log.Printf("❌ Failed to get projects for user %d: %v", userID, err)
 		return "", fmt.Errorf("failed to get projects: %v", err)
 	}
 
+	// Ownership is optional: "mine" keeps owned projects, "shared" the ones the user was added to
+	ownership, _ := parameters["ownership"].(string)
+	switch ownership {
+	case "mine":
+		projects, _ = splitProjectsByOwnership(projects)
+	case "shared":
+		_, projects = splitProjectsByOwnership(projects)
+	}
+
+	db.markNewActivity(userID, projects)
+
 	log.Printf("✅ Found %d projects for user %d", len(projects), userID)
 
 	// Return JSON data for GPT to format
@@ -984,6 +2083,11 @@ func executeListProjects(db *DB, userID int, parameters map[string]interface{})
 		"filters":  parameters,
 	}
 
+	// Without any projects suggest creating one, same as the welcome flow
+	if len(projects) == 0 && status == "" && ownership == "" {
+		result["next_action"] = NoProjectsHint
+	}
+
 	jsonData, err := json.Marshal(result)
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal projects data: %v", err)
@@ -992,22 +2096,50 @@ func executeListProjects(db *DB, userID int, parameters map[string]interface{})
 	return string(jsonData), nil
 }
 
-// getStatusEmoji returns emoji for project status
-func getStatusEmoji(status ProjectStatus) string {
-	switch status {
-	case StatusPlanning:
-		return "📝"
-	case StatusActive:
-		return "🚀"
-	case StatusPaused:
-		return "⏸️"
-	case StatusCompleted:
-		return "✅"
-	case StatusCancelled:
-		return "❌"
-	default:
-		return "❓"
+// projectCreatedMessage is the card of a project created from a suggestion. The headline only
+// says the project is current when it was made current, otherwise the user is asked to pick it
+func projectCreatedMessage(project *Project, madeCurrent bool) string {
+	headline := "✅ Проект создан и выбран текущим!"
+	note := ""
+	if !madeCurrent {
+		headline = "✅ Проект создан"
+		note = "\n\n⚠️ Не удалось сделать проект текущим, выберите его вручную."
+	}
+	return fmt.Sprintf("%s\n\n%s%s\n\n👉 Следующий шаг - добавьте первую задачу, а я прослежу чтобы задачи были выполнены.",
+		headline, formatProjectCard(project), note)
+}
+
+// formatProjectCard formats a short HTML card with the main project information
+func formatProjectCard(project *Project) string {
+	card := fmt.Sprintf("%s <b>%s</b>", StatusEmoji(project.Status), html.EscapeString(project.Title))
+	if project.Description != "" {
+		card += "\n" + html.EscapeString(project.Description)
+	}
+	card += fmt.Sprintf("\n📊 Статус: %s", project.Status)
+	if project.MemberCount > 0 {
+		card += fmt.Sprintf("\n👥 Участников: %d", project.MemberCount)
+	}
+	if project.UserRole != "" {
+		card += fmt.Sprintf("\n👤 Ваша роль: %s", project.UserRole)
+	}
+	return card
+}
+
+// findUserProjectByTitle returns the newest user's project with the given title, or nil
+func findUserProjectByTitle(db *DB, userID int, title string) *Project {
+	projects, err := db.GetUserProjects(userID)
+	if err != nil {
+		log.Printf("Error getting projects for user %d: %v", userID, err)
+		return nil
+	}
+
+	var found *Project
+	for _, project := range projects {
+		if project.Title == title && (found == nil || project.ID > found.ID) {
+			found = project
+		}
 	}
+	return found
 }
 
 // handleSetCurrentProject handles the set current project function call
@@ -1028,7 +2160,7 @@ func handleSetCurrentProject(userID int, chatID int64, parameters map[string]int
 		CreatedAt:   time.Now(),
 	}
 
-	pendingOperations[operation.ID] = operation
+	pendingOperations.Put(operation)
 	return operation, nil
 }
 
@@ -1038,37 +2170,122 @@ func handleGetCurrentProject(userID int, chatID int64, parameters map[string]int
 	return nil, fmt.Errorf("get_current_project_direct")
 }
 
-// handleSendMessageWithButtons handles the send_message_with_buttons function call
-func handleSendMessageWithButtons(userID int, chatID int64, parameters map[string]interface{}) (*PendingOperation, error) {
+// handleGetBlockedTasks handles the get blocked tasks function call
+func handleGetBlockedTasks(userID int, chatID int64, parameters map[string]interface{}) (*PendingOperation, error) {
+	// Blocked tasks lookup doesn't need confirmation, we'll handle it differently
+	return nil, fmt.Errorf("get_blocked_tasks_direct")
+}
+
+// handleListUpcomingTasks handles the list upcoming tasks function call
+func handleListUpcomingTasks(userID int, chatID int64, parameters map[string]interface{}) (*PendingOperation, error) {
+	// Upcoming tasks lookup doesn't need confirmation, we'll handle it differently
+	return nil, fmt.Errorf("list_upcoming_tasks_direct")
+}
+
+// handleRecentlyCompleted handles the recently completed tasks function call
+func handleRecentlyCompleted(userID int, chatID int64, parameters map[string]interface{}) (*PendingOperation, error) {
+	// Recently completed tasks lookup doesn't need confirmation, we'll handle it differently
+	return nil, fmt.Errorf("recently_completed_direct")
+}
+
+// handleListTaskAttachments handles the list task attachments function call
+func handleListTaskAttachments(userID int, chatID int64, parameters map[string]interface{}) (*PendingOperation, error) {
+	// Listing attachments doesn't need confirmation, we'll handle it differently
+	return nil, fmt.Errorf("list_task_attachments_direct")
+}
+
+// handleProjectMetrics handles the project metrics function call
+func handleProjectMetrics(userID int, chatID int64, parameters map[string]interface{}) (*PendingOperation, error) {
+	// Metrics are read-only and don't need confirmation, we'll handle it differently
+	return nil, fmt.Errorf("project_metrics_direct")
+}
+
+// handleMuteProject handles the mute project function call
+func handleMuteProject(userID int, chatID int64, parameters map[string]interface{}) (*PendingOperation, error) {
+	// Muting doesn't need confirmation, we'll handle it differently
+	return nil, fmt.Errorf("mute_project_direct")
+}
+
+// handleUnmuteProject handles the unmute project function call
+func handleUnmuteProject(userID int, chatID int64, parameters map[string]interface{}) (*PendingOperation, error) {
+	// Unmuting doesn't need confirmation, we'll handle it differently
+	return nil, fmt.Errorf("unmute_project_direct")
+}
+
+// customButtonPrefix is the callback data prefix of buttons sent by the AI, followed by the action
+const customButtonPrefix = "custom_button_"
+
+// maxMessageButtons is the most buttons the AI may attach to one message
+const maxMessageButtons = 6
+
+// MessageButton is a button the AI attaches to a message. Pressing it saves Action as the
+// user's message, so the AI sees the choice in the conversation
+type MessageButton struct {
+	Text   string `json:"text"`
+	Action string `json:"action"`
+}
+
+// ButtonMessage is a message with buttons produced by JavaScript
+type ButtonMessage struct {
+	Message string          `json:"message"`
+	Buttons []MessageButton `json:"buttons"`
+}
+
+// parseMessageButtons validates the message and buttons of send_message_with_buttons. Buttons are
+// objects with text and action, label and callback are accepted as their aliases. The action has
+// to fit into Telegram callback data together with customButtonPrefix
+func parseMessageButtons(parameters map[string]interface{}) (string, []MessageButton, error) {
 	message, ok := parameters["message"].(string)
-	if !ok {
-		return nil, fmt.Errorf("invalid message parameter")
+	if !ok || strings.TrimSpace(message) == "" {
+		return "", nil, fmt.Errorf("invalid message parameter")
 	}
 
-	buttons, ok := parameters["buttons"].([]interface{})
-	if !ok {
-		return nil, fmt.Errorf("invalid buttons parameter")
+	items, ok := parameters["buttons"].([]interface{})
+	if !ok || len(items) == 0 {
+		return "", nil, fmt.Errorf("invalid buttons parameter")
 	}
-
-	if len(buttons) > 6 {
-		return nil, fmt.Errorf("too many buttons (max 6 allowed)")
+	if len(items) > maxMessageButtons {
+		return "", nil, fmt.Errorf("too many buttons (max %d allowed)", maxMessageButtons)
 	}
 
-	buttonData := make([]string, len(buttons))
-	for i, button := range buttons {
-		buttonMap, ok := button.(map[string]interface{})
+	buttons := make([]MessageButton, len(items))
+	for i, item := range items {
+		buttonMap, ok := item.(map[string]interface{})
 		if !ok {
-			return nil, fmt.Errorf("invalid button format")
+			return "", nil, fmt.Errorf("invalid button format")
 		}
-		text, ok := buttonMap["text"].(string)
-		if !ok {
-			return nil, fmt.Errorf("invalid button text format")
+		text := firstStringParam(buttonMap, "text", "label")
+		if strings.TrimSpace(text) == "" {
+			return "", nil, fmt.Errorf("invalid button text format")
 		}
-		action, ok := buttonMap["action"].(string)
-		if !ok {
-			return nil, fmt.Errorf("invalid button action format")
+		action := firstStringParam(buttonMap, "action", "callback")
+		if strings.TrimSpace(action) == "" {
+			return "", nil, fmt.Errorf("invalid button action format")
 		}
-		buttonData[i] = fmt.Sprintf("%s|%s", text, action)
+		if len(customButtonPrefix+action) > telegramCallbackDataLimit {
+			return "", nil, fmt.Errorf("button action %q is too long (max %d bytes)", action, telegramCallbackDataLimit-len(customButtonPrefix))
+		}
+		buttons[i] = MessageButton{Text: text, Action: action}
+	}
+
+	return message, buttons, nil
+}
+
+// firstStringParam returns the first of keys that holds a string, "" if none does
+func firstStringParam(parameters map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if value, ok := parameters[key].(string); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// handleSendMessageWithButtons handles the send_message_with_buttons function call
+func handleSendMessageWithButtons(userID int, chatID int64, parameters map[string]interface{}) (*PendingOperation, error) {
+	message, _, err := parseMessageButtons(parameters)
+	if err != nil {
+		return nil, err
 	}
 
 	operation := &PendingOperation{
@@ -1081,25 +2298,23 @@ func handleSendMessageWithButtons(userID int, chatID int64, parameters map[strin
 		CreatedAt:   time.Now(),
 	}
 
-	pendingOperations[operation.ID] = operation
+	pendingOperations.Put(operation)
 	return operation, nil
 }
 
 // executeSendMessageWithButtons executes sending message with custom buttons
 func executeSendMessageWithButtons(db *DB, operation *PendingOperation) *OperationResult {
-	message := operation.Parameters["message"].(string)
-	buttons := operation.Parameters["buttons"].([]interface{})
+	message, buttons, err := parseMessageButtons(operation.Parameters)
+	if err != nil {
+		return &OperationResult{
+			Success: false,
+			Message: fmt.Sprintf("Ошибка в кнопках сообщения: %v", err),
+		}
+	}
 
 	log.Printf("📨 EXECUTING SEND_MESSAGE_WITH_BUTTONS for user %d: %s", operation.UserID, message)
 
-	// Note: This function returns success but the actual message sending is handled separately
-	// The bot will send the message with buttons based on this operation result
-	buttonTexts := make([]string, len(buttons))
-	for i, button := range buttons {
-		buttonMap := button.(map[string]interface{})
-		buttonTexts[i] = buttonMap["text"].(string)
-	}
-
+	// The message itself is sent by the caller with SendMessageWithCustomButtons
 	log.Printf("✅ Successfully prepared message with %d buttons for user %d", len(buttons), operation.UserID)
 	return &OperationResult{
 		Success:     true,
@@ -1109,9 +2324,10 @@ func executeSendMessageWithButtons(db *DB, operation *PendingOperation) *Operati
 	}
 }
 
-// SendMessageWithCustomButtons sends a message with custom buttons
-func SendMessageWithCustomButtons(bot *tgbotapi.BotAPI, chatID int64, message string, buttons []interface{}) error {
-	msg := tgbotapi.NewMessage(chatID, message)
+// SendMessageWithCustomButtons sends a message with custom buttons, two per row.
+// Returns the Telegram ID of the sent message
+func SendMessageWithCustomButtons(bot *tgbotapi.BotAPI, chatID int64, message string, buttons []MessageButton) (int, error) {
+	msg := tgbotapi.NewMessage(chatID, MarkdownToTelegramHTML(message))
 	msg.ParseMode = tgbotapi.ModeHTML // Enable HTML formatting
 
 	// Build keyboard from buttons
@@ -1119,14 +2335,8 @@ func SendMessageWithCustomButtons(bot *tgbotapi.BotAPI, chatID int64, message st
 	var currentRow []tgbotapi.InlineKeyboardButton
 
 	for i, button := range buttons {
-		buttonMap := button.(map[string]interface{})
-		text := buttonMap["text"].(string)
-		action := buttonMap["action"].(string)
-
 		// Use action as callback data with special prefix
-		callbackData := fmt.Sprintf("custom_button_%s", action)
-
-		btn := tgbotapi.NewInlineKeyboardButtonData(text, callbackData)
+		btn := tgbotapi.NewInlineKeyboardButtonData(button.Text, customButtonPrefix+button.Action)
 		currentRow = append(currentRow, btn)
 
 		// Add row when we have 2 buttons or it's the last button
@@ -1139,12 +2349,13 @@ func SendMessageWithCustomButtons(bot *tgbotapi.BotAPI, chatID int64, message st
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(keyboardRows...)
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	sent, err := bot.Send(msg)
+	if err != nil {
 		log.Printf("Failed to send message with custom buttons: %v", err)
-		return err
+		return 0, err
 	}
 
-	return nil
+	return sent.MessageID, nil
 }
 
 // handleExecuteJavaScript handles the execute JavaScript function call
@@ -1262,7 +2473,14 @@ func autoFixJavaScript(code string) (string, bool) {
 	return code, fixed
 }
 
-func executeJavaScriptDirect(db *DB, userID int, parameters map[string]interface{}) (string, error) {
+// isJavaScriptSyntaxError reports whether the code failed to compile. Nothing ran in that case,
+// so asking the AI for corrected code can't repeat any action
+func isJavaScriptSyntaxError(err error) bool {
+	var syntaxErr *goja.CompilerSyntaxError
+	return errors.As(err, &syntaxErr)
+}
+
+func executeJavaScriptDirect(db *DB, userID int, chatID int64, parameters map[string]interface{}) (string, error) {
 	code, ok := parameters["code"].(string)
 	if !ok {
 		return "", fmt.Errorf("invalid code parameter")
@@ -1315,6 +2533,9 @@ func executeJavaScriptDirect(db *DB, userID int, parameters map[string]interface
 		}
 	}
 
+	// Get output size cap, 0 disables it
+	maxOutputBytes, _ := parameters["max_output_bytes"].(int)
+
 	// Get input data if provided
 	inputData, _ := parameters["inputData"].(string)
 
@@ -1362,6 +2583,25 @@ func executeJavaScriptDirect(db *DB, userID int, parameters map[string]interface
 		return goja.Undefined()
 	})
 
+	// Add messageWithButtons() function to send a message with buttons to user
+	var buttonMessages []ButtonMessage
+	vm.Set("messageWithButtons", func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) < 2 {
+			panic(vm.NewTypeError("messageWithButtons requires 2 arguments (text, buttons)"))
+		}
+
+		message, buttons, err := parseMessageButtons(map[string]interface{}{
+			"message": call.Arguments[0].String(),
+			"buttons": call.Arguments[1].Export(),
+		})
+		if err != nil {
+			panic(vm.NewTypeError("messageWithButtons: " + err.Error()))
+		}
+		buttonMessages = append(buttonMessages, ButtonMessage{Message: message, Buttons: buttons})
+		log.Printf("📤 JS Message with %d buttons: %s", len(buttons), message)
+		return goja.Undefined()
+	})
+
 	// Add output() function to return data to GPT
 	vm.Set("output", func(call goja.FunctionCall) goja.Value {
 		if len(call.Arguments) > 0 {
@@ -1489,122 +2729,287 @@ func executeJavaScriptDirect(db *DB, userID int, parameters map[string]interface
 		return response
 	})
 
-	// Set up simplified setTimeout
-	vm.Set("setTimeout", func(call goja.FunctionCall) goja.Value {
-		if len(call.Arguments) < 2 {
-			panic(vm.NewTypeError("setTimeout requires at least 2 arguments"))
+	// Set up simplified setTimeout
+	vm.Set("setTimeout", func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) < 2 {
+			panic(vm.NewTypeError("setTimeout requires at least 2 arguments"))
+		}
+
+		callback := call.Arguments[0]
+		delay := call.Arguments[1].ToInteger()
+
+		go func() {
+			time.Sleep(time.Duration(delay) * time.Millisecond)
+			if fn, ok := goja.AssertFunction(callback); ok {
+				_, err := fn(goja.Undefined())
+				if err != nil {
+					log.Printf("⚠️ setTimeout callback error: %v", err)
+				}
+			}
+		}()
+
+		return goja.Undefined()
+	})
+
+	// Set up basic JSON support
+	vm.Set("JSON", vm.NewObject())
+	vm.RunString(`
+		JSON.parse = function(str) {
+			return JSON.parse(str);
+		};
+		JSON.stringify = function(obj, replacer, space) {
+			return JSON.stringify(obj, replacer, space);
+		};
+	`)
+
+	// Set up Teamwork API object
+	teamworkAPI := vm.NewObject()
+
+	// READ FUNCTIONS - execute immediately
+	teamworkAPI.Set("listProjects", func(call goja.FunctionCall) goja.Value {
+		// Get optional status filter and sorting
+		parameters := make(map[string]interface{})
+		if len(call.Arguments) > 0 && !goja.IsUndefined(call.Arguments[0]) && !goja.IsNull(call.Arguments[0]) {
+			if status := call.Arguments[0].String(); status != "" {
+				parameters["status"] = status
+			}
+		}
+		if len(call.Arguments) > 1 && !goja.IsUndefined(call.Arguments[1]) {
+			parameters["sort_by"] = call.Arguments[1].String()
+		}
+		if len(call.Arguments) > 2 && !goja.IsUndefined(call.Arguments[2]) {
+			parameters["direction"] = call.Arguments[2].String()
+		}
+		if len(call.Arguments) > 3 && !goja.IsUndefined(call.Arguments[3]) {
+			parameters["ownership"] = call.Arguments[3].String()
+		}
+
+		result, err := executeListProjects(db, userID, parameters)
+		if err != nil {
+			panic(vm.NewTypeError("Failed to list projects: " + err.Error()))
+		}
+
+		// Parse JSON result and extract projects array
+		var responseData map[string]interface{}
+		if err := json.Unmarshal([]byte(result), &responseData); err != nil {
+			panic(vm.NewTypeError("Failed to parse projects data: " + err.Error()))
+		}
+
+		// Debug: log what we got
+		log.Printf("🔍 Projects API response: %s", result)
+
+		// Return only the projects array, not the whole response object
+		projects, ok := responseData["projects"]
+		if !ok {
+			log.Printf("⚠️ No 'projects' field found in response")
+			return vm.ToValue([]interface{}{}) // Return empty array if no projects field
+		}
+
+		// Debug: log projects array
+		if projectsArray, ok := projects.([]interface{}); ok {
+			log.Printf("🔍 Found %d projects in array", len(projectsArray))
+			if len(projectsArray) > 0 {
+				log.Printf("🔍 First project: %+v", projectsArray[0])
+			}
+		}
+
+		return vm.ToValue(projects)
+	})
+
+	teamworkAPI.Set("listTasks", func(call goja.FunctionCall) goja.Value {
+		// Get optional parameters
+		parameters := make(map[string]interface{})
+		if len(call.Arguments) > 0 && !goja.IsUndefined(call.Arguments[0]) {
+			// If argument is object, use it as parameters
+			if obj := call.Arguments[0].ToObject(vm); obj != nil {
+				for _, key := range obj.Keys() {
+					value := obj.Get(key).Export()
+					// JS integers are exported as int64, handlers expect JSON-style float64 numbers
+					if number, ok := value.(int64); ok {
+						value = float64(number)
+					}
+					parameters[key] = value
+				}
+			}
+		}
+
+		result, err := executeListTasks(db, userID, chatID, parameters)
+		if err != nil {
+			panic(vm.NewTypeError("Failed to list tasks: " + err.Error()))
+		}
+
+		// Parse JSON result and extract tasks array
+		var responseData map[string]interface{}
+		if err := json.Unmarshal([]byte(result), &responseData); err != nil {
+			panic(vm.NewTypeError("Failed to parse tasks data: " + err.Error()))
+		}
+
+		// Return only the tasks array, not the whole response object
+		tasks, ok := responseData["tasks"]
+		if !ok {
+			return vm.ToValue([]interface{}{}) // Return empty array if no tasks field
+		}
+
+		return vm.ToValue(tasks)
+	})
+
+	teamworkAPI.Set("blockedTasks", func(call goja.FunctionCall) goja.Value {
+		result, err := executeBlockedTasks(db, userID, make(map[string]interface{}))
+		if err != nil {
+			panic(vm.NewTypeError("Failed to get blocked tasks: " + err.Error()))
+		}
+
+		var responseData map[string]interface{}
+		if err := json.Unmarshal([]byte(result), &responseData); err != nil {
+			panic(vm.NewTypeError("Failed to parse blocked tasks data: " + err.Error()))
+		}
+
+		tasks, ok := responseData["tasks"]
+		if !ok || tasks == nil {
+			return vm.ToValue([]interface{}{})
+		}
+
+		return vm.ToValue(tasks)
+	})
+
+	teamworkAPI.Set("recentlyCompleted", func(call goja.FunctionCall) goja.Value {
+		// A week unless the number of days is given
+		parameters := map[string]interface{}{"days": 7}
+		if len(call.Arguments) > 0 && !goja.IsUndefined(call.Arguments[0]) {
+			parameters["days"] = call.Arguments[0].ToInteger()
+		}
+
+		result, err := executeRecentlyCompleted(db, userID, parameters)
+		if err != nil {
+			panic(vm.NewTypeError("Failed to get recently completed tasks: " + err.Error()))
+		}
+
+		var responseData map[string]interface{}
+		if err := json.Unmarshal([]byte(result), &responseData); err != nil {
+			panic(vm.NewTypeError("Failed to parse recently completed tasks data: " + err.Error()))
+		}
+
+		tasks, ok := responseData["tasks"]
+		if !ok || tasks == nil {
+			return vm.ToValue([]interface{}{})
+		}
+
+		return vm.ToValue(tasks)
+	})
+
+	teamworkAPI.Set("upcomingTasks", func(call goja.FunctionCall) goja.Value {
+		// A week unless the number of days is given
+		parameters := map[string]interface{}{"days": 7}
+		if len(call.Arguments) > 0 && !goja.IsUndefined(call.Arguments[0]) {
+			parameters["days"] = call.Arguments[0].ToInteger()
+		}
+
+		result, err := executeListUpcomingTasks(db, userID, parameters)
+		if err != nil {
+			panic(vm.NewTypeError("Failed to get upcoming tasks: " + err.Error()))
 		}
 
-		callback := call.Arguments[0]
-		delay := call.Arguments[1].ToInteger()
+		var responseData map[string]interface{}
+		if err := json.Unmarshal([]byte(result), &responseData); err != nil {
+			panic(vm.NewTypeError("Failed to parse upcoming tasks data: " + err.Error()))
+		}
 
-		go func() {
-			time.Sleep(time.Duration(delay) * time.Millisecond)
-			if fn, ok := goja.AssertFunction(callback); ok {
-				_, err := fn(goja.Undefined())
-				if err != nil {
-					log.Printf("⚠️ setTimeout callback error: %v", err)
-				}
-			}
-		}()
+		tasks, ok := responseData["tasks"]
+		if !ok || tasks == nil {
+			return vm.ToValue([]interface{}{})
+		}
 
-		return goja.Undefined()
+		return vm.ToValue(tasks)
 	})
 
-	// Set up basic JSON support
-	vm.Set("JSON", vm.NewObject())
-	vm.RunString(`
-		JSON.parse = function(str) {
-			return JSON.parse(str);
-		};
-		JSON.stringify = function(obj, replacer, space) {
-			return JSON.stringify(obj, replacer, space);
-		};
-	`)
+	teamworkAPI.Set("listTaskAttachments", func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) == 0 {
+			panic(vm.NewTypeError("listTaskAttachments requires taskId"))
+		}
 
-	// Set up Teamwork API object
-	teamworkAPI := vm.NewObject()
+		parameters := map[string]interface{}{"task_id": call.Arguments[0].ToInteger()}
+		result, err := executeListTaskAttachments(db, userID, parameters)
+		if err != nil {
+			panic(vm.NewTypeError("Failed to get task attachments: " + err.Error()))
+		}
 
-	// READ FUNCTIONS - execute immediately
-	teamworkAPI.Set("listProjects", func(call goja.FunctionCall) goja.Value {
-		// Get optional status filter
-		var parameters map[string]interface{}
-		if len(call.Arguments) > 0 && !goja.IsUndefined(call.Arguments[0]) {
-			if status := call.Arguments[0].String(); status != "" {
-				parameters = map[string]interface{}{"status": status}
-			}
+		var responseData map[string]interface{}
+		if err := json.Unmarshal([]byte(result), &responseData); err != nil {
+			panic(vm.NewTypeError("Failed to parse task attachments data: " + err.Error()))
 		}
-		if parameters == nil {
-			parameters = make(map[string]interface{})
+
+		return vm.ToValue(responseData["attachments"])
+	})
+
+	teamworkAPI.Set("taskStatusHistory", func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) == 0 {
+			panic(vm.NewTypeError("taskStatusHistory requires taskId"))
 		}
 
-		result, err := executeListProjects(db, userID, parameters)
+		history, err := db.GetTaskStatusHistory(int(call.Arguments[0].ToInteger()), userID)
 		if err != nil {
-			panic(vm.NewTypeError("Failed to list projects: " + err.Error()))
+			panic(vm.NewTypeError("Failed to get task status history: " + err.Error()))
 		}
 
-		// Parse JSON result and extract projects array
-		var responseData map[string]interface{}
-		if err := json.Unmarshal([]byte(result), &responseData); err != nil {
-			panic(vm.NewTypeError("Failed to parse projects data: " + err.Error()))
+		// Round-trip through JSON so scripts see the json field names
+		data, err := json.Marshal(history)
+		if err != nil {
+			panic(vm.NewTypeError("Failed to encode task status history: " + err.Error()))
+		}
+		var changes []interface{}
+		if err := json.Unmarshal(data, &changes); err != nil {
+			panic(vm.NewTypeError("Failed to parse task status history: " + err.Error()))
 		}
 
-		// Debug: log what we got
-		log.Printf("🔍 Projects API response: %s", result)
+		return vm.ToValue(changes)
+	})
 
-		// Return only the projects array, not the whole response object
-		projects, ok := responseData["projects"]
-		if !ok {
-			log.Printf("⚠️ No 'projects' field found in response")
-			return vm.ToValue([]interface{}{}) // Return empty array if no projects field
+	teamworkAPI.Set("projectMetrics", func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) == 0 {
+			panic(vm.NewTypeError("projectMetrics requires projectId"))
 		}
 
-		// Debug: log projects array
-		if projectsArray, ok := projects.([]interface{}); ok {
-			log.Printf("🔍 Found %d projects in array", len(projectsArray))
-			if len(projectsArray) > 0 {
-				log.Printf("🔍 First project: %+v", projectsArray[0])
-			}
+		parameters := map[string]interface{}{"project_id": call.Arguments[0].ToFloat()}
+		result, err := executeProjectMetrics(db, userID, parameters)
+		if err != nil {
+			panic(vm.NewTypeError("Failed to get project metrics: " + err.Error()))
 		}
 
-		return vm.ToValue(projects)
+		var metrics map[string]interface{}
+		if err := json.Unmarshal([]byte(result), &metrics); err != nil {
+			panic(vm.NewTypeError("Failed to parse project metrics: " + err.Error()))
+		}
+
+		return vm.ToValue(metrics)
 	})
 
-	teamworkAPI.Set("listTasks", func(call goja.FunctionCall) goja.Value {
-		// Get optional parameters
+	teamworkAPI.Set("staleProjects", func(call goja.FunctionCall) goja.Value {
 		parameters := make(map[string]interface{})
 		if len(call.Arguments) > 0 && !goja.IsUndefined(call.Arguments[0]) {
-			// If argument is object, use it as parameters
-			if obj := call.Arguments[0].ToObject(vm); obj != nil {
-				for _, key := range obj.Keys() {
-					parameters[key] = obj.Get(key).Export()
-				}
-			}
+			parameters["days"] = call.Arguments[0].ToInteger()
 		}
 
-		result, err := executeListTasks(db, userID, parameters)
+		result, err := executeStaleProjects(db, userID, parameters)
 		if err != nil {
-			panic(vm.NewTypeError("Failed to list tasks: " + err.Error()))
+			panic(vm.NewTypeError("Failed to get stale projects: " + err.Error()))
 		}
 
-		// Parse JSON result and extract tasks array
 		var responseData map[string]interface{}
 		if err := json.Unmarshal([]byte(result), &responseData); err != nil {
-			panic(vm.NewTypeError("Failed to parse tasks data: " + err.Error()))
+			panic(vm.NewTypeError("Failed to parse stale projects data: " + err.Error()))
 		}
 
-		// Return only the tasks array, not the whole response object
-		tasks, ok := responseData["tasks"]
-		if !ok {
-			return vm.ToValue([]interface{}{}) // Return empty array if no tasks field
+		projects, ok := responseData["projects"]
+		if !ok || projects == nil {
+			return vm.ToValue([]interface{}{})
 		}
 
-		return vm.ToValue(tasks)
+		return vm.ToValue(projects)
 	})
 
 	teamworkAPI.Set("getCurrentProject", func(call goja.FunctionCall) goja.Value {
 		parameters := make(map[string]interface{})
-		result, err := executeGetCurrentProject(db, userID, parameters)
+		result, err := executeGetCurrentProject(db, userID, chatID, parameters)
 		if err != nil {
 			panic(vm.NewTypeError("Failed to get current project: " + err.Error()))
 		}
@@ -1618,6 +3023,54 @@ func executeJavaScriptDirect(db *DB, userID int, parameters map[string]interface
 		return vm.ToValue(projectData)
 	})
 
+	teamworkAPI.Set("projectDetail", func(call goja.FunctionCall) goja.Value {
+		// Project ID is optional, defaults to the current project
+		parameters := make(map[string]interface{})
+		if len(call.Arguments) > 0 && !goja.IsUndefined(call.Arguments[0]) {
+			parameters["project_id"] = call.Arguments[0].ToFloat()
+		}
+
+		result, err := executeProjectDetail(db, userID, chatID, parameters)
+		if err != nil {
+			panic(vm.NewTypeError("Failed to get project detail: " + err.Error()))
+		}
+
+		var detailData interface{}
+		if err := json.Unmarshal([]byte(result), &detailData); err != nil {
+			panic(vm.NewTypeError("Failed to parse project detail: " + err.Error()))
+		}
+
+		return vm.ToValue(detailData)
+	})
+
+	setProjectMuted := func(call goja.FunctionCall, muted bool) goja.Value {
+		// Project ID is optional, defaults to the current project
+		parameters := make(map[string]interface{})
+		if len(call.Arguments) > 0 && !goja.IsUndefined(call.Arguments[0]) {
+			parameters["project_id"] = call.Arguments[0].ToFloat()
+		}
+
+		result, err := executeSetProjectMuted(db, userID, chatID, parameters, muted)
+		if err != nil {
+			panic(vm.NewTypeError("Failed to update notifications: " + err.Error()))
+		}
+
+		var resultData interface{}
+		if err := json.Unmarshal([]byte(result), &resultData); err != nil {
+			panic(vm.NewTypeError("Failed to parse notifications data: " + err.Error()))
+		}
+
+		return vm.ToValue(resultData)
+	}
+
+	teamworkAPI.Set("muteProject", func(call goja.FunctionCall) goja.Value {
+		return setProjectMuted(call, true)
+	})
+
+	teamworkAPI.Set("unmuteProject", func(call goja.FunctionCall) goja.Value {
+		return setProjectMuted(call, false)
+	})
+
 	// WRITE FUNCTIONS - create pending operations that require confirmation
 	// We'll store pending operations in a global map that can be accessed later
 	teamworkAPI.Set("createProject", func(call goja.FunctionCall) goja.Value {
@@ -1632,9 +3085,12 @@ func executeJavaScriptDirect(db *DB, userID int, parameters map[string]interface
 		}
 
 		parameters := map[string]interface{}{
-			"name":        name,
+			"title":       name,
 			"description": description,
 		}
+		if len(call.Arguments) > 2 && !goja.IsUndefined(call.Arguments[2]) {
+			parameters["status"] = call.Arguments[2].String()
+		}
 
 		operation, err := handleCreateProject(userID, 0, parameters) // chatID will be set later
 		if err != nil {
@@ -1669,7 +3125,7 @@ func executeJavaScriptDirect(db *DB, userID int, parameters map[string]interface
 			}
 		}
 
-		operation, err := handleUpdateProject(userID, 0, parameters)
+		operation, err := CallGPTFunction(db, userID, chatID, "update_project", parameters)
 		if err != nil {
 			panic(vm.NewTypeError("Failed to create update project operation: " + err.Error()))
 		}
@@ -1692,7 +3148,7 @@ func executeJavaScriptDirect(db *DB, userID int, parameters map[string]interface
 			"project_id": projectID,
 		}
 
-		operation, err := handleDeleteProject(userID, 0, parameters)
+		operation, err := CallGPTFunction(db, userID, chatID, "delete_project", parameters)
 		if err != nil {
 			panic(vm.NewTypeError("Failed to create delete project operation: " + err.Error()))
 		}
@@ -1705,6 +3161,28 @@ func executeJavaScriptDirect(db *DB, userID int, parameters map[string]interface
 		})
 	})
 
+	teamworkAPI.Set("restoreProject", func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) < 1 {
+			panic(vm.NewTypeError("restoreProject requires 1 argument (project_id)"))
+		}
+
+		parameters := map[string]interface{}{
+			"project_id": call.Arguments[0].ToFloat(),
+		}
+
+		operation, err := CallGPTFunction(db, userID, chatID, "restore_project", parameters)
+		if err != nil {
+			panic(vm.NewTypeError("Failed to create restore project operation: " + err.Error()))
+		}
+
+		return vm.ToValue(map[string]interface{}{
+			"requiresConfirmation": true,
+			"operationID":          operation.ID,
+			"description":          operation.Description,
+			"type":                 "restore_project",
+		})
+	})
+
 	teamworkAPI.Set("createTask", func(call goja.FunctionCall) goja.Value {
 		if len(call.Arguments) < 1 {
 			panic(vm.NewTypeError("createTask requires at least 1 argument (title)"))
@@ -1724,7 +3202,22 @@ func executeJavaScriptDirect(db *DB, userID int, parameters map[string]interface
 			}
 		}
 
-		operation, err := handleCreateTask(userID, 0, parameters)
+		// Without project_id the task goes to the current or the only project,
+		// with several projects and none current the user picks one with buttons
+		if projectID, ok := intParam(parameters, "project_id"); ok {
+			parameters["project_id"] = float64(projectID)
+		} else {
+			delete(parameters, "project_id")
+			projectID, err := resolveTaskProject(db, userID, chatID)
+			if err != nil {
+				panic(vm.NewTypeError("Failed to create task operation: " + err.Error()))
+			}
+			if projectID != 0 {
+				parameters["project_id"] = float64(projectID)
+			}
+		}
+
+		operation, err := CallGPTFunction(db, userID, chatID, "create_task", parameters)
 		if err != nil {
 			panic(vm.NewTypeError("Failed to create task operation: " + err.Error()))
 		}
@@ -1756,7 +3249,7 @@ func executeJavaScriptDirect(db *DB, userID int, parameters map[string]interface
 			}
 		}
 
-		operation, err := handleUpdateTask(userID, 0, parameters)
+		operation, err := CallGPTFunction(db, userID, chatID, "update_task", parameters)
 		if err != nil {
 			panic(vm.NewTypeError("Failed to create update task operation: " + err.Error()))
 		}
@@ -1769,6 +3262,144 @@ func executeJavaScriptDirect(db *DB, userID int, parameters map[string]interface
 		})
 	})
 
+	teamworkAPI.Set("addTaskDependency", func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) < 2 {
+			panic(vm.NewTypeError("addTaskDependency requires 2 arguments (task_id, depends_on_task_id)"))
+		}
+
+		parameters := map[string]interface{}{
+			"task_id":            call.Arguments[0].ToFloat(),
+			"depends_on_task_id": call.Arguments[1].ToFloat(),
+		}
+
+		operation, err := CallGPTFunction(db, userID, chatID, "add_task_dependency", parameters)
+		if err != nil {
+			panic(vm.NewTypeError("Failed to create task dependency operation: " + err.Error()))
+		}
+
+		return vm.ToValue(map[string]interface{}{
+			"requiresConfirmation": true,
+			"operationID":          operation.ID,
+			"description":          operation.Description,
+			"type":                 "add_task_dependency",
+		})
+	})
+
+	teamworkAPI.Set("moveTask", func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) < 2 {
+			panic(vm.NewTypeError("moveTask requires 2 arguments (task_id, new_project_id)"))
+		}
+
+		parameters := map[string]interface{}{
+			"task_id":        call.Arguments[0].ToFloat(),
+			"new_project_id": call.Arguments[1].ToFloat(),
+		}
+
+		operation, err := CallGPTFunction(db, userID, chatID, "move_task", parameters)
+		if err != nil {
+			panic(vm.NewTypeError("Failed to create move task operation: " + err.Error()))
+		}
+
+		return vm.ToValue(map[string]interface{}{
+			"requiresConfirmation": true,
+			"operationID":          operation.ID,
+			"description":          operation.Description,
+			"type":                 "move_task",
+		})
+	})
+
+	teamworkAPI.Set("setTaskDeadline", func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) < 2 {
+			panic(vm.NewTypeError("setTaskDeadline requires 2 arguments (task_id, deadline)"))
+		}
+
+		parameters := map[string]interface{}{
+			"task_id":  call.Arguments[0].ToFloat(),
+			"deadline": call.Arguments[1].String(),
+		}
+
+		operation, err := CallGPTFunction(db, userID, chatID, "set_task_deadline", parameters)
+		if err != nil {
+			panic(vm.NewTypeError("Failed to create set task deadline operation: " + err.Error()))
+		}
+
+		return vm.ToValue(map[string]interface{}{
+			"requiresConfirmation": true,
+			"operationID":          operation.ID,
+			"description":          operation.Description,
+			"type":                 "set_task_deadline",
+		})
+	})
+
+	teamworkAPI.Set("setTaskPriority", func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) < 2 {
+			panic(vm.NewTypeError("setTaskPriority requires 2 arguments (task_id, priority)"))
+		}
+
+		parameters := map[string]interface{}{
+			"task_id":  call.Arguments[0].ToFloat(),
+			"priority": call.Arguments[1].String(),
+		}
+
+		operation, err := CallGPTFunction(db, userID, chatID, "set_task_priority", parameters)
+		if err != nil {
+			panic(vm.NewTypeError("Failed to create set task priority operation: " + err.Error()))
+		}
+
+		return vm.ToValue(map[string]interface{}{
+			"requiresConfirmation": true,
+			"operationID":          operation.ID,
+			"description":          operation.Description,
+			"type":                 "set_task_priority",
+		})
+	})
+
+	teamworkAPI.Set("setProjectDescription", func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) < 2 {
+			panic(vm.NewTypeError("setProjectDescription requires 2 arguments (project_id, description)"))
+		}
+
+		parameters := map[string]interface{}{
+			"project_id":  call.Arguments[0].ToFloat(),
+			"description": call.Arguments[1].String(),
+		}
+
+		operation, err := CallGPTFunction(db, userID, chatID, "set_project_description", parameters)
+		if err != nil {
+			panic(vm.NewTypeError("Failed to create set project description operation: " + err.Error()))
+		}
+
+		return vm.ToValue(map[string]interface{}{
+			"requiresConfirmation": true,
+			"operationID":          operation.ID,
+			"description":          operation.Description,
+			"type":                 "set_project_description",
+		})
+	})
+
+	teamworkAPI.Set("shiftDeadlines", func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) < 2 {
+			panic(vm.NewTypeError("shiftDeadlines requires 2 arguments (project_id, days)"))
+		}
+
+		parameters := map[string]interface{}{
+			"project_id": call.Arguments[0].ToFloat(),
+			"days":       call.Arguments[1].ToFloat(),
+		}
+
+		operation, err := CallGPTFunction(db, userID, chatID, "shift_deadlines", parameters)
+		if err != nil {
+			panic(vm.NewTypeError("Failed to create shift deadlines operation: " + err.Error()))
+		}
+
+		return vm.ToValue(map[string]interface{}{
+			"requiresConfirmation": true,
+			"operationID":          operation.ID,
+			"description":          operation.Description,
+			"type":                 "shift_deadlines",
+		})
+	})
+
 	teamworkAPI.Set("deleteTask", func(call goja.FunctionCall) goja.Value {
 		if len(call.Arguments) < 1 {
 			panic(vm.NewTypeError("deleteTask requires 1 argument (task_id)"))
@@ -1779,7 +3410,7 @@ func executeJavaScriptDirect(db *DB, userID int, parameters map[string]interface
 			"task_id": taskID,
 		}
 
-		operation, err := handleDeleteTask(userID, 0, parameters)
+		operation, err := CallGPTFunction(db, userID, chatID, "delete_task", parameters)
 		if err != nil {
 			panic(vm.NewTypeError("Failed to create delete task operation: " + err.Error()))
 		}
@@ -1915,10 +3546,19 @@ func executeJavaScriptDirect(db *DB, userID int, parameters map[string]interface
 		return "", fmt.Errorf("⏰ Вычисление заняло слишком много времени (%d сек)", timeout)
 	case err := <-errChan:
 		log.Printf("❌ JavaScript execution failed for user %d: %v", userID, err)
-		return "", fmt.Errorf("❌ Ошибка вычисления: %v", err)
+		return "", fmt.Errorf("❌ Ошибка вычисления: %w", err)
 	case result := <-resultChan:
 		log.Printf("✅ JavaScript executed successfully for user %d", userID)
 
+		// Cap messages and output so a runaway script can't bloat history and the next prompt
+		if maxOutputBytes > 0 {
+			var truncated bool
+			userMessages, outputData, truncated = limitJavaScriptOutput(userMessages, outputData, maxOutputBytes)
+			if truncated {
+				log.Printf("✂️ JavaScript output for user %d truncated to %d bytes", userID, maxOutputBytes)
+			}
+		}
+
 		// Build response structure
 		response := map[string]interface{}{}
 
@@ -1927,13 +3567,18 @@ func executeJavaScriptDirect(db *DB, userID int, parameters map[string]interface
 			response["messages"] = userMessages
 		}
 
+		// Add messages with buttons if any
+		if len(buttonMessages) > 0 {
+			response["button_messages"] = buttonMessages
+		}
+
 		// Add output data if any (as array, not joined string)
 		if len(outputData) > 0 {
 			response["output"] = outputData
 		}
 
 		// If no specific outputs, include execution result as array for consistency
-		if len(outputData) == 0 && len(userMessages) == 0 {
+		if len(outputData) == 0 && len(userMessages) == 0 && len(buttonMessages) == 0 {
 			var resultStr string
 			if result == nil {
 				resultStr = "undefined"
@@ -1953,6 +3598,41 @@ func executeJavaScriptDirect(db *DB, userID int, parameters map[string]interface
 	}
 }
 
+// limitJavaScriptOutput caps the total size of messages and output at maxBytes.
+// Messages are kept first, the entry crossing the limit is cut with a marker and the rest dropped
+func limitJavaScriptOutput(messages, output []string, maxBytes int) ([]string, []string, bool) {
+	remaining := maxBytes
+	truncated := false
+
+	limit := func(items []string) []string {
+		var kept []string
+		for _, item := range items {
+			if truncated {
+				break
+			}
+			if len(item) <= remaining {
+				kept = append(kept, item)
+				remaining -= len(item)
+				continue
+			}
+
+			// Cut on a rune boundary so multibyte text stays valid
+			cut := remaining
+			for cut > 0 && !utf8.RuneStart(item[cut]) {
+				cut--
+			}
+			kept = append(kept, item[:cut]+fmt.Sprintf("\n…[вывод обрезан: превышен лимит %d байт]", maxBytes))
+			remaining = 0
+			truncated = true
+		}
+		return kept
+	}
+
+	messages = limit(messages)
+	output = limit(output)
+	return messages, output, truncated
+}
+
 // executeJavaScript executes JavaScript code in a secure sandbox using Goja with custom fetch
 func executeJavaScript(db *DB, operation *PendingOperation) *OperationResult {
 	code := operation.Parameters["code"].(string)
@@ -0,0 +1,275 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFilterTaskProjects(t *testing.T) {
+	projects := []*Project{
+		{ID: 1, Status: StatusActive, UserRole: RoleOwner},
+		{ID: 2, Status: StatusCompleted, UserRole: RoleOwner},
+		{ID: 3, Status: StatusPaused, UserRole: RoleMember},
+		{ID: 4, Status: StatusActive, UserRole: RoleViewer},
+		{ID: 5, Status: StatusCancelled, UserRole: RoleMember},
+		{ID: 6, Status: StatusPlanning, UserRole: RoleAdmin},
+	}
+
+	var got []int
+	for _, project := range filterTaskProjects(projects) {
+		got = append(got, project.ID)
+	}
+	want := []int{1, 3, 6}
+	if len(got) != len(want) {
+		t.Fatalf("filterTaskProjects() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("filterTaskProjects() = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestFilterTaskProjectsLimit(t *testing.T) {
+	var projects []*Project
+	for i := 1; i <= maxTaskProjectChoices+3; i++ {
+		projects = append(projects, &Project{ID: i, Status: StatusActive, UserRole: RoleMember})
+	}
+	if got := filterTaskProjects(projects); len(got) != maxTaskProjectChoices {
+		t.Errorf("filterTaskProjects() returned %d projects, want %d", len(got), maxTaskProjectChoices)
+	}
+}
+
+func TestOnlyTaskProject(t *testing.T) {
+	tests := []struct {
+		name    string
+		choices []*Project
+		want    int
+		wantErr bool
+	}{
+		{"no projects", nil, 0, true},
+		{"one project", []*Project{{ID: 7}}, 7, false},
+		{"several projects", []*Project{{ID: 7}, {ID: 8}}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := onlyTaskProject(tt.choices)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("onlyTaskProject() = %d, %v, want %d, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResolveTaskProject(t *testing.T) {
+	db := openTestDB(t)
+	user := createTestUser(t, db, "member")
+
+	resolve := func() (int, error) {
+		t.Helper()
+		// A new project becomes current, resolution without one is what is tested
+		if err := db.ClearCurrentProject(user.ID, 0); err != nil {
+			t.Fatalf("ClearCurrentProject() error = %v", err)
+		}
+		return resolveTaskProject(db, user.ID, 0)
+	}
+
+	if _, err := resolve(); err == nil {
+		t.Errorf("resolveTaskProject() without projects succeeded")
+	}
+
+	first, err := db.CreateProject(user.ID, 0, "Первый", "")
+	if err != nil {
+		t.Fatalf("CreateProject() error = %v", err)
+	}
+	if got, err := resolve(); err != nil || got != first.ID {
+		t.Errorf("resolveTaskProject() with one project = %d, %v, want %d", got, err, first.ID)
+	}
+
+	second, err := db.CreateProject(user.ID, 0, "Второй", "")
+	if err != nil {
+		t.Fatalf("CreateProject() error = %v", err)
+	}
+	if got, err := resolve(); err != nil || got != 0 {
+		t.Errorf("resolveTaskProject() with several projects = %d, %v, want 0", got, err)
+	}
+
+	if err := db.SetCurrentProject(user.ID, 0, second.ID); err != nil {
+		t.Fatalf("SetCurrentProject() error = %v", err)
+	}
+	if got, err := resolveTaskProject(db, user.ID, 0); err != nil || got != second.ID {
+		t.Errorf("resolveTaskProject() with a current project = %d, %v, want %d", got, err, second.ID)
+	}
+}
+
+func TestParseMessageButtons(t *testing.T) {
+	button := func(text, action string) map[string]interface{} {
+		return map[string]interface{}{"text": text, "action": action}
+	}
+	buttons := func(count int) []interface{} {
+		var items []interface{}
+		for i := 0; i < count; i++ {
+			items = append(items, button("Кнопка", "action"))
+		}
+		return items
+	}
+	// customButtonPrefix takes 14 of the 64 bytes of callback data
+	longestAction := strings.Repeat("a", telegramCallbackDataLimit-len(customButtonPrefix))
+
+	tests := []struct {
+		name    string
+		message interface{}
+		buttons interface{}
+		want    []MessageButton
+		wantErr bool
+	}{
+		{"text and action", "Что дальше?", []interface{}{button("Создать", "create")},
+			[]MessageButton{{Text: "Создать", Action: "create"}}, false},
+		{"label and callback aliases", "Что дальше?", []interface{}{map[string]interface{}{"label": "Создать", "callback": "create"}},
+			[]MessageButton{{Text: "Создать", Action: "create"}}, false},
+		{"text wins over label", "Что дальше?", []interface{}{map[string]interface{}{"text": "Текст", "label": "Метка", "action": "go"}},
+			[]MessageButton{{Text: "Текст", Action: "go"}}, false},
+		{"six buttons", "Что дальше?", buttons(maxMessageButtons), nil, false},
+		{"seven buttons", "Что дальше?", buttons(maxMessageButtons + 1), nil, true},
+		{"longest action", "Что дальше?", []interface{}{button("Длинная", longestAction)},
+			[]MessageButton{{Text: "Длинная", Action: longestAction}}, false},
+		{"action over callback limit", "Что дальше?", []interface{}{button("Длинная", longestAction+"a")}, nil, true},
+		{"empty message", " ", buttons(1), nil, true},
+		{"no buttons", "Что дальше?", []interface{}{}, nil, true},
+		{"button not an object", "Что дальше?", []interface{}{"create"}, nil, true},
+		{"empty text", "Что дальше?", []interface{}{button(" ", "create")}, nil, true},
+		{"missing action", "Что дальше?", []interface{}{map[string]interface{}{"text": "Создать"}}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parameters := map[string]interface{}{"message": tt.message, "buttons": tt.buttons}
+			message, got, err := parseMessageButtons(parameters)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseMessageButtons() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if message != tt.message {
+				t.Errorf("parseMessageButtons() message = %q, want %q", message, tt.message)
+			}
+			if tt.want == nil {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseMessageButtons() = %v, want %v", got, tt.want)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("button %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestHandleShiftDeadlines(t *testing.T) {
+	tests := []struct {
+		name       string
+		parameters map[string]interface{}
+		want       string
+		wantErr    bool
+	}{
+		{"later", map[string]interface{}{"project_id": float64(3), "days": float64(7)}, "Сдвинуть все дедлайны проекта #3 на 7 дн. вперёд", false},
+		{"earlier", map[string]interface{}{"project_id": float64(3), "days": float64(-2)}, "Сдвинуть все дедлайны проекта #3 на 2 дн. назад", false},
+		{"zero days", map[string]interface{}{"project_id": float64(3), "days": float64(0)}, "", true},
+		{"no days", map[string]interface{}{"project_id": float64(3)}, "", true},
+		{"no project", map[string]interface{}{"days": float64(7)}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			operation, err := handleShiftDeadlines(1, 1, tt.parameters)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("handleShiftDeadlines() = %+v, want error", operation)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("handleShiftDeadlines() error = %v", err)
+			}
+			defer pendingOperations.Delete(operation.ID)
+			if operation.Type != "shift_deadlines" || operation.Description != tt.want {
+				t.Errorf("operation = %s %q, want shift_deadlines %q", operation.Type, operation.Description, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleSetTaskPriority(t *testing.T) {
+	tests := []struct {
+		name     string
+		priority interface{}
+		want     TaskPriority
+		wantErr  bool
+	}{
+		{"constant", "high", PriorityHigh, false},
+		{"synonym", "это срочно", PriorityUrgent, false},
+		{"english phrase", "low priority please", PriorityLow, false},
+		{"unrecognized", "когда-нибудь", "", true},
+		{"missing", nil, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parameters := map[string]interface{}{"task_id": float64(5)}
+			if tt.priority != nil {
+				parameters["priority"] = tt.priority
+			}
+
+			operation, err := handleSetTaskPriority(1, 1, parameters)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("handleSetTaskPriority() = %+v, want error", operation)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("handleSetTaskPriority() error = %v", err)
+			}
+			defer pendingOperations.Delete(operation.ID)
+			// Execution reads the parsed priority, not the free text
+			if got := operation.Parameters["priority"]; got != string(tt.want) {
+				t.Errorf("stored priority = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProjectCreatedMessage(t *testing.T) {
+	project := &Project{ID: 3, Title: "Сайт", Status: StatusPlanning}
+
+	tests := []struct {
+		name        string
+		madeCurrent bool
+		want        []string
+		notWant     []string
+	}{
+		{"made current", true, []string{"✅ Проект создан и выбран текущим!", "Сайт"}, []string{"⚠️"}},
+		{"current project not set", false, []string{"✅ Проект создан\n", "Сайт", "⚠️ Не удалось сделать проект текущим"}, []string{"выбран текущим"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := projectCreatedMessage(project, tt.madeCurrent)
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("projectCreatedMessage() = %q, want it to contain %q", got, want)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(got, notWant) {
+					t.Errorf("projectCreatedMessage() = %q, must not contain %q", got, notWant)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrorExample is a recurring mistake in generated JavaScript with its correction, shown to
+// the AI as a few-shot example
+type ErrorExample struct {
+	Kind  string `json:"kind"`
+	Title string `json:"title"`
+	Wrong string `json:"wrong"`
+	Right string `json:"right"`
+	Count int    `json:"count"` // Failures of this kind in the lookback window, 0 for default examples
+}
+
+// jsErrorKind recognizes one kind of JavaScript failure by the goja error text
+type jsErrorKind struct {
+	kind    string
+	pattern *regexp.Regexp
+	example ErrorExample
+}
+
+// jsErrorKinds are the recognized failures, checked in order. Unrecognized errors are stored
+// as "other" and never become examples since there is no correction to show
+var jsErrorKinds = []jsErrorKind{
+	{"map_object_literal", regexp.MustCompile(`Unexpected token :`), ErrorExample{
+		Title: "Объект в стрелочной функции без скобок",
+		Wrong: "projects.map(p => { title: p.title })",
+		Right: "projects.map(p => ({ title: p.title }))",
+	}},
+	{"unexpected_end", regexp.MustCompile(`Unexpected end of input|Unexpected EOF`), ErrorExample{
+		Title: "Незакрытая скобка",
+		Wrong: "tasks.forEach(t => { message(t.title); )",
+		Right: "tasks.forEach(t => { message(t.title); });",
+	}},
+	{"unterminated_string", regexp.MustCompile(`Unterminated string|Invalid or unexpected token`), ErrorExample{
+		Title: "Незакрытая строка или перенос строки внутри кавычек",
+		Wrong: "message(\"Задачи:\n\" + list);",
+		Right: "message(\"Задачи:\\n\" + list);",
+	}},
+	{"undefined_variable", regexp.MustCompile(`ReferenceError: .* is not defined`), ErrorExample{
+		Title: "Переменная не объявлена или API вызван без teamwork.",
+		Wrong: "let projects = listProjects();",
+		Right: "let projects = teamwork.listProjects();",
+	}},
+	{"not_a_function", regexp.MustCompile(`is not a function|has no member`), ErrorExample{
+		Title: "Вызов несуществующей функции API",
+		Wrong: "teamwork.getTasks();",
+		Right: "teamwork.listTasks();",
+	}},
+	{"property_of_undefined", regexp.MustCompile(`Cannot read property|of undefined|of null`), ErrorExample{
+		Title: "Обращение к полю без проверки результата",
+		Wrong: "message(teamwork.listTasks().tasks[0].title);",
+		Right: "let tasks = teamwork.listTasks().tasks;\nif (tasks.length > 0) { message(tasks[0].title); }",
+	}},
+	{"illegal_return", regexp.MustCompile(`Illegal return`), ErrorExample{
+		Title: "return вне функции",
+		Wrong: "return \"Готово\";",
+		Right: "message(\"Готово\");",
+	}},
+}
+
+// jsErrorOther is the kind of errors no pattern matched
+const jsErrorOther = "other"
+
+// defaultJSErrorExamples are shown until enough failures are recorded, the mistakes seen most
+// often before error data was collected
+var defaultJSErrorExamples = []string{"map_object_literal", "unexpected_end", "property_of_undefined"}
+
+// jsErrorLookbackDays limits the failures that count towards the examples, so the examples
+// follow the current prompt and model instead of old mistakes
+const jsErrorLookbackDays = 30
+
+// Stored failures are cut to these lengths in characters, the code and the error text only
+// help to find new kinds of failures and a runaway script must not fill the table
+const (
+	maxJSErrorCodeLength = 4000
+	maxJSErrorTextLength = 1000
+)
+
+// classifyJSError returns the kind of a JavaScript failure from its error text
+func classifyJSError(errText string) string {
+	for _, kind := range jsErrorKinds {
+		if kind.pattern.MatchString(errText) {
+			return kind.kind
+		}
+	}
+	return jsErrorOther
+}
+
+// jsErrorExample returns the example of a kind
+func jsErrorExample(kind string) (ErrorExample, bool) {
+	for _, k := range jsErrorKinds {
+		if k.kind == kind {
+			example := k.example
+			example.Kind = kind
+			return example, true
+		}
+	}
+	return ErrorExample{}, false
+}
+
+// RecordJSError stores a failed execution of generated JavaScript, classified by its full error.
+// The stored error and code are cut to maxJSErrorTextLength and maxJSErrorCodeLength
+func (db *DB) RecordJSError(userID int, errText, code string) error {
+	_, err := db.Exec(
+		"INSERT INTO js_errors (user_id, kind, error, code) VALUES (?, ?, ?, ?)",
+		userID, classifyJSError(errText), truncateRunes(errText, maxJSErrorTextLength), truncateRunes(code, maxJSErrorCodeLength),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record JavaScript error: %v", err)
+	}
+	return nil
+}
+
+// PurgeOldJSErrors removes failures older than jsErrorLookbackDays, they no longer count
+// towards the examples. Returns the number of removed rows
+func (db *DB) PurgeOldJSErrors() (int, error) {
+	result, err := db.Exec("DELETE FROM js_errors WHERE created_at < NOW() - INTERVAL ? DAY", jsErrorLookbackDays)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge old JavaScript errors: %v", err)
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	return int(removed), nil
+}
+
+// GetCommonJSErrors returns corrective examples for the most frequent recognized failures of
+// the last jsErrorLookbackDays, the default examples when none were recorded
+func (db *DB) GetCommonJSErrors(limit int) ([]ErrorExample, error) {
+	query := `
+		SELECT kind, COUNT(*) AS failures
+		FROM js_errors
+		WHERE kind <> ? AND created_at >= NOW() - INTERVAL ? DAY
+		GROUP BY kind
+		ORDER BY failures DESC, kind ASC
+		LIMIT ?
+	`
+
+	rows, err := db.Query(query, jsErrorOther, jsErrorLookbackDays, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get common JavaScript errors: %v", err)
+	}
+	defer rows.Close()
+
+	examples := []ErrorExample{}
+	for rows.Next() {
+		var kind string
+		var count int
+		if err := rows.Scan(&kind, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan JavaScript error: %v", err)
+		}
+		// Kinds removed from jsErrorKinds may still be stored
+		if example, ok := jsErrorExample(kind); ok {
+			example.Count = count
+			examples = append(examples, example)
+		}
+	}
+
+	if len(examples) == 0 {
+		return defaultErrorExamples(limit), nil
+	}
+	return examples, nil
+}
+
+// defaultErrorExamples returns up to limit default examples
+func defaultErrorExamples(limit int) []ErrorExample {
+	examples := []ErrorExample{}
+	for _, kind := range defaultJSErrorExamples {
+		if len(examples) >= limit {
+			break
+		}
+		if example, ok := jsErrorExample(kind); ok {
+			examples = append(examples, example)
+		}
+	}
+	return examples
+}
+
+// commonJSErrors holds the examples added to the system prompt, refreshed from the database
+var commonJSErrors = struct {
+	sync.RWMutex
+	examples []ErrorExample
+}{examples: defaultErrorExamples(3)}
+
+// currentErrorExamples returns the examples currently added to the system prompt
+func currentErrorExamples() []ErrorExample {
+	commonJSErrors.RLock()
+	defer commonJSErrors.RUnlock()
+	return commonJSErrors.examples
+}
+
+// jsErrorExamplesRefreshInterval is how often the examples are reloaded, they change slowly
+const jsErrorExamplesRefreshInterval = time.Hour
+
+// StartJSErrorExamplesRefresher loads the limit most common JavaScript failures into the system
+// prompt now and then every jsErrorExamplesRefreshInterval. A non-positive limit keeps the defaults
+func StartJSErrorExamplesRefresher(db *DB, limit int) {
+	if limit <= 0 {
+		return
+	}
+
+	refresh := func() {
+		examples, err := db.GetCommonJSErrors(limit)
+		if err != nil {
+			log.Printf("⚠️ Failed to refresh JavaScript error examples, keeping the previous ones: %v", err)
+			return
+		}
+		commonJSErrors.Lock()
+		commonJSErrors.examples = examples
+		commonJSErrors.Unlock()
+	}
+
+	refresh()
+	go func() {
+		ticker := time.NewTicker(jsErrorExamplesRefreshInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			refresh()
+		}
+	}()
+}
+
+// formatErrorExamples formats examples as numbered wrong/right pairs
+func formatErrorExamples(examples []ErrorExample) string {
+	var text strings.Builder
+	for i, example := range examples {
+		if i > 0 {
+			text.WriteString("\n\n")
+		}
+		fmt.Fprintf(&text, "%d. %s:\n❌ %s\n✅ %s", i+1, example.Title, example.Wrong, example.Right)
+	}
+	return text.String()
+}
@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestClassifyJSError(t *testing.T) {
+	tests := []struct {
+		name    string
+		errText string
+		want    string
+	}{
+		{"object literal", "SyntaxError: (anonymous): Line 1:25 Unexpected token :", "map_object_literal"},
+		{"unexpected end", "SyntaxError: Unexpected end of input", "unexpected_end"},
+		{"undefined variable", "ReferenceError: listProjects is not defined at <eval>:1:16", "undefined_variable"},
+		{"missing function", "TypeError: Object has no member 'getTasks'", "not_a_function"},
+		{"unknown", "RangeError: Maximum call stack size exceeded", jsErrorOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyJSError(tt.errText); got != tt.want {
+				t.Errorf("classifyJSError(%q) = %q, want %q", tt.errText, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordJSErrorCapsLength(t *testing.T) {
+	db := openTestDB(t)
+	user := createTestUser(t, db, "scripter")
+
+	code := strings.Repeat("я", maxJSErrorCodeLength+100)
+	errText := "SyntaxError: Unexpected end of input " + strings.Repeat("x", maxJSErrorTextLength)
+	if err := db.RecordJSError(user.ID, errText, code); err != nil {
+		t.Fatalf("RecordJSError() error = %v", err)
+	}
+
+	var kind, storedErr, storedCode string
+	err := db.QueryRow("SELECT kind, error, code FROM js_errors WHERE user_id = ?", user.ID).Scan(&kind, &storedErr, &storedCode)
+	if err != nil {
+		t.Fatalf("failed to read recorded error: %v", err)
+	}
+	if kind != "unexpected_end" {
+		t.Errorf("kind = %q, want unexpected_end", kind)
+	}
+	if length := utf8.RuneCountInString(storedCode); length != maxJSErrorCodeLength {
+		t.Errorf("stored code length = %d, want %d", length, maxJSErrorCodeLength)
+	}
+	if length := utf8.RuneCountInString(storedErr); length != maxJSErrorTextLength {
+		t.Errorf("stored error length = %d, want %d", length, maxJSErrorTextLength)
+	}
+}
+
+func TestPurgeOldJSErrors(t *testing.T) {
+	db := openTestDB(t)
+	user := createTestUser(t, db, "scripter")
+
+	tests := []struct {
+		name    string
+		ageDays int
+		kept    bool
+	}{
+		{"fresh", 0, true},
+		{"inside lookback", jsErrorLookbackDays - 1, true},
+		{"past lookback", jsErrorLookbackDays + 1, false},
+	}
+
+	for _, tt := range tests {
+		_, err := db.Exec(
+			"INSERT INTO js_errors (user_id, kind, error, code, created_at) VALUES (?, ?, ?, ?, NOW() - INTERVAL ? DAY)",
+			user.ID, jsErrorOther, tt.name, "", tt.ageDays,
+		)
+		if err != nil {
+			t.Fatalf("failed to insert %s error: %v", tt.name, err)
+		}
+	}
+
+	purged, err := db.PurgeOldJSErrors()
+	if err != nil {
+		t.Fatalf("PurgeOldJSErrors() error = %v", err)
+	}
+	if purged < 1 {
+		t.Errorf("PurgeOldJSErrors() = %d, want at least 1", purged)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var count int
+			err := db.QueryRow("SELECT COUNT(*) FROM js_errors WHERE user_id = ? AND error = ?", user.ID, tt.name).Scan(&count)
+			if err != nil {
+				t.Fatalf("failed to count errors: %v", err)
+			}
+			if kept := count == 1; kept != tt.kept {
+				t.Errorf("kept = %v, want %v", kept, tt.kept)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// orphanRule selects the rows of a table whose parent row is gone. Foreign keys keep a fresh
+// schema free of them, databases created before a table had its keys or restored with key
+// checks off may still hold some
+type orphanRule struct {
+	table     string
+	condition string
+}
+
+// orphanRules are checked in order: tasks go before the tables that reference tasks, so the
+// children of an orphaned task are removed in the same pass
+var orphanRules = []orphanRule{
+	{"project_users", `NOT EXISTS (SELECT 1 FROM projects p WHERE p.id = project_users.project_id)
+		OR NOT EXISTS (SELECT 1 FROM users u WHERE u.id = project_users.user_id)`},
+	{"tasks", `NOT EXISTS (SELECT 1 FROM projects p WHERE p.id = tasks.project_id)
+		OR NOT EXISTS (SELECT 1 FROM users u WHERE u.id = tasks.user_id)`},
+	{"task_dependencies", `NOT EXISTS (SELECT 1 FROM tasks t WHERE t.id = task_dependencies.task_id)
+		OR NOT EXISTS (SELECT 1 FROM tasks t WHERE t.id = task_dependencies.depends_on_task_id)`},
+	{"task_attachments", `NOT EXISTS (SELECT 1 FROM tasks t WHERE t.id = task_attachments.task_id)
+		OR NOT EXISTS (SELECT 1 FROM users u WHERE u.id = task_attachments.user_id)`},
+	{"task_status_history", `NOT EXISTS (SELECT 1 FROM tasks t WHERE t.id = task_status_history.task_id)
+		OR NOT EXISTS (SELECT 1 FROM users u WHERE u.id = task_status_history.user_id)`},
+	{"activity_log", `NOT EXISTS (SELECT 1 FROM users u WHERE u.id = activity_log.user_id)
+		OR NOT EXISTS (SELECT 1 FROM projects p WHERE p.id = activity_log.project_id)
+		OR (activity_log.task_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM tasks t WHERE t.id = activity_log.task_id))`},
+	{"project_notifications", `NOT EXISTS (SELECT 1 FROM users u WHERE u.id = project_notifications.user_id)
+		OR NOT EXISTS (SELECT 1 FROM projects p WHERE p.id = project_notifications.project_id)`},
+	{"messages", `NOT EXISTS (SELECT 1 FROM users u WHERE u.id = messages.user_id)`},
+	{"user_preferences", `NOT EXISTS (SELECT 1 FROM users u WHERE u.id = user_preferences.user_id)`},
+	{"js_errors", `NOT EXISTS (SELECT 1 FROM users u WHERE u.id = js_errors.user_id)`},
+	{"user_chat_state", `NOT EXISTS (SELECT 1 FROM users u WHERE u.id = user_chat_state.user_id)`},
+}
+
+// CleanupResult is the number of orphaned rows found or removed in a table
+type CleanupResult struct {
+	Table string
+	Rows  int
+}
+
+// CountOrphans returns the number of orphaned rows per table without removing them,
+// in the order CleanupOrphans removes them
+func (db *DB) CountOrphans() ([]CleanupResult, error) {
+	results := []CleanupResult{}
+	for _, rule := range orphanRules {
+		var count int
+		err := db.QueryRow("SELECT COUNT(*) FROM " + rule.table + " WHERE " + rule.condition).Scan(&count)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count orphaned %s: %v", rule.table, err)
+		}
+		results = append(results, CleanupResult{Table: rule.table, Rows: count})
+	}
+	return results, nil
+}
+
+// CleanupOrphans removes rows whose parent row is gone and returns the number removed per table.
+// Only orphans are removed, so running it again removes nothing. Rows removed by a cascade
+// from an orphaned task are not counted
+func (db *DB) CleanupOrphans() ([]CleanupResult, error) {
+	results := []CleanupResult{}
+	for _, rule := range orphanRules {
+		result, err := db.Exec("DELETE FROM " + rule.table + " WHERE " + rule.condition)
+		if err != nil {
+			return results, fmt.Errorf("failed to remove orphaned %s: %v", rule.table, err)
+		}
+		removed, err := result.RowsAffected()
+		if err != nil {
+			return results, fmt.Errorf("failed to get rows affected: %v", err)
+		}
+		results = append(results, CleanupResult{Table: rule.table, Rows: int(removed)})
+	}
+	return results, nil
+}
+
+// StartMaintenance removes orphaned rows and JavaScript failures past their lookback window now and
+// then every interval. Expired pending operations live in memory and have their own sweeper.
+// A non-positive interval disables the job
+func StartMaintenance(db *DB, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	cleanup := func() {
+		results, err := db.CleanupOrphans()
+		if err != nil {
+			log.Printf("⚠️ Database maintenance failed: %v", err)
+		}
+		for _, result := range results {
+			if result.Rows > 0 {
+				log.Printf("🧹 Removed %d orphaned rows from %s", result.Rows, result.Table)
+			}
+		}
+
+		purged, err := db.PurgeOldJSErrors()
+		if err != nil {
+			log.Printf("⚠️ Database maintenance failed: %v", err)
+		} else if purged > 0 {
+			log.Printf("🧹 Removed %d JavaScript errors older than %d days", purged, jsErrorLookbackDays)
+		}
+	}
+
+	cleanup()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			cleanup()
+		}
+	}()
+}
@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Markdown patterns converted to Telegram HTML. Inline markers must open and close
+// on the same line, unmatched markers are left as plain text
+var (
+	markdownCodeBlockRe  = regexp.MustCompile("(?s)```[a-zA-Z0-9_+-]*\\n?(.*?)```")
+	markdownInlineCodeRe = regexp.MustCompile("`([^`\\n]+)`")
+	markdownLinkRe       = regexp.MustCompile(`\[([^\]\n]+)\]\((https?://[^\s)]+)\)`)
+	markdownBoldRe       = regexp.MustCompile(`\*\*([^*\n]+?)\*\*|__([^_\n]+?)__`)
+	markdownItalicStarRe = regexp.MustCompile(`(^|[^*\p{L}\p{N}])\*([^*\s](?:[^*\n]*[^*\s])?)\*([^*\p{L}\p{N}]|$)`)
+	markdownItalicUndRe  = regexp.MustCompile(`(^|[^_\p{L}\p{N}])_([^_\s](?:[^_\n]*[^_\s])?)_([^_\p{L}\p{N}]|$)`)
+	markdownHeadingRe    = regexp.MustCompile(`(?m)^#{1,6}\s+(.+?)\s*#*$`)
+	markdownListItemRe   = regexp.MustCompile(`(?m)^(\s*)[-*+]\s+`)
+)
+
+// markdownPlaceholder marks code fragments extracted before other conversions
+const markdownPlaceholder = "\x00code%d\x00"
+
+// MarkdownToTelegramHTML converts common Markdown produced by the AI (bold, italic,
+// code, links, headings and lists) to the HTML subset supported by Telegram.
+// Existing HTML tags are kept as is, code contents are escaped
+func MarkdownToTelegramHTML(text string) string {
+	if !strings.ContainsAny(text, "*_`[#-+") {
+		return text
+	}
+
+	// Pull code out first so its contents are not treated as Markdown
+	var code []string
+	keep := func(fragment string) string {
+		code = append(code, fragment)
+		return fmt.Sprintf(markdownPlaceholder, len(code)-1)
+	}
+	text = markdownCodeBlockRe.ReplaceAllStringFunc(text, func(match string) string {
+		body := markdownCodeBlockRe.FindStringSubmatch(match)[1]
+		return keep("<pre>" + html.EscapeString(strings.TrimRight(body, "\n")) + "</pre>")
+	})
+	text = markdownInlineCodeRe.ReplaceAllStringFunc(text, func(match string) string {
+		return keep("<code>" + html.EscapeString(markdownInlineCodeRe.FindStringSubmatch(match)[1]) + "</code>")
+	})
+
+	text = markdownLinkRe.ReplaceAllStringFunc(text, func(match string) string {
+		parts := markdownLinkRe.FindStringSubmatch(match)
+		return keep(fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(parts[2]), parts[1]))
+	})
+
+	text = markdownHeadingRe.ReplaceAllString(text, "<b>$1</b>")
+	text = markdownListItemRe.ReplaceAllString(text, "${1}• ")
+	text = markdownBoldRe.ReplaceAllString(text, "<b>$1$2</b>")
+
+	// Adjacent italics share a boundary character, the second pass catches them
+	for i := 0; i < 2; i++ {
+		text = markdownItalicStarRe.ReplaceAllString(text, "$1<i>$2</i>$3")
+		text = markdownItalicUndRe.ReplaceAllString(text, "$1<i>$2</i>$3")
+	}
+
+	// Restore in reverse, later fragments (links) may contain earlier ones (code)
+	for i := len(code) - 1; i >= 0; i-- {
+		text = strings.Replace(text, fmt.Sprintf(markdownPlaceholder, i), code[i], 1)
+	}
+
+	return text
+}
@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestMarkdownToTelegramHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"plain text", "Готово, задача создана", "Готово, задача создана"},
+		{"existing HTML kept", "<b>Проект</b> создан", "<b>Проект</b> создан"},
+		{"bold", "**Срочно**: сдать отчёт", "<b>Срочно</b>: сдать отчёт"},
+		{"bold with underscores", "__Важно__", "<b>Важно</b>"},
+		{"italic", "это *очень* важно", "это <i>очень</i> важно"},
+		{"italic with underscores", "это _очень_ важно", "это <i>очень</i> важно"},
+		{"adjacent italics", "*раз* *два*", "<i>раз</i> <i>два</i>"},
+		{"identifiers untouched", "поля user_id и task_id", "поля user_id и task_id"},
+		{"multiplication untouched", "2*3*4 = 24", "2*3*4 = 24"},
+		{"inline code escaped", "вызови `a < b && **c**`", "вызови <code>a &lt; b &amp;&amp; **c**</code>"},
+		{"code block", "```js\nlet x = 1 < 2;\n```", "<pre>let x = 1 &lt; 2;</pre>"},
+		{"link", "[Документация](https://example.com/a?b=1&c=2)", `<a href="https://example.com/a?b=1&amp;c=2">Документация</a>`},
+		{"link with code URL kept", "см. [`main.go`](https://example.com)", `см. <a href="https://example.com"><code>main.go</code></a>`},
+		{"heading", "## Задачи на неделю", "<b>Задачи на неделю</b>"},
+		{"list", "- первая\n* вторая\n  + вложенная", "• первая\n• вторая\n  • вложенная"},
+		{"list with bold", "- **Сайт**: 3 задачи", "• <b>Сайт</b>: 3 задачи"},
+		{"unclosed bold", "**незакрыто", "**незакрыто"},
+		{"unclosed italic", "цена *от 100", "цена *от 100"},
+		{"unclosed code", "`незакрыто", "`незакрыто"},
+		{"markers across lines", "**начало\nконец**", "**начало\nконец**"},
+		{"not a link", "[текст](ftp://example.com)", "[текст](ftp://example.com)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MarkdownToTelegramHTML(tt.text); got != tt.want {
+				t.Errorf("MarkdownToTelegramHTML(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+// markdownTagRe matches the tags the converter produces
+var markdownTagRe = regexp.MustCompile(`</?(b|i|code|pre|a)(\s[^>]*)?>`)
+
+// balancedTags reports whether every tag the converter produces is closed in order
+func balancedTags(text string) bool {
+	var open []string
+	for _, match := range markdownTagRe.FindAllStringSubmatch(text, -1) {
+		if match[0][1] != '/' {
+			open = append(open, match[1])
+			continue
+		}
+		if len(open) == 0 || open[len(open)-1] != match[1] {
+			return false
+		}
+		open = open[:len(open)-1]
+	}
+	return len(open) == 0
+}
+
+func TestMarkdownToTelegramHTMLMalformed(t *testing.T) {
+	tests := []string{
+		"**жирный *курсив** конец*",
+		"*курсив **жирный* конец**",
+		"__a _b__ c_",
+		"`код **` текст**",
+		"[ссылка **жирная](https://example.com) конец**",
+		"```незакрытый блок\n**жирный**",
+		"- *пункт\n- пункт*",
+		"# **заголовок",
+		"***три звезды***",
+		"_*смесь_*",
+	}
+
+	for _, text := range tests {
+		t.Run(text, func(t *testing.T) {
+			if got := MarkdownToTelegramHTML(text); !balancedTags(got) {
+				t.Errorf("MarkdownToTelegramHTML(%q) = %q, tags are not balanced", text, got)
+			}
+		})
+	}
+}
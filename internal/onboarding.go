@@ -0,0 +1,153 @@
+package internal
+
+import (
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// welcomeAction is an onboarding button offered to users without projects. Pressing it replaces
+// the welcome message with the action's instructions
+type welcomeAction struct {
+	name   string // Name used in WELCOME_ACTIONS
+	label  string
+	data   string // Callback data
+	text   string // Instructions shown when the button is pressed
+	notice string // Short answer to the button press
+}
+
+// welcomeActionPrefix is the callback data prefix of onboarding buttons added after the
+// create project button, which keeps its original data for messages sent before
+const welcomeActionPrefix = "welcome_"
+
+// welcomeActions are the onboarding buttons operators can choose from, in the order they are shown
+var welcomeActions = []welcomeAction{
+	{
+		name:   "create_project",
+		label:  "➕ Создать проект",
+		data:   "create_project_button",
+		text:   "📋 У вас пока нет проектов\n\n💡 Для создания проекта отправьте сообщение в формате:\n\"Создать проект [название]\" или \"Создать проект [название] с описанием [описание]\"",
+		notice: "Отправьте название проекта!",
+	},
+	{
+		name:   "examples",
+		label:  "📖 Примеры запросов",
+		data:   welcomeActionPrefix + "examples",
+		text:   "📖 Примеры запросов, пишите своими словами:\n\n• Создай проект Сайт компании\n• Добавь задачу сверстать главную до пятницы\n• Какие задачи горят на этой неделе?\n• Отметь задачу про главную выполненной\n• Добавь @username в проект",
+		notice: "Попробуйте один из примеров!",
+	},
+	{
+		name:   "import",
+		label:  "📥 Импорт задач",
+		data:   welcomeActionPrefix + "import",
+		text:   "📥 Перенесём задачи из другого места\n\n💡 Создайте проект, затем отправьте список задач одним сообщением, по задаче на строку. Сроки можно указать прямо в строке, например:\n\"Подготовить макет до 15 марта\"",
+		notice: "Отправьте список задач!",
+	},
+	{
+		name:   "help",
+		label:  "❓ Помощь",
+		data:   welcomeActionPrefix + "help",
+		text:   "❓ Я веду проекты и задачи команды, просто пишите или говорите голосом, что нужно сделать.\n\nКоманды:\n/today - задачи на сегодня и просроченные\n/recent - недавние проекты\n/retro - итоги недели\n/export - выгрузка проекта\n/undo - отменить последнее действие\n/settings - настройки\n/whoami - ваш профиль",
+		notice: "Справка",
+	},
+}
+
+// defaultWelcomeActions are used when WELCOME_ACTIONS is not set
+var defaultWelcomeActions = []string{"create_project"}
+
+// maxWelcomeActionsPerRow keeps onboarding buttons readable on phones
+const maxWelcomeActionsPerRow = 2
+
+// limitWelcomeActions returns the known actions by name in the configured order.
+// Unknown names, repeats and callback data over the Telegram limit are skipped
+func limitWelcomeActions(names []string) []welcomeAction {
+	var result []welcomeAction
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		action, ok := findWelcomeAction(func(a welcomeAction) bool { return a.name == name })
+		if !ok {
+			log.Printf("Skipping unknown welcome action '%s'", name)
+			continue
+		}
+		if len(action.data) > telegramCallbackDataLimit {
+			log.Printf("Skipping welcome action '%s': exceeds callback data limit", name)
+			continue
+		}
+		result = append(result, action)
+	}
+	return result
+}
+
+// findWelcomeAction returns the first action matching match
+func findWelcomeAction(match func(welcomeAction) bool) (welcomeAction, bool) {
+	for _, action := range welcomeActions {
+		if match(action) {
+			return action, true
+		}
+	}
+	return welcomeAction{}, false
+}
+
+// buildWelcomeKeyboard lays out the onboarding actions and then the suggested project names,
+// two buttons per row
+func buildWelcomeKeyboard(actionNames []string, suggestions []string) [][]tgbotapi.InlineKeyboardButton {
+	var rows [][]tgbotapi.InlineKeyboardButton
+
+	var currentRow []tgbotapi.InlineKeyboardButton
+	for _, action := range limitWelcomeActions(actionNames) {
+		currentRow = append(currentRow, tgbotapi.NewInlineKeyboardButtonData(action.label, action.data))
+		if len(currentRow) == maxWelcomeActionsPerRow {
+			rows = append(rows, currentRow)
+			currentRow = nil
+		}
+	}
+	if len(currentRow) > 0 {
+		rows = append(rows, currentRow)
+		currentRow = nil
+	}
+
+	for _, name := range limitProjectSuggestions(suggestions) {
+		currentRow = append(currentRow, tgbotapi.NewInlineKeyboardButtonData("💡 "+name, suggestProjectPrefix+name))
+
+		// Two suggestions per row
+		if len(currentRow) == 2 {
+			rows = append(rows, currentRow)
+			currentRow = nil
+		}
+	}
+	if len(currentRow) > 0 {
+		rows = append(rows, currentRow)
+	}
+
+	return rows
+}
+
+// isWelcomeActionData returns whether callback data belongs to an onboarding button
+func isWelcomeActionData(data string) bool {
+	_, ok := findWelcomeAction(func(a welcomeAction) bool { return a.data == data })
+	return ok
+}
+
+// HandleWelcomeActionCallback replaces the welcome message with the instructions of the pressed
+// onboarding button. Buttons of actions removed from the configuration keep working
+func HandleWelcomeActionCallback(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery) {
+	action, ok := findWelcomeAction(func(a welcomeAction) bool { return a.data == query.Data })
+	if !ok {
+		bot.Send(tgbotapi.NewCallback(query.ID, "Неизвестное действие"))
+		return
+	}
+	log.Printf("👋 WELCOME ACTION '%s' clicked by user %d", action.name, query.From.ID)
+
+	editMsg := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, action.text)
+	editMsg.ParseMode = tgbotapi.ModeHTML // Enable HTML formatting
+	editMsg.ReplyMarkup = nil
+	bot.Send(editMsg)
+	bot.Send(tgbotapi.NewCallback(query.ID, action.notice))
+}
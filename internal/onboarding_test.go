@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// keyboardData returns the callback data of the buttons row by row
+func keyboardData(rows [][]tgbotapi.InlineKeyboardButton) [][]string {
+	var data [][]string
+	for _, row := range rows {
+		var rowData []string
+		for _, button := range row {
+			rowData = append(rowData, *button.CallbackData)
+		}
+		data = append(data, rowData)
+	}
+	return data
+}
+
+func TestBuildWelcomeKeyboard(t *testing.T) {
+	tooLong := strings.Repeat("я", telegramCallbackDataLimit)
+
+	tests := []struct {
+		name        string
+		actions     []string
+		suggestions []string
+		want        [][]string
+	}{
+		{"nothing", nil, nil, nil},
+		{"default action", defaultWelcomeActions, nil, [][]string{{"create_project_button"}}},
+		{"actions two per row", []string{"create_project", "examples", "import"}, nil,
+			[][]string{{"create_project_button", "welcome_examples"}, {"welcome_import"}}},
+		{"unknown and repeated actions skipped", []string{"help", "bogus", " help ", "create_project"}, nil,
+			[][]string{{"welcome_help", "create_project_button"}}},
+		{"suggestions start a new row", []string{"create_project"}, []string{"Сайт", "Бот", "CRM"},
+			[][]string{{"create_project_button"}, {"suggest_project_Сайт", "suggest_project_Бот"}, {"suggest_project_CRM"}}},
+		{"suggestions over the limit skipped", nil, []string{"Сайт", tooLong, "Бот"},
+			[][]string{{"suggest_project_Сайт", "suggest_project_Бот"}}},
+		{"at most four suggestions", nil, []string{"1", "2", "3", "4", "5"},
+			[][]string{{"suggest_project_1", "suggest_project_2"}, {"suggest_project_3", "suggest_project_4"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := keyboardData(buildWelcomeKeyboard(tt.actions, tt.suggestions)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("buildWelcomeKeyboard() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package internal
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pendingOperationStore keeps operations waiting for confirmation in memory. It is used from the
+// update loop, JavaScript goroutines and the sweeper, every access goes through its lock
+type pendingOperationStore struct {
+	mu         sync.Mutex
+	operations map[string]*PendingOperation
+}
+
+// pendingOperations stores pending operations in memory
+// In production, this should be stored in database
+var pendingOperations = &pendingOperationStore{operations: make(map[string]*PendingOperation)}
+
+// pendingOperationTTL is how long a pending operation waits for confirmation, 0 keeps them forever
+var pendingOperationTTL time.Duration
+
+// Put saves an operation until it is confirmed or cancelled
+func (s *pendingOperationStore) Put(operation *PendingOperation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.operations[operation.ID] = operation
+}
+
+// Get returns a pending operation by ID
+func (s *pendingOperationStore) Get(operationID string) (*PendingOperation, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	operation, exists := s.operations[operationID]
+	return operation, exists
+}
+
+// Delete removes a pending operation by ID
+func (s *pendingOperationStore) Delete(operationID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.operations, operationID)
+}
+
+// Take removes a pending operation by ID and returns it. Of several callers resolving the same
+// operation only one gets it, the others get false
+func (s *pendingOperationStore) Take(operationID string) (*PendingOperation, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	operation, exists := s.operations[operationID]
+	delete(s.operations, operationID)
+	return operation, exists
+}
+
+// Update runs fn on a pending operation under the store lock, so changing it doesn't race with
+// other goroutines reading or resolving it. Returns false if the operation is gone
+func (s *pendingOperationStore) Update(operationID string, fn func(operation *PendingOperation)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	operation, exists := s.operations[operationID]
+	if exists {
+		fn(operation)
+	}
+	return exists
+}
+
+// SetChat sets the chat an operation is confirmed in, operations created from JavaScript
+// get it only when they are shown
+func (s *pendingOperationStore) SetChat(operationID string, chatID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if operation, exists := s.operations[operationID]; exists {
+		operation.ChatID = chatID
+	}
+}
+
+// SetMessage records the message with the confirmation buttons of an operation
+func (s *pendingOperationStore) SetMessage(operationID string, messageID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if operation, exists := s.operations[operationID]; exists {
+		operation.MessageID = messageID
+	}
+}
+
+// FindByMessage returns the pending operation a message of the chat asks to confirm
+func (s *pendingOperationStore) FindByMessage(chatID int64, messageID int) (*PendingOperation, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, operation := range s.operations {
+		if operation.ChatID == chatID && operation.MessageID == messageID {
+			return operation, true
+		}
+	}
+	return nil, false
+}
+
+// Sweep removes operations created more than ttl ago and returns their number
+func (s *pendingOperationStore) Sweep(ttl time.Duration) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	for id, operation := range s.operations {
+		if time.Since(operation.CreatedAt) > ttl {
+			delete(s.operations, id)
+			removed++
+		}
+	}
+	return removed
+}
+
+// CancelFor removes all pending operations of the user in the chat and returns their number
+func (s *pendingOperationStore) CancelFor(userID int, chatID int64) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cancelled := 0
+	for id, operation := range s.operations {
+		// Operations created from JavaScript get their chat ID only when shown
+		if operation.UserID == userID && (operation.ChatID == chatID || operation.ChatID == 0) {
+			delete(s.operations, id)
+			cancelled++
+		}
+	}
+	return cancelled
+}
+
+// StartPendingOperationsSweeper periodically removes pending operations older than ttl.
+// A non-positive ttl disables the sweeper
+func StartPendingOperationsSweeper(ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	pendingOperationTTL = ttl
+
+	interval := ttl / 2
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if removed := pendingOperations.Sweep(ttl); removed > 0 {
+				log.Printf("🧹 Removed %d expired pending operations", removed)
+			}
+		}
+	}()
+}
+
+// isPendingOperationExpired reports whether an operation ID belongs to an operation
+// that outlived the TTL, based on the creation time encoded by generateOperationID
+func isPendingOperationExpired(operationID string) bool {
+	if pendingOperationTTL <= 0 {
+		return false
+	}
+
+	nanos, err := strconv.ParseInt(strings.TrimPrefix(operationID, "op_"), 10, 64)
+	if err != nil {
+		return false
+	}
+	return time.Since(time.Unix(0, nanos)) > pendingOperationTTL
+}
+
+// CancelPendingOperations removes all pending operations of the user in the chat
+// and returns the number of cancelled operations
+func CancelPendingOperations(userID int, chatID int64) int {
+	return pendingOperations.CancelFor(userID, chatID)
+}
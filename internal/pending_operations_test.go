@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestOperation(id string, userID int, chatID int64) *PendingOperation {
+	return &PendingOperation{
+		ID:         id,
+		UserID:     userID,
+		ChatID:     chatID,
+		Type:       "create_task",
+		Parameters: map[string]interface{}{"title": "Задача " + id},
+		CreatedAt:  time.Now(),
+	}
+}
+
+// Run with -race: creating, updating and confirming operations from many goroutines must not race
+// and every operation must be confirmed exactly once
+func TestPendingOperationStoreConcurrentConfirm(t *testing.T) {
+	store := &pendingOperationStore{operations: make(map[string]*PendingOperation)}
+
+	const operations = 50
+	const confirmers = 4
+
+	var confirmed [operations]int32
+	var wg sync.WaitGroup
+	for i := 0; i < operations; i++ {
+		id := fmt.Sprintf("op_test_%d", i)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			store.Put(newTestOperation(id, i, 100))
+			store.SetMessage(id, i)
+		}(i)
+
+		// Double clicks, reactions and a project choice arrive at the same time
+		for c := 0; c < confirmers; c++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for {
+					chosen := store.Update(id, func(operation *PendingOperation) {
+						operation.Parameters["project_id"] = float64(i)
+					})
+					store.FindByMessage(100, i)
+					if !chosen {
+						if atomic.LoadInt32(&confirmed[i]) > 0 {
+							return
+						}
+						continue
+					}
+					if operation, ok := store.Take(id); ok {
+						if _, ok := intParam(operation.Parameters, "project_id"); !ok {
+							t.Errorf("operation %s confirmed without a project", id)
+						}
+						atomic.AddInt32(&confirmed[i], 1)
+						return
+					}
+					if atomic.LoadInt32(&confirmed[i]) > 0 {
+						return
+					}
+				}
+			}(i)
+		}
+	}
+	wg.Wait()
+
+	for i, count := range confirmed {
+		if count != 1 {
+			t.Errorf("operation %d confirmed %d times, want 1", i, count)
+		}
+	}
+	if removed := store.Sweep(0); removed != 0 {
+		t.Errorf("%d operations left in the store", removed)
+	}
+}
+
+func TestPendingOperationStoreUpdate(t *testing.T) {
+	store := &pendingOperationStore{operations: make(map[string]*PendingOperation)}
+	store.Put(newTestOperation("op_1", 1, 100))
+
+	if !store.Update("op_1", func(operation *PendingOperation) { operation.Parameters["project_id"] = float64(7) }) {
+		t.Fatalf("Update of a stored operation returned false")
+	}
+	operation, _ := store.Get("op_1")
+	if projectID, _ := intParam(operation.Parameters, "project_id"); projectID != 7 {
+		t.Errorf("project_id = %d, want 7", projectID)
+	}
+
+	store.Delete("op_1")
+	called := false
+	if store.Update("op_1", func(*PendingOperation) { called = true }) || called {
+		t.Errorf("Update ran on a removed operation")
+	}
+}
+
+func TestPendingOperationStoreCancelFor(t *testing.T) {
+	store := &pendingOperationStore{operations: make(map[string]*PendingOperation)}
+	store.Put(newTestOperation("op_1", 1, 100))
+	store.Put(newTestOperation("op_2", 1, 0)) // Created from JavaScript, not shown yet
+	store.Put(newTestOperation("op_3", 1, 200))
+	store.Put(newTestOperation("op_4", 2, 100))
+
+	if cancelled := store.CancelFor(1, 100); cancelled != 2 {
+		t.Errorf("CancelFor() = %d, want 2", cancelled)
+	}
+	for id, want := range map[string]bool{"op_1": false, "op_2": false, "op_3": true, "op_4": true} {
+		if _, exists := store.Get(id); exists != want {
+			t.Errorf("%s exists = %v, want %v", id, exists, want)
+		}
+	}
+}
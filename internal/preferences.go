@@ -0,0 +1,125 @@
+package internal
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Default preferences for users who never changed their settings
+const (
+	defaultLanguage = "ru"
+	defaultTimezone = "Europe/Moscow"
+)
+
+// UserPreferences represents per-user settings
+type UserPreferences struct {
+	UserID        int    `json:"user_id"`
+	Language      string `json:"language"`       // "ru" or "en"
+	Timezone      string `json:"timezone"`       // IANA name, e.g. "Europe/Moscow"
+	DigestEnabled bool   `json:"digest_enabled"` // Whether the user receives the task digest
+
+	PreferredProvider string `json:"preferred_provider"` // AI provider for the user's requests, empty is the bot default
+}
+
+// Location returns the preferred timezone, falling back to the server timezone if it is invalid
+func (p *UserPreferences) Location() *time.Location {
+	loc, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		log.Printf("⚠️ Invalid timezone '%s' for user %d: %v", p.Timezone, p.UserID, err)
+		return time.Local
+	}
+	return loc
+}
+
+// GetUserPreferences returns the user's preferences, defaults if none are stored
+func (db *DB) GetUserPreferences(userID int) (*UserPreferences, error) {
+	prefs := &UserPreferences{
+		UserID:        userID,
+		Language:      defaultLanguage,
+		Timezone:      defaultTimezone,
+		DigestEnabled: true,
+	}
+
+	err := db.QueryRow(
+		"SELECT language, timezone, digest_enabled, preferred_provider FROM user_preferences WHERE user_id = ?",
+		userID,
+	).Scan(&prefs.Language, &prefs.Timezone, &prefs.DigestEnabled, &prefs.PreferredProvider)
+	if err == sql.ErrNoRows {
+		return prefs, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user preferences: %v", err)
+	}
+	resetUnavailableProvider(prefs)
+
+	return prefs, nil
+}
+
+// SaveUserPreferences stores the user's preferences
+func (db *DB) SaveUserPreferences(prefs *UserPreferences) error {
+	if _, err := time.LoadLocation(prefs.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone: %s", prefs.Timezone)
+	}
+	resetUnavailableProvider(prefs)
+
+	query := `
+		INSERT INTO user_preferences (user_id, language, timezone, digest_enabled, preferred_provider)
+		VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE language = VALUES(language), timezone = VALUES(timezone),
+		                        digest_enabled = VALUES(digest_enabled),
+		                        preferred_provider = VALUES(preferred_provider)
+	`
+
+	_, err := db.Exec(query, prefs.UserID, prefs.Language, prefs.Timezone, prefs.DigestEnabled, prefs.PreferredProvider)
+	if err != nil {
+		return fmt.Errorf("failed to save user preferences: %v", err)
+	}
+
+	return nil
+}
+
+// aiProviderChoices are the AI providers users may pick in /settings, set at startup
+var aiProviderChoices []string
+
+// SetAIProviderChoices sets the configured AI providers users may pick in /settings.
+// With fewer than two there is nothing to choose and the setting is hidden
+func SetAIProviderChoices(names []string) {
+	aiProviderChoices = names
+}
+
+// isAIProviderChoice reports whether name is a configured AI provider
+func isAIProviderChoice(name string) bool {
+	for _, choice := range aiProviderChoices {
+		if choice == name {
+			return true
+		}
+	}
+	return false
+}
+
+// resetUnavailableProvider switches a preferred provider that is no longer configured back to
+// the bot default. A provider removed from the configuration must not block saving other settings
+func resetUnavailableProvider(prefs *UserPreferences) {
+	if prefs.PreferredProvider != "" && !isAIProviderChoice(prefs.PreferredProvider) {
+		log.Printf("⚠️ AI provider '%s' of user %d is not available, using the default", prefs.PreferredProvider, prefs.UserID)
+		prefs.PreferredProvider = ""
+	}
+}
+
+// userPreferencesOrDefault returns the user's preferences, the defaults if they can't be loaded,
+// for requests that should still be answered when the preferences are unavailable
+func userPreferencesOrDefault(db *DB, userID int) *UserPreferences {
+	prefs, err := db.GetUserPreferences(userID)
+	if err != nil {
+		log.Printf("❌ Error getting preferences for user %d, using defaults: %v", userID, err)
+		return &UserPreferences{
+			UserID:        userID,
+			Language:      defaultLanguage,
+			Timezone:      defaultTimezone,
+			DigestEnabled: true,
+		}
+	}
+	return prefs
+}
@@ -0,0 +1,29 @@
+package internal
+
+import "testing"
+
+func TestResetUnavailableProvider(t *testing.T) {
+	defer SetAIProviderChoices(aiProviderChoices)
+	SetAIProviderChoices([]string{"openai", "claude"})
+
+	tests := []struct {
+		name     string
+		provider string
+		want     string
+	}{
+		{"bot default", "", ""},
+		{"configured provider", "claude", "claude"},
+		{"removed provider", "gemini", ""},
+		{"case differs", "Claude", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefs := &UserPreferences{UserID: 1, PreferredProvider: tt.provider}
+			resetUnavailableProvider(prefs)
+			if prefs.PreferredProvider != tt.want {
+				t.Errorf("PreferredProvider = %q, want %q", prefs.PreferredProvider, tt.want)
+			}
+		})
+	}
+}
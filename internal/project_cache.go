@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// projectsCacheEntry holds the projects of one user and when they were loaded
+type projectsCacheEntry struct {
+	projects []*Project
+	loadedAt time.Time
+}
+
+// projectsCache keeps GetUserProjects results per user. It is read on every message
+// (prompt context, welcome flow) while memberships change rarely
+var projectsCache = struct {
+	sync.Mutex
+	ttl     time.Duration
+	entries map[int]projectsCacheEntry
+}{entries: make(map[int]projectsCacheEntry)}
+
+// SetProjectsCacheTTL enables caching of user projects for ttl, a non-positive ttl disables it
+func SetProjectsCacheTTL(ttl time.Duration) {
+	projectsCache.Lock()
+	defer projectsCache.Unlock()
+
+	if ttl < 0 {
+		ttl = 0
+	}
+	projectsCache.ttl = ttl
+	projectsCache.entries = make(map[int]projectsCacheEntry)
+}
+
+// InvalidateUserProjects drops the cached projects of a user
+func InvalidateUserProjects(userID int) {
+	projectsCache.Lock()
+	defer projectsCache.Unlock()
+	delete(projectsCache.entries, userID)
+}
+
+// projectsCacheEnabled reports whether user projects are cached
+func projectsCacheEnabled() bool {
+	projectsCache.Lock()
+	defer projectsCache.Unlock()
+	return projectsCache.ttl > 0
+}
+
+// getCachedUserProjects returns a copy of the cached projects of a user if they are still fresh
+func getCachedUserProjects(userID int) ([]*Project, bool) {
+	projectsCache.Lock()
+	defer projectsCache.Unlock()
+
+	if projectsCache.ttl <= 0 {
+		return nil, false
+	}
+	entry, ok := projectsCache.entries[userID]
+	if !ok {
+		return nil, false
+	}
+	if time.Since(entry.loadedAt) > projectsCache.ttl {
+		delete(projectsCache.entries, userID)
+		return nil, false
+	}
+
+	return copyProjects(entry.projects), true
+}
+
+// cacheUserProjects stores a copy of the projects of a user
+func cacheUserProjects(userID int, projects []*Project) {
+	projectsCache.Lock()
+	defer projectsCache.Unlock()
+
+	if projectsCache.ttl <= 0 {
+		return
+	}
+	projectsCache.entries[userID] = projectsCacheEntry{
+		projects: copyProjects(projects),
+		loadedAt: time.Now(),
+	}
+}
+
+// copyProjects copies projects so callers can't modify cached values
+func copyProjects(projects []*Project) []*Project {
+	if projects == nil {
+		return nil
+	}
+
+	copied := make([]*Project, len(projects))
+	for i, project := range projects {
+		projectCopy := *project
+		copied[i] = &projectCopy
+	}
+	return copied
+}
+
+// projectMemberIDs returns the IDs of all project members, used to invalidate their cached
+// projects. It returns nil without querying when the cache is disabled
+func (db *DB) projectMemberIDs(projectID int) []int {
+	if !projectsCacheEnabled() {
+		return nil
+	}
+
+	rows, err := db.Query("SELECT user_id FROM project_users WHERE project_id = ?", projectID)
+	if err != nil {
+		log.Printf("⚠️ Failed to get members of project %d for cache invalidation: %v", projectID, err)
+		return nil
+	}
+	defer rows.Close()
+
+	var userIDs []int
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			log.Printf("⚠️ Failed to scan member of project %d: %v", projectID, err)
+			return userIDs
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	return userIDs
+}
+
+// invalidateProjectMembers drops the cached projects of every project member
+func (db *DB) invalidateProjectMembers(projectID int) {
+	for _, userID := range db.projectMemberIDs(projectID) {
+		InvalidateUserProjects(userID)
+	}
+}
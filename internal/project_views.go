@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+)
+
+// MarkProjectViewed records that the user looked at the project now, its new activity
+// badge is cleared until a task of the project changes again
+func (db *DB) MarkProjectViewed(projectID, userID int) error {
+	_, err := db.Exec(
+		"UPDATE project_users SET last_viewed_at = NOW() WHERE project_id = ? AND user_id = ?",
+		projectID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark project as viewed: %v", err)
+	}
+	return nil
+}
+
+// GetProjectsWithNewActivity returns the IDs of the user's projects with a task created or changed
+// after the user last viewed the project. A project never viewed counts from when the user joined
+func (db *DB) GetProjectsWithNewActivity(userID int) (map[int]bool, error) {
+	query := `
+		SELECT pu.project_id
+		FROM project_users pu
+		WHERE pu.user_id = ? AND EXISTS (
+			SELECT 1 FROM tasks t
+			WHERE t.project_id = pu.project_id
+			      AND t.updated_at > COALESCE(pu.last_viewed_at, pu.joined_at)
+		)
+	`
+
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get projects with new activity: %v", err)
+	}
+	defer rows.Close()
+
+	projectIDs := make(map[int]bool)
+	for rows.Next() {
+		var projectID int
+		if err := rows.Scan(&projectID); err != nil {
+			return nil, fmt.Errorf("failed to scan project ID: %v", err)
+		}
+		projectIDs[projectID] = true
+	}
+
+	return projectIDs, nil
+}
+
+// markNewActivity sets HasNewActivity on projects, errors only lose the badges
+func (db *DB) markNewActivity(userID int, projects []*Project) {
+	if len(projects) == 0 {
+		return
+	}
+
+	active, err := db.GetProjectsWithNewActivity(userID)
+	if err != nil {
+		log.Printf("⚠️ Failed to get new activity for user %d: %v", userID, err)
+		return
+	}
+	for _, project := range projects {
+		project.HasNewActivity = active[project.ID]
+	}
+}
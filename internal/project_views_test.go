@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetProjectsWithNewActivity(t *testing.T) {
+	db := openTestDB(t)
+	user := createTestUser(t, db, "viewer")
+
+	joined := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	at := func(hours int) *time.Time {
+		t := joined.Add(time.Duration(hours) * time.Hour)
+		return &t
+	}
+
+	tests := []struct {
+		name        string
+		lastViewed  *time.Time // nil for never viewed
+		taskUpdated *time.Time // nil for no tasks
+		want        bool
+	}{
+		{"never viewed, task changed after joining", nil, at(2), true},
+		{"never viewed, task changed before joining", nil, at(-2), false},
+		{"viewed after the change", at(3), at(2), false},
+		{"changed after the view", at(3), at(4), true},
+		{"no tasks", at(3), nil, false},
+	}
+
+	projectIDs := make(map[string]int)
+	for _, tt := range tests {
+		project, err := db.CreateProject(user.ID, 0, tt.name, "")
+		if err != nil {
+			t.Fatalf("CreateProject() error = %v", err)
+		}
+		projectIDs[tt.name] = project.ID
+
+		if _, err := db.Exec("UPDATE project_users SET joined_at = ?, last_viewed_at = ? WHERE project_id = ? AND user_id = ?",
+			joined, tt.lastViewed, project.ID, user.ID); err != nil {
+			t.Fatalf("failed to set view times: %v", err)
+		}
+		if tt.taskUpdated != nil {
+			task, err := db.CreateTask(project.ID, user.ID, "Задача", "", PriorityMedium, nil)
+			if err != nil {
+				t.Fatalf("CreateTask() error = %v", err)
+			}
+			if _, err := db.Exec("UPDATE tasks SET updated_at = ? WHERE id = ?", tt.taskUpdated, task.ID); err != nil {
+				t.Fatalf("failed to set task update time: %v", err)
+			}
+		}
+	}
+
+	active, err := db.GetProjectsWithNewActivity(user.ID)
+	if err != nil {
+		t.Fatalf("GetProjectsWithNewActivity() error = %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := active[projectIDs[tt.name]]; got != tt.want {
+				t.Errorf("new activity = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Viewing the project now clears its badge
+	changed := projectIDs["changed after the view"]
+	if err := db.MarkProjectViewed(changed, user.ID); err != nil {
+		t.Fatalf("MarkProjectViewed() error = %v", err)
+	}
+	active, err = db.GetProjectsWithNewActivity(user.ID)
+	if err != nil {
+		t.Fatalf("GetProjectsWithNewActivity() error = %v", err)
+	}
+	if active[changed] {
+		t.Errorf("project still has new activity after MarkProjectViewed")
+	}
+}
@@ -2,8 +2,10 @@ package internal
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 )
 
@@ -37,6 +39,22 @@ type Project struct {
 	CreatedAt   time.Time     `json:"created_at"`
 	UpdatedAt   time.Time     `json:"updated_at"`
 	UserRole    ProjectRole   `json:"user_role,omitempty"` // Role of current user in this project
+	MemberCount int           `json:"member_count"`
+
+	HasNewActivity bool              `json:"has_new_activity,omitempty"` // Tasks changed since the user last viewed the project, set by list_projects
+	TaskStats      *ProjectTaskStats `json:"task_stats,omitempty"`       // Set for the current project in the AI context
+}
+
+// ToPromptContext describes the project for the AI, one "- field: value" line per field.
+// It is the only place the project format for prompts is defined
+func (p *Project) ToPromptContext() string {
+	caps := CapabilitiesForRole(p.UserRole)
+	text := fmt.Sprintf("- ID: %d\n- Название: %s\n- Описание: %s\n- Статус: %s\n- Роль пользователя: %s\n- Разрешено: %s\n- Запрещено: %s",
+		p.ID, p.Title, p.Description, p.Status, p.UserRole, caps.Allowed(), caps.Denied())
+	if p.TaskStats != nil {
+		text += fmt.Sprintf("\n- Открытых задач: %d\n- Просроченных задач: %d", p.TaskStats.Open, p.TaskStats.Overdue)
+	}
+	return text
 }
 
 // ProjectUser represents a user's membership in a project
@@ -48,72 +66,199 @@ type ProjectUser struct {
 	JoinedAt  time.Time   `json:"joined_at"`
 }
 
-// CreateProject creates a new project and assigns the creator as owner
-func (db *DB) CreateProject(creatorUserID int, title, description string) (*Project, error) {
-	// Start transaction
-	tx, err := db.Begin()
-	if err != nil {
-		return nil, fmt.Errorf("failed to start transaction: %v", err)
+// InitialMember is a user added to a project when it is created
+type InitialMember struct {
+	UserID int
+	Role   ProjectRole
+}
+
+// validProjectRoles lists the roles a member can have
+var validProjectRoles = map[ProjectRole]bool{
+	RoleOwner:  true,
+	RoleAdmin:  true,
+	RoleMember: true,
+	RoleViewer: true,
+}
+
+// validProjectStatuses are the statuses a project can have
+var validProjectStatuses = map[ProjectStatus]bool{
+	StatusPlanning:  true,
+	StatusActive:    true,
+	StatusPaused:    true,
+	StatusCompleted: true,
+	StatusCancelled: true,
+}
+
+// defaultProjectStatus is the status of new projects created without one. It is always written
+// explicitly, the schema defaults of older databases may differ
+var defaultProjectStatus = StatusPlanning
+
+// SetDefaultProjectStatus sets the status of new projects, unknown statuses are ignored
+func SetDefaultProjectStatus(status ProjectStatus) {
+	if !validProjectStatuses[status] {
+		log.Printf("Warning: unknown default project status '%s', using %s", status, defaultProjectStatus)
+		return
 	}
-	defer tx.Rollback()
+	defaultProjectStatus = status
+}
 
-	// Create project
-	query := `
-		INSERT INTO projects (title, description) 
-		VALUES (?, ?)
-	`
+// CreateProject creates a new project with the default status and assigns the creator as owner.
+// The project becomes the creator's current project in the chat it was created from
+func (db *DB) CreateProject(creatorUserID int, chatID int64, title, description string) (*Project, error) {
+	return db.CreateProjectWithStatus(creatorUserID, chatID, title, description, "")
+}
+
+// CreateProjectWithStatus creates a new project with the given status, an empty status uses the default
+func (db *DB) CreateProjectWithStatus(creatorUserID int, chatID int64, title, description string, status ProjectStatus) (*Project, error) {
+	return db.CreateProjectWithMembers(creatorUserID, chatID, title, description, status, nil, false)
+}
 
-	result, err := tx.Exec(query, title, description)
+// CreateProjectWithMembers creates a project with the creator as owner and adds the given
+// members in the same transaction, so either all of them are added or the project is not created.
+// Members can only be owners when allowOwners is set
+func (db *DB) CreateProjectWithMembers(creatorUserID int, chatID int64, title, description string, status ProjectStatus, members []InitialMember, allowOwners bool) (*Project, error) {
+	title, err := sanitizeTitle(title, maxProjectTitleLength)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create project: %v", err)
+		return nil, err
 	}
+	description = sanitizeDescription(description)
 
-	projectID, err := result.LastInsertId()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get project ID: %v", err)
+	if status == "" {
+		status = defaultProjectStatus
+	}
+	if !validProjectStatuses[status] {
+		return nil, fmt.Errorf("invalid project status %q", status)
 	}
 
-	// Add creator as owner
-	_, err = tx.Exec(
-		"INSERT INTO project_users (project_id, user_id, role) VALUES (?, ?, ?)",
-		projectID, creatorUserID, RoleOwner,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to add project owner: %v", err)
+	seen := map[int]bool{creatorUserID: true}
+	for _, member := range members {
+		if !validProjectRoles[member.Role] {
+			return nil, fmt.Errorf("invalid role %q for user %d", member.Role, member.UserID)
+		}
+		if member.Role == RoleOwner && !allowOwners {
+			return nil, fmt.Errorf("user %d cannot be added as a second owner", member.UserID)
+		}
+		if seen[member.UserID] {
+			return nil, fmt.Errorf("user %d is listed more than once", member.UserID)
+		}
+		seen[member.UserID] = true
 	}
 
-	// Commit transaction
-	if err = tx.Commit(); err != nil {
-		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	var projectID int64
+	err = db.WithTx(func(tx *sql.Tx) error {
+		// Create project
+		query := `
+			INSERT INTO projects (title, description, status) 
+			VALUES (?, ?, ?)
+		`
+
+		result, err := tx.Exec(query, title, description, status)
+		if err != nil {
+			return fmt.Errorf("failed to create project: %v", err)
+		}
+
+		projectID, err = result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to get project ID: %v", err)
+		}
+
+		// Add creator as owner
+		_, err = tx.Exec(
+			"INSERT INTO project_users (project_id, user_id, role) VALUES (?, ?, ?)",
+			projectID, creatorUserID, RoleOwner,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to add project owner: %v", err)
+		}
+
+		// Add initial members
+		for _, member := range members {
+			_, err = tx.Exec(
+				"INSERT INTO project_users (project_id, user_id, role) VALUES (?, ?, ?)",
+				projectID, member.UserID, member.Role,
+			)
+			if err != nil {
+				return fmt.Errorf("failed to add user %d to project: %v", member.UserID, err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	InvalidateUserProjects(creatorUserID)
+	for _, member := range members {
+		InvalidateUserProjects(member.UserID)
 	}
 
-	// Set this project as the user's current project
-	if err = db.SetUserCurrentProject(creatorUserID, int(projectID)); err != nil {
+	// Set this project as the user's current project in the chat it was created from
+	if err = db.SetCurrentProject(creatorUserID, chatID, int(projectID)); err != nil {
 		// Log error but don't fail the creation
 		log.Printf("Warning: failed to set current project for user %d: %v", creatorUserID, err)
 	}
 
-	return db.GetProjectByIDForUser(int(projectID), creatorUserID)
+	// The project exists at this point, a failed read-back must not look like a failed creation
+	project, err := db.GetProjectByIDForUser(int(projectID), creatorUserID)
+	if err != nil || project == nil {
+		log.Printf("Warning: failed to read back created project %d: %v", projectID, err)
+		now := time.Now()
+		return &Project{
+			ID:          int(projectID),
+			Title:       title,
+			Description: description,
+			Status:      status,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+			UserRole:    RoleOwner,
+			MemberCount: 1 + len(members),
+		}, nil
+	}
+
+	return project, nil
 }
 
-// GetProjectByIDForUser retrieves a project by its ID with user's role
-func (db *DB) GetProjectByIDForUser(projectID, userID int) (*Project, error) {
-	query := `
-		SELECT p.id, p.title, p.description, p.status, 
-		       p.created_at, p.updated_at, pu.role
-		FROM projects p
-		JOIN project_users pu ON p.id = pu.project_id
-		WHERE p.id = ? AND pu.user_id = ?
-	`
+// projectColumns is the column list read by scanProject.
+// Queries must alias projects as p and project_users (for the current user) as pu.
+// The member count is a subquery so lists don't need a query per project for it
+const projectColumns = `p.id, p.title, p.description, p.status, 
+		       p.created_at, p.updated_at, pu.role,
+		       (SELECT COUNT(*) FROM project_users mc WHERE mc.project_id = p.id) AS member_count`
 
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanProject scans a row selected with projectColumns into a Project.
+// UserRole stays empty when pu matched no membership row
+func scanProject(row rowScanner) (*Project, error) {
 	project := &Project{}
+	var role sql.NullString
 
-	err := db.QueryRow(query, projectID, userID).Scan(
+	err := row.Scan(
 		&project.ID, &project.Title, &project.Description,
 		&project.Status, &project.CreatedAt, &project.UpdatedAt,
-		&project.UserRole,
+		&role, &project.MemberCount,
 	)
+	if err != nil {
+		return nil, err
+	}
+	project.UserRole = ProjectRole(role.String)
+
+	return project, nil
+}
+
+// GetProjectByIDForUser retrieves a project by its ID with user's role
+func (db *DB) GetProjectByIDForUser(projectID, userID int) (*Project, error) {
+	query := `
+		SELECT ` + projectColumns + `
+		FROM projects p
+		JOIN project_users pu ON p.id = pu.project_id
+		WHERE p.id = ? AND pu.user_id = ? AND p.deleted_at IS NULL
+	`
 
+	project, err := scanProject(db.QueryRow(query, projectID, userID))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -124,68 +269,136 @@ func (db *DB) GetProjectByIDForUser(projectID, userID int) (*Project, error) {
 	return project, nil
 }
 
-// GetUserProjects retrieves all projects for a specific user
-func (db *DB) GetUserProjects(userID int) ([]*Project, error) {
+// projectSortColumns maps allowed sort options to columns, user input is never put into SQL
+var projectSortColumns = map[string]string{
+	"created": "p.created_at",
+	"updated": "p.updated_at",
+	"title":   "p.title",
+	"status":  "p.status",
+}
+
+// GetProjectsByIDs loads several projects in one query, keyed by ID. Duplicate IDs are loaded once
+// and missing projects are left out. Access is not checked and UserRole is empty, it is meant for
+// enriching rows the user could already read, like tasks of a cross-project list
+func (db *DB) GetProjectsByIDs(ids []int) (map[int]*Project, error) {
+	projects := make(map[int]*Project)
+
+	seen := make(map[int]bool, len(ids))
+	args := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			args = append(args, id)
+		}
+	}
+	if len(args) == 0 {
+		return projects, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ")
+	// No user is joined as pu, so UserRole comes back empty
 	query := `
-		SELECT p.id, p.title, p.description, p.status, 
-		       p.created_at, p.updated_at, pu.role
+		SELECT ` + projectColumns + `
 		FROM projects p
-		JOIN project_users pu ON p.id = pu.project_id
-		WHERE pu.user_id = ? 
-		ORDER BY p.created_at DESC
+		LEFT JOIN project_users pu ON FALSE
+		WHERE p.id IN (` + placeholders + `) AND p.deleted_at IS NULL
 	`
 
-	rows, err := db.Query(query, userID)
+	rows, err := db.Query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user projects: %v", err)
+		return nil, fmt.Errorf("failed to get projects: %v", err)
 	}
 	defer rows.Close()
 
-	var projects []*Project
 	for rows.Next() {
-		project := &Project{}
-
-		err := rows.Scan(
-			&project.ID, &project.Title, &project.Description,
-			&project.Status, &project.CreatedAt, &project.UpdatedAt,
-			&project.UserRole,
-		)
+		project, err := scanProject(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan project: %v", err)
 		}
+		projects[project.ID] = project
+	}
 
-		projects = append(projects, project)
+	return projects, rows.Err()
+}
+
+// GetUserProjects retrieves all projects for a specific user, cached when SetProjectsCacheTTL is set
+func (db *DB) GetUserProjects(userID int) ([]*Project, error) {
+	if projects, ok := getCachedUserProjects(userID); ok {
+		return projects, nil
 	}
 
+	projects, err := db.GetUserProjectsSorted(userID, "", "created", "desc")
+	if err != nil {
+		return nil, err
+	}
+	cacheUserProjects(userID, projects)
+
 	return projects, nil
 }
 
+// GetUserProjectsSplit returns the user's projects split into the ones the user owns and the
+// ones the user was added to with another role
+func (db *DB) GetUserProjectsSplit(userID int) (owned []*Project, sharedWith []*Project, err error) {
+	projects, err := db.GetUserProjects(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	owned, sharedWith = splitProjectsByOwnership(projects)
+	return owned, sharedWith, nil
+}
+
+// splitProjectsByOwnership partitions projects by the user's role, keeping their order
+func splitProjectsByOwnership(projects []*Project) (owned []*Project, sharedWith []*Project) {
+	owned, sharedWith = []*Project{}, []*Project{}
+	for _, project := range projects {
+		if project.UserRole == RoleOwner {
+			owned = append(owned, project)
+		} else {
+			sharedWith = append(sharedWith, project)
+		}
+	}
+	return owned, sharedWith
+}
+
 // GetUserProjectsByStatus retrieves projects for a user filtered by status
 func (db *DB) GetUserProjectsByStatus(userID int, status ProjectStatus) ([]*Project, error) {
+	return db.GetUserProjectsSorted(userID, status, "created", "desc")
+}
+
+// GetUserProjectsSorted retrieves projects for a user with optional status filter and sorting.
+// sortBy is one of created, updated, title, status; direction is asc or desc
+func (db *DB) GetUserProjectsSorted(userID int, status ProjectStatus, sortBy, direction string) ([]*Project, error) {
+	column, ok := projectSortColumns[strings.ToLower(sortBy)]
+	if !ok {
+		column = projectSortColumns["created"]
+	}
+	order := "DESC"
+	if strings.EqualFold(direction, "asc") {
+		order = "ASC"
+	}
+
 	query := `
-		SELECT p.id, p.title, p.description, p.status, 
-		       p.created_at, p.updated_at, pu.role
+		SELECT ` + projectColumns + `
 		FROM projects p
 		JOIN project_users pu ON p.id = pu.project_id
-		WHERE pu.user_id = ? AND p.status = ?
-		ORDER BY p.created_at DESC
-	`
+		WHERE pu.user_id = ? AND p.deleted_at IS NULL`
+	args := []interface{}{userID}
+	if status != "" {
+		query += " AND p.status = ?"
+		args = append(args, status)
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s, p.id %s", column, order, order)
 
-	rows, err := db.Query(query, userID, status)
+	rows, err := db.Query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user projects by status: %v", err)
+		return nil, fmt.Errorf("failed to get user projects: %v", err)
 	}
 	defer rows.Close()
 
 	var projects []*Project
 	for rows.Next() {
-		project := &Project{}
-
-		err := rows.Scan(
-			&project.ID, &project.Title, &project.Description,
-			&project.Status, &project.CreatedAt, &project.UpdatedAt,
-			&project.UserRole,
-		)
+		project, err := scanProject(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan project: %v", err)
 		}
@@ -209,6 +422,12 @@ func (db *DB) UpdateProject(projectID, userID int, title, description string, st
 		return fmt.Errorf("insufficient permissions to update project")
 	}
 
+	title, err = sanitizeTitle(title, maxProjectTitleLength)
+	if err != nil {
+		return err
+	}
+	description = sanitizeDescription(description)
+
 	query := `
 		UPDATE projects 
 		SET title = ?, description = ?, status = ?, updated_at = CURRENT_TIMESTAMP
@@ -219,6 +438,29 @@ func (db *DB) UpdateProject(projectID, userID int, title, description string, st
 	if err != nil {
 		return fmt.Errorf("failed to update project: %v", err)
 	}
+	db.invalidateProjectMembers(projectID)
+	InvalidateProjectTasks(projectID) // Tasks carry the project title
+
+	return nil
+}
+
+// SetProjectDescription changes only the description of a project, the title and status are left as they are
+func (db *DB) SetProjectDescription(projectID, userID int, description string) error {
+	if err := db.requireCapability(projectID, userID, func(c *Capabilities) bool { return c.CanEditProject }, "edit the project"); err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE projects 
+		SET description = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+
+	_, err := db.Exec(query, sanitizeDescription(description), projectID)
+	if err != nil {
+		return fmt.Errorf("failed to update project description: %v", err)
+	}
+	db.invalidateProjectMembers(projectID)
 
 	return nil
 }
@@ -253,11 +495,37 @@ func (db *DB) UpdateProjectStatus(projectID, userID int, status ProjectStatus) e
 	if rowsAffected == 0 {
 		return fmt.Errorf("project not found")
 	}
+	db.invalidateProjectMembers(projectID)
 
 	return nil
 }
 
-// DeleteProject deletes a project (only owners can delete)
+// ReopenProject sets a completed project back to active and records it in the activity log
+func (db *DB) ReopenProject(projectID, userID int) error {
+	project, err := db.GetProjectByIDForUser(projectID, userID)
+	if err != nil {
+		return err
+	}
+	if project == nil {
+		return fmt.Errorf("project not found or no access")
+	}
+	if project.Status != StatusCompleted {
+		return fmt.Errorf("project is not completed")
+	}
+
+	if err := db.UpdateProjectStatus(projectID, userID, StatusActive); err != nil {
+		return err
+	}
+
+	db.logActivity(userID, projectID, nil, ActivityProjectReopened,
+		ActivityDetails{From: string(project.Status), To: string(StatusActive)})
+
+	return nil
+}
+
+// DeleteProject deletes a project (only owners can delete). The project is only marked deleted:
+// it disappears from every read together with its tasks, RestoreProject brings it back until
+// PurgeDeletedProjects removes it for good
 func (db *DB) DeleteProject(projectID, userID int) error {
 	// Check user permissions
 	userRole, err := db.GetUserRoleInProject(projectID, userID)
@@ -268,7 +536,7 @@ func (db *DB) DeleteProject(projectID, userID int) error {
 		return fmt.Errorf("insufficient permissions: only owners can delete projects")
 	}
 
-	query := "DELETE FROM projects WHERE id = ?"
+	query := "UPDATE projects SET deleted_at = NOW() WHERE id = ? AND deleted_at IS NULL"
 
 	result, err := db.Exec(query, projectID)
 	if err != nil {
@@ -283,16 +551,106 @@ func (db *DB) DeleteProject(projectID, userID int) error {
 	if rowsAffected == 0 {
 		return fmt.Errorf("project not found")
 	}
+	db.invalidateProjectMembers(projectID)
+	InvalidateProjectTasks(projectID)
+
+	// /undo restores the project
+	db.logActivity(userID, projectID, nil, ActivityProjectDeleted, ActivityDetails{})
+
+	return nil
+}
+
+// RestoreProject brings back a deleted project with its tasks and members (only owners can restore)
+func (db *DB) RestoreProject(projectID, userID int) error {
+	// GetUserRoleInProject skips deleted projects, the role is read directly
+	var userRole ProjectRole
+	err := db.QueryRow(`
+		SELECT pu.role
+		FROM projects p
+		JOIN project_users pu ON p.id = pu.project_id
+		WHERE p.id = ? AND pu.user_id = ? AND p.deleted_at IS NOT NULL
+	`, projectID, userID).Scan(&userRole)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("deleted project not found or no access")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check user permissions: %v", err)
+	}
+	if userRole != RoleOwner {
+		return fmt.Errorf("insufficient permissions: only owners can restore projects")
+	}
+
+	_, err = db.Exec("UPDATE projects SET deleted_at = NULL WHERE id = ?", projectID)
+	if err != nil {
+		return fmt.Errorf("failed to restore project: %v", err)
+	}
+	db.invalidateProjectMembers(projectID)
+	InvalidateProjectTasks(projectID)
 
 	return nil
 }
 
-// GetProjectCount returns the total number of projects for a user
+// PurgeDeletedProjects removes projects deleted more than olderThan ago for good, with their
+// tasks and memberships, and returns how many were removed
+func (db *DB) PurgeDeletedProjects(olderThan time.Duration) (int, error) {
+	// The cutoff is computed by MySQL so it matches the time zone deleted_at is stored in
+	result, err := db.Exec(
+		"DELETE FROM projects WHERE deleted_at IS NOT NULL AND deleted_at < NOW() - INTERVAL ? SECOND",
+		int64(olderThan/time.Second),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge deleted projects: %v", err)
+	}
+
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	return int(purged), nil
+}
+
+// deletedProjectsPurgeInterval is how often deleted projects past their retention are removed
+const deletedProjectsPurgeInterval = time.Hour
+
+// StartDeletedProjectsPurger removes projects deleted more than retention ago now and then every
+// deletedProjectsPurgeInterval. A non-positive retention keeps deleted projects forever
+func StartDeletedProjectsPurger(db *DB, retention time.Duration) {
+	if retention <= 0 {
+		return
+	}
+
+	purge := func() {
+		purged, err := db.PurgeDeletedProjects(retention)
+		if err != nil {
+			log.Printf("⚠️ Failed to purge deleted projects: %v", err)
+			return
+		}
+		if purged > 0 {
+			log.Printf("🧹 Purged %d deleted projects", purged)
+		}
+	}
+
+	purge()
+	go func() {
+		ticker := time.NewTicker(deletedProjectsPurgeInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			purge()
+		}
+	}()
+}
+
+// NoProjectsHint is the suggested next action shown wherever a user has no projects
+const NoProjectsHint = "💡 Напишите: создай проект [название]"
+
+// GetProjectCount returns the total number of projects for a user.
+// Like GetUserProjects it counts every membership, not only owned projects
 func (db *DB) GetProjectCount(userID int) (int, error) {
 	query := `
 		SELECT COUNT(*) 
-		FROM project_users 
-		WHERE user_id = ?
+		FROM projects p
+		JOIN project_users pu ON p.id = pu.project_id
+		WHERE pu.user_id = ? AND p.deleted_at IS NULL
 	`
 
 	var count int
@@ -304,13 +662,42 @@ func (db *DB) GetProjectCount(userID int) (int, error) {
 	return count, nil
 }
 
+// GetOwnedProjectCount returns the number of projects the user owns.
+// Unlike GetProjectCount it ignores memberships in other users' projects
+func (db *DB) GetOwnedProjectCount(userID int) (int, error) {
+	query := `
+		SELECT COUNT(*) 
+		FROM projects p
+		JOIN project_users pu ON p.id = pu.project_id
+		WHERE pu.user_id = ? AND pu.role = 'owner' AND p.deleted_at IS NULL
+	`
+
+	var count int
+	err := db.QueryRow(query, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get owned project count: %v", err)
+	}
+
+	return count, nil
+}
+
+// HasOwnedProjects reports whether the user owns at least one project.
+// Onboarding uses it, so a user who was only invited to someone else's project is still offered to create a first one
+func (db *DB) HasOwnedProjects(userID int) (bool, error) {
+	count, err := db.GetOwnedProjectCount(userID)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
 // GetProjectCountByStatus returns the number of projects with a specific status for a user
 func (db *DB) GetProjectCountByStatus(userID int, status ProjectStatus) (int, error) {
 	query := `
 		SELECT COUNT(*) 
 		FROM projects p
 		JOIN project_users pu ON p.id = pu.project_id
-		WHERE pu.user_id = ? AND p.status = ?
+		WHERE pu.user_id = ? AND p.status = ? AND p.deleted_at IS NULL
 	`
 
 	var count int
@@ -322,6 +709,41 @@ func (db *DB) GetProjectCountByStatus(userID int, status ProjectStatus) (int, er
 	return count, nil
 }
 
+// GetStaleProjects returns the user's open projects without task activity for at least inactiveFor.
+// Activity is the latest task update, or the project update when it has no tasks.
+// Paused, completed and cancelled projects are skipped
+func (db *DB) GetStaleProjects(userID int, inactiveFor time.Duration) ([]*Project, error) {
+	query := `
+		SELECT ` + projectColumns + `
+		FROM projects p
+		JOIN project_users pu ON p.id = pu.project_id
+		WHERE pu.user_id = ? AND p.deleted_at IS NULL
+		      AND p.status NOT IN ('paused', 'completed', 'cancelled')
+		      AND COALESCE(
+		          (SELECT MAX(t.updated_at) FROM tasks t WHERE t.project_id = p.id),
+		          p.updated_at
+		      ) < ?
+		ORDER BY p.updated_at ASC
+	`
+
+	rows, err := db.Query(query, userID, time.Now().Add(-inactiveFor))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stale projects: %v", err)
+	}
+	defer rows.Close()
+
+	var projects []*Project
+	for rows.Next() {
+		project, err := scanProject(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan project: %v", err)
+		}
+		projects = append(projects, project)
+	}
+
+	return projects, nil
+}
+
 // AddUserToProject adds a user to a project with specified role
 func (db *DB) AddUserToProject(projectID, userID, inviterUserID int, role ProjectRole) error {
 	// Check inviter permissions
@@ -342,6 +764,8 @@ func (db *DB) AddUserToProject(projectID, userID, inviterUserID int, role Projec
 	if err != nil {
 		return fmt.Errorf("failed to add user to project: %v", err)
 	}
+	// The member count of the project changed for every member
+	db.invalidateProjectMembers(projectID)
 
 	return nil
 }
@@ -380,11 +804,19 @@ func (db *DB) RemoveUserFromProject(projectID, userID, removerUserID int) error
 	if err != nil {
 		return fmt.Errorf("failed to remove user from project: %v", err)
 	}
+	// The member count of the project changed for every member, the removed user is no longer one
+	InvalidateUserProjects(userID)
+	db.invalidateProjectMembers(projectID)
 
-	return nil
+	return db.EnsureProjectHasOwner(projectID)
 }
 
-// UpdateUserRoleInProject updates a user's role in a project
+// ErrLastOwner is returned by UpdateUserRoleInProject when the change would leave the project without an owner
+var ErrLastOwner = errors.New("cannot change the role of the last owner")
+
+// UpdateUserRoleInProject updates a user's role in a project. The change is recorded in the
+// activity log in the same transaction, so the audit trail can't miss a role change.
+// Demoting the last owner is refused with ErrLastOwner
 func (db *DB) UpdateUserRoleInProject(projectID, userID, updaterUserID int, newRole ProjectRole) error {
 	// Check updater permissions
 	updaterRole, err := db.GetUserRoleInProject(projectID, updaterUserID)
@@ -395,32 +827,192 @@ func (db *DB) UpdateUserRoleInProject(projectID, userID, updaterUserID int, newR
 		return fmt.Errorf("insufficient permissions: only owners and admins can update roles")
 	}
 
-	query := `
-		UPDATE project_users 
-		SET role = ? 
-		WHERE project_id = ? AND user_id = ?
-	`
+	err = db.WithTx(func(tx *sql.Tx) error {
+		var oldRole ProjectRole
+		err := tx.QueryRow(
+			"SELECT role FROM project_users WHERE project_id = ? AND user_id = ? FOR UPDATE",
+			projectID, userID,
+		).Scan(&oldRole)
+		if err == sql.ErrNoRows {
+			return ErrNotProjectMember
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get user role: %v", err)
+		}
+		if oldRole == newRole {
+			return nil
+		}
+
+		// Don't allow demoting the last owner, the owner rows are locked so a concurrent
+		// demotion can't pass the same check
+		if oldRole == RoleOwner {
+			var ownerCount int
+			err := tx.QueryRow(
+				"SELECT COUNT(*) FROM project_users WHERE project_id = ? AND role = ? FOR UPDATE",
+				projectID, RoleOwner,
+			).Scan(&ownerCount)
+			if err != nil {
+				return fmt.Errorf("failed to check owner count: %v", err)
+			}
+			if ownerCount <= 1 {
+				return ErrLastOwner
+			}
+		}
+
+		query := `
+			UPDATE project_users 
+			SET role = ? 
+			WHERE project_id = ? AND user_id = ?
+		`
+
+		if _, err := tx.Exec(query, newRole, projectID, userID); err != nil {
+			return fmt.Errorf("failed to update user role: %v", err)
+		}
+
+		return insertActivity(tx, updaterUserID, projectID, nil, ActivityRoleChanged, ActivityDetails{
+			From:         string(oldRole),
+			To:           string(newRole),
+			TargetUserID: userID,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	InvalidateUserProjects(userID)
+
+	return nil
+}
+
+// Capabilities lists the actions a user may perform in a project, derived from the role.
+// It mirrors the permission checks of the DB methods so the bot never offers an action that fails
+type Capabilities struct {
+	Role              ProjectRole `json:"role"`
+	CanCreateTasks    bool        `json:"can_create_tasks"`
+	CanEditTasks      bool        `json:"can_edit_tasks"`
+	CanDeleteOwnTasks bool        `json:"can_delete_own_tasks"`
+	CanDeleteAnyTask  bool        `json:"can_delete_any_task"`
+	CanChangeStatus   bool        `json:"can_change_status"`
+	CanEditProject    bool        `json:"can_edit_project"`
+	CanManageMembers  bool        `json:"can_manage_members"`
+	CanDeleteProject  bool        `json:"can_delete_project"`
+}
+
+// CapabilitiesForRole returns the capabilities of a project role
+func CapabilitiesForRole(role ProjectRole) *Capabilities {
+	caps := &Capabilities{Role: role}
+
+	switch role {
+	case RoleOwner:
+		caps.CanDeleteProject = true
+		fallthrough
+	case RoleAdmin:
+		caps.CanEditProject = true
+		caps.CanManageMembers = true
+		caps.CanDeleteAnyTask = true
+		fallthrough
+	case RoleMember:
+		caps.CanCreateTasks = true
+		caps.CanEditTasks = true
+		caps.CanDeleteOwnTasks = true
+		caps.CanChangeStatus = true
+	}
+	// Viewers only read
+
+	return caps
+}
+
+// capabilityNames are human-readable names of capabilities used in prompts
+var capabilityNames = []struct {
+	name    string
+	enabled func(c *Capabilities) bool
+}{
+	{"создавать задачи", func(c *Capabilities) bool { return c.CanCreateTasks }},
+	{"редактировать задачи", func(c *Capabilities) bool { return c.CanEditTasks }},
+	{"менять статус задач", func(c *Capabilities) bool { return c.CanChangeStatus }},
+	{"удалять свои задачи", func(c *Capabilities) bool { return c.CanDeleteOwnTasks }},
+	{"удалять любые задачи", func(c *Capabilities) bool { return c.CanDeleteAnyTask }},
+	{"редактировать проект", func(c *Capabilities) bool { return c.CanEditProject }},
+	{"управлять участниками", func(c *Capabilities) bool { return c.CanManageMembers }},
+	{"удалять проект", func(c *Capabilities) bool { return c.CanDeleteProject }},
+}
+
+// Allowed lists the permitted actions as a comma-separated string
+func (c *Capabilities) Allowed() string {
+	return c.describe(true)
+}
+
+// Denied lists the forbidden actions as a comma-separated string
+func (c *Capabilities) Denied() string {
+	return c.describe(false)
+}
+
+// describe lists capabilities with the given state, "нет" if there are none
+func (c *Capabilities) describe(enabled bool) string {
+	var names []string
+	for _, capability := range capabilityNames {
+		if capability.enabled(c) == enabled {
+			names = append(names, capability.name)
+		}
+	}
+	if len(names) == 0 {
+		return "нет"
+	}
+	return strings.Join(names, ", ")
+}
 
-	_, err = db.Exec(query, newRole, projectID, userID)
+// GetUserCapabilities returns the actions the user may perform in a project
+func (db *DB) GetUserCapabilities(projectID, userID int) (*Capabilities, error) {
+	role, err := db.GetUserRoleInProject(projectID, userID)
 	if err != nil {
-		return fmt.Errorf("failed to update user role: %v", err)
+		return nil, err
 	}
 
+	return CapabilitiesForRole(role), nil
+}
+
+// requireCapability checks that the user's role in the project allows an action.
+// Task write methods use it so their checks match CapabilitiesForRole, membership
+// itself is always resolved by GetUserRoleInProject
+func (db *DB) requireCapability(projectID, userID int, allowed func(c *Capabilities) bool, action string) error {
+	caps, err := db.GetUserCapabilities(projectID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to check permissions: %v", err)
+	}
+	if !allowed(caps) {
+		return fmt.Errorf("insufficient permissions: %s cannot %s", caps.Role, action)
+	}
 	return nil
 }
 
-// GetUserRoleInProject returns the role of a user in a specific project
+// ErrNotProjectMember is returned by GetUserRoleInProject when the user is not a project member
+var ErrNotProjectMember = errors.New("user not found in project")
+
+// ProjectExists reports whether a project with the given ID exists, regardless of membership.
+// Deleted projects don't exist until they are restored
+func (db *DB) ProjectExists(projectID int) (bool, error) {
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM projects WHERE id = ? AND deleted_at IS NULL)", projectID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check project existence: %v", err)
+	}
+	return exists, nil
+}
+
+// GetUserRoleInProject returns the role of a user in a specific project.
+// A project_users row is the only way to access a project, every read joins on it the same way.
+// Members of a deleted project have no role until it is restored
 func (db *DB) GetUserRoleInProject(projectID, userID int) (ProjectRole, error) {
 	query := `
-		SELECT role 
-		FROM project_users 
-		WHERE project_id = ? AND user_id = ?
+		SELECT pu.role 
+		FROM project_users pu
+		JOIN projects p ON p.id = pu.project_id
+		WHERE pu.project_id = ? AND pu.user_id = ? AND p.deleted_at IS NULL
 	`
 
 	var role ProjectRole
 	err := db.QueryRow(query, projectID, userID).Scan(&role)
 	if err == sql.ErrNoRows {
-		return "", fmt.Errorf("user not found in project")
+		return "", ErrNotProjectMember
 	}
 	if err != nil {
 		return "", fmt.Errorf("failed to get user role: %v", err)
@@ -429,6 +1021,68 @@ func (db *DB) GetUserRoleInProject(projectID, userID int) (ProjectRole, error) {
 	return role, nil
 }
 
+// GetUserHighestRole returns the most privileged role the user has in any project,
+// empty when the user is in none
+func (db *DB) GetUserHighestRole(userID int) (ProjectRole, error) {
+	projects, err := db.GetUserProjects(userID)
+	if err != nil {
+		return "", err
+	}
+	return highestRole(projects), nil
+}
+
+// highestRole returns the most privileged role the user has in projects, empty for none
+func highestRole(projects []*Project) ProjectRole {
+	var highest ProjectRole
+	for _, project := range projects {
+		if roleRanks[project.UserRole] > roleRanks[highest] {
+			highest = project.UserRole
+		}
+	}
+	return highest
+}
+
+// GetUserRolesInProjects returns the user's roles for several projects in one query.
+// Projects where the user is not a member and deleted projects are absent from the result
+func (db *DB) GetUserRolesInProjects(userID int, projectIDs []int) (map[int]ProjectRole, error) {
+	roles := make(map[int]ProjectRole)
+	if len(projectIDs) == 0 {
+		return roles, nil
+	}
+
+	placeholders := make([]string, len(projectIDs))
+	args := make([]interface{}, 0, len(projectIDs)+1)
+	args = append(args, userID)
+	for i, projectID := range projectIDs {
+		placeholders[i] = "?"
+		args = append(args, projectID)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT pu.project_id, pu.role 
+		FROM project_users pu
+		JOIN projects p ON p.id = pu.project_id
+		WHERE pu.user_id = ? AND pu.project_id IN (%s) AND p.deleted_at IS NULL
+	`, strings.Join(placeholders, ", "))
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user roles: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var projectID int
+		var role ProjectRole
+		if err := rows.Scan(&projectID, &role); err != nil {
+			return nil, fmt.Errorf("failed to scan user role: %v", err)
+		}
+		roles[projectID] = role
+	}
+
+	return roles, rows.Err()
+}
+
 // GetProjectUsers returns all users in a project with their roles
 func (db *DB) GetProjectUsers(projectID int) ([]*ProjectUser, error) {
 	query := `
@@ -473,3 +1127,208 @@ func (db *DB) GetProjectOwnerCount(projectID int) (int, error) {
 
 	return count, nil
 }
+
+// EnsureProjectHasOwner repairs a project with members but no owner, as left when the last
+// owner removes themselves. The longest-tenured admin is promoted (or the longest-tenured
+// member when there are no admins either)
+func (db *DB) EnsureProjectHasOwner(projectID int) error {
+	ownerCount, err := db.GetProjectOwnerCount(projectID)
+	if err != nil {
+		return fmt.Errorf("failed to check owner count: %v", err)
+	}
+	if ownerCount > 0 {
+		return nil
+	}
+
+	query := `
+		SELECT user_id 
+		FROM project_users 
+		WHERE project_id = ?
+		ORDER BY role = ? DESC, joined_at ASC, id ASC
+		LIMIT 1
+	`
+
+	var userID int
+	err = db.QueryRow(query, projectID, RoleAdmin).Scan(&userID)
+	if err == sql.ErrNoRows {
+		// Project has no members left, nobody to promote
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find user to promote: %v", err)
+	}
+
+	_, err = db.Exec(
+		"UPDATE project_users SET role = ? WHERE project_id = ? AND user_id = ?",
+		RoleOwner, projectID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to promote new owner: %v", err)
+	}
+	InvalidateUserProjects(userID)
+
+	log.Printf("⚠️ Project %d had no owner, promoted user %d to owner", projectID, userID)
+	return nil
+}
+
+// ProjectMember represents a project member with user details
+type ProjectMember struct {
+	UserID   int         `json:"user_id"`
+	TgName   string      `json:"tg_name"`
+	Name     string      `json:"name,omitempty"`
+	Role     ProjectRole `json:"role"`
+	JoinedAt time.Time   `json:"joined_at"`
+
+	LastActive *time.Time `json:"last_active,omitempty"` // Last message to the bot, nil if the member never wrote
+}
+
+// ProjectDetail represents a full project card: project, members and open tasks
+type ProjectDetail struct {
+	Project      *Project         `json:"project"`
+	Members      []*ProjectMember `json:"members"`
+	OpenTasks    []*Task          `json:"open_tasks"`
+	Capabilities *Capabilities    `json:"capabilities"`
+}
+
+// GetProjectDetail retrieves a project with its members and open tasks
+// Returns nil if the project doesn't exist or the user is not a member
+func (db *DB) GetProjectDetail(projectID, userID int) (*ProjectDetail, error) {
+	// Membership check happens once here, the following reads are scoped by project
+	project, err := db.GetProjectByIDForUser(projectID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if project == nil {
+		return nil, nil
+	}
+
+	members, err := db.GetProjectMembersWithDetails(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT t.id, t.project_id, t.user_id, t.title, t.description, 
+		       t.status, t.priority, t.deadline, t.created_at, t.updated_at, 
+		       t.completed_at, p.title, ` + taskBlockedColumn + `
+		FROM tasks t
+		JOIN projects p ON t.project_id = p.id
+		WHERE t.project_id = ? AND t.status NOT IN ('done', 'cancelled') AND p.deleted_at IS NULL
+		ORDER BY t.created_at DESC
+	`
+
+	rows, err := db.Query(query, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get open project tasks: %v", err)
+	}
+	defer rows.Close()
+
+	openTasks := []*Task{}
+	for rows.Next() {
+		task := &Task{}
+		var deadline, completedAt sql.NullTime
+
+		err := rows.Scan(
+			&task.ID, &task.ProjectID, &task.UserID, &task.Title, &task.Description,
+			&task.Status, &task.Priority, &deadline, &task.CreatedAt, &task.UpdatedAt,
+			&completedAt, &task.ProjectTitle, &task.Blocked,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan task: %v", err)
+		}
+
+		if deadline.Valid {
+			task.Deadline = &deadline.Time
+		}
+		if completedAt.Valid {
+			task.CompletedAt = &completedAt.Time
+		}
+
+		openTasks = append(openTasks, task)
+	}
+
+	return &ProjectDetail{
+		Project:      project,
+		Members:      members,
+		OpenTasks:    openTasks,
+		Capabilities: CapabilitiesForRole(project.UserRole),
+	}, nil
+}
+
+// GetProjectMembersWithDetails returns all project members with their names, roles and when
+// they last wrote to the bot
+func (db *DB) GetProjectMembersWithDetails(projectID int) ([]*ProjectMember, error) {
+	query := `
+		SELECT pu.user_id, u.tg_name, u.name, pu.role, pu.joined_at, la.last_active
+		FROM project_users pu
+		JOIN users u ON pu.user_id = u.id
+		LEFT JOIN (
+			SELECT user_id, MAX(created_at) AS last_active
+			FROM messages
+			WHERE role = 'user'
+			GROUP BY user_id
+		) la ON la.user_id = pu.user_id
+		WHERE pu.project_id = ?
+		ORDER BY pu.joined_at ASC
+	`
+
+	rows, err := db.Query(query, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project members: %v", err)
+	}
+	defer rows.Close()
+
+	members := []*ProjectMember{}
+	for rows.Next() {
+		member := &ProjectMember{}
+		var lastActive sql.NullTime
+		err := rows.Scan(&member.UserID, &member.TgName, &member.Name, &member.Role, &member.JoinedAt, &lastActive)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan project member: %v", err)
+		}
+		if lastActive.Valid {
+			member.LastActive = &lastActive.Time
+		}
+		members = append(members, member)
+	}
+
+	return members, nil
+}
+
+// SetProjectMuted mutes or unmutes notifications of a project for a user
+func (db *DB) SetProjectMuted(userID, projectID int, muted bool) error {
+	// Check if user has access to this project
+	if _, err := db.GetUserRoleInProject(projectID, userID); err != nil {
+		return fmt.Errorf("failed to check project access: %v", err)
+	}
+
+	query := `
+		INSERT INTO project_notifications (user_id, project_id, muted) 
+		VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE muted = VALUES(muted)
+	`
+
+	_, err := db.Exec(query, userID, projectID, muted)
+	if err != nil {
+		return fmt.Errorf("failed to update project notifications: %v", err)
+	}
+
+	return nil
+}
+
+// IsProjectMuted returns whether the user muted notifications of a project (unmuted by default)
+func (db *DB) IsProjectMuted(userID, projectID int) (bool, error) {
+	var muted bool
+	err := db.QueryRow(
+		"SELECT muted FROM project_notifications WHERE user_id = ? AND project_id = ?",
+		userID, projectID,
+	).Scan(&muted)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get project notifications: %v", err)
+	}
+
+	return muted, nil
+}
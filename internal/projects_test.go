@@ -0,0 +1,699 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeleteAndRestoreProject(t *testing.T) {
+	db := openTestDB(t)
+	owner := createTestUser(t, db, "owner")
+
+	project, err := db.CreateProject(owner.ID, 0, "Удаляемый проект", "")
+	if err != nil {
+		t.Fatalf("CreateProject() error = %v", err)
+	}
+	if _, err := db.CreateTask(project.ID, owner.ID, "Задача", "", PriorityMedium, nil); err != nil {
+		t.Fatalf("CreateTask() error = %v", err)
+	}
+
+	visible := func() (bool, int) {
+		t.Helper()
+		projects, err := db.GetUserProjects(owner.ID)
+		if err != nil {
+			t.Fatalf("GetUserProjects() error = %v", err)
+		}
+		counts, err := db.GetUserTaskCountsByStatus(owner.ID)
+		if err != nil {
+			t.Fatalf("GetUserTaskCountsByStatus() error = %v", err)
+		}
+		for _, p := range projects {
+			if p.ID == project.ID {
+				return true, counts[TaskTodo]
+			}
+		}
+		return false, counts[TaskTodo]
+	}
+
+	if found, todo := visible(); !found || todo != 1 {
+		t.Fatalf("before delete: project listed = %v, todo tasks = %d, want true, 1", found, todo)
+	}
+
+	if err := db.DeleteProject(project.ID, owner.ID); err != nil {
+		t.Fatalf("DeleteProject() error = %v", err)
+	}
+	if found, todo := visible(); found || todo != 0 {
+		t.Errorf("after delete: project listed = %v, todo tasks = %d, want false, 0", found, todo)
+	}
+	if deleted, err := db.GetProjectByIDForUser(project.ID, owner.ID); err == nil && deleted != nil {
+		t.Errorf("deleted project is still returned by GetProjectByIDForUser")
+	}
+
+	// Deleted just now, well within the retention
+	if _, err := db.PurgeDeletedProjects(time.Hour); err != nil {
+		t.Fatalf("PurgeDeletedProjects() error = %v", err)
+	}
+
+	if err := db.RestoreProject(project.ID, owner.ID); err != nil {
+		t.Fatalf("RestoreProject() error = %v", err)
+	}
+	if found, todo := visible(); !found || todo != 1 {
+		t.Errorf("after restore: project listed = %v, todo tasks = %d, want true, 1", found, todo)
+	}
+}
+
+func TestRestoreProjectRequiresOwner(t *testing.T) {
+	db := openTestDB(t)
+	owner := createTestUser(t, db, "owner")
+	stranger := createTestUser(t, db, "stranger")
+
+	project, err := db.CreateProject(owner.ID, 0, "Чужой проект", "")
+	if err != nil {
+		t.Fatalf("CreateProject() error = %v", err)
+	}
+	if err := db.DeleteProject(project.ID, owner.ID); err != nil {
+		t.Fatalf("DeleteProject() error = %v", err)
+	}
+
+	if err := db.RestoreProject(project.ID, stranger.ID); err == nil {
+		t.Errorf("RestoreProject() by a non-member succeeded")
+	}
+}
+
+func TestSetProjectDescriptionPermissions(t *testing.T) {
+	db := openTestDB(t)
+	owner := createTestUser(t, db, "owner")
+
+	project, err := db.CreateProject(owner.ID, 0, "Проект с описанием", "")
+	if err != nil {
+		t.Fatalf("CreateProject() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		role    ProjectRole
+		allowed bool
+	}{
+		{"owner", RoleOwner, true},
+		{"admin", RoleAdmin, true},
+		{"member", RoleMember, false},
+		{"viewer", RoleViewer, false},
+		{"stranger", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := owner
+			if tt.role != RoleOwner {
+				user = createTestUser(t, db, tt.name)
+				if tt.role != "" {
+					if err := db.AddUserToProject(project.ID, user.ID, owner.ID, tt.role); err != nil {
+						t.Fatalf("AddUserToProject() error = %v", err)
+					}
+				}
+			}
+
+			err := db.SetProjectDescription(project.ID, user.ID, "Описание от "+tt.name)
+			if allowed := err == nil; allowed != tt.allowed {
+				t.Errorf("SetProjectDescription() error = %v, want allowed = %v", err, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestProjectToPromptContextTaskStats(t *testing.T) {
+	tests := []struct {
+		name    string
+		stats   *ProjectTaskStats
+		want    []string
+		notWant []string
+	}{
+		{"with stats", &ProjectTaskStats{Open: 7, Overdue: 2},
+			[]string{"\n- Открытых задач: 7", "\n- Просроченных задач: 2"}, nil},
+		{"nothing overdue", &ProjectTaskStats{Open: 3},
+			[]string{"\n- Открытых задач: 3", "\n- Просроченных задач: 0"}, nil},
+		{"without stats", nil, nil, []string{"Открытых задач", "Просроченных задач"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			project := &Project{ID: 1, Title: "Сайт", Status: StatusActive, UserRole: RoleOwner, TaskStats: tt.stats}
+			text := project.ToPromptContext()
+			for _, line := range tt.want {
+				if !strings.Contains(text, line) {
+					t.Errorf("ToPromptContext() = %q, want it to contain %q", text, line)
+				}
+			}
+			for _, line := range tt.notWant {
+				if strings.Contains(text, line) {
+					t.Errorf("ToPromptContext() = %q, want no %q", text, line)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitProjectsByOwnership(t *testing.T) {
+	owned1 := &Project{ID: 1, UserRole: RoleOwner}
+	owned2 := &Project{ID: 2, UserRole: RoleOwner}
+	admin := &Project{ID: 3, UserRole: RoleAdmin}
+	member := &Project{ID: 4, UserRole: RoleMember}
+	viewer := &Project{ID: 5, UserRole: RoleViewer}
+
+	tests := []struct {
+		name       string
+		projects   []*Project
+		owned      []int
+		sharedWith []int
+	}{
+		{"none", nil, []int{}, []int{}},
+		{"only owned", []*Project{owned1, owned2}, []int{1, 2}, []int{}},
+		{"only shared", []*Project{admin, viewer}, []int{}, []int{3, 5}},
+		{"mixed keeps order", []*Project{member, owned2, admin, owned1, viewer}, []int{2, 1}, []int{4, 3, 5}},
+	}
+
+	ids := func(projects []*Project) []int {
+		result := []int{}
+		for _, project := range projects {
+			result = append(result, project.ID)
+		}
+		return result
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			owned, sharedWith := splitProjectsByOwnership(tt.projects)
+			if got := ids(owned); fmt.Sprint(got) != fmt.Sprint(tt.owned) {
+				t.Errorf("owned = %v, want %v", got, tt.owned)
+			}
+			if got := ids(sharedWith); fmt.Sprint(got) != fmt.Sprint(tt.sharedWith) {
+				t.Errorf("sharedWith = %v, want %v", got, tt.sharedWith)
+			}
+		})
+	}
+}
+
+func TestProjectMemberCount(t *testing.T) {
+	db := openTestDB(t)
+	owner := createTestUser(t, db, "owner")
+	admin := createTestUser(t, db, "admin")
+	viewer := createTestUser(t, db, "viewer")
+
+	project, err := db.CreateProject(owner.ID, 0, "Команда", "")
+	if err != nil {
+		t.Fatalf("CreateProject() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		change func() error
+	}{
+		{"owner only", func() error { return nil }},
+		{"admin added", func() error { return db.AddUserToProject(project.ID, admin.ID, owner.ID, RoleAdmin) }},
+		{"viewer added", func() error { return db.AddUserToProject(project.ID, viewer.ID, owner.ID, RoleViewer) }},
+		{"admin removed", func() error { return db.RemoveUserFromProject(project.ID, admin.ID, owner.ID) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.change(); err != nil {
+				t.Fatalf("membership change error = %v", err)
+			}
+			users, err := db.GetProjectUsers(project.ID)
+			if err != nil {
+				t.Fatalf("GetProjectUsers() error = %v", err)
+			}
+			want := len(users)
+
+			byID, err := db.GetProjectByIDForUser(project.ID, owner.ID)
+			if err != nil {
+				t.Fatalf("GetProjectByIDForUser() error = %v", err)
+			}
+			if byID.MemberCount != want {
+				t.Errorf("GetProjectByIDForUser() MemberCount = %d, want %d", byID.MemberCount, want)
+			}
+
+			listed, err := db.GetUserProjects(owner.ID)
+			if err != nil {
+				t.Fatalf("GetUserProjects() error = %v", err)
+			}
+			for _, p := range listed {
+				if p.ID == project.ID && p.MemberCount != want {
+					t.Errorf("GetUserProjects() MemberCount = %d, want %d", p.MemberCount, want)
+				}
+			}
+
+			byIDs, err := db.GetProjectsByIDs([]int{project.ID})
+			if err != nil {
+				t.Fatalf("GetProjectsByIDs() error = %v", err)
+			}
+			if got := byIDs[project.ID]; got == nil || got.MemberCount != want {
+				t.Errorf("GetProjectsByIDs() = %+v, want MemberCount %d", got, want)
+			}
+		})
+	}
+}
+
+func TestUpdateUserRoleKeepsOwner(t *testing.T) {
+	db := openTestDB(t)
+	owner := createTestUser(t, db, "owner")
+	admin := createTestUser(t, db, "admin")
+
+	project, err := db.CreateProject(owner.ID, 0, "Владелец", "")
+	if err != nil {
+		t.Fatalf("CreateProject() error = %v", err)
+	}
+	if err := db.AddUserToProject(project.ID, admin.ID, owner.ID, RoleAdmin); err != nil {
+		t.Fatalf("AddUserToProject() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		userID  int
+		updater int
+		role    ProjectRole
+		wantErr error
+		want    map[int]ProjectRole
+	}{
+		{"sole owner can't demote themselves", owner.ID, owner.ID, RoleAdmin, ErrLastOwner,
+			map[int]ProjectRole{owner.ID: RoleOwner, admin.ID: RoleAdmin}},
+		{"admin can't demote the sole owner", owner.ID, admin.ID, RoleMember, ErrLastOwner,
+			map[int]ProjectRole{owner.ID: RoleOwner, admin.ID: RoleAdmin}},
+		{"second owner added", admin.ID, owner.ID, RoleOwner, nil,
+			map[int]ProjectRole{owner.ID: RoleOwner, admin.ID: RoleOwner}},
+		{"one of two owners steps down", owner.ID, owner.ID, RoleAdmin, nil,
+			map[int]ProjectRole{owner.ID: RoleAdmin, admin.ID: RoleOwner}},
+		{"the remaining owner can't step down", admin.ID, admin.ID, RoleMember, ErrLastOwner,
+			map[int]ProjectRole{owner.ID: RoleAdmin, admin.ID: RoleOwner}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := db.UpdateUserRoleInProject(project.ID, tt.userID, tt.updater, tt.role)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdateUserRoleInProject() error = %v, want %v", err, tt.wantErr)
+			}
+			for userID, want := range tt.want {
+				role, err := db.GetUserRoleInProject(project.ID, userID)
+				if err != nil {
+					t.Fatalf("GetUserRoleInProject() error = %v", err)
+				}
+				if role != want {
+					t.Errorf("role of user %d = %s, want %s", userID, role, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEnsureProjectHasOwner(t *testing.T) {
+	db := openTestDB(t)
+	owner := createTestUser(t, db, "owner")
+	admin := createTestUser(t, db, "admin")
+	member := createTestUser(t, db, "member")
+
+	project, err := db.CreateProject(owner.ID, 0, "Без владельца", "")
+	if err != nil {
+		t.Fatalf("CreateProject() error = %v", err)
+	}
+	if err := db.AddUserToProject(project.ID, member.ID, owner.ID, RoleMember); err != nil {
+		t.Fatalf("AddUserToProject() error = %v", err)
+	}
+	if err := db.AddUserToProject(project.ID, admin.ID, owner.ID, RoleAdmin); err != nil {
+		t.Fatalf("AddUserToProject() error = %v", err)
+	}
+
+	// The sole owner leaving is the one way the project loses its owner
+	if err := db.RemoveUserFromProject(project.ID, owner.ID, owner.ID); err != nil {
+		t.Fatalf("RemoveUserFromProject() error = %v", err)
+	}
+
+	// The admin is promoted even though the member joined earlier
+	tests := []struct {
+		userID int
+		want   ProjectRole
+	}{
+		{admin.ID, RoleOwner},
+		{member.ID, RoleMember},
+	}
+	for _, tt := range tests {
+		role, err := db.GetUserRoleInProject(project.ID, tt.userID)
+		if err != nil {
+			t.Fatalf("GetUserRoleInProject() error = %v", err)
+		}
+		if role != tt.want {
+			t.Errorf("role of user %d = %s, want %s", tt.userID, role, tt.want)
+		}
+	}
+
+	// A project that already has an owner is left alone
+	if err := db.EnsureProjectHasOwner(project.ID); err != nil {
+		t.Fatalf("EnsureProjectHasOwner() error = %v", err)
+	}
+	if count, err := db.GetProjectOwnerCount(project.ID); err != nil || count != 1 {
+		t.Errorf("GetProjectOwnerCount() = %d, %v, want 1 owner", count, err)
+	}
+}
+
+func TestCreateProjectWithMembers(t *testing.T) {
+	db := openTestDB(t)
+	owner := createTestUser(t, db, "owner")
+	member := createTestUser(t, db, "member")
+
+	// A user that no longer exists makes the member insert fail on its foreign key
+	gone := createTestUser(t, db, "gone")
+	if _, err := db.Exec("DELETE FROM users WHERE id = ?", gone.ID); err != nil {
+		t.Fatalf("failed to delete user: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		members []InitialMember
+		wantErr bool
+	}{
+		{"members added", []InitialMember{{UserID: member.ID, Role: RoleMember}}, false},
+		{"failed member insert rolls back", []InitialMember{{UserID: member.ID, Role: RoleMember}, {UserID: gone.ID, Role: RoleViewer}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			title := fmt.Sprintf("Команда %d", time.Now().UnixNano())
+			project, err := db.CreateProjectWithMembers(owner.ID, 0, title, "", "", tt.members, false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateProjectWithMembers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var projects, members int
+			if err := db.QueryRow("SELECT COUNT(*) FROM projects WHERE title = ?", title).Scan(&projects); err != nil {
+				t.Fatalf("failed to count projects: %v", err)
+			}
+			if err := db.QueryRow(
+				"SELECT COUNT(*) FROM project_users pu JOIN projects p ON p.id = pu.project_id WHERE p.title = ?", title,
+			).Scan(&members); err != nil {
+				t.Fatalf("failed to count members: %v", err)
+			}
+
+			if tt.wantErr {
+				if projects != 0 || members != 0 {
+					t.Errorf("failed create left %d projects and %d members, want none", projects, members)
+				}
+				return
+			}
+			if projects != 1 || members != len(tt.members)+1 {
+				t.Errorf("created %d projects with %d members, want 1 with %d", projects, members, len(tt.members)+1)
+			}
+			if project.MemberCount != len(tt.members)+1 {
+				t.Errorf("MemberCount = %d, want %d", project.MemberCount, len(tt.members)+1)
+			}
+		})
+	}
+}
+
+func TestProjectReadPathsAgree(t *testing.T) {
+	db := openTestDB(t)
+	owner := createTestUser(t, db, "owner")
+	member := createTestUser(t, db, "member")
+
+	project, err := db.CreateProject(owner.ID, 0, "Все поля", "Описание проекта")
+	if err != nil {
+		t.Fatalf("CreateProject() error = %v", err)
+	}
+	if err := db.AddUserToProject(project.ID, member.ID, owner.ID, RoleMember); err != nil {
+		t.Fatalf("AddUserToProject() error = %v", err)
+	}
+	if err := db.SetCurrentProject(member.ID, 0, project.ID); err != nil {
+		t.Fatalf("SetCurrentProject() error = %v", err)
+	}
+
+	want, err := db.GetProjectByIDForUser(project.ID, member.ID)
+	if err != nil || want == nil {
+		t.Fatalf("GetProjectByIDForUser() = %v, %v", want, err)
+	}
+	if want.UserRole != RoleMember || want.MemberCount != 2 || want.Description != "Описание проекта" {
+		t.Fatalf("GetProjectByIDForUser() = %+v, want the member's view with 2 members", want)
+	}
+
+	find := func(projects []*Project) *Project {
+		for _, p := range projects {
+			if p.ID == project.ID {
+				return p
+			}
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name string
+		read func() (*Project, error)
+	}{
+		{"GetUserProjects", func() (*Project, error) {
+			projects, err := db.GetUserProjects(member.ID)
+			return find(projects), err
+		}},
+		{"GetUserProjectsSorted", func() (*Project, error) {
+			projects, err := db.GetUserProjectsSorted(member.ID, "", "title", "asc")
+			return find(projects), err
+		}},
+		{"GetCurrentProject", func() (*Project, error) {
+			return db.GetCurrentProject(member.ID, 0)
+		}},
+		{"GetRecentProjects", func() (*Project, error) {
+			projects, err := db.GetRecentProjects(member.ID, 10)
+			return find(projects), err
+		}},
+		{"GetProjectsByIDs", func() (*Project, error) {
+			projects, err := db.GetProjectsByIDs([]int{project.ID})
+			if got := projects[project.ID]; got != nil {
+				// Read without a user, the role is the only field left out
+				got.UserRole = want.UserRole
+			}
+			return projects[project.ID], err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.read()
+			if err != nil {
+				t.Fatalf("%s error = %v", tt.name, err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s = %+v, want %+v", tt.name, got, want)
+			}
+		})
+	}
+}
+
+func TestReopenProject(t *testing.T) {
+	db := openTestDB(t)
+	owner := createTestUser(t, db, "owner")
+
+	project, err := db.CreateProject(owner.ID, 0, "Завершённый", "")
+	if err != nil {
+		t.Fatalf("CreateProject() error = %v", err)
+	}
+	if err := db.ReopenProject(project.ID, owner.ID); err == nil {
+		t.Errorf("ReopenProject() of a project that is not completed succeeded")
+	}
+
+	if err := db.UpdateProjectStatus(project.ID, owner.ID, StatusCompleted); err != nil {
+		t.Fatalf("UpdateProjectStatus() error = %v", err)
+	}
+	if err := db.ReopenProject(project.ID, owner.ID); err != nil {
+		t.Fatalf("ReopenProject() error = %v", err)
+	}
+	reopened, err := db.GetProjectByIDForUser(project.ID, owner.ID)
+	if err != nil {
+		t.Fatalf("GetProjectByIDForUser() error = %v", err)
+	}
+	if reopened.Status != StatusActive {
+		t.Errorf("status after reopening = %s, want %s", reopened.Status, StatusActive)
+	}
+}
+
+func TestProjectReadAccessMatrix(t *testing.T) {
+	db := openTestDB(t)
+	owner := createTestUser(t, db, "owner")
+
+	project, err := db.CreateProject(owner.ID, 0, "Доступ", "")
+	if err != nil {
+		t.Fatalf("CreateProject() error = %v", err)
+	}
+	task, err := db.CreateTask(project.ID, owner.ID, "Задача", "", PriorityMedium, nil)
+	if err != nil {
+		t.Fatalf("CreateTask() error = %v", err)
+	}
+
+	users := map[string]int{"owner": owner.ID}
+	for _, role := range []ProjectRole{RoleAdmin, RoleMember, RoleViewer} {
+		user := createTestUser(t, db, string(role))
+		if err := db.AddUserToProject(project.ID, user.ID, owner.ID, role); err != nil {
+			t.Fatalf("AddUserToProject() error = %v", err)
+		}
+		users[string(role)] = user.ID
+	}
+	users["non-member"] = createTestUser(t, db, "stranger").ID
+
+	// Each method reports whether the user could read the project through it
+	methods := map[string]func(userID int) bool{
+		"GetUserRoleInProject": func(userID int) bool {
+			role, err := db.GetUserRoleInProject(project.ID, userID)
+			return err == nil && role != ""
+		},
+		"GetProjectByIDForUser": func(userID int) bool {
+			got, err := db.GetProjectByIDForUser(project.ID, userID)
+			return err == nil && got != nil
+		},
+		"GetProjectDetail": func(userID int) bool {
+			got, err := db.GetProjectDetail(project.ID, userID)
+			return err == nil && got != nil
+		},
+		"GetProjectTasks": func(userID int) bool {
+			tasks, err := db.GetProjectTasks(project.ID, userID)
+			return err == nil && len(tasks) == 1
+		},
+		"GetProjectTasksByStatus": func(userID int) bool {
+			tasks, err := db.GetProjectTasksByStatus(project.ID, userID, TaskTodo)
+			return err == nil && len(tasks) == 1
+		},
+		"GetTaskByID": func(userID int) bool {
+			got, err := db.GetTaskByID(task.ID, userID)
+			return err == nil && got != nil
+		},
+	}
+
+	tests := []struct {
+		user string
+		want bool
+	}{
+		{"owner", true},
+		{"admin", true},
+		{"member", true},
+		{"viewer", true},
+		{"non-member", false},
+	}
+
+	for _, tt := range tests {
+		for method, canRead := range methods {
+			t.Run(tt.user+"/"+method, func(t *testing.T) {
+				if got := canRead(users[tt.user]); got != tt.want {
+					t.Errorf("%s can read via %s = %v, want %v", tt.user, method, got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestCreateProjectWithMembersRoles(t *testing.T) {
+	db := openTestDB(t)
+	creator := createTestUser(t, db, "creator")
+	users := make([]int, 3)
+	for i := range users {
+		users[i] = createTestUser(t, db, fmt.Sprintf("teammate%d", i)).ID
+	}
+
+	tests := []struct {
+		name        string
+		members     []InitialMember
+		allowOwners bool
+		wantErr     bool
+	}{
+		{"mixed roles", []InitialMember{{users[0], RoleAdmin}, {users[1], RoleMember}, {users[2], RoleViewer}}, false, false},
+		{"second owner refused", []InitialMember{{users[0], RoleOwner}}, false, true},
+		{"second owner when allowed", []InitialMember{{users[0], RoleOwner}, {users[1], RoleViewer}}, true, false},
+		{"invalid role", []InitialMember{{users[0], ProjectRole("boss")}}, false, true},
+		{"member listed twice", []InitialMember{{users[0], RoleMember}, {users[0], RoleAdmin}}, false, true},
+		{"creator listed as member", []InitialMember{{creator.ID, RoleMember}}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			project, err := db.CreateProjectWithMembers(creator.ID, 0, tt.name, "", "", tt.members, tt.allowOwners)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateProjectWithMembers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			want := map[int]ProjectRole{creator.ID: RoleOwner}
+			for _, member := range tt.members {
+				want[member.UserID] = member.Role
+			}
+			for userID, role := range want {
+				got, err := db.GetUserRoleInProject(project.ID, userID)
+				if err != nil {
+					t.Fatalf("GetUserRoleInProject() error = %v", err)
+				}
+				if got != role {
+					t.Errorf("role of user %d = %s, want %s", userID, got, role)
+				}
+			}
+		})
+	}
+}
+
+func TestSetDefaultProjectStatus(t *testing.T) {
+	defer func(previous ProjectStatus) { defaultProjectStatus = previous }(defaultProjectStatus)
+
+	tests := []struct {
+		status ProjectStatus
+		want   ProjectStatus
+	}{
+		{StatusActive, StatusActive},
+		{ProjectStatus("archived"), StatusActive},
+		{StatusPlanning, StatusPlanning},
+	}
+
+	for _, tt := range tests {
+		SetDefaultProjectStatus(tt.status)
+		if defaultProjectStatus != tt.want {
+			t.Errorf("SetDefaultProjectStatus(%q): default = %s, want %s", tt.status, defaultProjectStatus, tt.want)
+		}
+	}
+}
+
+func TestCreateProjectStatus(t *testing.T) {
+	db := openTestDB(t)
+	owner := createTestUser(t, db, "owner")
+	defer func(previous ProjectStatus) { defaultProjectStatus = previous }(defaultProjectStatus)
+
+	tests := []struct {
+		name          string
+		defaultStatus ProjectStatus
+		status        ProjectStatus
+		want          ProjectStatus
+		wantErr       bool
+	}{
+		{"schema-independent default", StatusPlanning, "", StatusPlanning, false},
+		{"configured default", StatusActive, "", StatusActive, false},
+		{"explicit status", StatusActive, StatusPaused, StatusPaused, false},
+		{"invalid status", StatusPlanning, ProjectStatus("archived"), "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetDefaultProjectStatus(tt.defaultStatus)
+			project, err := db.CreateProjectWithStatus(owner.ID, 0, tt.name, "", tt.status)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateProjectWithStatus() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			// Read back what was stored, not what CreateProjectWithStatus returned
+			stored, err := db.GetProjectByIDForUser(project.ID, owner.ID)
+			if err != nil {
+				t.Fatalf("GetProjectByIDForUser() error = %v", err)
+			}
+			if stored.Status != tt.want {
+				t.Errorf("stored status = %s, want %s", stored.Status, tt.want)
+			}
+		})
+	}
+}
@@ -1,5 +1,12 @@
 package internal
 
+import (
+	"context"
+	"log"
+	"strings"
+	"unicode/utf8"
+)
+
 // WelcomePromptTemplate template for generating personalized welcome messages
 const WelcomePromptTemplate = `Создай персонализированное приветственное сообщение для пользователя.
 
@@ -35,7 +42,7 @@ const ProjectListPromptTemplate = `Создай красивое сообщен
 Требования:
 - Покажи проекты в удобном формате
 - Группируй по статусам если нужно
-- Используй эмодзи для статусов (🔵 planning, 🟢 active, ⏸️ paused, ✅ completed, ❌ cancelled)
+- Используй эмодзи для статусов (📝 planning, 🚀 active, ⏸️ paused, ✅ completed, ❌ cancelled)
 - Добавь краткие инструкции по управлению проектами
 - Если проектов нет, предложи создать первый`
 
@@ -61,32 +68,380 @@ const ProjectCreatedPromptTemplate = `Создай сообщение подтв
 - Предложи следующие шаги
 - Будь мотивирующим`
 
+// JavaScriptSyntaxRetryHint is added as a system message when the generated code doesn't compile,
+// the AI gets one retry to fix it before the user sees the error
+const JavaScriptSyntaxRetryHint = `Твой предыдущий ответ не выполнился: синтаксическая ошибка JavaScript: %v
+
+Исправь код и ответь заново только JavaScript кодом для последнего сообщения пользователя. Частые ошибки: пропущен return в map(), объект без скобок в стрелочной функции, незакрытые скобки и кавычки.`
+
+// OutputContinuationPrompt is sent after a script passed data to output(), the AI answers with
+// new code that gets the data as prev_output. The system prompt with the user's language and
+// the persona applies as for the first step
+const OutputContinuationPrompt = `Проанализируй данные из output() и сгенерируй НОВЫЙ JavaScript код для обработки этих данных`
+
+// outputContinuationPromptEn is OutputContinuationPrompt for users who prefer English
+const outputContinuationPromptEn = `Analyze the data from output() and generate NEW JavaScript code that processes it`
+
+// RetrospectivePromptTemplate template for the /retro summary of recent work
+const RetrospectivePromptTemplate = `Создай короткую ретроспективу работы пользователя за последние %d дн.
+
+Данные (выполненные и созданные задачи, число смен статуса): %s
+
+Требования:
+- Начни с общей оценки периода в одном предложении
+- Перечисли главные выполненные задачи с названиями проектов
+- Отметь, сколько новых задач появилось
+- Используй подходящие эмодзи
+- Длина: не больше 10 строк`
+
+// maxAssistantPersonaLength is the maximum persona length in characters, a persona is a short
+// note on tone and must not outweigh the base instructions
+const maxAssistantPersonaLength = 500
+
+// assistantPersona is the operator-configured tone appended to the system prompt
+var assistantPersona string
+
+// SetAssistantPersona sets the tone of the bot's replies. An empty persona keeps the default tone,
+// a persona longer than maxAssistantPersonaLength is ignored
+func SetAssistantPersona(persona string) {
+	persona = strings.TrimSpace(persona)
+	if length := utf8.RuneCountInString(persona); length > maxAssistantPersonaLength {
+		log.Printf("Warning: assistant persona is %d characters (max %d), using the default tone", length, maxAssistantPersonaLength)
+		return
+	}
+	assistantPersona = persona
+}
+
+// GetSystemPrompt returns the system prompt with the assistant persona, if any, appended last.
+// The persona only changes the tone of messages, the JavaScript-only rule of the base prompt still applies
 func GetSystemPrompt() string {
-	return `🤖 ТЫ - JAVASCRIPT ПОМОЩНИК
+	return GetSystemPromptForLanguage(defaultLanguage)
+}
+
+// GetSystemPromptForLanguage returns the system prompt for users who prefer language ("ru", "en"),
+// the default language when it has no translation
+func GetSystemPromptForLanguage(language string) string {
+	return buildSystemPrompt(language, allowAllFunctions)
+}
+
+// allowAllFunctions keeps every method in the function reference
+func allowAllFunctions(string) bool { return true }
+
+// buildSystemPrompt returns the system prompt for language, the function reference lists the
+// methods whose GPT function allowed reports true for
+func buildSystemPrompt(language string, allowed func(function string) bool) string {
+	modules := promptModulesFor(language)
+	prompt := baseSystemPrompt(modules, allowed) + errorExamplesPrompt()
+	if assistantPersona == "" {
+		return prompt
+	}
+	return prompt + modules.persona.heading + assistantPersona + modules.persona.footer
+}
+
+// promptLanguageKey is the context key of the language AI calls build the system prompt for
+type promptLanguageKey struct{}
+
+// WithPromptLanguage makes AI calls made with the returned context instruct the AI in language
+func WithPromptLanguage(ctx context.Context, language string) context.Context {
+	return context.WithValue(ctx, promptLanguageKey{}, language)
+}
+
+// systemPromptFor returns the system prompt for the language set on ctx, the default without one.
+// With a role set by WithFunctionRole the function reference lists only what the role may call
+func systemPromptFor(ctx context.Context) string {
+	language, _ := ctx.Value(promptLanguageKey{}).(string)
+	role, ok := functionRoleFrom(ctx)
+	if !ok {
+		return GetSystemPromptForLanguage(language)
+	}
+	return buildSystemPrompt(language, func(function string) bool { return functionAllowedFor(function, role) })
+}
+
+// systemPromptForType returns the system prompt of a single-prompt call. Formatting calls answer
+// with text shown to the user as is, the JavaScript-only chat prompt would turn it into code
+func systemPromptForType(ctx context.Context, promptType PromptType) string {
+	if promptType != PromptFormatting {
+		return systemPromptFor(ctx)
+	}
+
+	language, _ := ctx.Value(promptLanguageKey{}).(string)
+	modules := promptModulesFor(language)
+	if assistantPersona == "" {
+		return modules.text
+	}
+	return modules.text + modules.textPersona + assistantPersona
+}
+
+// errorExamplesPrompt is the few-shot section with the most common mistakes in generated code
+func errorExamplesPrompt() string {
+	examples := currentErrorExamples()
+	if len(examples) == 0 {
+		return ""
+	}
+	return `
+
+⚠️ ЧАСТЫЕ ОШИБКИ В КОДЕ (не повторяй их):
+` + formatErrorExamples(examples)
+}
+
+// systemPromptModules are the parts of the system prompt written per language. Only the emoji
+// legend and the examples of common mistakes are shared
+type systemPromptModules struct {
+	intro         string            // Role and the JavaScript-only rule
+	functions     functionReference // teamwork API methods
+	communication string            // message(), output() and prev_output
+	webParsing    string            // Fetching and parsing web pages
+	language      string            // Which language to answer in, empty for the default language
+	continuation  string            // Prompt of the step after output()
+	persona       personaSection    // Wraps the assistant persona in the chat prompt
+	text          string            // System prompt of calls answering with text instead of code
+	textPersona   string            // Heading of the assistant persona in the text prompt
+}
+
+// functionReference is the function reference of a language, method names and parameters are
+// the same in any language
+type functionReference struct {
+	heading string
+	lines   []promptFunction
+}
+
+// personaSection wraps the assistant persona: the heading goes before it, the footer repeats
+// that the persona doesn't lift the JavaScript-only rule
+type personaSection struct {
+	heading string
+	footer  string
+}
+
+// systemPromptLanguages maps supported languages to their prompt modules, unknown languages use defaultLanguage
+var systemPromptLanguages = map[string]systemPromptModules{
+	"ru": {
+		intro:         promptIntroRu,
+		functions:     functionReference{promptFunctionsHeadingRu, promptFunctionsRu},
+		communication: promptCommunicationRu,
+		webParsing:    promptWebParsingRu,
+		continuation:  OutputContinuationPrompt,
+		persona:       personaSection{promptPersonaHeadingRu, promptPersonaFooterRu},
+		text:          promptTextRu,
+		textPersona:   promptTextPersonaRu,
+	},
+	"en": {
+		intro:         promptIntroEn,
+		functions:     functionReference{promptFunctionsHeadingEn, promptFunctionsEn},
+		communication: promptCommunicationEn,
+		webParsing:    promptWebParsingEn,
+		language:      promptLanguageEn,
+		continuation:  outputContinuationPromptEn,
+		persona:       personaSection{promptPersonaHeadingEn, promptPersonaFooterEn},
+		text:          promptTextEn,
+		textPersona:   promptTextPersonaEn,
+	},
+}
+
+// promptModulesFor returns the prompt modules of language, those of defaultLanguage when it has no translation
+func promptModulesFor(language string) systemPromptModules {
+	if modules, ok := systemPromptLanguages[language]; ok {
+		return modules
+	}
+	return systemPromptLanguages[defaultLanguage]
+}
+
+// OutputContinuationPromptForLanguage returns the prompt of the step after output() for users
+// who prefer language, OutputContinuationPrompt when it has no translation
+func OutputContinuationPromptForLanguage(language string) string {
+	if modules, ok := systemPromptLanguages[language]; ok && modules.continuation != "" {
+		return modules.continuation
+	}
+	return OutputContinuationPrompt
+}
+
+func baseSystemPrompt(modules systemPromptModules, allowed func(function string) bool) string {
+	prompt := modules.intro
+	if modules.language != "" {
+		prompt += modules.language + "\n\n"
+	}
+	return prompt + functionReferencePrompt(modules.functions, allowed) + emojiLegendPrompt() + modules.communication + modules.webParsing
+}
+
+const promptIntroRu = `🤖 ТЫ - JAVASCRIPT ПОМОЩНИК
 
 🔒 ВАЖНО: Отвечай ТОЛЬКО JavaScript кодом! Любой обычный текст вызовет ошибку!
 
 ❌ НЕПРАВИЛЬНО: "Вот ваши проекты"
 ✅ ПРАВИЛЬНО: message("Вот ваши проекты");
 
-🔧 ДОСТУПНЫЕ ФУНКЦИИ:
+`
+
+const promptIntroEn = `🤖 YOU ARE A JAVASCRIPT ASSISTANT
 
-📊 ПРОЕКТЫ И ЗАДАЧИ:
-- teamwork.listProjects() - список проектов
-- teamwork.listTasks() - список задач  
-- teamwork.createProject(name, description) - создать проект
-- teamwork.createTask(title, params) - создать задачу
+🔒 IMPORTANT: Answer ONLY with JavaScript code! Any plain text causes an error!
 
-💬 ОБЩЕНИЕ:
+❌ WRONG: "Here are your projects"
+✅ RIGHT: message("Here are your projects");
+
+`
+
+const promptTextRu = `Ты - помощник команды в Telegram боте для управления проектами и задачами.
+Отвечай обычным текстом для пользователя, не кодом. Для оформления используй Markdown (**жирный**, *курсив*, списки) или теги <b> и <i>.`
+
+const promptTextEn = `You are a team assistant in a Telegram bot for managing projects and tasks.
+Answer in English with plain text for the user, not code. Format with Markdown (**bold**, *italic*, lists) or <b> and <i> tags.`
+
+const promptPersonaHeadingRu = `
+
+🎭 СТИЛЬ ОБЩЕНИЯ (задан администратором, соблюдай его в текстах message()):
+`
+
+const promptPersonaFooterRu = `
+
+Стиль влияет только на тон сообщений: по-прежнему отвечай ТОЛЬКО JavaScript кодом`
+
+const promptPersonaHeadingEn = `
+
+🎭 COMMUNICATION STYLE (set by the administrator, follow it in message() texts):
+`
+
+const promptPersonaFooterEn = `
+
+The style only changes the tone of messages: still answer ONLY with JavaScript code`
+
+const promptTextPersonaRu = `
+
+🎭 СТИЛЬ ОБЩЕНИЯ (задан администратором):
+`
+
+const promptTextPersonaEn = `
+
+🎭 COMMUNICATION STYLE (set by the administrator):
+`
+
+// promptLanguageEn tells the AI to answer in English, the emoji legend and the examples of common
+// mistakes are shared with the Russian prompt
+const promptLanguageEn = `🌐 LANGUAGE: The user prefers English. Write every message() text in English,
+even where an example below is in Russian.`
+
+// promptFunction is a line of the function reference. Lines of methods that call a GPT function
+// are left out for users whose role may not call it, so the AI doesn't offer what would be refused
+type promptFunction struct {
+	function string // GPT function the method calls, empty for lines every role may use
+	text     string
+}
+
+const promptFunctionsHeadingRu = "🔧 ДОСТУПНЫЕ ФУНКЦИИ:\n\n📊 ПРОЕКТЫ И ЗАДАЧИ:\n"
+
+// promptFunctionsRu documents the teamwork API in Russian
+var promptFunctionsRu = []promptFunction{
+	{"", `teamwork.listProjects(status, sortBy, direction, ownership) - список проектов (все аргументы необязательны; sortBy: "created", "updated", "title", "status"; direction: "asc" или "desc"; ownership: "mine" - свои проекты, "shared" - проекты, куда пользователя добавили). У проектов с новыми изменениями задач has_new_activity: true - отмечай их "🔴 new"`},
+	{"", `teamwork.listTasks() - список задач`},
+	{"", `teamwork.listTasks({active_projects_only: true}) - задачи без завершённых и отменённых проектов (у каждой задачи есть project_status)`},
+	{"", `teamwork.listTasks({current_project: true}) - задачи текущего проекта (ошибка, если проект не выбран - предложи выбрать)`},
+	{"", `teamwork.listTasks({project_id: id, order: "board"}) - задачи проекта по статусам, приоритету и дедлайну (для канбан-вида)`},
+	{"", `teamwork.listTasks({status: "todo"}) - задачи со статусом по всем проектам; открытые идут по дедлайну (без дедлайна в конце) - подходит для "что делать дальше". order: "created" - сначала новые`},
+	{"", `teamwork.listTasks({project_id: id, due_within_days: 7}) - открытые задачи проекта с дедлайном до конца дня через 7 дней, включая просроченные ("что горит на этой неделе в проекте X?")`},
+	{"", `Пустой массив из listTasks({current_project: true}) или listTasks({project_id: id}) значит, что в проекте нет задач - не ограничивайся "нет задач", предложи создать первую: "💡 Напишите: добавь задачу [название]". Ошибка "does not have access" - другое: у пользователя нет доступа к проекту, предложи выбрать один из его проектов`},
+	{"", `teamwork.projectDetail(projectId) - карточка проекта: участники (last_active - когда последний раз писал боту, нет поля - никогда), открытые задачи и capabilities - разрешённые пользователю действия (без аргумента - текущий проект). Предлагай только разрешённые действия`},
+	{"mute_project", `teamwork.muteProject(projectId) / teamwork.unmuteProject(projectId) - отключить/включить напоминания по проекту (без аргумента - текущий проект)`},
+	{"create_project", `teamwork.createProject(name, description, status) - создать проект (status необязателен: "planning", "active"...; без него - статус по умолчанию)`},
+	{"update_project", `teamwork.updateProject(projectId, {title, description, status}) - изменить название, описание или статус проекта (передавай только меняющиеся поля)`},
+	{"delete_project", `teamwork.deleteProject(projectId) - удалить проект вместе с задачами (владелец может восстановить его через restoreProject или /undo)`},
+	{"restore_project", `teamwork.restoreProject(projectId) - восстановить удалённый проект вместе с задачами (только владелец), пока не истёк срок хранения удалённых проектов`},
+	{"set_project_description", `teamwork.setProjectDescription(projectId, description) - изменить только описание проекта ("обнови описание проекта"). Используй вместо updateProject, когда меняется только описание`},
+	{"create_task", `teamwork.createTask(title, params) - создать задачу. Без params.project_id задача попадёт в текущий проект, а если его нет - в единственный проект пользователя или пользователь выберет проект кнопками. Не спрашивай проект сам`},
+	{"update_task", `teamwork.updateTask(taskId, {title, description, status, priority, deadline}) - изменить задачу (передавай только меняющиеся поля; status: todo, in_progress, review, done, cancelled)`},
+	{"delete_task", `teamwork.deleteTask(taskId) - удалить задачу (вернуть можно через /undo)`},
+	{"add_task_dependency", `teamwork.addTaskDependency(taskId, dependsOnTaskId) - задача taskId ждёт выполнения задачи dependsOnTaskId`},
+	{"move_task", `teamwork.moveTask(taskId, newProjectId) - перенести задачу в другой проект (если задачу создали не там). Задачи с зависимостями не переносятся`},
+	{"set_task_deadline", `teamwork.setTaskDeadline(taskId, deadline) - установить только дедлайн задачи ("2024-05-01 18:00", "завтра 15:00", "через неделю", "нет" убирает). Используй вместо updateTask, когда меняется только дедлайн`},
+	{"set_task_priority", `teamwork.setTaskPriority(taskId, priority) - изменить только приоритет задачи (low, medium, high, urgent; "срочно" = urgent). Используй вместо updateTask, когда меняется только приоритет`},
+	{"shift_deadlines", `teamwork.shiftDeadlines(projectId, days) - сдвинуть все дедлайны проекта на days дней ("сдвинь все дедлайны на неделю" = 7, отрицательное число сдвигает раньше)`},
+	{"", `teamwork.listTaskAttachments(taskId) - файлы, прикреплённые к задаче (file_name, type). Прикрепить файл: отправить фото или документ боту при выбранном проекте`},
+	{"", `teamwork.upcomingTasks(days) - открытые задачи с дедлайном до конца дня через days дней (1-90, по умолчанию 7) по всем проектам, по возрастанию дедлайна; просроченные с overdue: true. Используй для "что горит на этой неделе?" вместо фильтрации listTasks`},
+	{"", `teamwork.recentlyCompleted(days) - задачи, выполненные за последние days дней (1-90, по умолчанию 7) по всем проектам, сначала самые свежие, время выполнения в completed_at. Используй для "что я сделал на этой неделе?"`},
+	{"", `teamwork.blockedTasks() - заблокированные задачи, у каждой blocked_by - список блокирующих задач`},
+	{"", `teamwork.projectMetrics(projectId) - метрики выполненных задач: avg_cycle_hours (от in_progress до done) и avg_lead_hours (от создания до done), с числом задач в расчёте`},
+	{"", `teamwork.taskStatusHistory(taskId) - история статусов задачи по порядку (from, to, changed_at, user_id), например "todo → in_progress → done"`},
+	{"", `В списках задач blocked: true - задача ждёт незавершённую зависимость, показывай её с пометкой "🚫 заблокирована"`},
+	{"", `teamwork.staleProjects(days) - открытые проекты без активности по задачам дольше days дней (по умолчанию 14). Предложи приостановить: "проект X давно не обновлялся, приостановить?"`},
+}
+
+const promptFunctionsHeadingEn = "🔧 AVAILABLE FUNCTIONS:\n\n📊 PROJECTS AND TASKS:\n"
+
+// promptFunctionsEn documents the teamwork API in English, line for line with promptFunctionsRu
+var promptFunctionsEn = []promptFunction{
+	{"", `teamwork.listProjects(status, sortBy, direction, ownership) - list projects (all arguments are optional; sortBy: "created", "updated", "title", "status"; direction: "asc" or "desc"; ownership: "mine" - own projects, "shared" - projects the user was added to). Projects with new task changes have has_new_activity: true - mark them "🔴 new"`},
+	{"", `teamwork.listTasks() - list tasks`},
+	{"", `teamwork.listTasks({active_projects_only: true}) - tasks without completed and cancelled projects (every task has project_status)`},
+	{"", `teamwork.listTasks({current_project: true}) - tasks of the current project (an error if no project is selected - offer to select one)`},
+	{"", `teamwork.listTasks({project_id: id, order: "board"}) - project tasks by status, priority and deadline (for a kanban view)`},
+	{"", `teamwork.listTasks({status: "todo"}) - tasks with a status across all projects; open ones go by deadline (without a deadline last) - good for "what to do next". order: "created" - newest first`},
+	{"", `teamwork.listTasks({project_id: id, due_within_days: 7}) - open project tasks with a deadline up to the end of the day in 7 days, overdue ones included ("what is burning this week in project X?")`},
+	{"", `An empty array from listTasks({current_project: true}) or listTasks({project_id: id}) means the project has no tasks - don't stop at "no tasks", offer to create the first one: "💡 Write: add task [title]". The error "does not have access" is different: the user has no access to the project, offer to pick one of their projects`},
+	{"", `teamwork.projectDetail(projectId) - project card: members (last_active - when they last wrote to the bot, no field - never), open tasks and capabilities - the actions the user may take (without an argument - the current project). Offer only allowed actions`},
+	{"mute_project", `teamwork.muteProject(projectId) / teamwork.unmuteProject(projectId) - turn project reminders off/on (without an argument - the current project)`},
+	{"create_project", `teamwork.createProject(name, description, status) - create a project (status is optional: "planning", "active"...; without it - the default status)`},
+	{"update_project", `teamwork.updateProject(projectId, {title, description, status}) - change the title, description or status of a project (pass only the changing fields)`},
+	{"delete_project", `teamwork.deleteProject(projectId) - delete a project with its tasks (the owner can restore it with restoreProject or /undo)`},
+	{"restore_project", `teamwork.restoreProject(projectId) - restore a deleted project with its tasks (owner only) until deleted projects expire`},
+	{"set_project_description", `teamwork.setProjectDescription(projectId, description) - change only the project description ("update the project description"). Use it instead of updateProject when only the description changes`},
+	{"create_task", `teamwork.createTask(title, params) - create a task. Without params.project_id the task goes to the current project, without one - to the user's only project, or the user picks the project with buttons. Don't ask for the project yourself`},
+	{"update_task", `teamwork.updateTask(taskId, {title, description, status, priority, deadline}) - change a task (pass only the changing fields; status: todo, in_progress, review, done, cancelled)`},
+	{"delete_task", `teamwork.deleteTask(taskId) - delete a task (it can be brought back with /undo)`},
+	{"add_task_dependency", `teamwork.addTaskDependency(taskId, dependsOnTaskId) - task taskId waits for task dependsOnTaskId to be done`},
+	{"move_task", `teamwork.moveTask(taskId, newProjectId) - move a task to another project (if it was created in the wrong one). Tasks with dependencies can't be moved`},
+	{"set_task_deadline", `teamwork.setTaskDeadline(taskId, deadline) - set only the task deadline ("2024-05-01 18:00", "tomorrow 15:00", "in 1 week", "none" removes it). Use it instead of updateTask when only the deadline changes`},
+	{"set_task_priority", `teamwork.setTaskPriority(taskId, priority) - change only the task priority (low, medium, high, urgent; "asap" = urgent). Use it instead of updateTask when only the priority changes`},
+	{"shift_deadlines", `teamwork.shiftDeadlines(projectId, days) - shift all project deadlines by days days ("move all deadlines by a week" = 7, a negative number shifts them earlier)`},
+	{"", `teamwork.listTaskAttachments(taskId) - files attached to a task (file_name, type). To attach a file: send a photo or a document to the bot with a project selected`},
+	{"", `teamwork.upcomingTasks(days) - open tasks with a deadline up to the end of the day in days days (1-90, 7 by default) across all projects, earliest deadline first; overdue ones have overdue: true. Use it for "what is burning this week?" instead of filtering listTasks`},
+	{"", `teamwork.recentlyCompleted(days) - tasks completed in the last days days (1-90, 7 by default) across all projects, most recent first, completion time in completed_at. Use it for "what did I do this week?"`},
+	{"", `teamwork.blockedTasks() - blocked tasks, each with blocked_by - the list of blocking tasks`},
+	{"", `teamwork.projectMetrics(projectId) - metrics of completed tasks: avg_cycle_hours (from in_progress to done) and avg_lead_hours (from creation to done), with the number of tasks counted`},
+	{"", `teamwork.taskStatusHistory(taskId) - status history of a task in order (from, to, changed_at, user_id), for example "todo → in_progress → done"`},
+	{"", `In task lists blocked: true means the task waits for an unfinished dependency, show it marked "🚫 blocked"`},
+	{"", `teamwork.staleProjects(days) - open projects without task activity for more than days days (14 by default). Offer to pause them: "project X hasn't been updated for a while, pause it?"`},
+}
+
+// functionReferencePrompt is the system prompt section listing the teamwork API methods of
+// reference whose GPT function allowed reports true for
+func functionReferencePrompt(reference functionReference, allowed func(function string) bool) string {
+	var text strings.Builder
+	text.WriteString(reference.heading)
+	for _, line := range reference.lines {
+		if line.function == "" || allowed(line.function) {
+			text.WriteString("- " + line.text + "\n")
+		}
+	}
+	text.WriteString("\n")
+	return text.String()
+}
+
+const promptCommunicationRu = `💬 ОБЩЕНИЕ:
 - message("текст") - ответить пользователю
+- messageWithButtons("текст", [{text: "Да", action: "да, удали"}]) - ответить с кнопками (до 6, action до 50 байт - около 25 русских букв). Нажатие кнопки приходит в диалог как сообщение пользователя с текстом action
 - output(data) - передать данные СЕБЕ для продолжения работы
 
 🔄 ПЕРЕМЕННЫЕ:
 - prev_output[] - массив данных из предыдущих output() вызовов
 - prev_output[0] - первый элемент из output() (например HTML страницы)
 - prev_output.length - количество элементов в массиве
+- В истории диалога результаты output() приходят как результат функции execute_javascript в JSON: {"output": [...]}
+
+`
+
+const promptCommunicationEn = `💬 COMMUNICATION:
+- message("text") - reply to the user
+- messageWithButtons("text", [{text: "Yes", action: "yes, delete it"}]) - reply with buttons (up to 6, action up to 50 bytes). A pressed button arrives in the conversation as a user message with the action text
+- output(data) - pass data to YOURSELF to continue working
 
-🌐 ИНТЕРНЕТ - ПАРСИНГ САЙТОВ:
+🔄 VARIABLES:
+- prev_output[] - array of data from previous output() calls
+- prev_output[0] - first item from output() (for example the HTML of a page)
+- prev_output.length - number of items in the array
+- In the dialog history output() results come as the result of the execute_javascript function in JSON: {"output": [...]}
+
+`
+
+// promptWebParsingRu explains fetching and parsing web pages
+const promptWebParsingRu = `🌐 ИНТЕРНЕТ - ПАРСИНГ САЙТОВ:
 - fetch(url) - загрузить любую веб-страницу
 - output(data) - передать HTML себе для анализа
 
@@ -261,4 +616,180 @@ if (prev_output.length > 0) {
 1. Сначала проверь prev_output[] 
 2. Если есть данные - СРАЗУ анализируй и отвечай
 3. Если нет данных - загружай через fetch + output`
+
+// promptWebParsingEn explains fetching and parsing web pages, the translation of promptWebParsingRu
+const promptWebParsingEn = `🌐 INTERNET - PARSING WEBSITES:
+- fetch(url) - load any web page
+- output(data) - pass the HTML to yourself for analysis
+
+🎯 WEB SEARCH STRATEGY:
+
+**IF prev_output[] ALREADY HAS DATA:**
+✅ **ANSWER RIGHT AWAY** - if prev_output[0] has HTML, parse it and answer immediately!
+
+**IF prev_output[] IS EMPTY:**
+1️⃣ **LOAD THE PAGE** - use fetch() to get the HTML
+2️⃣ **PASS THE DATA** - use output() to pass the HTML into the context
+3️⃣ **THE SYSTEM CALLS YOU AGAIN** - you get the data in prev_output[]
+4️⃣ **ANALYZE** - parse the data from prev_output[0] and extract the information
+5️⃣ **ANSWER** - use message() to reply to the user
+
+🚀 **PRIORITY**: If prev_output[] is not empty - analyze and answer IMMEDIATELY!
+
+🌐 WEBSITE PARSING EXAMPLES:
+
+// Google search
+let query = "JavaScript basics";
+let googleUrl = "https://www.google.com/search?q=" + encodeURIComponent(query);
+let response = fetch(googleUrl, {
+  headers: {
+    "User-Agent": "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36"
+  }
+});
+let html = response.text();
+output("GOOGLE_SEARCH:" + html);
+
+// Loading Wikipedia
+let topic = "React";
+let wikiUrl = "https://en.wikipedia.org/wiki/" + encodeURIComponent(topic);
+let wiki = fetch(wikiUrl);
+let wikiHtml = wiki.text();
+output("WIKI_PAGE:" + wikiHtml);
+
+// Loading news
+let newsUrl = "https://news.ycombinator.com/";
+let hn = fetch(newsUrl);
+let newsHtml = hn.text();
+output("NEWS_PAGE:" + newsHtml);
+
+// Note: after output() the system calls GPT again automatically
+// GPT analyzes the data from the context and generates NEW code for parsing
+
+💡 SMART TWO-STEP STRATEGY:
+
+**STEP 1 - LOADING (first GPT call):**
+message("🔍 Looking for information...");
+let response = fetch("https://example.com/page");
+let html = response.text();
+output("PAGE_DATA:" + html);
+
+**STEP 2 - ANALYSIS (new code with prev_output):**
+// Check whether prev_output has data
+if (prev_output.length > 0) {
+  let html = prev_output[0]; // Take the HTML from the array
+  let title = html.match(/<title>(.*?)<\/title>/);
+  if (title) {
+    message("📖 " + title[1]);
+  }
+}
+
+🌐 USEFUL WEBSITES FOR PARSING:
+
+// Google search
+"https://www.google.com/search?q=" + encodeURIComponent(query)
+
+// Wikipedia (any language)
+"https://en.wikipedia.org/wiki/" + encodeURIComponent(topic)
+"https://ru.wikipedia.org/wiki/" + encodeURIComponent(topic)
+
+// IT news
+"https://news.ycombinator.com/"
+"https://habr.com/en/all/"
+
+// Exchange rates
+"https://www.google.com/search?q=usd+to+eur"
+"https://www.ecb.europa.eu/"
+
+// Weather
+"https://www.google.com/search?q=weather+" + encodeURIComponent(city)
+
+// GitHub search
+"https://github.com/search?q=" + encodeURIComponent(query)
+
+🔧 HTML PARSING TECHNIQUES:
+
+// Extract the title
+let title = html.match(/<title>(.*?)<\/title>/);
+
+// Find all links
+let links = html.match(/<a[^>]+href="([^"]*)"[^>]*>(.*?)<\/a>/g);
+
+// Find the text of specific tags
+let headings = html.match(/<h[1-6][^>]*>(.*?)<\/h[1-6]>/g);
+
+// Find the meta description
+let description = html.match(/<meta[^>]+name="description"[^>]+content="([^"]*)"/);
+
+// Strip HTML tags
+let cleanText = htmlString.replace(/<[^>]*>/g, '');
+
+✅ FULL PROCESS EXAMPLES:
+
+**User:** "What is React?"
+
+**STEP 1 (first GPT call):**
+message("🔍 Looking up React...");
+let wikiUrl = "https://en.wikipedia.org/wiki/React_(software)";
+let response = fetch(wikiUrl);
+let html = response.text();
+output("WIKI_REACT:" + html);
+
+**STEP 2 (new code with access to prev_output):**
+// Check whether prev_output has data about React
+if (prev_output.length > 0 && prev_output[0].includes("WIKI_REACT:")) {
+  let html = prev_output[0].substring("WIKI_REACT:".length);
+  let paragraph = html.match(/<p[^>]*>(.*?)<\/p>/);
+  if (paragraph) {
+    let cleanText = paragraph[1].replace(/<[^>]*>/g, '');
+    message("📖 React: " + cleanText);
+  }
+}
+
+**User:** "Dollar to euro rate"
+
+**STEP 1 (first GPT call):**
+message("💰 Checking the dollar rate...");
+let googleUrl = "https://www.google.com/search?q=usd+to+eur";
+let response = fetch(googleUrl, {
+  headers: {"User-Agent": "Mozilla/5.0 (Windows NT 10.0; Win64; x64)"}
+});
+let html = response.text();
+output("CURRENCY_USD:" + html);
+
+**STEP 2 (new code analyzing prev_output):**
+// Analyze the rate data from prev_output
+if (prev_output.length > 0 && prev_output[0].includes("CURRENCY_USD:")) {
+  let html = prev_output[0].substring("CURRENCY_USD:".length);
+  let rate = html.match(/(\d+[\.,]\d+)\s*(?:euro|EUR|€)/i);
+  if (rate) {
+    message("💵 Current dollar rate: " + rate[1] + " €");
+  }
 }
+
+🚨 REMEMBER:
+- **FIRST OF ALL** check prev_output.length > 0 - if there is data, analyze it RIGHT AWAY!
+- Use the TWO-STEP approach: fetch → output → parse → message
+- Always add a User-Agent for better compatibility
+- Parse HTML with regular expressions
+
+💡 prev_output CHECK EXAMPLES:
+
+// AT THE START OF ANY CODE - check prev_output!
+if (prev_output.length > 0) {
+  // There is data - analyze and answer!
+  let data = prev_output[0];
+  if (data.includes("WEATHER:")) {
+    // parse the weather and answer
+  } else if (data.includes("WIKI:")) {
+    // parse Wikipedia and answer
+  }
+} else {
+  // No data - load it
+  let html = fetch("https://example.com").text();
+  output("DATA:" + html);
+}
+
+🎯 BE PROACTIVE:
+1. Check prev_output[] first
+2. If there is data - analyze and answer RIGHT AWAY
+3. If there is no data - load it with fetch + output`
@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSystemPromptForType(t *testing.T) {
+	english := WithPromptLanguage(context.Background(), "en")
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		promptType PromptType
+		want       string
+		wantJS     bool
+	}{
+		{"chat", context.Background(), PromptChat, promptIntroRu, true},
+		{"formatting", context.Background(), PromptFormatting, promptTextRu, false},
+		{"formatting in English", english, PromptFormatting, promptTextEn, false},
+		{"formatting in unknown language", WithPromptLanguage(context.Background(), "xx"), PromptFormatting, promptTextRu, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prompt := systemPromptForType(tt.ctx, tt.promptType)
+			if !strings.HasPrefix(prompt, tt.want) {
+				t.Errorf("systemPromptForType() = %.60q..., want the %s prompt", prompt, tt.name)
+			}
+			if got := strings.Contains(prompt, "JavaScript"); got != tt.wantJS {
+				t.Errorf("systemPromptForType() mentions JavaScript = %v, want %v", got, tt.wantJS)
+			}
+		})
+	}
+}
+
+func TestPromptFunctionsTranslated(t *testing.T) {
+	if len(promptFunctionsEn) != len(promptFunctionsRu) {
+		t.Fatalf("promptFunctionsEn has %d lines, promptFunctionsRu %d", len(promptFunctionsEn), len(promptFunctionsRu))
+	}
+	for i, line := range promptFunctionsRu {
+		if promptFunctionsEn[i].function != line.function {
+			t.Errorf("line %d: English function = %q, Russian %q", i, promptFunctionsEn[i].function, line.function)
+		}
+	}
+}
+
+func TestEnglishPromptModules(t *testing.T) {
+	modules := systemPromptLanguages["en"]
+	var reference strings.Builder
+	for _, line := range modules.functions.lines {
+		reference.WriteString(line.text)
+	}
+
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"intro", modules.intro},
+		{"function reference", modules.functions.heading + reference.String()},
+		{"communication", modules.communication},
+		{"web parsing", modules.webParsing},
+		{"language", modules.language},
+		{"persona", modules.persona.heading + modules.persona.footer},
+		{"text", modules.text + modules.textPersona},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.text == "" {
+				t.Fatal("module is empty")
+			}
+			for _, r := range tt.text {
+				if r >= 'А' && r <= 'я' || r == 'ё' || r == 'Ё' {
+					t.Fatalf("module has Russian text: %.80q", tt.text[strings.IndexRune(tt.text, r):])
+				}
+			}
+		})
+	}
+}
+
+func TestSystemPromptPersona(t *testing.T) {
+	defer SetAssistantPersona(assistantPersona)
+	SetAssistantPersona("Отвечай коротко")
+
+	tests := []struct {
+		name     string
+		language string
+		heading  string
+		footer   string
+	}{
+		{"russian", "ru", promptPersonaHeadingRu, promptPersonaFooterRu},
+		{"english", "en", promptPersonaHeadingEn, promptPersonaFooterEn},
+		{"unknown language", "xx", promptPersonaHeadingRu, promptPersonaFooterRu},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prompt := GetSystemPromptForLanguage(tt.language)
+			if !strings.HasSuffix(prompt, tt.heading+"Отвечай коротко"+tt.footer) {
+				t.Errorf("GetSystemPromptForLanguage(%q) ends with %.80q, want the persona section", tt.language, prompt[len(prompt)-80:])
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Update is a Telegram update with the fields the bot library doesn't decode yet
+type Update struct {
+	tgbotapi.Update
+	MessageReaction *MessageReactionUpdated `json:"message_reaction,omitempty"`
+}
+
+// MessageReactionUpdated is a change of a user's reactions to a message
+type MessageReactionUpdated struct {
+	Chat        tgbotapi.Chat  `json:"chat"`
+	MessageID   int            `json:"message_id"`
+	User        *tgbotapi.User `json:"user,omitempty"` // Absent for anonymous reactions
+	Date        int            `json:"date"`
+	OldReaction []ReactionType `json:"old_reaction"`
+	NewReaction []ReactionType `json:"new_reaction"`
+}
+
+// ReactionType is a reaction on a message, Emoji is set for the "emoji" type only
+type ReactionType struct {
+	Type  string `json:"type"`
+	Emoji string `json:"emoji,omitempty"`
+}
+
+// allowedUpdates are the update types the bot asks for. Telegram only sends message_reaction
+// when it is listed; in groups the bot also has to be an administrator to get reactions
+var allowedUpdates = []string{"message", "callback_query", "message_reaction"}
+
+// GetUpdatesChan polls updates like tgbotapi.BotAPI.GetUpdatesChan, decoding message reactions too
+func GetUpdatesChan(bot *tgbotapi.BotAPI, config tgbotapi.UpdateConfig) <-chan Update {
+	config.AllowedUpdates = allowedUpdates
+	ch := make(chan Update, bot.Buffer)
+
+	go func() {
+		for {
+			resp, err := bot.Request(config)
+			var updates []Update
+			if err == nil {
+				err = json.Unmarshal(resp.Result, &updates)
+			}
+			if err != nil {
+				log.Printf("Failed to get updates, retrying in 3 seconds: %v", err)
+				time.Sleep(3 * time.Second)
+				continue
+			}
+
+			for _, update := range updates {
+				if update.UpdateID >= config.Offset {
+					config.Offset = update.UpdateID + 1
+					ch <- update
+				}
+			}
+		}
+	}()
+
+	return ch
+}
+
+// reactionActions maps the reactions that answer a confirmation to the action of its buttons
+var reactionActions = map[string]string{
+	"👍": "confirm",
+	"👌": "confirm",
+	"👎": "cancel",
+}
+
+// HandleMessageReaction confirms or cancels a pending operation when its author reacts to the
+// confirmation message with one of reactionActions. Other reactions and messages are ignored
+func HandleMessageReaction(bot *tgbotapi.BotAPI, db *DB, reaction *MessageReactionUpdated) {
+	if reaction.User == nil {
+		return
+	}
+
+	action := addedReactionAction(reaction)
+	if action == "" {
+		return
+	}
+
+	operation, exists := pendingOperations.FindByMessage(reaction.Chat.ID, reaction.MessageID)
+	if !exists {
+		return
+	}
+	// A task without a project is confirmed by picking the project, a reaction can only cancel it
+	if action == "confirm" {
+		var needsChoice bool
+		pendingOperations.Update(operation.ID, func(operation *PendingOperation) {
+			needsChoice = needsProjectChoice(operation)
+		})
+		if needsChoice {
+			return
+		}
+	}
+
+	user, err := db.GetUserByTgID(reaction.User.ID)
+	if err != nil || user == nil || user.ID != operation.UserID {
+		log.Printf("Ignoring reaction of TG user %d to operation %s", reaction.User.ID, operation.ID)
+		return
+	}
+
+	log.Printf("👍 User %s (ID=%d) reacted to operation %s with action '%s'", user.TgName, user.ID, operation.ID, action)
+	resolvePendingOperation(bot, db, operation, action, reaction.Chat.ID, reaction.MessageID, operation.Description)
+}
+
+// addedReactionAction returns the action of the newly added reaction, empty when no reaction
+// with an action was added
+func addedReactionAction(reaction *MessageReactionUpdated) string {
+	previous := make(map[string]bool)
+	for _, old := range reaction.OldReaction {
+		previous[old.Emoji] = true
+	}
+
+	for _, added := range reaction.NewReaction {
+		if added.Type != "emoji" || previous[added.Emoji] {
+			continue
+		}
+		if action, ok := reactionActions[added.Emoji]; ok {
+			return action
+		}
+	}
+	return ""
+}
@@ -0,0 +1,165 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// recentProjectsMaxAgeDays is how long a project stays in the recent list after the user last
+// used it. Older entries age out by themselves, nothing is deleted: using the project again
+// brings it back
+const recentProjectsMaxAgeDays = 30
+
+// recentProjectsLimit is how many quick-switch buttons /recent shows
+const recentProjectsLimit = 5
+
+// recentProjectPrefix is the callback data prefix of the /recent quick-switch buttons
+const recentProjectPrefix = "recent_project_"
+
+// TouchRecentProject moves the project to the top of the user's recent projects
+func (db *DB) TouchRecentProject(projectID, userID int) error {
+	_, err := db.Exec(
+		"UPDATE project_users SET last_used_at = NOW() WHERE project_id = ? AND user_id = ?",
+		projectID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update recent project: %v", err)
+	}
+	return nil
+}
+
+// touchRecentProject is TouchRecentProject for callers that only log the error,
+// a stale recent list is not worth failing the action for
+func (db *DB) touchRecentProject(projectID, userID int) {
+	if err := db.TouchRecentProject(projectID, userID); err != nil {
+		log.Printf("Warning: failed to update recent project %d for user %d: %v", projectID, userID, err)
+	}
+}
+
+// GetRecentProjects returns up to limit projects the user switched to or worked on in the last
+// recentProjectsMaxAgeDays, most recently used first. Projects the user left are skipped
+func (db *DB) GetRecentProjects(userID int, limit int) ([]*Project, error) {
+	query := `
+		SELECT pu.project_id
+		FROM project_users pu
+		JOIN projects p ON p.id = pu.project_id
+		WHERE pu.user_id = ? AND pu.last_used_at >= NOW() - INTERVAL ? DAY AND p.deleted_at IS NULL
+		ORDER BY pu.last_used_at DESC, pu.project_id DESC
+		LIMIT ?
+	`
+
+	rows, err := db.Query(query, userID, recentProjectsMaxAgeDays, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recent projects: %v", err)
+	}
+	defer rows.Close()
+
+	var projectIDs []int
+	for rows.Next() {
+		var projectID int
+		if err := rows.Scan(&projectID); err != nil {
+			return nil, fmt.Errorf("failed to scan recent project: %v", err)
+		}
+		projectIDs = append(projectIDs, projectID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get recent projects: %v", err)
+	}
+
+	projects := []*Project{}
+	for _, projectID := range projectIDs {
+		project, err := db.GetProjectByIDForUser(projectID, userID)
+		if err != nil {
+			return nil, err
+		}
+		// Membership may have ended since the IDs were read
+		if project != nil {
+			projects = append(projects, project)
+		}
+	}
+
+	return projects, nil
+}
+
+// SendRecentProjects handles the /recent command: the recently used projects as buttons
+// that make the project current
+func SendRecentProjects(bot *tgbotapi.BotAPI, db *DB, chatID int64, userID int) {
+	projects, err := db.GetRecentProjects(userID, recentProjectsLimit)
+	if err != nil {
+		log.Printf("❌ Error getting recent projects for user %d: %v", userID, err)
+		SendReply(bot, chatID, "❌ Не удалось получить недавние проекты")
+		return
+	}
+	if len(projects) == 0 {
+		SendReply(bot, chatID, "🤷 Недавних проектов нет. Выберите проект, и он появится здесь")
+		return
+	}
+
+	currentID := 0
+	if current, err := db.GetCurrentProject(userID, chatID); err == nil && current != nil {
+		currentID = current.ID
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, project := range projects {
+		text := StatusEmoji(project.Status) + " " + project.Title
+		if project.ID == currentID {
+			text = "📌 " + text
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(text, recentProjectPrefix+strconv.Itoa(project.ID)),
+		))
+	}
+
+	msg := tgbotapi.NewMessage(chatID, "🕘 Недавние проекты, нажмите чтобы сделать текущим:")
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	if _, err := bot.Send(msg); err != nil {
+		log.Printf("Failed to send recent projects: %v", err)
+	}
+}
+
+// HandleRecentProjectCallback makes the project of a /recent button current
+func HandleRecentProjectCallback(bot *tgbotapi.BotAPI, db *DB, query *tgbotapi.CallbackQuery) {
+	projectID, err := strconv.Atoi(strings.TrimPrefix(query.Data, recentProjectPrefix))
+	if err != nil {
+		bot.Send(tgbotapi.NewCallback(query.ID, "Неизвестный проект"))
+		return
+	}
+
+	user, err := getCallbackUser(db, query)
+	if err != nil {
+		log.Printf("Error getting user by TG ID %d: %v", query.From.ID, err)
+		bot.Send(tgbotapi.NewCallback(query.ID, "Ошибка при получении пользователя"))
+		return
+	}
+
+	project, err := db.GetProjectByIDForUser(projectID, user.ID)
+	if err != nil {
+		log.Printf("Error getting project %d for user %d: %v", projectID, user.ID, err)
+		bot.Send(tgbotapi.NewCallback(query.ID, "Ошибка при выборе проекта"))
+		return
+	}
+	if project == nil {
+		bot.Send(tgbotapi.NewCallback(query.ID, "Проект недоступен"))
+		return
+	}
+
+	if err := db.SetCurrentProject(user.ID, query.Message.Chat.ID, projectID); err != nil {
+		log.Printf("Error setting current project %d for user %d: %v", projectID, user.ID, err)
+		bot.Send(tgbotapi.NewCallback(query.ID, "Ошибка при выборе проекта"))
+		return
+	}
+	if err := db.MarkProjectViewed(projectID, user.ID); err != nil {
+		log.Printf("Warning: failed to mark project %d as viewed: %v", projectID, err)
+	}
+
+	editMsg := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID,
+		"✅ Текущий проект:\n\n"+formatProjectCard(project))
+	editMsg.ParseMode = tgbotapi.ModeHTML
+	bot.Send(editMsg)
+	bot.Send(tgbotapi.NewCallback(query.ID, "Проект выбран"))
+}
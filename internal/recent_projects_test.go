@@ -0,0 +1,74 @@
+package internal
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestGetRecentProjects(t *testing.T) {
+	db := openTestDB(t)
+	user := createTestUser(t, db, "switcher")
+
+	// Minutes since the project was last used, the last one aged out
+	lastUsed := []int{4, 3, 2, 1, (recentProjectsMaxAgeDays + 1) * 24 * 60}
+	projects := make([]*Project, len(lastUsed))
+	for i, minutes := range lastUsed {
+		project, err := db.CreateProject(user.ID, 0, fmt.Sprintf("Проект %d", i), "")
+		if err != nil {
+			t.Fatalf("CreateProject() error = %v", err)
+		}
+		projects[i] = project
+		if _, err := db.Exec("UPDATE project_users SET last_used_at = NOW() - INTERVAL ? MINUTE WHERE project_id = ? AND user_id = ?",
+			minutes, project.ID, user.ID); err != nil {
+			t.Fatalf("failed to set last use: %v", err)
+		}
+	}
+	ids := func(indexes ...int) []int {
+		result := []int{}
+		for _, i := range indexes {
+			result = append(result, projects[i].ID)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name   string
+		action func() error
+		limit  int
+		want   []int
+	}{
+		{"most recent first, old entries aged out", nil, 10, ids(3, 2, 1, 0)},
+		{"limited", nil, 2, ids(3, 2)},
+		{"switching moves a project to the top", func() error {
+			return db.SetCurrentProject(user.ID, 0, projects[0].ID)
+		}, 10, ids(0, 3, 2, 1)},
+		{"using an aged out project brings it back", func() error {
+			return db.TouchRecentProject(projects[4].ID, user.ID)
+		}, 3, ids(4, 0, 3)},
+		{"deleted projects are skipped", func() error {
+			return db.DeleteProject(projects[3].ID, user.ID)
+		}, 10, ids(4, 0, 2, 1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.action != nil {
+				if err := tt.action(); err != nil {
+					t.Fatalf("action error = %v", err)
+				}
+			}
+
+			recent, err := db.GetRecentProjects(user.ID, tt.limit)
+			if err != nil {
+				t.Fatalf("GetRecentProjects() error = %v", err)
+			}
+			got := []int{}
+			for _, project := range recent {
+				got = append(got, project.ID)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("GetRecentProjects() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,614 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/sashabaranov/go-openai/jsonschema"
+)
+
+// GPTFunctionHandler handles a GPT function call.
+// Write operations return a pending operation that needs user confirmation
+type GPTFunctionHandler func(userID int, chatID int64, parameters map[string]interface{}) (*PendingOperation, error)
+
+// ProjectAccess reports whether the capabilities allow calling a project function
+type ProjectAccess func(caps *Capabilities) bool
+
+// ErrNoAccess is returned when the user's role in the project does not allow the function
+var ErrNoAccess = errors.New("нет доступа")
+
+// gptFunction is a registered GPT function with its schema and handler.
+// Functions with access set act on a project and are checked before the handler runs
+type gptFunction struct {
+	definition openai.FunctionDefinition
+	handler    GPTFunctionHandler
+	access     ProjectAccess
+}
+
+// exposeGPTFunctions controls whether registered functions are sent to the model.
+// Disabled while all responses are treated as JavaScript code
+const exposeGPTFunctions = false
+
+// gptFunctions stores registered functions by name, gptFunctionOrder keeps registration order
+var gptFunctions = make(map[string]*gptFunction)
+var gptFunctionOrder []string
+
+// RegisterGPTFunction registers a function schema and its handler.
+// Registering the same name again replaces the previous registration
+func RegisterGPTFunction(def openai.FunctionDefinition, handler GPTFunctionHandler) {
+	registerGPTFunction(&gptFunction{definition: def, handler: handler})
+}
+
+// RegisterProjectGPTFunction registers a function that acts on a project (project_id or task_id parameter).
+// Before the handler runs, the user's role is checked with access and passed in the user_role parameter
+func RegisterProjectGPTFunction(def openai.FunctionDefinition, access ProjectAccess, handler GPTFunctionHandler) {
+	registerGPTFunction(&gptFunction{definition: def, handler: handler, access: access})
+}
+
+// registerGPTFunction stores a function keeping registration order
+func registerGPTFunction(function *gptFunction) {
+	name := function.definition.Name
+	if _, exists := gptFunctions[name]; !exists {
+		gptFunctionOrder = append(gptFunctionOrder, name)
+	}
+	gptFunctions[name] = function
+}
+
+// GetGPTFunctions returns all available functions for GPT
+// Now returns empty list since all responses are treated as JavaScript code
+func GetGPTFunctions() []openai.FunctionDefinition {
+	if !exposeGPTFunctions {
+		return []openai.FunctionDefinition{}
+	}
+	return registeredDefinitions(func(*gptFunction) bool { return true })
+}
+
+// GetGPTFunctionsForRole returns the functions a user with the role may call, so the model
+// is not offered functions that would be refused. An empty role is a user without projects
+func GetGPTFunctionsForRole(role ProjectRole) []openai.FunctionDefinition {
+	if !exposeGPTFunctions {
+		return []openai.FunctionDefinition{}
+	}
+	return registeredDefinitions(func(function *gptFunction) bool { return function.allowedFor(role) })
+}
+
+// registeredDefinitions returns the schemas of the registered functions that pass include,
+// in registration order
+func registeredDefinitions(include func(*gptFunction) bool) []openai.FunctionDefinition {
+	definitions := []openai.FunctionDefinition{}
+	for _, name := range gptFunctionOrder {
+		if function := gptFunctions[name]; include(function) {
+			definitions = append(definitions, function.definition)
+		}
+	}
+	return definitions
+}
+
+// functionRoleKey is the context key of the role AI calls build the function list for
+type functionRoleKey struct{}
+
+// WithFunctionRole makes AI calls made with the returned context offer only the functions
+// the role may call
+func WithFunctionRole(ctx context.Context, role ProjectRole) context.Context {
+	return context.WithValue(ctx, functionRoleKey{}, role)
+}
+
+// functionRoleFrom returns the role set on ctx by WithFunctionRole
+func functionRoleFrom(ctx context.Context) (ProjectRole, bool) {
+	role, ok := ctx.Value(functionRoleKey{}).(ProjectRole)
+	return role, ok
+}
+
+// gptFunctionsFor returns the functions for the role set on ctx, all of them without one
+func gptFunctionsFor(ctx context.Context) []openai.FunctionDefinition {
+	role, ok := functionRoleFrom(ctx)
+	if !ok {
+		return GetGPTFunctions()
+	}
+	return GetGPTFunctionsForRole(role)
+}
+
+// FunctionRole returns the role the function list of a request is built for: the user's role in
+// the current project, the highest role across the user's projects without one
+func FunctionRole(store Store, userID int, currentProject *Project) ProjectRole {
+	if currentProject != nil && currentProject.UserRole != "" {
+		return currentProject.UserRole
+	}
+
+	projects, err := store.GetUserProjects(userID)
+	if err != nil {
+		// Offering too much is caught by the access check, offering nothing breaks the request
+		log.Printf("Warning: failed to get highest role of user %d: %v", userID, err)
+		return RoleOwner
+	}
+	return highestRole(projects)
+}
+
+// roleRanks orders the project roles from least to most privileged, unknown roles rank 0
+var roleRanks = map[ProjectRole]int{
+	RoleViewer: 1,
+	RoleMember: 2,
+	RoleAdmin:  3,
+	RoleOwner:  4,
+}
+
+// functionMinRoles are the operator-configured minimum roles by function name. They apply on top
+// of the function's own access check and can only take functions away from a role
+var functionMinRoles = map[string]ProjectRole{}
+
+// SetFunctionMinRoles sets the minimum roles from "function=role" entries,
+// invalid entries and unknown functions are skipped
+func SetFunctionMinRoles(entries []string) {
+	minRoles := map[string]ProjectRole{}
+	for _, entry := range entries {
+		name, role, ok := strings.Cut(entry, "=")
+		name, role = strings.TrimSpace(name), strings.TrimSpace(role)
+		if !ok || !validProjectRoles[ProjectRole(role)] {
+			log.Printf("Warning: could not parse function minimum role %q, skipping", entry)
+			continue
+		}
+		if _, exists := gptFunctions[name]; !exists {
+			log.Printf("Warning: minimum role set for unknown function %s, skipping", name)
+			continue
+		}
+		minRoles[name] = ProjectRole(role)
+	}
+	functionMinRoles = minRoles
+}
+
+// meetsMinRole reports whether the role is at least the configured minimum role of the function
+func (f *gptFunction) meetsMinRole(role ProjectRole) bool {
+	minRole, ok := functionMinRoles[f.definition.Name]
+	return !ok || roleRanks[role] >= roleRanks[minRole]
+}
+
+// allowedFor reports whether a user with the role may call the function
+func (f *gptFunction) allowedFor(role ProjectRole) bool {
+	return f.meetsMinRole(role) && (f.access == nil || f.access(CapabilitiesForRole(role)))
+}
+
+// functionAllowedFor reports whether a user with the role may call the function by name.
+// Unknown names are allowed, calling them fails with its own error
+func functionAllowedFor(name string, role ProjectRole) bool {
+	function, exists := gptFunctions[name]
+	return !exists || function.allowedFor(role)
+}
+
+// ProcessGPTFunctionCall processes a function call from GPT
+func ProcessGPTFunctionCall(db *DB, userID int, chatID int64, functionCall *openai.FunctionCall) (*PendingOperation, error) {
+	log.Printf("🔧 GPT FUNCTION CALL: %s for user %d with args: %s", functionCall.Name, userID, functionCall.Arguments)
+
+	// Parse parameters
+	var parameters map[string]interface{}
+	if err := json.Unmarshal([]byte(functionCall.Arguments), &parameters); err != nil {
+		log.Printf("❌ Failed to parse function arguments for %s: %v", functionCall.Name, err)
+		return nil, fmt.Errorf("failed to parse function arguments: %v", err)
+	}
+
+	return CallGPTFunction(db, userID, chatID, functionCall.Name, parameters)
+}
+
+// CallGPTFunction calls a registered function by name, checking project access first
+func CallGPTFunction(db *DB, userID int, chatID int64, name string, parameters map[string]interface{}) (*PendingOperation, error) {
+	function, exists := gptFunctions[name]
+	if !exists {
+		log.Printf("❌ Unknown function: %s", name)
+		return nil, fmt.Errorf("unknown function: %s", name)
+	}
+
+	if function.access != nil {
+		if err := checkProjectAccess(db, userID, parameters, function); err != nil {
+			log.Printf("⛔ Access check failed for %s (user %d): %v", name, userID, err)
+			return nil, err
+		}
+	} else if err := checkMinRole(db, userID, function); err != nil {
+		log.Printf("⛔ Minimum role check failed for %s (user %d)", name, userID)
+		return nil, err
+	}
+
+	log.Printf("✅ Calling handler for function: %s", name)
+	return function.handler(userID, chatID, parameters)
+}
+
+// checkMinRole checks the configured minimum role of a call without a known project against the
+// user's highest role across projects
+func checkMinRole(db *DB, userID int, function *gptFunction) error {
+	if _, limited := functionMinRoles[function.definition.Name]; !limited {
+		return nil
+	}
+	role, err := db.GetUserHighestRole(userID)
+	if err != nil || !function.meetsMinRole(role) {
+		return ErrNoAccess
+	}
+	return nil
+}
+
+// checkProjectAccess resolves the project from project_id or task_id, verifies the user's role
+// and stores it in the user_role parameter. Calls without either parameter are checked against
+// the minimum role only, the handler checks the project it picks
+func checkProjectAccess(db *DB, userID int, parameters map[string]interface{}, function *gptFunction) error {
+	projectID, ok := intParam(parameters, "project_id")
+	if !ok {
+		taskID, ok := intParam(parameters, "task_id")
+		if !ok {
+			return checkMinRole(db, userID, function)
+		}
+
+		task, err := db.GetTaskByID(taskID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to get task: %v", err)
+		}
+		if task == nil {
+			return ErrNoAccess
+		}
+		projectID = task.ProjectID
+	}
+
+	role, err := db.GetUserRoleInProject(projectID, userID)
+	if err != nil || role == "" {
+		return ErrNoAccess
+	}
+	if !function.allowedFor(role) {
+		return ErrNoAccess
+	}
+
+	parameters["user_role"] = string(role)
+	return nil
+}
+
+// intParam reads a numeric parameter, JSON gives float64 and JavaScript may give int64
+func intParam(parameters map[string]interface{}, key string) (int, bool) {
+	switch value := parameters[key].(type) {
+	case float64:
+		return int(value), true
+	case int64:
+		return int(value), true
+	case int:
+		return value, true
+	}
+	return 0, false
+}
+
+// daysParam returns the "days" parameter if it is between 1 and max inclusive
+func daysParam(parameters map[string]interface{}, max int) (int, error) {
+	days, ok := intParam(parameters, "days")
+	if !ok || days < 1 || days > max {
+		return 0, fmt.Errorf("days must be between 1 and %d", max)
+	}
+	return days, nil
+}
+
+// Common parameter schemas
+var (
+	projectIDSchema = jsonschema.Definition{Type: jsonschema.Integer, Description: "ID проекта"}
+	taskIDSchema    = jsonschema.Definition{Type: jsonschema.Integer, Description: "ID задачи"}
+	projectStatuses = []string{string(StatusPlanning), string(StatusActive), string(StatusPaused), string(StatusCompleted), string(StatusCancelled)}
+	taskStatuses    = []string{string(TaskTodo), string(TaskInProgress), string(TaskReview), string(TaskDone), string(TaskCancelled)}
+	taskPriorities  = []string{string(PriorityLow), string(PriorityMedium), string(PriorityHigh), string(PriorityUrgent)}
+)
+
+func init() {
+	RegisterGPTFunction(openai.FunctionDefinition{
+		Name:        "create_project",
+		Description: "Создать новый проект",
+		Parameters: jsonschema.Definition{
+			Type: jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{
+				"title":       {Type: jsonschema.String, Description: "Название проекта"},
+				"description": {Type: jsonschema.String, Description: "Описание проекта"},
+				"status":      {Type: jsonschema.String, Enum: projectStatuses, Description: "Начальный статус (по умолчанию из настроек бота)"},
+			},
+			Required: []string{"title"},
+		},
+	}, handleCreateProject)
+
+	RegisterProjectGPTFunction(openai.FunctionDefinition{
+		Name:        "update_project",
+		Description: "Обновить проект",
+		Parameters: jsonschema.Definition{
+			Type: jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{
+				"project_id":  projectIDSchema,
+				"title":       {Type: jsonschema.String, Description: "Новое название"},
+				"description": {Type: jsonschema.String, Description: "Новое описание"},
+				"status":      {Type: jsonschema.String, Enum: projectStatuses},
+			},
+			Required: []string{"project_id"},
+		},
+	}, func(c *Capabilities) bool { return c.CanEditProject }, handleUpdateProject)
+
+	RegisterProjectGPTFunction(openai.FunctionDefinition{
+		Name:        "set_project_description",
+		Description: "Изменить только описание проекта, не меняя название и статус",
+		Parameters: jsonschema.Definition{
+			Type: jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{
+				"project_id":  projectIDSchema,
+				"description": {Type: jsonschema.String, Description: "Новое описание"},
+			},
+			Required: []string{"project_id", "description"},
+		},
+	}, func(c *Capabilities) bool { return c.CanEditProject }, handleSetProjectDescription)
+
+	RegisterProjectGPTFunction(openai.FunctionDefinition{
+		Name:        "delete_project",
+		Description: "Удалить проект",
+		Parameters: jsonschema.Definition{
+			Type:       jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{"project_id": projectIDSchema},
+			Required:   []string{"project_id"},
+		},
+	}, func(c *Capabilities) bool { return c.CanDeleteProject }, handleDeleteProject)
+
+	// Deleted projects have no members for the access check, RestoreProject checks ownership itself
+	RegisterGPTFunction(openai.FunctionDefinition{
+		Name:        "restore_project",
+		Description: "Восстановить удалённый проект вместе с задачами (только владелец)",
+		Parameters: jsonschema.Definition{
+			Type:       jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{"project_id": projectIDSchema},
+			Required:   []string{"project_id"},
+		},
+	}, handleRestoreProject)
+
+	RegisterGPTFunction(openai.FunctionDefinition{
+		Name:        "list_projects",
+		Description: "Показать проекты пользователя",
+		Parameters: jsonschema.Definition{
+			Type: jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{
+				"status":    {Type: jsonschema.String, Enum: projectStatuses},
+				"sort_by":   {Type: jsonschema.String, Enum: []string{"created", "updated", "title", "status"}},
+				"direction": {Type: jsonschema.String, Enum: []string{"asc", "desc"}},
+				"ownership": {Type: jsonschema.String, Enum: []string{"mine", "shared"}, Description: "mine - проекты, где пользователь владелец; shared - куда его добавили"},
+			},
+		},
+	}, handleListProjects)
+
+	RegisterProjectGPTFunction(openai.FunctionDefinition{
+		Name:        "create_task",
+		Description: "Создать задачу в проекте",
+		Parameters: jsonschema.Definition{
+			Type: jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{
+				"project_id":  {Type: jsonschema.Integer, Description: "ID проекта, без него - текущий проект или выбор проекта кнопками"},
+				"title":       {Type: jsonschema.String, Description: "Название задачи"},
+				"description": {Type: jsonschema.String, Description: "Описание задачи"},
+				"priority":    {Type: jsonschema.String, Enum: taskPriorities},
+				"deadline":    {Type: jsonschema.String, Description: "Дедлайн: YYYY-MM-DD HH:MM, DD.MM, \"завтра 15:00\", \"через неделю\"; \"нет\" - без дедлайна"},
+			},
+			Required: []string{"title"},
+		},
+	}, func(c *Capabilities) bool { return c.CanCreateTasks }, handleCreateTask)
+
+	RegisterGPTFunction(openai.FunctionDefinition{
+		Name:        "list_tasks",
+		Description: "Показать задачи пользователя",
+		Parameters: jsonschema.Definition{
+			Type: jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{
+				"project_id":      projectIDSchema,
+				"status":          {Type: jsonschema.String, Enum: taskStatuses},
+				"current_project": {Type: jsonschema.Boolean, Description: "Только задачи текущего проекта"},
+				"order":           {Type: jsonschema.String, Enum: []string{string(TaskOrderCreated), string(TaskOrderBoard), string(TaskOrderDeadline)}, Description: "Порядок задач: board - по статусу, приоритету и дедлайну; deadline - ближайший дедлайн первым, без дедлайна в конце. Задачи со статусом todo/in_progress/review по умолчанию по дедлайну"},
+			},
+		},
+	}, handleListTasks)
+
+	RegisterProjectGPTFunction(openai.FunctionDefinition{
+		Name:        "update_task",
+		Description: "Обновить задачу",
+		Parameters: jsonschema.Definition{
+			Type: jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{
+				"task_id":     taskIDSchema,
+				"title":       {Type: jsonschema.String, Description: "Новое название"},
+				"description": {Type: jsonschema.String, Description: "Новое описание"},
+				"status":      {Type: jsonschema.String, Enum: taskStatuses},
+				"priority":    {Type: jsonschema.String, Enum: taskPriorities},
+				"deadline":    {Type: jsonschema.String, Description: "Дедлайн: YYYY-MM-DD HH:MM, DD.MM, \"завтра 15:00\", \"через неделю\"; \"нет\" - без дедлайна"},
+			},
+			Required: []string{"task_id"},
+		},
+	}, func(c *Capabilities) bool { return c.CanEditTasks }, handleUpdateTask)
+
+	RegisterProjectGPTFunction(openai.FunctionDefinition{
+		Name:        "delete_task",
+		Description: "Удалить задачу",
+		Parameters: jsonschema.Definition{
+			Type:       jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{"task_id": taskIDSchema},
+			Required:   []string{"task_id"},
+		},
+	}, func(c *Capabilities) bool { return c.CanDeleteOwnTasks }, handleDeleteTask)
+
+	RegisterProjectGPTFunction(openai.FunctionDefinition{
+		Name:        "add_task_dependency",
+		Description: "Сделать задачу зависимой от другой задачи того же проекта (нельзя начать, пока другая не выполнена)",
+		Parameters: jsonschema.Definition{
+			Type: jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{
+				"task_id":            taskIDSchema,
+				"depends_on_task_id": {Type: jsonschema.Integer, Description: "ID задачи, которую нужно выполнить раньше"},
+			},
+			Required: []string{"task_id", "depends_on_task_id"},
+		},
+	}, func(c *Capabilities) bool { return c.CanEditTasks }, handleAddTaskDependency)
+
+	// Access is checked on the task's current project, MoveTask checks the new one
+	RegisterProjectGPTFunction(openai.FunctionDefinition{
+		Name:        "move_task",
+		Description: "Перенести задачу в другой проект пользователя (задачу с зависимостями перенести нельзя)",
+		Parameters: jsonschema.Definition{
+			Type: jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{
+				"task_id":        taskIDSchema,
+				"new_project_id": {Type: jsonschema.Integer, Description: "ID проекта, в который переносится задача"},
+			},
+			Required: []string{"task_id", "new_project_id"},
+		},
+	}, func(c *Capabilities) bool { return c.CanEditTasks }, handleMoveTask)
+
+	RegisterProjectGPTFunction(openai.FunctionDefinition{
+		Name:        "set_task_deadline",
+		Description: "Установить, изменить или убрать дедлайн задачи, не меняя остальные поля",
+		Parameters: jsonschema.Definition{
+			Type: jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{
+				"task_id":  taskIDSchema,
+				"deadline": {Type: jsonschema.String, Description: "Дедлайн: YYYY-MM-DD HH:MM, DD.MM, \"завтра 15:00\", \"через неделю\"; \"нет\" убирает дедлайн"},
+			},
+			Required: []string{"task_id", "deadline"},
+		},
+	}, func(c *Capabilities) bool { return c.CanEditTasks }, handleSetTaskDeadline)
+
+	RegisterProjectGPTFunction(openai.FunctionDefinition{
+		Name:        "set_task_priority",
+		Description: "Изменить только приоритет задачи (например, \"сделай срочной\"), не меняя остальные поля",
+		Parameters: jsonschema.Definition{
+			Type: jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{
+				"task_id":  taskIDSchema,
+				"priority": {Type: jsonschema.String, Enum: taskPriorities, Description: "Новый приоритет"},
+			},
+			Required: []string{"task_id", "priority"},
+		},
+	}, func(c *Capabilities) bool { return c.CanEditTasks }, handleSetTaskPriority)
+
+	RegisterProjectGPTFunction(openai.FunctionDefinition{
+		Name:        "shift_deadlines",
+		Description: "Сдвинуть дедлайны всех задач проекта на несколько дней (например, когда проект задерживается)",
+		Parameters: jsonschema.Definition{
+			Type: jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{
+				"project_id": projectIDSchema,
+				"days":       {Type: jsonschema.Integer, Description: "На сколько дней сдвинуть: положительное число переносит дедлайны позже, отрицательное раньше"},
+			},
+			Required: []string{"project_id", "days"},
+		},
+	}, func(c *Capabilities) bool { return c.CanEditProject }, handleShiftDeadlines)
+
+	RegisterGPTFunction(openai.FunctionDefinition{
+		Name:        "get_blocked_tasks",
+		Description: "Показать открытые задачи, ожидающие выполнения других задач, и что их блокирует",
+		Parameters:  jsonschema.Definition{Type: jsonschema.Object},
+	}, handleGetBlockedTasks)
+
+	RegisterGPTFunction(openai.FunctionDefinition{
+		Name:        "list_upcoming_tasks",
+		Description: "Показать открытые задачи с дедлайном в ближайшие дни по всем проектам, по возрастанию дедлайна, просроченные отмечены overdue",
+		Parameters: jsonschema.Definition{
+			Type: jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{
+				"days": {Type: jsonschema.Integer, Description: "Сколько дней вперёд, включая сегодня: от 1 до 90 (\"на этой неделе\" = 7)"},
+			},
+			Required: []string{"days"},
+		},
+	}, handleListUpcomingTasks)
+
+	RegisterGPTFunction(openai.FunctionDefinition{
+		Name:        "recently_completed",
+		Description: "Показать задачи, выполненные за последние дни по всем проектам, сначала самые свежие",
+		Parameters: jsonschema.Definition{
+			Type: jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{
+				"days": {Type: jsonschema.Integer, Description: "За сколько последних дней: от 1 до 90 (\"за неделю\" = 7)"},
+			},
+			Required: []string{"days"},
+		},
+	}, handleRecentlyCompleted)
+
+	RegisterProjectGPTFunction(openai.FunctionDefinition{
+		Name:        "project_metrics",
+		Description: "Показать метрики проекта: среднее время цикла (in_progress → done) и время выполнения (создание → done)",
+		Parameters: jsonschema.Definition{
+			Type:       jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{"project_id": projectIDSchema},
+			Required:   []string{"project_id"},
+		},
+	}, func(c *Capabilities) bool { return true }, handleProjectMetrics)
+
+	RegisterProjectGPTFunction(openai.FunctionDefinition{
+		Name:        "list_task_attachments",
+		Description: "Показать файлы, прикреплённые к задаче",
+		Parameters: jsonschema.Definition{
+			Type:       jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{"task_id": taskIDSchema},
+			Required:   []string{"task_id"},
+		},
+	}, func(c *Capabilities) bool { return true }, handleListTaskAttachments)
+
+	RegisterGPTFunction(openai.FunctionDefinition{
+		Name:        "set_current_project",
+		Description: "Выбрать текущий рабочий проект",
+		Parameters: jsonschema.Definition{
+			Type:       jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{"project_id": projectIDSchema},
+			Required:   []string{"project_id"},
+		},
+	}, handleSetCurrentProject)
+
+	RegisterGPTFunction(openai.FunctionDefinition{
+		Name:        "get_current_project",
+		Description: "Получить текущий рабочий проект",
+		Parameters:  jsonschema.Definition{Type: jsonschema.Object},
+	}, handleGetCurrentProject)
+
+	RegisterGPTFunction(openai.FunctionDefinition{
+		Name:        "mute_project",
+		Description: "Отключить напоминания по проекту",
+		Parameters: jsonschema.Definition{
+			Type:       jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{"project_id": projectIDSchema},
+		},
+	}, handleMuteProject)
+
+	RegisterGPTFunction(openai.FunctionDefinition{
+		Name:        "unmute_project",
+		Description: "Включить напоминания по проекту",
+		Parameters: jsonschema.Definition{
+			Type:       jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{"project_id": projectIDSchema},
+		},
+	}, handleUnmuteProject)
+
+	RegisterGPTFunction(openai.FunctionDefinition{
+		Name:        "send_message_with_buttons",
+		Description: "Отправить сообщение с кнопками (максимум 6)",
+		Parameters: jsonschema.Definition{
+			Type: jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{
+				"message": {Type: jsonschema.String, Description: "Текст сообщения"},
+				"buttons": {
+					Type: jsonschema.Array,
+					Items: &jsonschema.Definition{
+						Type: jsonschema.Object,
+						Properties: map[string]jsonschema.Definition{
+							"text":   {Type: jsonschema.String, Description: "Текст кнопки"},
+							"action": {Type: jsonschema.String, Description: "Действие при нажатии"},
+						},
+						Required: []string{"text", "action"},
+					},
+				},
+			},
+			Required: []string{"message", "buttons"},
+		},
+	}, handleSendMessageWithButtons)
+
+	RegisterGPTFunction(openai.FunctionDefinition{
+		Name:        "execute_javascript",
+		Description: "Выполнить JavaScript код",
+		Parameters: jsonschema.Definition{
+			Type: jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{
+				"code": {Type: jsonschema.String, Description: "JavaScript код"},
+			},
+			Required: []string{"code"},
+		},
+	}, handleExecuteJavaScript)
+}
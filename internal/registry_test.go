@@ -0,0 +1,177 @@
+package internal
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestFunctionAllowedFor(t *testing.T) {
+	tests := []struct {
+		name     string
+		function string
+		role     ProjectRole
+		want     bool
+	}{
+		{"viewer can't delete projects", "delete_project", RoleViewer, false},
+		{"member can't delete projects", "delete_project", RoleMember, false},
+		{"owner deletes projects", "delete_project", RoleOwner, true},
+		{"viewer can't create tasks", "create_task", RoleViewer, false},
+		{"member creates tasks", "create_task", RoleMember, true},
+		{"viewer lists tasks", "list_tasks", RoleViewer, true},
+		{"user without projects creates one", "create_project", "", true},
+		{"unknown function left to the call", "no_such_function", RoleViewer, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := functionAllowedFor(tt.function, tt.role); got != tt.want {
+				t.Errorf("functionAllowedFor(%s, %q) = %v, want %v", tt.function, tt.role, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFunctionMinRoles(t *testing.T) {
+	defer func(previous map[string]ProjectRole) { functionMinRoles = previous }(functionMinRoles)
+	SetFunctionMinRoles([]string{"delete_task=admin", "create_project = member", "no_such_function=admin", "update_task=boss"})
+
+	if _, ok := functionMinRoles["no_such_function"]; ok {
+		t.Errorf("minimum role of an unknown function was kept")
+	}
+	if _, ok := functionMinRoles["update_task"]; ok {
+		t.Errorf("minimum role with an invalid role was kept")
+	}
+
+	tests := []struct {
+		function string
+		role     ProjectRole
+		want     bool
+	}{
+		{"delete_task", RoleMember, false},
+		{"delete_task", RoleAdmin, true},
+		{"create_project", "", false},
+		{"create_project", RoleViewer, false},
+		{"create_project", RoleMember, true},
+		{"update_task", RoleMember, true},
+	}
+
+	for _, tt := range tests {
+		if got := functionAllowedFor(tt.function, tt.role); got != tt.want {
+			t.Errorf("functionAllowedFor(%s, %q) = %v, want %v", tt.function, tt.role, got, tt.want)
+		}
+	}
+}
+
+func TestSystemPromptFunctionReferenceByRole(t *testing.T) {
+	tests := []struct {
+		name        string
+		ctx         context.Context
+		wantMethods []string
+		notMethods  []string
+	}{
+		{
+			name:        "viewer",
+			ctx:         WithFunctionRole(context.Background(), RoleViewer),
+			wantMethods: []string{"teamwork.listTasks(", "teamwork.createProject("},
+			notMethods:  []string{"teamwork.deleteProject(", "teamwork.deleteTask(", "teamwork.createTask(", "teamwork.updateProject("},
+		},
+		{
+			name:        "member",
+			ctx:         WithFunctionRole(context.Background(), RoleMember),
+			wantMethods: []string{"teamwork.createTask(", "teamwork.deleteTask("},
+			notMethods:  []string{"teamwork.deleteProject(", "teamwork.updateProject("},
+		},
+		{
+			name:        "owner",
+			ctx:         WithFunctionRole(context.Background(), RoleOwner),
+			wantMethods: []string{"teamwork.deleteProject(", "teamwork.updateProject(", "teamwork.createTask("},
+		},
+		{
+			name:        "no role",
+			ctx:         context.Background(),
+			wantMethods: []string{"teamwork.deleteProject(", "teamwork.createTask("},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prompt := systemPromptFor(tt.ctx)
+			for _, method := range tt.wantMethods {
+				if !strings.Contains(prompt, method) {
+					t.Errorf("prompt is missing %s", method)
+				}
+			}
+			for _, method := range tt.notMethods {
+				if strings.Contains(prompt, method) {
+					t.Errorf("prompt offers %s", method)
+				}
+			}
+		})
+	}
+}
+
+func TestDaysParam(t *testing.T) {
+	tests := []struct {
+		name       string
+		parameters map[string]interface{}
+		want       int
+		wantErr    bool
+	}{
+		{"missing", map[string]interface{}{}, 0, true},
+		{"not a number", map[string]interface{}{"days": "7"}, 0, true},
+		{"zero", map[string]interface{}{"days": float64(0)}, 0, true},
+		{"negative", map[string]interface{}{"days": float64(-1)}, 0, true},
+		{"lower bound", map[string]interface{}{"days": float64(1)}, 1, false},
+		{"upper bound", map[string]interface{}{"days": float64(90)}, 90, false},
+		{"above upper bound", map[string]interface{}{"days": float64(91)}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := daysParam(tt.parameters, 90)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("daysParam() = %d, %v, want %d, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRegisteredDefinitions(t *testing.T) {
+	all := registeredDefinitions(func(*gptFunction) bool { return true })
+	if len(all) != len(gptFunctionOrder) {
+		t.Fatalf("registeredDefinitions() returned %d functions, want %d", len(all), len(gptFunctionOrder))
+	}
+	for i, definition := range all {
+		if definition.Name != gptFunctionOrder[i] {
+			t.Errorf("definition %d = %s, want %s in registration order", i, definition.Name, gptFunctionOrder[i])
+		}
+	}
+
+	tests := []struct {
+		role     ProjectRole
+		function string
+		want     bool
+	}{
+		{RoleViewer, "list_tasks", true},
+		{RoleViewer, "create_task", false},
+		{RoleMember, "create_task", true},
+		{RoleMember, "delete_project", false},
+		{RoleOwner, "delete_project", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.role)+"/"+tt.function, func(t *testing.T) {
+			role := tt.role
+			got := false
+			for _, definition := range registeredDefinitions(func(function *gptFunction) bool { return function.allowedFor(role) }) {
+				if definition.Name == tt.function {
+					got = true
+				}
+			}
+			if got != tt.want {
+				t.Errorf("%s offered to %s = %v, want %v", tt.function, tt.role, got, tt.want)
+			}
+		})
+	}
+}
@@ -3,12 +3,16 @@ package internal
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"sort"
 	"strings"
 	"time"
+	"unicode/utf16"
+	"unicode/utf8"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
@@ -43,20 +47,19 @@ func SendTypingWithContext(bot *tgbotapi.BotAPI, chatID int64, ctx context.Conte
 }
 
 // HandleUserMessage processes incoming user messages and handles database operations
-func HandleUserMessage(bot *tgbotapi.BotAPI, db *DB, aiService *AIService, update tgbotapi.Update) {
+func HandleUserMessage(bot *tgbotapi.BotAPI, db *DB, aiService *AIService, config *Config, update tgbotapi.Update) {
 	if update.Message == nil {
 		return
 	}
 
+	if !shouldHandleMessage(bot, config, update.Message) {
+		return
+	}
+	group := isGroupChat(update.Message)
+
 	// Get Telegram user ID and name
 	tgID := update.Message.From.ID
-	tgName := update.Message.From.UserName
-	if tgName == "" {
-		tgName = update.Message.From.FirstName
-		if update.Message.From.LastName != "" {
-			tgName += " " + update.Message.From.LastName
-		}
-	}
+	tgName := telegramUserName(update.Message.From)
 
 	log.Printf("[%s] (ID: %d) %s", tgName, tgID, update.Message.Text)
 
@@ -82,38 +85,253 @@ func HandleUserMessage(bot *tgbotapi.BotAPI, db *DB, aiService *AIService, updat
 		}
 	}
 
+	// Current project may have been deleted by another member or the user lost access to it.
+	// It is loaded once here and passed on to the AI context
+	projects, cleared := loadProjectContext(db, user.ID, update.Message.Chat.ID)
+	if cleared {
+		SendReply(bot, update.Message.Chat.ID, "⚠️ Ваш текущий проект был удалён, выберите другой")
+	}
+
 	// Handle voice/audio messages
 	if update.Message.Voice != nil || update.Message.Audio != nil {
 		log.Printf("[%s] (ID: %d) sent audio message", tgName, tgID)
-		handleAudioMessage(bot, db, aiService, update, user)
+		handleAudioMessage(bot, db, aiService, config, update, user, projects)
 		return
 	}
 
-	// Get message text
-	messageText := strings.TrimSpace(update.Message.Text)
+	// Handle photos and documents, they can be attached to tasks
+	if len(update.Message.Photo) > 0 || update.Message.Document != nil {
+		log.Printf("[%s] (ID: %d) sent a file", tgName, tgID)
+		handleFileMessage(bot, db, update, user)
+		return
+	}
+
+	// Get message text, without the mention that addressed the bot in a group
+	messageText := strings.TrimSpace(stripBotMention(bot, update.Message.Text, update.Message.Entities))
 	log.Printf("Processing message: '%s', isNewUser: %t", messageText, isNewUser)
 
-	// Send welcome message for new users OR /start command
-	if isNewUser {
+	// Send welcome message for new users OR /start command. A group is not the new user's chat,
+	// the members would get a welcome every time someone writes to the bot for the first time
+	if isNewUser && !group {
 		log.Printf("Sending welcome message to NEW USER: %s", user.TgName)
-		SendWelcomeMessageWithTyping(bot, db, aiService, update.Message.Chat.ID, user.TgName, user.ID, true)
+		SendWelcomeMessageWithTyping(bot, db, aiService, config, update.Message.Chat.ID, user.TgName, user.ID, true)
+		return
+	}
+
+	// Stickers, locations, polls, contacts and the like have no text, the AI would get an empty prompt
+	if messageText == "" {
+		handleUnsupportedMessage(bot, config, update.Message)
 		return
 	}
 
 	if messageText == "/start" {
 		log.Printf("Sending welcome message for /start command: %s", user.TgName)
-		SendWelcomeMessageWithTyping(bot, db, aiService, update.Message.Chat.ID, user.TgName, user.ID, false)
+		SendWelcomeMessageWithTyping(bot, db, aiService, config, update.Message.Chat.ID, user.TgName, user.ID, false)
+		return
+	}
+
+	if messageText == "/cancel" {
+		cancelled := CancelPendingOperations(user.ID, update.Message.Chat.ID)
+		log.Printf("User %s cancelled %d pending operations", user.TgName, cancelled)
+		if cancelled == 0 {
+			SendReply(bot, update.Message.Chat.ID, "🤷 Нет ожидающих действий")
+		} else {
+			SendReply(bot, update.Message.Chat.ID, fmt.Sprintf("❌ Отменено ожидающих действий: %d", cancelled))
+		}
+		return
+	}
+
+	if messageText == "/undo" {
+		SendUndo(bot, db, update.Message.Chat.ID, user.ID)
+		return
+	}
+
+	if messageText == "/today" {
+		SendDayView(bot, db, update.Message.Chat.ID, user.ID)
+		return
+	}
+
+	if messageText == "/retro" {
+		SendRetrospective(bot, db, aiService, update.Message.Chat.ID, user.ID, config.RetroLookbackDays)
+		return
+	}
+
+	if messageText == "/export" || strings.HasPrefix(messageText, "/export ") {
+		SendProjectExport(bot, db, update.Message.Chat.ID, user.ID, strings.TrimPrefix(messageText, "/export"))
+		return
+	}
+
+	if messageText == "/recent" {
+		SendRecentProjects(bot, db, update.Message.Chat.ID, user.ID)
+		return
+	}
+
+	if messageText == "/whoami" {
+		SendWhoAmI(bot, db, update.Message.Chat.ID, user)
+		return
+	}
+
+	if messageText == "/settings" {
+		SendSettings(bot, db, update.Message.Chat.ID, user.ID)
+		return
+	}
+
+	if messageText == "/activity" && config.IsAdmin(tgID) {
+		SendRecentActivity(bot, db, update.Message.Chat.ID)
 		return
 	}
 
 	// Process text message
-	processTextMessage(bot, db, aiService, update, user, messageText)
+	processTextMessage(bot, db, aiService, config, update, user, projects, messageText)
+}
+
+// messageHandlerTimeout limits the AI work on one message, provider calls and the retry of
+// generated code that doesn't compile included
+const messageHandlerTimeout = 30 * time.Second
+
+// shouldHandleMessage reports whether the bot answers the message. Members of a group talk to each
+// other too, answering all of it would spam the chat and the AI, so unless configured otherwise
+// only group messages meant for the bot are handled
+func shouldHandleMessage(bot *tgbotapi.BotAPI, config *Config, message *tgbotapi.Message) bool {
+	return !isGroupChat(message) || !config.GroupMentionOnly || addressedToBot(bot, message)
+}
+
+// projectContext is the user's project state a message is handled with, loaded once per message
+// and passed on so the AI context and the function reference don't query it again
+type projectContext struct {
+	current *Project    // Current project in the chat, nil when none is set
+	role    ProjectRole // Role the AI function reference is built for
+}
+
+// loadProjectContext loads the current project, clearing a stale one, and the function role.
+// Returns true if a stale current project was cleared. Errors are logged, the message is then
+// handled without a current project
+func loadProjectContext(store Store, userID int, chatID int64) (projectContext, bool) {
+	current, cleared, err := store.LoadCurrentProject(userID, chatID)
+	if err != nil {
+		log.Printf("❌ Error checking current project for user %d: %v", userID, err)
+		current, cleared = nil, false
+	}
+	return projectContext{current: current, role: FunctionRole(store, userID, current)}, cleared
+}
+
+// isGroupChat returns whether the message comes from a group, where several users share the chat
+func isGroupChat(message *tgbotapi.Message) bool {
+	return message.Chat.IsGroup() || message.Chat.IsSuperGroup()
+}
+
+// addressedToBot returns whether a group message is meant for the bot: a command without a bot
+// name or with this bot's, a reply to a bot message or a mention of the bot in the text or caption
+func addressedToBot(bot *tgbotapi.BotAPI, message *tgbotapi.Message) bool {
+	if message.IsCommand() {
+		_, target, found := strings.Cut(message.CommandWithAt(), "@")
+		return !found || strings.EqualFold(target, bot.Self.UserName)
+	}
+
+	if reply := message.ReplyToMessage; reply != nil && reply.From != nil && reply.From.ID == bot.Self.ID {
+		return true
+	}
+
+	return mentionsBot(bot, message.Text, message.Entities) || mentionsBot(bot, message.Caption, message.CaptionEntities)
+}
+
+// mentionsBot returns whether the entities of text mention the bot, by @username or, for
+// clients that link the name instead, as a text mention of the bot user
+func mentionsBot(bot *tgbotapi.BotAPI, text string, entities []tgbotapi.MessageEntity) bool {
+	// Entity offsets count UTF-16 code units
+	units := utf16.Encode([]rune(text))
+	for _, entity := range entities {
+		switch {
+		case entity.Type == "text_mention":
+			if entity.User != nil && entity.User.ID == bot.Self.ID {
+				return true
+			}
+		case entity.IsMention():
+			end := entity.Offset + entity.Length
+			if entity.Offset < 0 || end > len(units) {
+				continue
+			}
+			if strings.EqualFold(string(utf16.Decode(units[entity.Offset:end])), "@"+bot.Self.UserName) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// stripBotMention removes mentions of the bot, "@bot сделай" and "/today@bot" are handled
+// as "сделай" and "/today". Text mentions of the bot, its linked name, are found by the entities
+func stripBotMention(bot *tgbotapi.BotAPI, text string, entities []tgbotapi.MessageEntity) string {
+	text = stripBotTextMentions(bot, text, entities)
+
+	name := bot.Self.UserName
+	if name == "" {
+		return text
+	}
+
+	var stripped strings.Builder
+	for i := 0; i < len(text); i++ {
+		end := i + 1 + len(name)
+		// Usernames are ASCII, the mention ends where the name does and no word character follows
+		if text[i] == '@' && end <= len(text) && strings.EqualFold(text[i+1:end], name) &&
+			(end == len(text) || !isUsernameByte(text[end])) {
+			i = end - 1
+			continue
+		}
+		stripped.WriteByte(text[i])
+	}
+	return stripped.String()
+}
+
+// stripBotTextMentions removes the text of text_mention entities of the bot user
+func stripBotTextMentions(bot *tgbotapi.BotAPI, text string, entities []tgbotapi.MessageEntity) string {
+	var mentions []tgbotapi.MessageEntity
+	for _, entity := range entities {
+		if entity.Type == "text_mention" && entity.User != nil && entity.User.ID == bot.Self.ID {
+			mentions = append(mentions, entity)
+		}
+	}
+	if len(mentions) == 0 {
+		return text
+	}
+
+	// Entity offsets count UTF-16 code units, removing from the end keeps earlier offsets valid
+	units := utf16.Encode([]rune(text))
+	sort.Slice(mentions, func(i, j int) bool { return mentions[i].Offset > mentions[j].Offset })
+	for _, mention := range mentions {
+		end := mention.Offset + mention.Length
+		if mention.Offset < 0 || end > len(units) {
+			continue
+		}
+		units = append(units[:mention.Offset], units[end:]...)
+	}
+	return string(utf16.Decode(units))
+}
+
+// isUsernameByte reports whether b may appear in a Telegram username
+func isUsernameByte(b byte) bool {
+	return b == '_' || '0' <= b && b <= '9' || 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z'
+}
+
+// defaultUnsupportedMessageReply is used when UNSUPPORTED_MESSAGE_REPLY is not set
+const defaultUnsupportedMessageReply = "🤷 Я пока не умею работать с этим типом сообщений. Напишите текстом или отправьте голосовое"
+
+// handleUnsupportedMessage answers a message without text the bot can't process.
+// A sticker is answered with its emoji when StickerEmojiReply is set
+func handleUnsupportedMessage(bot *tgbotapi.BotAPI, config *Config, message *tgbotapi.Message) {
+	if message.Sticker != nil && config.StickerEmojiReply && message.Sticker.Emoji != "" {
+		SendReply(bot, message.Chat.ID, message.Sticker.Emoji)
+		return
+	}
+
+	log.Printf("Unsupported message without text from chat %d", message.Chat.ID)
+	SendReply(bot, message.Chat.ID, config.UnsupportedMessageReply)
 }
 
 // handleAudioMessage processes voice and audio messages
-func handleAudioMessage(bot *tgbotapi.BotAPI, db *DB, aiService *AIService, update tgbotapi.Update, user *User) {
-	// Check if AI service is enabled
-	if !aiService.IsEnabled() {
+func handleAudioMessage(bot *tgbotapi.BotAPI, db *DB, aiService *AIService, config *Config, update tgbotapi.Update, user *User, projects projectContext) {
+	// Transcription has its own provider, it works whichever chat provider is used
+	if !aiService.CanTranscribe() {
 		SendReply(bot, update.Message.Chat.ID, "🎤 Получил аудиосообщение, но функция транскрипции недоступна. Пожалуйста, отправьте текстовое сообщение.")
 		return
 	}
@@ -127,19 +345,29 @@ func handleAudioMessage(bot *tgbotapi.BotAPI, db *DB, aiService *AIService, upda
 
 	var fileID string
 	var fileName string
+	var duration int
 
 	// Get file info based on message type
 	if update.Message.Voice != nil {
 		fileID = update.Message.Voice.FileID
 		fileName = "voice.ogg" // Telegram voice messages are in OGG format
-		log.Printf("Processing voice message: duration=%ds", update.Message.Voice.Duration)
+		duration = update.Message.Voice.Duration
+		log.Printf("Processing voice message: duration=%ds", duration)
 	} else if update.Message.Audio != nil {
 		fileID = update.Message.Audio.FileID
 		fileName = update.Message.Audio.FileName
 		if fileName == "" {
 			fileName = "audio.mp3" // Default name if not provided
 		}
-		log.Printf("Processing audio message: duration=%ds, filename=%s", update.Message.Audio.Duration, fileName)
+		duration = update.Message.Audio.Duration
+		log.Printf("Processing audio message: duration=%ds, filename=%s", duration, fileName)
+	}
+
+	// Reject long recordings before downloading them
+	if config.MaxAudioSeconds > 0 && duration > config.MaxAudioSeconds {
+		log.Printf("Audio message too long: %ds > %ds", duration, config.MaxAudioSeconds)
+		SendReply(bot, update.Message.Chat.ID, fmt.Sprintf("🎤 Аудиосообщение слишком длинное (%d сек). Максимальная длительность для распознавания - %d сек. Пожалуйста, запишите сообщение короче или отправьте текстом.", duration, config.MaxAudioSeconds))
+		return
 	}
 
 	// Download the audio file from Telegram
@@ -160,10 +388,8 @@ func handleAudioMessage(bot *tgbotapi.BotAPI, db *DB, aiService *AIService, upda
 
 	log.Printf("Audio transcribed: %s", transcribedText)
 
-	// Process the transcribed text as a regular message
-	if transcribedText != "" {
-		processTextMessage(bot, db, aiService, update, user, transcribedText)
-	}
+	// Process the transcribed text as a regular message, silence gets the rephrase prompt
+	processTextMessage(bot, db, aiService, config, update, user, projects, transcribedText)
 }
 
 // downloadTelegramFile downloads a file from Telegram
@@ -185,36 +411,142 @@ func downloadTelegramFile(bot *tgbotapi.BotAPI, fileID string) (io.Reader, error
 	return resp.Body, nil
 }
 
+// telegramUserName returns the username, or the full name for users without one
+func telegramUserName(from *tgbotapi.User) string {
+	if from.UserName != "" {
+		return from.UserName
+	}
+	name := from.FirstName
+	if from.LastName != "" {
+		name += " " + from.LastName
+	}
+	return name
+}
+
+// getCallbackUser returns the user who pressed a button, creating the row if it doesn't exist yet.
+// A button can outlive the user row, e.g. a message sent before the database was reset
+func getCallbackUser(db *DB, query *tgbotapi.CallbackQuery) (*User, error) {
+	user, isNewUser, err := db.GetOrCreateUser(query.From.ID, telegramUserName(query.From))
+	if err != nil {
+		return nil, err
+	}
+	if isNewUser {
+		log.Printf("👤 Created user %d for TG ID %d from a button press", user.ID, query.From.ID)
+	}
+	return user, nil
+}
+
+// EmptyMessageReply is sent instead of calling the AI when a message or transcription has no text
+const EmptyMessageReply = "🤔 Не удалось разобрать сообщение, попробуйте сформулировать ещё раз"
+
+// DatabaseUnavailableMessage is sent when the conversation can't be saved or loaded even after retries
+const DatabaseUnavailableMessage = "⚠️ Временные неполадки, попробуйте ещё раз через минуту"
+
+// limitMessageLength cuts text to maxLength characters and reports whether it was cut,
+// a non-positive maxLength is no limit
+func limitMessageLength(text string, maxLength int) (string, bool) {
+	if maxLength <= 0 || utf8.RuneCountInString(text) <= maxLength {
+		return text, false
+	}
+	return truncateRunes(text, maxLength), true
+}
+
 // processTextMessage processes a text message (extracted from HandleUserMessage)
-func processTextMessage(bot *tgbotapi.BotAPI, db *DB, aiService *AIService, update tgbotapi.Update, user *User, messageText string) {
-	// Save user message to database
-	if err := db.SaveMessage(user.ID, update.Message.Chat.ID, "user", messageText); err != nil {
+func processTextMessage(bot *tgbotapi.BotAPI, db *DB, aiService *AIService, config *Config, update tgbotapi.Update, user *User, projects projectContext, messageText string) {
+	// An empty prompt wastes a request and confuses the model, ask the user to rephrase instead
+	messageText = strings.TrimSpace(messageText)
+	if messageText == "" {
+		log.Printf("Empty message text from user %d, skipping AI", user.ID)
+		SendReply(bot, update.Message.Chat.ID, EmptyMessageReply)
+		return
+	}
+
+	// Very long input would bloat the stored history and every prompt that includes it
+	if limited, truncated := limitMessageLength(messageText, config.MaxUserMessageLength); truncated {
+		log.Printf("Message from user %d is longer than %d characters, truncating", user.ID, config.MaxUserMessageLength)
+		messageText = limited
+		SendReply(bot, update.Message.Chat.ID, fmt.Sprintf("✂️ Сообщение слишком длинное, обработаю первые %d символов", config.MaxUserMessageLength))
+	}
+
+	// Answer with the provider and in the language the user picked in /settings
+	prefs := userPreferencesOrDefault(db, user.ID)
+	aiService = aiService.ForProvider(prefs.PreferredProvider)
+
+	// Members share the history of a group chat, the AI has to know who is speaking.
+	// Fallback commands are matched without the name
+	commandText := messageText
+	if isGroupChat(update.Message) {
+		messageText = user.TgName + ": " + messageText
+	}
+
+	// Save user message to database. If it can't be saved the database is down, answering
+	// without memory of the conversation would only confuse the user
+	err := WithRetry("Saving user message", func() error {
+		return db.SaveMessage(user.ID, update.Message.Chat.ID, "user", messageText)
+	})
+	if err != nil {
 		log.Printf("Error saving user message: %v", err)
+		SendReply(bot, update.Message.Chat.ID, DatabaseUnavailableMessage)
+		return
 	}
 
-	// Load recent conversation history (last 50 messages)
-	history, err := db.GetRecentMessages(update.Message.Chat.ID, 50)
+	// Without AI use the deterministic command parser
+	if !aiService.IsEnabled() {
+		reply := HandleFallbackCommand(db, user, update.Message.Chat.ID, commandText)
+		messageID := SendReply(bot, update.Message.Chat.ID, reply)
+		if err := db.SaveSentMessage(user.ID, update.Message.Chat.ID, "assistant", reply, messageID); err != nil {
+			log.Printf("Error saving fallback response: %v", err)
+		}
+		return
+	}
+
+	// Load recent conversation history (context window, storage keeps up to 50 messages).
+	// The count and age limits both apply, whichever leaves fewer messages
+	var history []*Message
+	err = WithRetry("Loading conversation history", func() error {
+		var err error
+		history, err = db.GetRecentMessagesWithin(update.Message.Chat.ID, config.ContextWindowMessages, config.ContextMaxAge())
+		return err
+	})
 	if err != nil {
 		log.Printf("Error loading conversation history: %v", err)
-		history = []*Message{} // Use empty history on error
+		SendReply(bot, update.Message.Chat.ID, DatabaseUnavailableMessage)
+		return
 	}
 
 	// Create context with timeout for AI generation
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), messageHandlerTimeout)
 	defer cancel()
+	ctx = WithPromptLanguage(ctx, prefs.Language)
 
 	// Start typing indicator
 	SendTypingWithContext(bot, update.Message.Chat.ID, ctx)
 
-	// Get user's current project for context
-	currentProject, err := db.GetUserCurrentProject(user.ID)
-	if err != nil {
-		log.Printf("Error getting current project for user %d: %v", user.ID, err)
-		currentProject = nil // Continue without current project context
+	// Optional "thinking" message for slow responses, the first reply replaces it
+	placeholder := StartThinkingPlaceholder(bot, update.Message.Chat.ID)
+	defer placeholder.Remove()
+	reply := func(text string) int {
+		if messageID := placeholder.ReplaceWith(text); messageID != 0 {
+			return messageID
+		}
+		return SendReply(bot, update.Message.Chat.ID, text)
+	}
+
+	// The current project and the role were loaded by HandleUserMessage
+	currentProject := projects.current
+	if currentProject != nil {
+		// Lets the AI bring up overdue tasks without being asked
+		stats, err := db.GetProjectTaskStats(currentProject.ID, prefs.Location())
+		if err != nil {
+			log.Printf("Error getting task stats of project %d: %v", currentProject.ID, err)
+		}
+		currentProject.TaskStats = stats
 	}
+	ctx = WithFunctionRole(ctx, projects.role)
 
 	// Generate AI response with conversation context and current project
 	aiResponse, err := aiService.GenerateResponseWithContextAndProject(ctx, messageText, history, currentProject, "Привет! Я помощник команды разработчиков. Как дела? 👋")
+	placeholder.Stop()
 
 	// Handle AI service errors
 	if err != nil {
@@ -224,14 +556,16 @@ func processTextMessage(bot *tgbotapi.BotAPI, db *DB, aiService *AIService, upda
 		} else {
 			// Real error - inform user and save error message
 			errorMsg := fmt.Sprintf("❌ Произошла ошибка при обработке запроса: %v", err)
+			if errors.Is(err, ErrAITimeout) {
+				errorMsg = "⏳ AI не ответил вовремя, попробуйте ещё раз"
+			}
 			log.Printf("AI generation error: %v", err)
 
 			// Save error response to database
-			if saveErr := db.SaveMessage(user.ID, update.Message.Chat.ID, "assistant", errorMsg); saveErr != nil {
+			messageID := reply(errorMsg)
+			if saveErr := db.SaveSentMessage(user.ID, update.Message.Chat.ID, "assistant", errorMsg, messageID); saveErr != nil {
 				log.Printf("Error saving bot error response: %v", saveErr)
 			}
-
-			SendReply(bot, update.Message.Chat.ID, errorMsg)
 			return
 		}
 	}
@@ -240,10 +574,38 @@ func processTextMessage(bot *tgbotapi.BotAPI, db *DB, aiService *AIService, upda
 	log.Printf("🔄 EXECUTING JAVASCRIPT for user %d: %s", user.ID, aiResponse)
 
 	parameters := map[string]interface{}{
-		"code": aiResponse,
+		"code":             aiResponse,
+		"max_output_bytes": config.MaxJSOutputSize,
+	}
+
+	jsResult, err := executeJavaScriptDirect(db, user.ID, update.Message.Chat.ID, parameters)
+
+	// Code that doesn't compile didn't run, let the AI fix it once before the user sees the error
+	if err != nil && isJavaScriptSyntaxError(err) && ctx.Err() == nil {
+		log.Printf("🔁 JavaScript syntax error for user %d, retrying with the error as hint: %v", user.ID, err)
+
+		retryHistory := append(history[:len(history):len(history)],
+			&Message{UserID: user.ID, ChatID: update.Message.Chat.ID, Role: "assistant", Content: aiResponse},
+			&Message{UserID: user.ID, ChatID: update.Message.Chat.ID, Role: "system", Content: fmt.Sprintf(JavaScriptSyntaxRetryHint, err)},
+		)
+		retryResponse, retryErr := aiService.GenerateResponseWithContextAndProject(ctx, messageText, retryHistory, currentProject, "")
+		if retryErr != nil && strings.HasPrefix(retryErr.Error(), "function_call:") {
+			retryResponse, retryErr = retryErr.Error(), nil
+		}
+
+		if retryErr != nil {
+			log.Printf("AI retry after JavaScript syntax error failed for user %d: %v", user.ID, retryErr)
+		} else {
+			log.Printf("🔄 EXECUTING RETRIED JAVASCRIPT for user %d: %s", user.ID, retryResponse)
+			aiResponse = retryResponse
+			parameters["code"] = aiResponse
+			jsResult, err = executeJavaScriptDirect(db, user.ID, update.Message.Chat.ID, parameters)
+			if err == nil {
+				log.Printf("✅ JavaScript retry succeeded for user %d", user.ID)
+			}
+		}
 	}
 
-	jsResult, err := executeJavaScriptDirect(db, user.ID, parameters)
 	if err != nil {
 		log.Printf("Error executing JavaScript: %v", err)
 
@@ -270,7 +632,7 @@ message("%s");
 
 🔄 Попробуйте еще раз с JavaScript кодом!`, aiResponse, aiResponse)
 
-			SendReply(bot, update.Message.Chat.ID, errorMsg)
+			reply(errorMsg)
 		} else {
 			// This is a JavaScript syntax error, provide specific help
 			jsErrorMsg := fmt.Sprintf(`🚨 ОШИБКА JAVASCRIPT: %v
@@ -280,22 +642,15 @@ message("%s");
 
 🔧 ЧАСТЫЕ ОШИБКИ И ИСПРАВЛЕНИЯ:
 
-1️⃣ Пропущен return в map():
-❌ projects.map(p => { title: p.title })
-✅ projects.map(p => ({ title: p.title }))
-✅ projects.map(p => { return { title: p.title }; })
-
-2️⃣ Неправильный синтаксис объекта:
-❌ { title: project.title, count: tasks.length }
-✅ let obj = { title: project.title, count: tasks.length };
-✅ return { title: project.title, count: tasks.length };
+%s
 
-3️⃣ Забыли точку с запятой:
-❌ let x = 5
-✅ let x = 5;
+🔄 Исправьте синтаксис и попробуйте снова!`, err, aiResponse, formatErrorExamples(currentErrorExamples()))
+			reply(jsErrorMsg)
 
-🔄 Исправьте синтаксис и попробуйте снова!`, err, aiResponse)
-			SendReply(bot, update.Message.Chat.ID, jsErrorMsg)
+			// Recorded failures pick the examples in the system prompt
+			if err := db.RecordJSError(user.ID, err.Error(), aiResponse); err != nil {
+				log.Printf("Error recording JavaScript error: %v", err)
+			}
 
 			// Save the error to context so GPT learns
 			systemError := fmt.Sprintf("КРИТИЧЕСКАЯ ОШИБКА JAVASCRIPT: GPT написал код с синтаксической ошибкой '%s'. ОБЯЗАТЕЛЬНО проверять синтаксис JavaScript! Частые ошибки: пропущен return в map(), неправильные объекты, забытые точки с запятой.", aiResponse)
@@ -313,15 +668,28 @@ message("%s");
 		if requiresConfirmation, ok := resultObj["requiresConfirmation"].(bool); ok && requiresConfirmation {
 			// This is a pending operation, handle it normally
 			operationID := resultObj["operationID"].(string)
-			if pendingOp, exists := pendingOperations[operationID]; exists {
-				pendingOp.ChatID = update.Message.Chat.ID // Set correct chat ID
-				pendingOperations[operationID] = pendingOp
+			if pendingOp, exists := pendingOperations.Get(operationID); exists {
+				pendingOperations.SetChat(pendingOp.ID, update.Message.Chat.ID) // Set correct chat ID
+				// Confirmations and announcements carry buttons, they can't replace the placeholder
+				placeholder.Remove()
+
+				// Preview mode runs non-destructive operations right away
+				if config.PreviewActions && RunPreviewedOperation(bot, db, pendingOp) {
+					return
+				}
+				// Deleting an empty personal project doesn't need confirmation either
+				if RunLowImpactOperation(bot, db, pendingOp) {
+					return
+				}
 
 				confirmationMsg := CreateConfirmationMessage(db, pendingOp)
-				if _, err := bot.Send(confirmationMsg); err != nil {
+				sent, err := bot.Send(confirmationMsg)
+				if err != nil {
 					log.Printf("Error sending confirmation message: %v", err)
-					SendReply(bot, update.Message.Chat.ID, "Ошибка отправки подтверждения")
+					reply("Ошибка отправки подтверждения")
+					return
 				}
+				pendingOperations.SetMessage(pendingOp.ID, sent.MessageID)
 				return
 			}
 		}
@@ -329,43 +697,42 @@ message("%s");
 		// Handle messages and output from JavaScript
 		messages, hasMessages := resultObj["messages"].([]interface{})
 		outputArray, hasOutput := resultObj["output"].([]interface{})
+		buttonMessages, hasButtonMessages := resultObj["button_messages"].([]interface{})
 
 		// Send messages to user if any
 		if hasMessages && len(messages) > 0 {
 			for _, msg := range messages {
 				if msgStr, ok := msg.(string); ok && msgStr != "" {
-					SendReply(bot, update.Message.Chat.ID, msgStr)
+					messageID := reply(msgStr)
 					// Save each message to history
-					if err := db.SaveMessage(user.ID, update.Message.Chat.ID, "assistant", msgStr); err != nil {
+					if err := db.SaveSentMessage(user.ID, update.Message.Chat.ID, "assistant", msgStr, messageID); err != nil {
 						log.Printf("Error saving bot message: %v", err)
 					}
 				}
 			}
 		}
 
+		// Send messages with buttons after the plain ones
+		if hasButtonMessages {
+			sendButtonMessages(bot, db, user.ID, update.Message.Chat.ID, buttonMessages)
+		}
+
 		// If there's output data, pass it back to GPT for continuation
 		if hasOutput && len(outputArray) > 0 {
 			log.Printf("🔄 JavaScript returned %d output items, continuing GPT conversation", len(outputArray))
 
-			// Convert output array to strings and join for context message
-			var outputStrings []string
-			for _, item := range outputArray {
-				if itemStr, ok := item.(string); ok {
-					outputStrings = append(outputStrings, itemStr)
-				} else {
-					outputStrings = append(outputStrings, fmt.Sprintf("%v", item))
-				}
+			// Store the output as a structured function result so the model reads it as data
+			outputMessage, err := javaScriptOutputMessage(outputArray)
+			if err != nil {
+				log.Printf("Error encoding JavaScript output: %v", err)
+				return
 			}
-			outputData := strings.Join(outputStrings, "\n")
-
-			// Add detailed output data to conversation context
-			outputMessage := fmt.Sprintf("Результат выполнения JavaScript кода:\n\nВызванный код вернул следующие данные через output():\n%s\n\nПроанализируй эти данные и продолжи диалог с пользователем.", outputData)
-			if err := db.SaveMessage(user.ID, update.Message.Chat.ID, "system", outputMessage); err != nil {
+			if err := db.SaveMessage(user.ID, update.Message.Chat.ID, "function", outputMessage); err != nil {
 				log.Printf("Error saving JavaScript output to history: %v", err)
 			}
 
 			// Generate new AI response based on the output
-			messages, err := db.GetRecentMessages(update.Message.Chat.ID, 10)
+			messages, err := db.GetRecentMessagesWithin(update.Message.Chat.ID, 10, config.ContextMaxAge())
 			if err != nil {
 				log.Printf("Error getting recent messages for continuation: %v", err)
 				return
@@ -374,10 +741,12 @@ message("%s");
 			// Send typing indicator while generating response
 			ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 			defer cancel()
+			ctx = WithPromptLanguage(ctx, prefs.Language)
+			ctx = WithFunctionRole(ctx, projects.role)
 			SendTypingWithContext(bot, update.Message.Chat.ID, ctx)
 
 			// Generate AI response with the new context - GPT should generate NEW JavaScript code
-			continueResponse, err := aiService.GenerateResponseWithContext(ctx, "Проанализируй данные из output() и сгенерируй НОВЫЙ JavaScript код для обработки этих данных", messages, "")
+			continueResponse, err := aiService.GenerateResponseWithContext(ctx, OutputContinuationPromptForLanguage(prefs.Language), messages, "")
 			if err != nil {
 				log.Printf("Error generating continuation response: %v", err)
 				return
@@ -386,10 +755,11 @@ message("%s");
 			// Execute the NEW JavaScript code generated by GPT with prev_output array
 			log.Printf("🔄 EXECUTING NEW JS CODE generated by GPT for user %d", user.ID)
 			recParams := map[string]interface{}{
-				"code":        continueResponse,
-				"prev_output": outputArray, // Передаем массив output данных
+				"code":             continueResponse,
+				"prev_output":      outputArray, // Передаем массив output данных
+				"max_output_bytes": config.MaxJSOutputSize,
 			}
-			recResult, err := executeJavaScriptDirect(db, user.ID, recParams)
+			recResult, err := executeJavaScriptDirect(db, user.ID, update.Message.Chat.ID, recParams)
 			if err == nil {
 				// Handle recursive result
 				var recObj map[string]interface{}
@@ -397,8 +767,8 @@ message("%s");
 					if recMessages, ok := recObj["messages"].([]interface{}); ok {
 						for _, msg := range recMessages {
 							if msgStr, ok := msg.(string); ok && msgStr != "" {
-								SendReply(bot, update.Message.Chat.ID, msgStr)
-								if err := db.SaveMessage(user.ID, update.Message.Chat.ID, "assistant", msgStr); err != nil {
+								messageID := reply(msgStr)
+								if err := db.SaveSentMessage(user.ID, update.Message.Chat.ID, "assistant", msgStr, messageID); err != nil {
 									log.Printf("Error saving recursive bot message: %v", err)
 								}
 							}
@@ -410,7 +780,7 @@ message("%s");
 		}
 
 		// If only messages were sent (no output), we're done
-		if hasMessages {
+		if hasMessages || hasButtonMessages {
 			return
 		}
 	}
@@ -418,17 +788,17 @@ message("%s");
 	// Fallback: if no messages were sent, this might be an error or unexpected result
 	if jsResult != "" {
 		log.Printf("⚠️ JavaScript executed but no messages sent to user. Result: %s", jsResult)
-		SendReply(bot, update.Message.Chat.ID, "Код выполнен, но результат не был отправлен через message()")
+		reply("Код выполнен, но результат не был отправлен через message()")
 	}
 
 	// Cleanup old messages (keep last 50)
-	if err := db.CleanupOldMessages(update.Message.Chat.ID, 50); err != nil {
+	if err := db.MaybeCleanupOldMessages(update.Message.Chat.ID, maxContextWindowMessages); err != nil {
 		log.Printf("Error cleaning up old messages: %v", err)
 	}
 }
 
 // SendWelcomeMessageWithTyping sends a welcome message with typing indicator
-func SendWelcomeMessageWithTyping(bot *tgbotapi.BotAPI, db *DB, aiService *AIService, chatID int64, userName string, userID int, isNewUser bool) {
+func SendWelcomeMessageWithTyping(bot *tgbotapi.BotAPI, db *DB, aiService *AIService, config *Config, chatID int64, userName string, userID int, isNewUser bool) {
 	// Create context with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
@@ -436,9 +806,11 @@ func SendWelcomeMessageWithTyping(bot *tgbotapi.BotAPI, db *DB, aiService *AISer
 	// Start typing indicator
 	SendTypingWithContext(bot, chatID, ctx)
 
-	// Check if user has any projects
-	projects, err := db.GetUserProjects(userID)
-	hasProjects := err == nil && len(projects) > 0
+	// Check if user owns any projects, being invited to someone else's project doesn't skip onboarding
+	hasProjects, err := db.HasOwnedProjects(userID)
+	if err != nil {
+		log.Printf("Error checking projects for user %d: %v", userID, err)
+	}
 
 	var welcomeText string
 
@@ -465,14 +837,28 @@ func SendWelcomeMessageWithTyping(bot *tgbotapi.BotAPI, db *DB, aiService *AISer
 		status := "возвращающийся пользователь"
 		timestamp := time.Now().Format("15:04, 2 January 2006")
 
+		// Tailor the greeting to how long the user has been away
+		daysAway := 0
+		if lastActivity, err := db.GetUserLastActivity(userID); err != nil {
+			log.Printf("Error getting last activity for user %d: %v", userID, err)
+		} else {
+			daysAway = int(time.Since(lastActivity).Hours() / 24)
+		}
+		longAway := config.ReturningUserCatchUpDays > 0 && daysAway >= config.ReturningUserCatchUpDays
+
 		if hasProjects {
-			welcomeText = aiService.GenerateWelcomeMessage(
-				ctx,
-				userName,
-				status,
-				timestamp,
-				"👋 Привет снова, "+userName+"!\n\nРад видеть вас! Чем могу помочь?\n\nИспользуйте команды для взаимодействия со мной.",
-			)
+			fallback := "👋 С возвращением, " + userName + "!\n\nЧем могу помочь?"
+			if longAway {
+				status = fmt.Sprintf("возвращающийся пользователь, не заходил %d дн.", daysAway)
+				fallback = "👋 С возвращением, " + userName + "! Давно не виделись."
+			}
+			welcomeText = aiService.GenerateWelcomeMessage(ctx, userName, status, timestamp, fallback)
+
+			if longAway {
+				if summary := buildCatchUpSummary(db, userID); summary != "" {
+					welcomeText += "\n\n" + summary
+				}
+			}
 		} else {
 			// Suggest creating first project for returning users with no projects
 			welcomeText = fmt.Sprintf("👋 Привет снова, %s!\n\nЯ заметил, что у вас пока нет проектов. Давайте исправим это!\n\n🚀 Выберите один из популярных типов проектов ниже или создайте свой:\n\n💡 Просто скажите: \"Создай проект [ваше название]\"", userName)
@@ -480,9 +866,9 @@ func SendWelcomeMessageWithTyping(bot *tgbotapi.BotAPI, db *DB, aiService *AISer
 		log.Printf("Sending /start welcome message to %s (hasProjects: %t)", userName, hasProjects)
 	}
 
-	// Send message with create project button if no projects exist
+	// Send message with onboarding buttons if no projects exist
 	if !hasProjects {
-		SendMessageWithCreateProjectButton(bot, chatID, welcomeText)
+		SendMessageWithWelcomeButtons(bot, chatID, welcomeText, config.WelcomeActions, config.WelcomeProjectSuggestions)
 	} else {
 		// Send regular message if user has projects
 		msg := tgbotapi.NewMessage(chatID, welcomeText)
@@ -495,33 +881,187 @@ func SendWelcomeMessageWithTyping(bot *tgbotapi.BotAPI, db *DB, aiService *AISer
 	}
 }
 
-// SendReply sends a reply message to the user
-func SendReply(bot *tgbotapi.BotAPI, chatID int64, text string) {
-	msg := tgbotapi.NewMessage(chatID, text)
+// buildCatchUpSummary summarizes open and overdue tasks for a user returning after a long break
+func buildCatchUpSummary(db *DB, userID int) string {
+	counts, err := db.GetUserTaskCountsByStatus(userID)
+	if err != nil {
+		log.Printf("Error getting task counts for user %d: %v", userID, err)
+		return ""
+	}
+
+	tasks, err := db.GetUserTasks(userID)
+	if err != nil {
+		log.Printf("Error getting tasks for user %d: %v", userID, err)
+		return ""
+	}
+
+	overdue := 0
+	now := time.Now()
+	for _, task := range tasks {
+		if task.Deadline != nil && task.Deadline.Before(now) && task.Status != TaskDone && task.Status != TaskCancelled {
+			overdue++
+		}
+	}
+
+	summary := fmt.Sprintf("📋 Ваши задачи сейчас:\n• К выполнению: %d\n• В работе: %d\n• На проверке: %d",
+		counts[TaskTodo], counts[TaskInProgress], counts[TaskReview])
+	if overdue > 0 {
+		summary += fmt.Sprintf("\n• ⚠️ Просрочено: %d", overdue)
+	}
+	return summary
+}
+
+// SendReply sends a reply message to the user.
+// Markdown in the text (usually from the AI) is converted to Telegram HTML
+func SendReply(bot *tgbotapi.BotAPI, chatID int64, text string) int {
+	msg := tgbotapi.NewMessage(chatID, MarkdownToTelegramHTML(text))
 	msg.ParseMode = tgbotapi.ModeHTML // Enable HTML formatting
-	if _, err := bot.Send(msg); err != nil {
+	sent, err := bot.Send(msg)
+	if err != nil {
 		log.Printf("Failed to send message: %v", err)
+		return 0
 	}
+	return sent.MessageID
 }
 
-// SendMessageWithCreateProjectButton sends a message with "Create Project" inline button
-func SendMessageWithCreateProjectButton(bot *tgbotapi.BotAPI, chatID int64, text string) {
+// streamEditInterval is the minimum time between edits of a streamed message
+var streamEditInterval = time.Second
+
+// SetStreamEditInterval sets how often StreamReply edits the message, non-positive values are ignored
+func SetStreamEditInterval(interval time.Duration) {
+	if interval > 0 {
+		streamEditInterval = interval
+	}
+}
+
+// StreamReply sends text arriving in deltas as one message, editing it at most once per
+// streamEditInterval to stay within Telegram rate limits. Intermediate edits are plain text
+// since unfinished Markdown can't be converted, the final text is formatted like SendReply
+func StreamReply(bot *tgbotapi.BotAPI, chatID int64, deltas <-chan string) {
+	var text strings.Builder
+	var messageID int
+	lastSent := ""
+
+	flush := func(final bool) {
+		content := text.String()
+		if strings.TrimSpace(content) == "" {
+			return
+		}
+
+		parseMode := ""
+		if final {
+			content = MarkdownToTelegramHTML(content)
+			parseMode = tgbotapi.ModeHTML
+		}
+		if content == lastSent && !final {
+			return
+		}
+
+		if messageID == 0 {
+			msg := tgbotapi.NewMessage(chatID, content)
+			msg.ParseMode = parseMode
+			sent, err := bot.Send(msg)
+			if err != nil {
+				log.Printf("Failed to send streamed message: %v", err)
+				return
+			}
+			messageID = sent.MessageID
+		} else {
+			editMsg := tgbotapi.NewEditMessageText(chatID, messageID, content)
+			editMsg.ParseMode = parseMode
+			// Telegram rejects edits that don't change the message, nothing to do then
+			if _, err := bot.Send(editMsg); err != nil && !strings.Contains(err.Error(), "message is not modified") {
+				log.Printf("Failed to edit streamed message: %v", err)
+				return
+			}
+		}
+		lastSent = content
+	}
+
+	ticker := time.NewTicker(streamEditInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case delta, ok := <-deltas:
+			if !ok {
+				flush(true)
+				return
+			}
+			text.WriteString(delta)
+		case <-ticker.C:
+			flush(false)
+		}
+	}
+}
+
+// SendMessageWithWelcomeButtons sends a message with the configured onboarding buttons
+// and buttons for suggested project names
+func SendMessageWithWelcomeButtons(bot *tgbotapi.BotAPI, chatID int64, text string, actions []string, suggestions []string) {
 	msg := tgbotapi.NewMessage(chatID, text)
 	msg.ParseMode = tgbotapi.ModeHTML // Enable HTML formatting
 
-	// Add inline keyboard with "Create Project" button and suggested project names
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("➕ Создать проект", "create_project_button"),
-		),
-		// thats an name suggesion
-		/*tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("💻 Веб-приложение", "suggest_project_Веб-приложение"),
-		),*/
-	)
-
-	msg.ReplyMarkup = keyboard
+	if rows := buildWelcomeKeyboard(actions, suggestions); len(rows) > 0 {
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	}
 	if _, err := bot.Send(msg); err != nil {
-		log.Printf("Failed to send message with create project button: %v", err)
+		log.Printf("Failed to send message with welcome buttons: %v", err)
+	}
+}
+
+// suggestProjectPrefix is the callback data prefix for suggested project buttons
+const suggestProjectPrefix = "suggest_project_"
+
+// maxProjectSuggestions limits how many suggestion buttons are shown
+const maxProjectSuggestions = 4
+
+// sendButtonMessages sends the messages with buttons of a JavaScript result and saves them to history.
+// They were validated when JavaScript produced them, items that don't parse are skipped
+func sendButtonMessages(bot *tgbotapi.BotAPI, db *DB, userID int, chatID int64, items []interface{}) {
+	for _, item := range items {
+		parameters, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		message, buttons, err := parseMessageButtons(parameters)
+		if err != nil {
+			log.Printf("Skipping message with invalid buttons: %v", err)
+			continue
+		}
+
+		messageID, err := SendMessageWithCustomButtons(bot, chatID, message, buttons)
+		if err != nil {
+			continue
+		}
+		if err := db.SaveSentMessage(userID, chatID, "assistant", message, messageID); err != nil {
+			log.Printf("Error saving bot message with buttons: %v", err)
+		}
+	}
+}
+
+// telegramCallbackDataLimit is the maximum size of callback data in bytes
+const telegramCallbackDataLimit = 64
+
+// defaultWelcomeProjectSuggestions are used when WELCOME_PROJECT_SUGGESTIONS is not set
+var defaultWelcomeProjectSuggestions = []string{
+	"Веб-приложение",
+	"Мобильное приложение",
+	"Маркетинг",
+	"Исследование",
+}
+
+// limitProjectSuggestions keeps suggestions that fit into callback data, up to maxProjectSuggestions
+func limitProjectSuggestions(suggestions []string) []string {
+	var result []string
+	for _, name := range suggestions {
+		if len(result) >= maxProjectSuggestions {
+			break
+		}
+		if len(suggestProjectPrefix+name) > telegramCallbackDataLimit {
+			log.Printf("Skipping project suggestion '%s': exceeds callback data limit", name)
+			continue
+		}
+		result = append(result, name)
 	}
+	return result
 }
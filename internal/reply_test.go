@@ -0,0 +1,279 @@
+package internal
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// testBot is a bot that is never connected, enough for code that only reads its own user
+func testBot() *tgbotapi.BotAPI {
+	return &tgbotapi.BotAPI{Self: tgbotapi.User{ID: 42, IsBot: true, UserName: "teamwork_bot"}}
+}
+
+// sentMessagesClient accepts every Telegram request and records the texts of sent messages
+type sentMessagesClient struct {
+	texts []string
+}
+
+func (c *sentMessagesClient) Do(req *http.Request) (*http.Response, error) {
+	body, _ := io.ReadAll(req.Body)
+	if strings.HasSuffix(req.URL.Path, "/sendMessage") {
+		values, _ := url.ParseQuery(string(body))
+		c.texts = append(c.texts, values.Get("text"))
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(`{"ok":true,"result":{"message_id":1}}`)),
+		Header:     http.Header{},
+	}, nil
+}
+
+// recordingBot is testBot sending its requests to a sentMessagesClient
+func recordingBot() (*tgbotapi.BotAPI, *sentMessagesClient) {
+	client := &sentMessagesClient{}
+	bot := testBot()
+	bot.Client = client
+	bot.SetAPIEndpoint(tgbotapi.APIEndpoint)
+	return bot, client
+}
+
+func TestShouldHandleMessage(t *testing.T) {
+	bot := testBot()
+	private := &tgbotapi.Chat{ID: 7, Type: "private"}
+	group := &tgbotapi.Chat{ID: -100, Type: "supergroup"}
+	command := func(length int) []tgbotapi.MessageEntity {
+		return []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: length}}
+	}
+
+	tests := []struct {
+		name        string
+		mentionOnly bool
+		message     *tgbotapi.Message
+		want        bool
+	}{
+		{"private chat", true, &tgbotapi.Message{Chat: private, Text: "привет"}, true},
+		{"group, every message", false, &tgbotapi.Message{Chat: group, Text: "привет"}, true},
+		{"group, plain text", true, &tgbotapi.Message{Chat: group, Text: "привет"}, false},
+		{"group, command", true, &tgbotapi.Message{Chat: group, Text: "/today", Entities: command(6)}, true},
+		{"group, command to the bot", true,
+			&tgbotapi.Message{Chat: group, Text: "/today@teamwork_bot", Entities: command(19)}, true},
+		{"group, command to another bot", true,
+			&tgbotapi.Message{Chat: group, Text: "/today@other_bot", Entities: command(16)}, false},
+		{"group, mention", true, &tgbotapi.Message{Chat: group, Text: "@teamwork_bot задачи",
+			Entities: []tgbotapi.MessageEntity{{Type: "mention", Offset: 0, Length: 13}}}, true},
+		{"group, reply to the bot", true,
+			&tgbotapi.Message{Chat: group, Text: "да", ReplyToMessage: &tgbotapi.Message{From: &bot.Self}}, true},
+		{"group, reply to a member", true,
+			&tgbotapi.Message{Chat: group, Text: "да", ReplyToMessage: &tgbotapi.Message{From: &tgbotapi.User{ID: 8}}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{GroupMentionOnly: tt.mentionOnly}
+			if got := shouldHandleMessage(bot, config, tt.message); got != tt.want {
+				t.Errorf("shouldHandleMessage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMentionsBot(t *testing.T) {
+	bot := testBot()
+	mention := func(offset, length int) []tgbotapi.MessageEntity {
+		return []tgbotapi.MessageEntity{{Type: "mention", Offset: offset, Length: length}}
+	}
+	textMention := func(offset, length int, user *tgbotapi.User) []tgbotapi.MessageEntity {
+		return []tgbotapi.MessageEntity{{Type: "text_mention", Offset: offset, Length: length, User: user}}
+	}
+
+	tests := []struct {
+		name     string
+		text     string
+		entities []tgbotapi.MessageEntity
+		want     bool
+	}{
+		{"mention", "@teamwork_bot задачи", mention(0, 13), true},
+		{"mention in other case", "@TeamWork_Bot задачи", mention(0, 13), true},
+		// "🚀 " is three UTF-16 code units
+		{"mention after an emoji", "🚀 @teamwork_bot", mention(3, 13), true},
+		{"text mention of the bot", "Бот, задачи", textMention(0, 3, &bot.Self), true},
+		{"text mention of a member", "Иван, задачи", textMention(0, 4, &tgbotapi.User{ID: 8}), false},
+		{"mention of another bot", "@other_bot задачи", mention(0, 10), false},
+		{"username without an entity", "@teamwork_bot задачи", nil, false},
+		{"entity out of range", "@teamwork_bot", mention(5, 13), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mentionsBot(bot, tt.text, tt.entities); got != tt.want {
+				t.Errorf("mentionsBot() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripBotMention(t *testing.T) {
+	bot := testBot()
+	textMention := func(offset, length int, user *tgbotapi.User) []tgbotapi.MessageEntity {
+		return []tgbotapi.MessageEntity{{Type: "text_mention", Offset: offset, Length: length, User: user}}
+	}
+
+	tests := []struct {
+		name     string
+		text     string
+		entities []tgbotapi.MessageEntity
+		want     string
+	}{
+		{"mention first", "@teamwork_bot покажи задачи", nil, " покажи задачи"},
+		{"command to the bot", "/today@teamwork_bot", nil, "/today"},
+		{"mention in other case", "@TeamWork_Bot привет", nil, " привет"},
+		{"mention last", "спроси @teamwork_bot", nil, "спроси "},
+		{"longer username", "@teamwork_bot2 привет", nil, "@teamwork_bot2 привет"},
+		{"another bot", "@other_bot привет", nil, "@other_bot привет"},
+		{"shorter username", "@teamwork_bo", nil, "@teamwork_bo"},
+		{"text mention of the bot", "Бот, покажи задачи", textMention(0, 3, &bot.Self), ", покажи задачи"},
+		// "🚀 " is three UTF-16 code units
+		{"text mention after an emoji", "🚀 Бот покажи", textMention(3, 3, &bot.Self), "🚀  покажи"},
+		{"text mention of a member", "Иван, задачи", textMention(0, 4, &tgbotapi.User{ID: 8}), "Иван, задачи"},
+		{"text mention out of range", "Бот", textMention(2, 3, &bot.Self), "Бот"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripBotMention(bot, tt.text, tt.entities); got != tt.want {
+				t.Errorf("stripBotMention(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleUnsupportedMessage(t *testing.T) {
+	chat := &tgbotapi.Chat{ID: 7, Type: "private"}
+	sticker := &tgbotapi.Sticker{FileID: "sticker", Emoji: "👍"}
+
+	tests := []struct {
+		name       string
+		emojiReply bool
+		message    *tgbotapi.Message
+		want       string
+	}{
+		{"sticker answered with its emoji", true, &tgbotapi.Message{Chat: chat, Sticker: sticker}, "👍"},
+		{"sticker with emoji replies off", false, &tgbotapi.Message{Chat: chat, Sticker: sticker}, defaultUnsupportedMessageReply},
+		{"sticker without an emoji", true, &tgbotapi.Message{Chat: chat, Sticker: &tgbotapi.Sticker{FileID: "sticker"}}, defaultUnsupportedMessageReply},
+		{"location", true, &tgbotapi.Message{Chat: chat, Location: &tgbotapi.Location{Latitude: 55.75, Longitude: 37.62}}, defaultUnsupportedMessageReply},
+		{"contact", false, &tgbotapi.Message{Chat: chat, Contact: &tgbotapi.Contact{PhoneNumber: "+70000000000"}}, defaultUnsupportedMessageReply},
+		{"poll", false, &tgbotapi.Message{Chat: chat, Poll: &tgbotapi.Poll{Question: "Когда созвон?"}}, defaultUnsupportedMessageReply},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot, sent := recordingBot()
+			config := &Config{UnsupportedMessageReply: defaultUnsupportedMessageReply, StickerEmojiReply: tt.emojiReply}
+
+			handleUnsupportedMessage(bot, config, tt.message)
+			if len(sent.texts) != 1 || sent.texts[0] != tt.want {
+				t.Errorf("sent %q, want one message %q", sent.texts, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessTextMessageEmpty(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"empty", ""},
+		{"spaces", "   "},
+		{"line breaks and tabs", "\n\t \n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot, sent := recordingBot()
+			update := tgbotapi.Update{Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 7, Type: "private"}, Text: tt.text}}
+
+			// No database or AI: an empty message must not reach them
+			processTextMessage(bot, nil, nil, &Config{}, update, &User{ID: 1, TgName: "user"}, projectContext{}, tt.text)
+			if len(sent.texts) != 1 || sent.texts[0] != EmptyMessageReply {
+				t.Errorf("sent %q, want one message %q", sent.texts, EmptyMessageReply)
+			}
+		})
+	}
+}
+
+func TestLimitMessageLength(t *testing.T) {
+	oversized := strings.Repeat("задача ", 20000)
+
+	tests := []struct {
+		name          string
+		text          string
+		maxLength     int
+		want          string
+		wantTruncated bool
+	}{
+		{"short", "привет", 10, "привет", false},
+		{"exactly the limit", "привет", 6, "привет", false},
+		{"cut by characters, not bytes", "привет мир", 6, "привет", true},
+		{"oversized", oversized, 7000, strings.Repeat("задача ", 1000), true},
+		{"no limit", oversized, 0, oversized, false},
+		{"negative limit", "привет", -1, "привет", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, truncated := limitMessageLength(tt.text, tt.maxLength)
+			if got != tt.want || truncated != tt.wantTruncated {
+				t.Errorf("limitMessageLength() = %.40q (%d bytes), %v, want %.40q (%d bytes), %v",
+					got, len(got), truncated, tt.want, len(tt.want), tt.wantTruncated)
+			}
+		})
+	}
+}
+
+func TestProcessTextMessageNoCurrentProject(t *testing.T) {
+	db := openTestDB(t)
+	user := createTestUser(t, db, "member")
+	chatID := user.TgID
+
+	provider := &scriptedProvider{responses: []string{
+		`try { output(teamwork.listTasks({current_project: true})); } catch (e) { output({error: String(e)}); }`,
+		`message("Сначала выберите проект");`,
+	}}
+	bot, sent := recordingBot()
+	config := &Config{ContextWindowMessages: 50, MaxUserMessageLength: 8000, MaxJSOutputSize: 16384}
+	update := tgbotapi.Update{Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: chatID, Type: "private"}, Text: "покажи задачи"}}
+
+	processTextMessage(bot, db, NewAIService(provider, true), config, update, user, projectContext{}, "покажи задачи")
+
+	if len(provider.calls) != 2 {
+		t.Fatalf("provider called %d times, want 2", len(provider.calls))
+	}
+
+	first := provider.calls[0]
+	if first.prompt != "покажи задачи" || first.currentProject != nil {
+		t.Errorf("first call got prompt %q with project %v, want the user's text without a project", first.prompt, first.currentProject)
+	}
+	if n := len(first.history); n == 0 || first.history[n-1].Role != "user" || first.history[n-1].Content != "покажи задачи" {
+		t.Errorf("first call history does not end with the user's message: %+v", first.history)
+	}
+
+	// The failed listTasks reaches the model as a function result it can act on
+	continuation := provider.calls[1]
+	n := len(continuation.history)
+	if n == 0 || continuation.history[n-1].Role != "function" {
+		t.Fatalf("continuation history does not end with the JavaScript output: %+v", continuation.history)
+	}
+	if !strings.Contains(continuation.history[n-1].Content, ErrNoCurrentProject.Error()) {
+		t.Errorf("JavaScript output = %q, want the no current project error", continuation.history[n-1].Content)
+	}
+
+	if len(sent.texts) != 1 || sent.texts[0] != "Сначала выберите проект" {
+		t.Errorf("sent %q, want the continuation's message", sent.texts)
+	}
+}
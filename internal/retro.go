@@ -0,0 +1,149 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Retrospective is what happened in the user's active projects over the last days
+type Retrospective struct {
+	Days          int     `json:"days"`
+	Completed     []*Task `json:"completed"`      // Tasks finished in the period
+	Created       []*Task `json:"created"`        // Tasks added in the period
+	StatusChanges int     `json:"status_changes"` // Task status changes by any member in the period
+}
+
+// GetUserRetrospective collects completed and created tasks and status changes of the last days
+// in the user's projects that are not completed or cancelled
+func (db *DB) GetUserRetrospective(userID, days int) (*Retrospective, error) {
+	completed, err := db.getActiveProjectTasksWithin(userID, "t.completed_at", days)
+	if err != nil {
+		return nil, err
+	}
+	created, err := db.getActiveProjectTasksWithin(userID, "t.created_at", days)
+	if err != nil {
+		return nil, err
+	}
+
+	// The cutoff is computed by MySQL so it matches the time zone timestamps are stored in
+	query := `
+		SELECT COUNT(*)
+		FROM activity_log al
+		JOIN projects p ON al.project_id = p.id
+		JOIN project_users pu ON p.id = pu.project_id
+		WHERE pu.user_id = ? AND p.status NOT IN ('completed', 'cancelled') AND p.deleted_at IS NULL
+		      AND al.action = ? AND al.undone = FALSE
+		      AND al.created_at >= NOW() - INTERVAL ? DAY
+	`
+
+	retro := &Retrospective{Days: days, Completed: completed, Created: created}
+	err = db.QueryRow(query, userID, ActivityTaskStatusChanged, days).Scan(&retro.StatusChanges)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count status changes: %v", err)
+	}
+
+	return retro, nil
+}
+
+// getActiveProjectTasksWithin returns tasks of the user's active projects whose timestamp column
+// (t.created_at or t.completed_at) is within the last days
+func (db *DB) getActiveProjectTasksWithin(userID int, column string, days int) ([]*Task, error) {
+	query := `
+		SELECT t.id, t.project_id, t.user_id, t.title, t.description,
+		       t.status, t.priority, t.deadline, t.created_at, t.updated_at,
+		       t.completed_at, p.title, ` + taskBlockedColumn + `
+		FROM tasks t
+		JOIN projects p ON t.project_id = p.id
+		JOIN project_users pu ON p.id = pu.project_id
+		WHERE pu.user_id = ? AND p.status NOT IN ('completed', 'cancelled') AND p.deleted_at IS NULL
+		      AND ` + column + ` >= NOW() - INTERVAL ? DAY
+		ORDER BY ` + column + ` ASC
+	`
+
+	rows, err := db.Query(query, userID, days)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tasks for retrospective: %v", err)
+	}
+	defer rows.Close()
+
+	tasks := []*Task{}
+	for rows.Next() {
+		task := &Task{}
+		var deadline, completedAt sql.NullTime
+
+		err := rows.Scan(
+			&task.ID, &task.ProjectID, &task.UserID, &task.Title, &task.Description,
+			&task.Status, &task.Priority, &deadline, &task.CreatedAt, &task.UpdatedAt,
+			&completedAt, &task.ProjectTitle, &task.Blocked,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan task: %v", err)
+		}
+
+		if deadline.Valid {
+			task.Deadline = &deadline.Time
+		}
+		if completedAt.Valid {
+			task.CompletedAt = &completedAt.Time
+		}
+
+		tasks = append(tasks, task)
+	}
+
+	return tasks, nil
+}
+
+// formatRetrospectiveCounts is the retrospective without AI: counts and finished task titles
+func formatRetrospectiveCounts(retro *Retrospective) string {
+	var text strings.Builder
+	fmt.Fprintf(&text, "📆 <b>Итоги за %d дн.</b>\n\n• Выполнено задач: %d\n• Создано задач: %d\n• Смен статуса: %d",
+		retro.Days, len(retro.Completed), len(retro.Created), retro.StatusChanges)
+
+	if len(retro.Completed) > 0 {
+		text.WriteString("\n\n✅ <b>Выполнено</b>")
+		for _, task := range retro.Completed {
+			fmt.Fprintf(&text, "\n• #%d %s — %s", task.ID, html.EscapeString(task.Title), html.EscapeString(task.ProjectTitle))
+		}
+	}
+	return text.String()
+}
+
+// SendRetrospective handles the /retro command: an AI-written summary of the last days,
+// the plain counts when AI is disabled or fails
+func SendRetrospective(bot *tgbotapi.BotAPI, db *DB, aiService *AIService, chatID int64, userID, days int) {
+	retro, err := db.GetUserRetrospective(userID, days)
+	if err != nil {
+		log.Printf("❌ Error getting retrospective for user %d: %v", userID, err)
+		SendReply(bot, chatID, "❌ Не удалось собрать итоги")
+		return
+	}
+	if len(retro.Completed) == 0 && len(retro.Created) == 0 && retro.StatusChanges == 0 {
+		SendReply(bot, chatID, fmt.Sprintf("📆 За последние %d дн. в ваших активных проектах ничего не происходило", days))
+		return
+	}
+
+	fallback := formatRetrospectiveCounts(retro)
+	data, err := json.Marshal(retro)
+	if err != nil {
+		log.Printf("❌ Error marshalling retrospective for user %d: %v", userID, err)
+		SendReply(bot, chatID, fallback)
+		return
+	}
+
+	SendTypingAction(bot, chatID)
+	ctx, cancel := context.WithTimeout(context.Background(), messageHandlerTimeout)
+	defer cancel()
+	if prefs, err := db.GetUserPreferences(userID); err == nil {
+		ctx = WithPromptLanguage(ctx, prefs.Language)
+	}
+
+	// SendReply converts the Markdown of the AI text like any other reply
+	SendReply(bot, chatID, aiService.GenerateFormattedText(ctx, fmt.Sprintf(RetrospectivePromptTemplate, days, data), fallback))
+}
@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Maximum lengths in characters, titles match the column sizes
+const (
+	maxProjectTitleLength = 255
+	maxTaskTitleLength    = 500
+	maxDescriptionLength  = 4000
+)
+
+// ErrEmptyTitle is returned when a title is empty after sanitization
+var ErrEmptyTitle = errors.New("title is empty")
+
+// sanitizeTitle strips control characters, joins the title into one line and cuts it to maxLength
+// characters. Emoji, "<" and other printable characters are kept as typed, HTML messages escape
+// titles with html.EscapeString when rendering them
+func sanitizeTitle(title string, maxLength int) (string, error) {
+	title = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return ' '
+		}
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, title)
+	title = truncateRunes(strings.Join(strings.Fields(title), " "), maxLength)
+
+	if title == "" {
+		return "", ErrEmptyTitle
+	}
+	return title, nil
+}
+
+// sanitizeDescription strips control characters except line breaks and tabs, and cuts the
+// description to maxDescriptionLength characters
+func sanitizeDescription(description string) string {
+	description = strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' {
+			return r
+		}
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, description)
+
+	return strings.TrimSpace(truncateRunes(strings.TrimSpace(description), maxDescriptionLength))
+}
+
+// truncateRunes cuts s to at most maxLength characters without splitting a multi-byte character
+func truncateRunes(s string, maxLength int) string {
+	if utf8.RuneCountInString(s) <= maxLength {
+		return s
+	}
+	return string([]rune(s)[:maxLength])
+}
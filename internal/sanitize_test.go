@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeTitle(t *testing.T) {
+	tests := []struct {
+		name      string
+		title     string
+		maxLength int
+		want      string
+		wantErr   error
+	}{
+		{"plain", "Сайт компании", 255, "Сайт компании", nil},
+		{"html kept as typed", "<b>Bold</b> & <i>co</i>", 255, "<b>Bold</b> & <i>co</i>", nil},
+		{"comparison kept", "a < b > c", 255, "a < b > c", nil},
+		{"emoji kept", "🚀 Запуск 🎉", 255, "🚀 Запуск 🎉", nil},
+		{"joined into one line", "  Первая\nвторая\tстрока  ", 255, "Первая вторая строка", nil},
+		{"control characters removed", "Re\x00po\x07rt", 255, "Report", nil},
+		{"cut by characters", "Привет мир", 6, "Привет", nil},
+		{"emoji not split", "🚀🚀🚀", 2, "🚀🚀", nil},
+		{"empty", " \n\t ", 255, "", ErrEmptyTitle},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sanitizeTitle(tt.title, tt.maxLength)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("sanitizeTitle(%q) error = %v, want %v", tt.title, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("sanitizeTitle(%q) = %q, want %q", tt.title, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeDescription(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+		want        string
+	}{
+		{"line breaks and tabs kept", "Шаги:\n\t1. <b>макет</b>", "Шаги:\n\t1. <b>макет</b>"},
+		{"control characters removed", "a\x00b\x1bc", "abc"},
+		{"trimmed", "  текст  \n", "текст"},
+		{"cut to limit", strings.Repeat("я", maxDescriptionLength+10), strings.Repeat("я", maxDescriptionLength)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeDescription(tt.description); got != tt.want {
+				t.Errorf("sanitizeDescription(%q) = %q, want %q", tt.description, got, tt.want)
+			}
+		})
+	}
+}
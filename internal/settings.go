@@ -0,0 +1,254 @@
+package internal
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// settingsPrefix is the callback data prefix for /settings buttons
+const settingsPrefix = "settings_"
+
+// settingsTimezonePrefix is the callback data prefix for timezone buttons
+const settingsTimezonePrefix = settingsPrefix + "tz_"
+
+// languageNames maps supported languages to their display names
+var languageNames = map[string]string{
+	"ru": "Русский",
+	"en": "English",
+}
+
+// settingsTimezones are the timezones offered in /settings
+var settingsTimezones = []string{
+	"Europe/Kaliningrad",
+	"Europe/Moscow",
+	"Europe/Samara",
+	"Asia/Yekaterinburg",
+	"Asia/Novosibirsk",
+	"Asia/Vladivostok",
+	"Europe/London",
+	"UTC",
+}
+
+// SendWhoAmI sends the stored profile of the user
+func SendWhoAmI(bot *tgbotapi.BotAPI, db *DB, chatID int64, user *User) {
+	prefs, err := db.GetUserPreferences(user.ID)
+	if err != nil {
+		log.Printf("❌ Error getting preferences for user %d: %v", user.ID, err)
+		SendReply(bot, chatID, "❌ Не удалось получить ваши данные")
+		return
+	}
+
+	currentProject := "не выбран"
+	project, err := db.GetCurrentProject(user.ID, chatID)
+	if err != nil {
+		log.Printf("❌ Error getting current project for user %d: %v", user.ID, err)
+	} else if project != nil {
+		currentProject = fmt.Sprintf("#%d %s", project.ID, html.EscapeString(project.Title))
+	}
+
+	projectCount, err := db.GetProjectCount(user.ID)
+	if err != nil {
+		log.Printf("❌ Error counting projects for user %d: %v", user.ID, err)
+	}
+	ownedCount, err := db.GetOwnedProjectCount(user.ID)
+	if err != nil {
+		log.Printf("❌ Error counting owned projects for user %d: %v", user.ID, err)
+	}
+
+	text := fmt.Sprintf(`👤 <b>Ваш профиль</b>
+
+• Имя: %s
+• Telegram ID: %d
+• С нами с: %s
+• Текущий проект: %s
+• Проектов: %d (своих: %d)
+
+%s`,
+		html.EscapeString(user.TgName), user.TgID, user.TS.Format("02.01.2006"),
+		currentProject, projectCount, ownedCount, formatPreferences(prefs))
+
+	SendReply(bot, chatID, text+"\n\n💡 Изменить настройки: /settings")
+}
+
+// SendSettings sends the user's settings with buttons to change them
+func SendSettings(bot *tgbotapi.BotAPI, db *DB, chatID int64, userID int) {
+	prefs, err := db.GetUserPreferences(userID)
+	if err != nil {
+		log.Printf("❌ Error getting preferences for user %d: %v", userID, err)
+		SendReply(bot, chatID, "❌ Не удалось получить настройки")
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatID, "⚙️ <b>Настройки</b>\n\n"+formatPreferences(prefs))
+	msg.ParseMode = tgbotapi.ModeHTML // Enable HTML formatting
+	msg.ReplyMarkup = settingsKeyboard(prefs)
+	if _, err := bot.Send(msg); err != nil {
+		log.Printf("Failed to send settings: %v", err)
+	}
+}
+
+// HandleSettingsCallback handles /settings buttons and updates the settings message in place
+func HandleSettingsCallback(bot *tgbotapi.BotAPI, db *DB, query *tgbotapi.CallbackQuery) {
+	data := query.Data
+
+	user, err := getCallbackUser(db, query)
+	if err != nil {
+		log.Printf("Error getting user by TG ID %d: %v", query.From.ID, err)
+		bot.Send(tgbotapi.NewCallback(query.ID, "Ошибка при получении пользователя"))
+		return
+	}
+
+	prefs, err := db.GetUserPreferences(user.ID)
+	if err != nil {
+		log.Printf("❌ Error getting preferences for user %d: %v", user.ID, err)
+		bot.Send(tgbotapi.NewCallback(query.ID, "Ошибка при загрузке настроек"))
+		return
+	}
+
+	changed := true
+
+	switch {
+	case data == settingsPrefix+"lang":
+		if prefs.Language == "ru" {
+			prefs.Language = "en"
+		} else {
+			prefs.Language = "ru"
+		}
+	case data == settingsPrefix+"digest":
+		prefs.DigestEnabled = !prefs.DigestEnabled
+	case data == settingsPrefix+"provider":
+		prefs.PreferredProvider = nextAIProviderChoice(prefs.PreferredProvider)
+	case data == settingsPrefix+"tz":
+		// Show the timezone picker without saving anything
+		editMsg := tgbotapi.NewEditMessageTextAndMarkup(query.Message.Chat.ID, query.Message.MessageID,
+			"🕐 Выберите часовой пояс", timezoneKeyboard())
+		bot.Send(editMsg)
+		bot.Send(tgbotapi.NewCallback(query.ID, ""))
+		return
+	case strings.HasPrefix(data, settingsTimezonePrefix):
+		prefs.Timezone = strings.TrimPrefix(data, settingsTimezonePrefix)
+	case data == settingsPrefix+"back":
+		changed = false
+	default:
+		log.Printf("Unknown settings callback: %s", data)
+		bot.Send(tgbotapi.NewCallback(query.ID, "Неизвестная настройка"))
+		return
+	}
+
+	answer := ""
+	if changed {
+		if err := db.SaveUserPreferences(prefs); err != nil {
+			log.Printf("❌ Error saving preferences for user %d: %v", user.ID, err)
+			bot.Send(tgbotapi.NewCallback(query.ID, "Ошибка при сохранении настроек"))
+			return
+		}
+		log.Printf("⚙️ User %d updated settings: %+v", user.ID, prefs)
+		answer = "Сохранено"
+	}
+
+	editMsg := tgbotapi.NewEditMessageTextAndMarkup(query.Message.Chat.ID, query.Message.MessageID,
+		"⚙️ <b>Настройки</b>\n\n"+formatPreferences(prefs), settingsKeyboard(prefs))
+	editMsg.ParseMode = tgbotapi.ModeHTML // Enable HTML formatting
+	bot.Send(editMsg)
+	bot.Send(tgbotapi.NewCallback(query.ID, answer))
+}
+
+// formatPreferences formats the user's preferences for display
+func formatPreferences(prefs *UserPreferences) string {
+	digest := "выключен"
+	if prefs.DigestEnabled {
+		digest = "включён"
+	}
+
+	text := fmt.Sprintf("🌐 Язык: %s\n🕐 Часовой пояс: %s\n📬 Дайджест: %s",
+		languageName(prefs.Language), prefs.Timezone, digest)
+	if len(aiProviderChoices) > 1 {
+		text += "\n🤖 AI: " + providerName(prefs.PreferredProvider)
+	}
+	return text
+}
+
+// providerName returns the display name of a preferred AI provider
+func providerName(name string) string {
+	if name == "" || !isAIProviderChoice(name) {
+		return "по умолчанию"
+	}
+	return name
+}
+
+// nextAIProviderChoice cycles the preferred provider: default, then each configured provider
+func nextAIProviderChoice(current string) string {
+	for i, choice := range aiProviderChoices {
+		if choice == current {
+			if i+1 < len(aiProviderChoices) {
+				return aiProviderChoices[i+1]
+			}
+			return ""
+		}
+	}
+	if len(aiProviderChoices) > 0 {
+		return aiProviderChoices[0]
+	}
+	return ""
+}
+
+// languageName returns the display name of a language code
+func languageName(code string) string {
+	if name, ok := languageNames[code]; ok {
+		return name
+	}
+	return code
+}
+
+// settingsKeyboard builds the /settings buttons for the current preferences
+func settingsKeyboard(prefs *UserPreferences) tgbotapi.InlineKeyboardMarkup {
+	digestButton := "📬 Включить дайджест"
+	if prefs.DigestEnabled {
+		digestButton = "🔕 Выключить дайджест"
+	}
+
+	rows := [][]tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🌐 Язык: "+languageName(prefs.Language), settingsPrefix+"lang"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🕐 Часовой пояс", settingsPrefix+"tz"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(digestButton, settingsPrefix+"digest"),
+		),
+	}
+	// Choosing the provider only makes sense when more than one is configured
+	if len(aiProviderChoices) > 1 {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🤖 AI: "+providerName(prefs.PreferredProvider), settingsPrefix+"provider"),
+		))
+	}
+
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// timezoneKeyboard builds the timezone picker, two timezones per row
+func timezoneKeyboard() tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	var currentRow []tgbotapi.InlineKeyboardButton
+	for _, timezone := range settingsTimezones {
+		currentRow = append(currentRow, tgbotapi.NewInlineKeyboardButtonData(timezone, settingsTimezonePrefix+timezone))
+		if len(currentRow) == 2 {
+			rows = append(rows, currentRow)
+			currentRow = nil
+		}
+	}
+	if len(currentRow) > 0 {
+		rows = append(rows, currentRow)
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("◀️ Назад", settingsPrefix+"back"),
+	))
+
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
@@ -0,0 +1,36 @@
+package internal
+
+import "time"
+
+// Store is the storage used by message handlers. *DB is the production implementation,
+// handlers that take a Store can run against an in-memory implementation without MySQL
+type Store interface {
+	// Users and conversation history
+	GetUserByTgID(tgID int64) (*User, error)
+	GetOrCreateUser(tgID int64, tgName string) (*User, bool, error)
+	SaveMessage(userID int, chatID int64, role, content string) error
+	GetRecentMessages(chatID int64, limit int) ([]*Message, error)
+
+	// Projects
+	GetCurrentProject(userID int, chatID int64) (*Project, error)
+	LoadCurrentProject(userID int, chatID int64) (*Project, bool, error)
+	SetCurrentProject(userID int, chatID int64, projectID int) error
+	CreateProject(creatorUserID int, chatID int64, title, description string) (*Project, error)
+	GetProjectByIDForUser(projectID, userID int) (*Project, error)
+	GetUserProjects(userID int) ([]*Project, error)
+	GetUserProjectsSplit(userID int) (owned []*Project, sharedWith []*Project, err error)
+	UpdateProject(projectID, userID int, title, description string, status ProjectStatus) error
+	DeleteProject(projectID, userID int) error
+
+	// Tasks
+	CreateTask(projectID, userID int, title, description string, priority TaskPriority, deadline *time.Time) (*Task, error)
+	GetTaskByID(taskID, userID int) (*Task, error)
+	GetProjectTasks(projectID, userID int) ([]*Task, error)
+	GetCurrentProjectTasks(userID int, chatID int64) ([]*Task, error)
+	UpdateTask(taskID, userID int, title, description string, status TaskStatus, priority TaskPriority, deadline *time.Time) error
+	UpdateTaskStatus(taskID, userID int, status TaskStatus) error
+	DeleteTask(taskID, userID int) error
+}
+
+// *DB must keep satisfying Store
+var _ Store = (*DB)(nil)
@@ -0,0 +1,261 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeStore is an in-memory Store for one user's projects and tasks. calls counts the calls of
+// each method, failing makes the named methods return errFakeStore
+type fakeStore struct {
+	projects []*Project
+	tasks    []*Task
+	current  map[int64]int // Current project ID by chat
+	stale    bool          // LoadCurrentProject reports the stored project as cleared
+
+	calls   map[string]int
+	failing map[string]bool
+}
+
+var errFakeStore = errors.New("fake store failure")
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{current: make(map[int64]int), calls: make(map[string]int), failing: make(map[string]bool)}
+}
+
+// call counts a call of method and returns errFakeStore if it is set to fail
+func (s *fakeStore) call(method string) error {
+	s.calls[method]++
+	if s.failing[method] {
+		return errFakeStore
+	}
+	return nil
+}
+
+func (s *fakeStore) project(projectID int) *Project {
+	for _, project := range s.projects {
+		if project.ID == projectID {
+			return project
+		}
+	}
+	return nil
+}
+
+func (s *fakeStore) task(taskID int) *Task {
+	for _, task := range s.tasks {
+		if task.ID == taskID {
+			return task
+		}
+	}
+	return nil
+}
+
+func (s *fakeStore) GetUserByTgID(tgID int64) (*User, error) {
+	return &User{ID: 1, TgID: tgID}, s.call("GetUserByTgID")
+}
+
+func (s *fakeStore) GetOrCreateUser(tgID int64, tgName string) (*User, bool, error) {
+	return &User{ID: 1, TgID: tgID, TgName: tgName}, false, s.call("GetOrCreateUser")
+}
+
+func (s *fakeStore) SaveMessage(userID int, chatID int64, role, content string) error {
+	return s.call("SaveMessage")
+}
+
+func (s *fakeStore) GetRecentMessages(chatID int64, limit int) ([]*Message, error) {
+	return nil, s.call("GetRecentMessages")
+}
+
+func (s *fakeStore) GetCurrentProject(userID int, chatID int64) (*Project, error) {
+	if err := s.call("GetCurrentProject"); err != nil {
+		return nil, err
+	}
+	return s.project(s.current[chatID]), nil
+}
+
+func (s *fakeStore) LoadCurrentProject(userID int, chatID int64) (*Project, bool, error) {
+	if err := s.call("LoadCurrentProject"); err != nil {
+		return nil, false, err
+	}
+	if s.stale {
+		delete(s.current, chatID)
+		return nil, true, nil
+	}
+	return s.project(s.current[chatID]), false, nil
+}
+
+func (s *fakeStore) SetCurrentProject(userID int, chatID int64, projectID int) error {
+	if err := s.call("SetCurrentProject"); err != nil {
+		return err
+	}
+	s.current[chatID] = projectID
+	return nil
+}
+
+func (s *fakeStore) CreateProject(creatorUserID int, chatID int64, title, description string) (*Project, error) {
+	if err := s.call("CreateProject"); err != nil {
+		return nil, err
+	}
+	project := &Project{ID: len(s.projects) + 1, Title: title, Description: description, Status: StatusPlanning, UserRole: RoleOwner}
+	s.projects = append(s.projects, project)
+	s.current[chatID] = project.ID
+	return project, nil
+}
+
+func (s *fakeStore) GetProjectByIDForUser(projectID, userID int) (*Project, error) {
+	return s.project(projectID), s.call("GetProjectByIDForUser")
+}
+
+func (s *fakeStore) GetUserProjects(userID int) ([]*Project, error) {
+	if err := s.call("GetUserProjects"); err != nil {
+		return nil, err
+	}
+	return s.projects, nil
+}
+
+func (s *fakeStore) GetUserProjectsSplit(userID int) ([]*Project, []*Project, error) {
+	if err := s.call("GetUserProjectsSplit"); err != nil {
+		return nil, nil, err
+	}
+	owned, sharedWith := splitProjectsByOwnership(s.projects)
+	return owned, sharedWith, nil
+}
+
+func (s *fakeStore) UpdateProject(projectID, userID int, title, description string, status ProjectStatus) error {
+	return s.call("UpdateProject")
+}
+
+func (s *fakeStore) DeleteProject(projectID, userID int) error {
+	return s.call("DeleteProject")
+}
+
+func (s *fakeStore) CreateTask(projectID, userID int, title, description string, priority TaskPriority, deadline *time.Time) (*Task, error) {
+	if err := s.call("CreateTask"); err != nil {
+		return nil, err
+	}
+	task := &Task{ID: len(s.tasks) + 1, ProjectID: projectID, UserID: userID, Title: title, Description: description,
+		Status: TaskTodo, Priority: priority, Deadline: deadline}
+	s.tasks = append(s.tasks, task)
+	return task, nil
+}
+
+func (s *fakeStore) GetTaskByID(taskID, userID int) (*Task, error) {
+	return s.task(taskID), s.call("GetTaskByID")
+}
+
+func (s *fakeStore) projectTasks(projectID int) []*Task {
+	var tasks []*Task
+	for _, task := range s.tasks {
+		if task.ProjectID == projectID {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
+
+func (s *fakeStore) GetProjectTasks(projectID, userID int) ([]*Task, error) {
+	if err := s.call("GetProjectTasks"); err != nil {
+		return nil, err
+	}
+	return s.projectTasks(projectID), nil
+}
+
+func (s *fakeStore) GetCurrentProjectTasks(userID int, chatID int64) ([]*Task, error) {
+	if err := s.call("GetCurrentProjectTasks"); err != nil {
+		return nil, err
+	}
+	projectID, ok := s.current[chatID]
+	if !ok {
+		return nil, ErrNoCurrentProject
+	}
+	return s.projectTasks(projectID), nil
+}
+
+func (s *fakeStore) UpdateTask(taskID, userID int, title, description string, status TaskStatus, priority TaskPriority, deadline *time.Time) error {
+	return s.call("UpdateTask")
+}
+
+func (s *fakeStore) UpdateTaskStatus(taskID, userID int, status TaskStatus) error {
+	return s.call("UpdateTaskStatus")
+}
+
+func (s *fakeStore) DeleteTask(taskID, userID int) error {
+	return s.call("DeleteTask")
+}
+
+var _ Store = (*fakeStore)(nil)
+
+func TestLoadProjectContextQueriesOnce(t *testing.T) {
+	const chatID = 7
+
+	tests := []struct {
+		name             string
+		setup            func(s *fakeStore)
+		wantCurrent      int
+		wantRole         ProjectRole
+		wantCleared      bool
+		wantProjectCalls int
+	}{
+		{
+			name: "current project gives the role",
+			setup: func(s *fakeStore) {
+				s.projects = []*Project{{ID: 1, UserRole: RoleViewer}, {ID: 2, UserRole: RoleOwner}}
+				s.current[chatID] = 1
+			},
+			wantCurrent: 1, wantRole: RoleViewer, wantProjectCalls: 0,
+		},
+		{
+			name: "highest role without a current project",
+			setup: func(s *fakeStore) {
+				s.projects = []*Project{{ID: 1, UserRole: RoleViewer}, {ID: 2, UserRole: RoleAdmin}}
+			},
+			wantRole: RoleAdmin, wantProjectCalls: 1,
+		},
+		{
+			name: "stale current project",
+			setup: func(s *fakeStore) {
+				s.projects = []*Project{{ID: 2, UserRole: RoleMember}}
+				s.current[chatID] = 1
+				s.stale = true
+			},
+			wantRole: RoleMember, wantCleared: true, wantProjectCalls: 1,
+		},
+		{
+			name: "lookup fails",
+			setup: func(s *fakeStore) {
+				s.projects = []*Project{{ID: 1, UserRole: RoleMember}}
+				s.current[chatID] = 1
+				s.failing["LoadCurrentProject"] = true
+			},
+			wantRole: RoleMember, wantProjectCalls: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeStore()
+			tt.setup(store)
+
+			projects, cleared := loadProjectContext(store, 1, chatID)
+
+			currentID := 0
+			if projects.current != nil {
+				currentID = projects.current.ID
+			}
+			if currentID != tt.wantCurrent || projects.role != tt.wantRole || cleared != tt.wantCleared {
+				t.Errorf("loadProjectContext() = project %d, role %q, cleared %v, want %d, %q, %v",
+					currentID, projects.role, cleared, tt.wantCurrent, tt.wantRole, tt.wantCleared)
+			}
+			if got := store.calls["LoadCurrentProject"]; got != 1 {
+				t.Errorf("LoadCurrentProject called %d times, want once", got)
+			}
+			if got := store.calls["GetCurrentProject"]; got != 0 {
+				t.Errorf("GetCurrentProject called %d times, want the loaded project reused", got)
+			}
+			if got := store.calls["GetUserProjects"]; got != tt.wantProjectCalls {
+				t.Errorf("GetUserProjects called %d times, want %d", got, tt.wantProjectCalls)
+			}
+		})
+	}
+}
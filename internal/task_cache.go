@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"sync"
+	"time"
+)
+
+// projectTasksCacheEntry holds the tasks of one project in one order and when they were loaded
+type projectTasksCacheEntry struct {
+	tasks    []*Task
+	loadedAt time.Time
+}
+
+// projectTasksCache keeps GetProjectTasksOrdered results per project and order. The AI often
+// lists tasks, acts on one and lists again, every task change in a project drops its entries
+var projectTasksCache = struct {
+	sync.Mutex
+	ttl     time.Duration
+	entries map[int]map[TaskOrder]projectTasksCacheEntry
+}{entries: make(map[int]map[TaskOrder]projectTasksCacheEntry)}
+
+// SetProjectTasksCacheTTL enables caching of project task lists for ttl, a non-positive ttl disables it
+func SetProjectTasksCacheTTL(ttl time.Duration) {
+	projectTasksCache.Lock()
+	defer projectTasksCache.Unlock()
+
+	if ttl < 0 {
+		ttl = 0
+	}
+	projectTasksCache.ttl = ttl
+	projectTasksCache.entries = make(map[int]map[TaskOrder]projectTasksCacheEntry)
+}
+
+// InvalidateProjectTasks drops the cached task lists of a project
+func InvalidateProjectTasks(projectID int) {
+	projectTasksCache.Lock()
+	defer projectTasksCache.Unlock()
+	delete(projectTasksCache.entries, projectID)
+}
+
+// getCachedProjectTasks returns a copy of the cached tasks of a project if they are still fresh
+func getCachedProjectTasks(projectID int, order TaskOrder) ([]*Task, bool) {
+	projectTasksCache.Lock()
+	defer projectTasksCache.Unlock()
+
+	if projectTasksCache.ttl <= 0 {
+		return nil, false
+	}
+	entry, ok := projectTasksCache.entries[projectID][order]
+	if !ok {
+		return nil, false
+	}
+	if time.Since(entry.loadedAt) > projectTasksCache.ttl {
+		delete(projectTasksCache.entries[projectID], order)
+		return nil, false
+	}
+
+	return copyTasks(entry.tasks), true
+}
+
+// cacheProjectTasks stores a copy of the tasks of a project
+func cacheProjectTasks(projectID int, order TaskOrder, tasks []*Task) {
+	projectTasksCache.Lock()
+	defer projectTasksCache.Unlock()
+
+	if projectTasksCache.ttl <= 0 {
+		return
+	}
+	if projectTasksCache.entries[projectID] == nil {
+		projectTasksCache.entries[projectID] = make(map[TaskOrder]projectTasksCacheEntry)
+	}
+	projectTasksCache.entries[projectID][order] = projectTasksCacheEntry{
+		tasks:    copyTasks(tasks),
+		loadedAt: time.Now(),
+	}
+}
+
+// copyTasks copies tasks so callers can't modify cached values
+func copyTasks(tasks []*Task) []*Task {
+	if tasks == nil {
+		return nil
+	}
+
+	copied := make([]*Task, len(tasks))
+	for i, task := range tasks {
+		taskCopy := *task
+		copied[i] = &taskCopy
+	}
+	return copied
+}
@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// StatusChange is an entry of a task's status history
+type StatusChange struct {
+	UserID    int        `json:"user_id"`
+	From      TaskStatus `json:"from"`
+	To        TaskStatus `json:"to"`
+	ChangedAt time.Time  `json:"changed_at"`
+}
+
+// insertStatusChange records a status change of a task, inside the transaction that changes
+// the status so the history can't diverge from the task
+func insertStatusChange(exec execer, taskID, userID int, from, to TaskStatus) error {
+	_, err := exec.Exec(
+		"INSERT INTO task_status_history (task_id, user_id, from_status, to_status) VALUES (?, ?, ?, ?)",
+		taskID, userID, from, to,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record status change: %v", err)
+	}
+	return nil
+}
+
+// GetTaskStatusHistory returns the status changes of a task in the order they happened.
+// The user must be a member of the task's project
+func (db *DB) GetTaskStatusHistory(taskID, userID int) ([]StatusChange, error) {
+	task, err := db.GetTaskByID(taskID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get task: %v", err)
+	}
+	if task == nil {
+		return nil, fmt.Errorf("task not found or no access")
+	}
+
+	query := `
+		SELECT user_id, from_status, to_status, changed_at
+		FROM task_status_history
+		WHERE task_id = ?
+		ORDER BY changed_at ASC, id ASC
+	`
+
+	rows, err := db.Query(query, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get status history: %v", err)
+	}
+	defer rows.Close()
+
+	history := []StatusChange{}
+	for rows.Next() {
+		var change StatusChange
+		if err := rows.Scan(&change.UserID, &change.From, &change.To, &change.ChangedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan status change: %v", err)
+		}
+		history = append(history, change)
+	}
+
+	return history, nil
+}
+
+// CycleMetrics are delivery metrics of a project's completed tasks. Cycle time is from the
+// first switch to in_progress to the last switch to done, lead time from creation to completion
+type CycleMetrics struct {
+	CycleTimeTasks int     `json:"cycle_time_tasks"` // Done tasks with both transitions in the history
+	AvgCycleHours  float64 `json:"avg_cycle_hours"`
+	LeadTimeTasks  int     `json:"lead_time_tasks"` // Done tasks with a completion time
+	AvgLeadHours   float64 `json:"avg_lead_hours"`
+}
+
+// GetProjectCycleTimes computes cycle and lead time averages over the project's done tasks.
+// Tasks without the needed transitions are skipped, averages are 0 when no task qualifies
+func (db *DB) GetProjectCycleTimes(projectID, userID int) (*CycleMetrics, error) {
+	if _, err := db.GetUserRoleInProject(projectID, userID); err != nil {
+		if err == ErrNotProjectMember {
+			return nil, ErrProjectAccessDenied
+		}
+		return nil, fmt.Errorf("failed to check project access: %v", err)
+	}
+
+	metrics := &CycleMetrics{}
+	var avgSeconds sql.NullFloat64
+
+	leadQuery := `
+		SELECT COUNT(*), AVG(TIMESTAMPDIFF(SECOND, created_at, completed_at))
+		FROM tasks
+		WHERE project_id = ? AND status = 'done' AND completed_at IS NOT NULL
+	`
+	if err := db.QueryRow(leadQuery, projectID).Scan(&metrics.LeadTimeTasks, &avgSeconds); err != nil {
+		return nil, fmt.Errorf("failed to compute lead time: %v", err)
+	}
+	metrics.AvgLeadHours = avgSeconds.Float64 / 3600
+
+	cycleQuery := `
+		SELECT COUNT(*), AVG(TIMESTAMPDIFF(SECOND, started_at, finished_at))
+		FROM (
+			SELECT MIN(CASE WHEN h.to_status = 'in_progress' THEN h.changed_at END) AS started_at,
+			       MAX(CASE WHEN h.to_status = 'done' THEN h.changed_at END) AS finished_at
+			FROM task_status_history h
+			JOIN tasks t ON h.task_id = t.id
+			WHERE t.project_id = ? AND t.status = 'done'
+			GROUP BY h.task_id
+		) transitions
+		WHERE started_at IS NOT NULL AND finished_at IS NOT NULL AND started_at < finished_at
+	`
+	if err := db.QueryRow(cycleQuery, projectID).Scan(&metrics.CycleTimeTasks, &avgSeconds); err != nil {
+		return nil, fmt.Errorf("failed to compute cycle time: %v", err)
+	}
+	metrics.AvgCycleHours = avgSeconds.Float64 / 3600
+
+	return metrics, nil
+}
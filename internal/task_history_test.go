@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestGetProjectCycleTimes(t *testing.T) {
+	db := openTestDB(t)
+	owner := createTestUser(t, db, "owner")
+	stranger := createTestUser(t, db, "stranger")
+
+	project, err := db.CreateProject(owner.ID, 0, "Метрики", "")
+	if err != nil {
+		t.Fatalf("CreateProject() error = %v", err)
+	}
+
+	created := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	hours := func(n int) time.Time { return created.Add(time.Duration(n) * time.Hour) }
+
+	// transition is a status change n hours after the task was created
+	type transition struct {
+		from, to TaskStatus
+		at       int
+	}
+	tasks := []struct {
+		title       string
+		status      TaskStatus
+		transitions []transition
+	}{
+		// Cycle 2h, lead 3h
+		{"Быстрая", TaskDone, []transition{{TaskTodo, TaskInProgress, 1}, {TaskInProgress, TaskDone, 3}}},
+		// Cycle from the first start to the last finish: 6h, lead 8h
+		{"Переоткрытая", TaskDone, []transition{{TaskTodo, TaskInProgress, 2}, {TaskInProgress, TaskDone, 4},
+			{TaskDone, TaskInProgress, 5}, {TaskInProgress, TaskDone, 8}}},
+		// Never in progress: lead 5h only
+		{"Сразу готова", TaskDone, []transition{{TaskTodo, TaskDone, 5}}},
+		// Not done: skipped
+		{"В работе", TaskInProgress, []transition{{TaskTodo, TaskInProgress, 1}}},
+	}
+
+	for _, tt := range tasks {
+		task, err := db.CreateTask(project.ID, owner.ID, tt.title, "", PriorityMedium, nil)
+		if err != nil {
+			t.Fatalf("CreateTask() error = %v", err)
+		}
+		var completedAt *time.Time
+		if tt.status == TaskDone {
+			last := hours(tt.transitions[len(tt.transitions)-1].at)
+			completedAt = &last
+		}
+		if _, err := db.Exec("UPDATE tasks SET status = ?, created_at = ?, completed_at = ? WHERE id = ?",
+			tt.status, created, completedAt, task.ID); err != nil {
+			t.Fatalf("failed to set up task %q: %v", tt.title, err)
+		}
+		if _, err := db.Exec("DELETE FROM task_status_history WHERE task_id = ?", task.ID); err != nil {
+			t.Fatalf("failed to clear history of %q: %v", tt.title, err)
+		}
+		for _, change := range tt.transitions {
+			if _, err := db.Exec(
+				"INSERT INTO task_status_history (task_id, user_id, from_status, to_status, changed_at) VALUES (?, ?, ?, ?, ?)",
+				task.ID, owner.ID, change.from, change.to, hours(change.at),
+			); err != nil {
+				t.Fatalf("failed to insert history of %q: %v", tt.title, err)
+			}
+		}
+	}
+
+	metrics, err := db.GetProjectCycleTimes(project.ID, owner.ID)
+	if err != nil {
+		t.Fatalf("GetProjectCycleTimes() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"cycle time tasks", float64(metrics.CycleTimeTasks), 2},
+		{"average cycle hours", metrics.AvgCycleHours, 4},
+		{"lead time tasks", float64(metrics.LeadTimeTasks), 3},
+		{"average lead hours", metrics.AvgLeadHours, 16.0 / 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if math.Abs(tt.got-tt.want) > 0.01 {
+				t.Errorf("%s = %.2f, want %.2f", tt.name, tt.got, tt.want)
+			}
+		})
+	}
+
+	if _, err := db.GetProjectCycleTimes(project.ID, stranger.ID); !errors.Is(err, ErrProjectAccessDenied) {
+		t.Errorf("GetProjectCycleTimes() by a non-member error = %v, want ErrProjectAccessDenied", err)
+	}
+}
+
+func TestGetProjectCycleTimesEmpty(t *testing.T) {
+	db := openTestDB(t)
+	owner := createTestUser(t, db, "owner")
+
+	project, err := db.CreateProject(owner.ID, 0, "Без выполненных задач", "")
+	if err != nil {
+		t.Fatalf("CreateProject() error = %v", err)
+	}
+	if _, err := db.CreateTask(project.ID, owner.ID, "Открытая", "", PriorityMedium, nil); err != nil {
+		t.Fatalf("CreateTask() error = %v", err)
+	}
+
+	metrics, err := db.GetProjectCycleTimes(project.ID, owner.ID)
+	if err != nil {
+		t.Fatalf("GetProjectCycleTimes() error = %v", err)
+	}
+	if *metrics != (CycleMetrics{}) {
+		t.Errorf("GetProjectCycleTimes() = %+v, want zero metrics", *metrics)
+	}
+}
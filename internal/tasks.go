@@ -2,7 +2,10 @@ package internal
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -27,31 +30,114 @@ const (
 	PriorityUrgent TaskPriority = "urgent"
 )
 
+// prioritySynonyms maps free-text priority words (Russian and English) to priorities.
+// Negations go first so "неважно" is not matched as "важно" and "not urgent" as "urgent"
+var prioritySynonyms = []struct {
+	word     string
+	priority TaskPriority
+}{
+	{"не срочно", PriorityLow},
+	{"несрочно", PriorityLow},
+	{"неважно", PriorityLow},
+	{"не важно", PriorityLow},
+	{"not urgent", PriorityLow},
+	{"non-urgent", PriorityLow},
+	{"not important", PriorityLow},
+	{"unimportant", PriorityLow},
+	{"not critical", PriorityLow},
+	{"no rush", PriorityLow},
+	{"низк", PriorityLow},
+	{"low", PriorityLow},
+	{"minor", PriorityLow},
+	{"срочн", PriorityUrgent},
+	{"критич", PriorityUrgent},
+	{"горит", PriorityUrgent},
+	{"asap", PriorityUrgent},
+	{"urgent", PriorityUrgent},
+	{"critical", PriorityUrgent},
+	{"высок", PriorityHigh},
+	{"важн", PriorityHigh},
+	{"high", PriorityHigh},
+	{"important", PriorityHigh},
+	{"средн", PriorityMedium},
+	{"обычн", PriorityMedium},
+	{"medium", PriorityMedium},
+	{"normal", PriorityMedium},
+}
+
+// ParseTaskPriority converts free text like "это срочно" or "low priority" into a TaskPriority.
+// Returns PriorityMedium and false when the text is not recognized
+func ParseTaskPriority(s string) (TaskPriority, bool) {
+	text := strings.ToLower(strings.TrimSpace(s))
+
+	switch TaskPriority(text) {
+	case PriorityLow, PriorityMedium, PriorityHigh, PriorityUrgent:
+		return TaskPriority(text), true
+	}
+
+	for _, synonym := range prioritySynonyms {
+		if strings.Contains(text, synonym.word) {
+			return synonym.priority, true
+		}
+	}
+
+	return PriorityMedium, false
+}
+
 // Task represents a task in the database
 type Task struct {
-	ID           int          `json:"id"`
-	ProjectID    int          `json:"project_id"`
-	UserID       int          `json:"user_id"`
-	Title        string       `json:"title"`
-	Description  string       `json:"description"`
-	Status       TaskStatus   `json:"status"`
-	Priority     TaskPriority `json:"priority"`
-	Deadline     *time.Time   `json:"deadline,omitempty"`
-	CreatedAt    time.Time    `json:"created_at"`
-	UpdatedAt    time.Time    `json:"updated_at"`
-	CompletedAt  *time.Time   `json:"completed_at,omitempty"`
-	ProjectTitle string       `json:"project_title,omitempty"` // For display purposes
+	ID            int           `json:"id"`
+	ProjectID     int           `json:"project_id"`
+	UserID        int           `json:"user_id"`
+	Title         string        `json:"title"`
+	Description   string        `json:"description"`
+	Status        TaskStatus    `json:"status"`
+	Priority      TaskPriority  `json:"priority"`
+	Deadline      *time.Time    `json:"deadline,omitempty"`
+	CreatedAt     time.Time     `json:"created_at"`
+	UpdatedAt     time.Time     `json:"updated_at"`
+	CompletedAt   *time.Time    `json:"completed_at,omitempty"`
+	ProjectTitle  string        `json:"project_title,omitempty"`  // For display purposes
+	ProjectStatus ProjectStatus `json:"project_status,omitempty"` // Filled by GetUserTasks for filtering by project status and by AttachProjects
+	BlockedBy     []*TaskRef    `json:"blocked_by,omitempty"`     // Incomplete dependencies, filled by GetBlockedTasks
+	Blocked       bool          `json:"blocked,omitempty"`        // Open task waiting for an incomplete dependency, filled by task lists
+	Overdue       bool          `json:"overdue,omitempty"`        // Deadline before today, filled by list_upcoming_tasks
+}
+
+// TaskRef is a short reference to a task
+type TaskRef struct {
+	ID     int        `json:"id"`
+	Title  string     `json:"title"`
+	Status TaskStatus `json:"status"`
 }
 
 // CreateTask creates a new task in a project
 func (db *DB) CreateTask(projectID, userID int, title, description string, priority TaskPriority, deadline *time.Time) (*Task, error) {
-	// First check if user has access to this project
+	title, err := sanitizeTitle(title, maxTaskTitleLength)
+	if err != nil {
+		return nil, err
+	}
+	description = sanitizeDescription(description)
+
+	// Tell a nonexistent project apart from one the user can't see, the AI picks a valid project either way
+	exists, err := db.ProjectExists(projectID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrProjectNotFound
+	}
+
+	// Check if user has access to this project
 	userRole, err := db.GetUserRoleInProject(projectID, userID)
+	if err == ErrNotProjectMember || (err == nil && userRole == "") {
+		return nil, ErrProjectAccessDenied
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to check project access: %v", err)
 	}
-	if userRole == "" {
-		return nil, fmt.Errorf("user does not have access to this project")
+	if !CapabilitiesForRole(userRole).CanCreateTasks {
+		return nil, fmt.Errorf("insufficient permissions: %s cannot create tasks", userRole)
 	}
 
 	query := `
@@ -69,7 +155,11 @@ func (db *DB) CreateTask(projectID, userID int, title, description string, prior
 		return nil, fmt.Errorf("failed to get task ID: %v", err)
 	}
 
-	return db.GetTaskByID(int(taskID), userID)
+	createdID := int(taskID)
+	InvalidateProjectTasks(projectID)
+	db.logActivity(userID, projectID, &createdID, ActivityTaskCreated, ActivityDetails{})
+
+	return db.GetTaskByID(createdID, userID)
 }
 
 // GetTaskByID retrieves a task by its ID (with project access check)
@@ -77,11 +167,11 @@ func (db *DB) GetTaskByID(taskID, userID int) (*Task, error) {
 	query := `
 		SELECT t.id, t.project_id, t.user_id, t.title, t.description, 
 		       t.status, t.priority, t.deadline, t.created_at, t.updated_at, 
-		       t.completed_at, p.title
+		       t.completed_at, p.title, ` + taskBlockedColumn + `
 		FROM tasks t
 		JOIN projects p ON t.project_id = p.id
 		JOIN project_users pu ON p.id = pu.project_id
-		WHERE t.id = ? AND pu.user_id = ?
+		WHERE t.id = ? AND pu.user_id = ? AND p.deleted_at IS NULL
 	`
 
 	task := &Task{}
@@ -90,7 +180,7 @@ func (db *DB) GetTaskByID(taskID, userID int) (*Task, error) {
 	err := db.QueryRow(query, taskID, userID).Scan(
 		&task.ID, &task.ProjectID, &task.UserID, &task.Title, &task.Description,
 		&task.Status, &task.Priority, &deadline, &task.CreatedAt, &task.UpdatedAt,
-		&completedAt, &task.ProjectTitle,
+		&completedAt, &task.ProjectTitle, &task.Blocked,
 	)
 
 	if err == sql.ErrNoRows {
@@ -110,18 +200,34 @@ func (db *DB) GetTaskByID(taskID, userID int) (*Task, error) {
 	return task, nil
 }
 
+// taskBlockedColumn selects whether an open task has an incomplete dependency, so task lists
+// can show blocked tasks without a query per task. Queries must alias tasks as t
+const taskBlockedColumn = `t.status NOT IN ('done', 'cancelled') AND EXISTS(
+		           SELECT 1 FROM task_dependencies td
+		           JOIN tasks b ON td.depends_on_task_id = b.id
+		           WHERE td.task_id = t.id AND b.status NOT IN ('done', 'cancelled')
+		       )`
+
 // GetUserTasks retrieves all tasks for a user across all their projects
 func (db *DB) GetUserTasks(userID int) ([]*Task, error) {
+	return db.GetUserTasksFiltered(userID, false)
+}
+
+// GetUserTasksFiltered retrieves tasks for a user across their projects. With activeProjectsOnly
+// tasks of completed and cancelled projects are left out
+func (db *DB) GetUserTasksFiltered(userID int, activeProjectsOnly bool) ([]*Task, error) {
 	query := `
 		SELECT t.id, t.project_id, t.user_id, t.title, t.description, 
 		       t.status, t.priority, t.deadline, t.created_at, t.updated_at, 
-		       t.completed_at, p.title
+		       t.completed_at, p.title, p.status, ` + taskBlockedColumn + `
 		FROM tasks t
 		JOIN projects p ON t.project_id = p.id
 		JOIN project_users pu ON p.id = pu.project_id
-		WHERE pu.user_id = ?
-		ORDER BY t.created_at DESC
-	`
+		WHERE pu.user_id = ? AND p.deleted_at IS NULL`
+	if activeProjectsOnly {
+		query += " AND p.status NOT IN ('completed', 'cancelled')"
+	}
+	query += " ORDER BY t.created_at DESC"
 
 	rows, err := db.Query(query, userID)
 	if err != nil {
@@ -137,7 +243,7 @@ func (db *DB) GetUserTasks(userID int) ([]*Task, error) {
 		err := rows.Scan(
 			&task.ID, &task.ProjectID, &task.UserID, &task.Title, &task.Description,
 			&task.Status, &task.Priority, &deadline, &task.CreatedAt, &task.UpdatedAt,
-			&completedAt, &task.ProjectTitle,
+			&completedAt, &task.ProjectTitle, &task.ProjectStatus, &task.Blocked,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan task: %v", err)
@@ -156,26 +262,78 @@ func (db *DB) GetUserTasks(userID int) ([]*Task, error) {
 	return tasks, nil
 }
 
+// AttachProjects fills ProjectTitle and ProjectStatus of tasks from different projects with one
+// query for all their projects, for lists whose queries don't select them
+func (db *DB) AttachProjects(tasks []*Task) error {
+	ids := make([]int, len(tasks))
+	for i, task := range tasks {
+		ids[i] = task.ProjectID
+	}
+
+	projects, err := db.GetProjectsByIDs(ids)
+	if err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		if project, ok := projects[task.ProjectID]; ok {
+			task.ProjectTitle = project.Title
+			task.ProjectStatus = project.Status
+		}
+	}
+	return nil
+}
+
+// TaskOrder selects how task lists are ordered
+type TaskOrder string
+
+const (
+	TaskOrderCreated  TaskOrder = "created"  // newest first
+	TaskOrderBoard    TaskOrder = "board"    // kanban: by status, then priority and deadline
+	TaskOrderDeadline TaskOrder = "deadline" // earliest deadline first, tasks without deadline last
+)
+
+// taskOrderClauses maps task orders to ORDER BY clauses
+var taskOrderClauses = map[TaskOrder]string{
+	TaskOrderCreated: "t.created_at DESC",
+	TaskOrderBoard: `FIELD(t.status, 'todo', 'in_progress', 'review', 'done', 'cancelled'),
+		         FIELD(t.priority, 'urgent', 'high', 'medium', 'low'),
+		         t.deadline IS NULL, t.deadline ASC, t.created_at DESC`,
+	TaskOrderDeadline: "t.deadline IS NULL, t.deadline ASC, t.created_at DESC",
+}
+
 // GetProjectTasks retrieves all tasks for a specific project
 func (db *DB) GetProjectTasks(projectID, userID int) ([]*Task, error) {
-	// Check if user has access to this project
+	return db.GetProjectTasksOrdered(projectID, userID, TaskOrderCreated)
+}
+
+// GetProjectTasksOrdered retrieves all tasks for a specific project in the given order
+func (db *DB) GetProjectTasksOrdered(projectID, userID int, order TaskOrder) ([]*Task, error) {
+	// Check if user has access to this project, an empty result then always means the project has no tasks
 	userRole, err := db.GetUserRoleInProject(projectID, userID)
+	if err == ErrNotProjectMember || (err == nil && userRole == "") {
+		return nil, ErrProjectAccessDenied
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to check project access: %v", err)
 	}
-	if userRole == "" {
-		return nil, fmt.Errorf("user does not have access to this project")
+
+	if tasks, ok := getCachedProjectTasks(projectID, order); ok {
+		return tasks, nil
+	}
+
+	orderBy, ok := taskOrderClauses[order]
+	if !ok {
+		orderBy = taskOrderClauses[TaskOrderCreated]
 	}
 
 	query := `
 		SELECT t.id, t.project_id, t.user_id, t.title, t.description, 
 		       t.status, t.priority, t.deadline, t.created_at, t.updated_at, 
-		       t.completed_at, p.title
+		       t.completed_at, p.title, ` + taskBlockedColumn + `
 		FROM tasks t
 		JOIN projects p ON t.project_id = p.id
-		WHERE t.project_id = ?
-		ORDER BY t.created_at DESC
-	`
+		WHERE t.project_id = ? AND p.deleted_at IS NULL
+		ORDER BY ` + orderBy
 
 	rows, err := db.Query(query, projectID)
 	if err != nil {
@@ -191,7 +349,7 @@ func (db *DB) GetProjectTasks(projectID, userID int) ([]*Task, error) {
 		err := rows.Scan(
 			&task.ID, &task.ProjectID, &task.UserID, &task.Title, &task.Description,
 			&task.Status, &task.Priority, &deadline, &task.CreatedAt, &task.UpdatedAt,
-			&completedAt, &task.ProjectTitle,
+			&completedAt, &task.ProjectTitle, &task.Blocked,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan task: %v", err)
@@ -207,20 +365,36 @@ func (db *DB) GetProjectTasks(projectID, userID int) ([]*Task, error) {
 		tasks = append(tasks, task)
 	}
 
+	cacheProjectTasks(projectID, order, tasks)
 	return tasks, nil
 }
 
-// GetTasksByStatus retrieves tasks by status for a user
+// GetTasksByStatus retrieves tasks by status for a user. Open tasks come by deadline, what to do
+// next first, done and cancelled tasks newest first
 func (db *DB) GetTasksByStatus(userID int, status TaskStatus) ([]*Task, error) {
+	order := TaskOrderDeadline
+	if status == TaskDone || status == TaskCancelled {
+		order = TaskOrderCreated
+	}
+	return db.GetTasksByStatusOrdered(userID, status, order)
+}
+
+// GetTasksByStatusOrdered retrieves tasks by status for a user in the given order
+func (db *DB) GetTasksByStatusOrdered(userID int, status TaskStatus, order TaskOrder) ([]*Task, error) {
+	orderBy, ok := taskOrderClauses[order]
+	if !ok {
+		orderBy = taskOrderClauses[TaskOrderCreated]
+	}
+
 	query := `
 		SELECT t.id, t.project_id, t.user_id, t.title, t.description, 
 		       t.status, t.priority, t.deadline, t.created_at, t.updated_at, 
-		       t.completed_at, p.title
+		       t.completed_at, p.title, ` + taskBlockedColumn + `
 		FROM tasks t
 		JOIN projects p ON t.project_id = p.id
 		JOIN project_users pu ON p.id = pu.project_id
-		WHERE pu.user_id = ? AND t.status = ?
-		ORDER BY t.created_at DESC
+		WHERE pu.user_id = ? AND t.status = ? AND p.deleted_at IS NULL
+		ORDER BY ` + orderBy + `
 	`
 
 	rows, err := db.Query(query, userID, status)
@@ -234,6 +408,57 @@ func (db *DB) GetTasksByStatus(userID int, status TaskStatus) ([]*Task, error) {
 		task := &Task{}
 		var deadline, completedAt sql.NullTime
 
+		err := rows.Scan(
+			&task.ID, &task.ProjectID, &task.UserID, &task.Title, &task.Description,
+			&task.Status, &task.Priority, &deadline, &task.CreatedAt, &task.UpdatedAt,
+			&completedAt, &task.ProjectTitle, &task.Blocked,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan task: %v", err)
+		}
+
+		if deadline.Valid {
+			task.Deadline = &deadline.Time
+		}
+		if completedAt.Valid {
+			task.CompletedAt = &completedAt.Time
+		}
+
+		tasks = append(tasks, task)
+	}
+
+	return tasks, nil
+}
+
+// GetRecentlyCompletedTasks returns the done tasks of the user's projects completed in the last
+// days days by the DB clock, most recently completed first. Tasks marked done before completion
+// times were recorded have no completed_at and are left out, their completion date is unknown
+func (db *DB) GetRecentlyCompletedTasks(userID int, days int) ([]*Task, error) {
+	query := `
+		SELECT t.id, t.project_id, t.user_id, t.title, t.description,
+		       t.status, t.priority, t.deadline, t.created_at, t.updated_at,
+		       t.completed_at, p.title
+		FROM tasks t
+		JOIN projects p ON t.project_id = p.id
+		JOIN project_users pu ON p.id = pu.project_id
+		WHERE pu.user_id = ? AND t.status = ? AND p.deleted_at IS NULL
+		      AND t.completed_at IS NOT NULL
+		      AND t.completed_at >= NOW() - INTERVAL ? DAY
+		ORDER BY t.completed_at DESC, t.id DESC
+	`
+
+	rows, err := db.Query(query, userID, TaskDone, days)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recently completed tasks: %v", err)
+	}
+	defer rows.Close()
+
+	tasks := []*Task{}
+	for rows.Next() {
+		task := &Task{}
+		var deadline sql.NullTime
+		var completedAt time.Time
+
 		err := rows.Scan(
 			&task.ID, &task.ProjectID, &task.UserID, &task.Title, &task.Description,
 			&task.Status, &task.Priority, &deadline, &task.CreatedAt, &task.UpdatedAt,
@@ -243,6 +468,155 @@ func (db *DB) GetTasksByStatus(userID int, status TaskStatus) ([]*Task, error) {
 			return nil, fmt.Errorf("failed to scan task: %v", err)
 		}
 
+		if deadline.Valid {
+			task.Deadline = &deadline.Time
+		}
+		task.CompletedAt = &completedAt
+
+		tasks = append(tasks, task)
+	}
+
+	return tasks, rows.Err()
+}
+
+// GetUserTaskCountsByStatus counts the user's tasks per status across all their projects.
+// Every status is present in the result, missing ones have zero count
+func (db *DB) GetUserTaskCountsByStatus(userID int) (map[TaskStatus]int, error) {
+	query := `
+		SELECT t.status, COUNT(*)
+		FROM tasks t
+		JOIN project_users pu ON t.project_id = pu.project_id
+		JOIN projects p ON t.project_id = p.id
+		WHERE pu.user_id = ? AND p.deleted_at IS NULL
+		GROUP BY t.status
+	`
+
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get task counts: %v", err)
+	}
+	defer rows.Close()
+
+	counts := map[TaskStatus]int{
+		TaskTodo:       0,
+		TaskInProgress: 0,
+		TaskReview:     0,
+		TaskDone:       0,
+		TaskCancelled:  0,
+	}
+	for rows.Next() {
+		var status TaskStatus
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan task count: %v", err)
+		}
+		counts[status] = count
+	}
+
+	return counts, nil
+}
+
+// GetProjectTaskCount returns the number of tasks in a project in any status
+func (db *DB) GetProjectTaskCount(projectID int) (int, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM tasks WHERE project_id = ?", projectID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get project task count: %v", err)
+	}
+	return count, nil
+}
+
+// ProjectTaskStats are the task counts of a project shown to the AI
+type ProjectTaskStats struct {
+	Open    int `json:"open"`    // Not done or cancelled
+	Overdue int `json:"overdue"` // Open with a deadline before today
+}
+
+// GetProjectTaskStats counts the open and overdue tasks of a project in one query,
+// today is taken in loc like the deadlines
+func (db *DB) GetProjectTaskStats(projectID int, loc *time.Location) (*ProjectTaskStats, error) {
+	endOfToday := deadlineCutoff(time.Now(), 0, loc)
+	startOfToday := time.Date(endOfToday.Year(), endOfToday.Month(), endOfToday.Day(), 0, 0, 0, 0, time.UTC)
+
+	query := `
+		SELECT COALESCE(SUM(status NOT IN ('done', 'cancelled')), 0),
+		       COALESCE(SUM(status NOT IN ('done', 'cancelled') AND deadline < ?), 0)
+		FROM tasks
+		WHERE project_id = ?
+	`
+
+	stats := &ProjectTaskStats{}
+	if err := db.QueryRow(query, startOfToday, projectID).Scan(&stats.Open, &stats.Overdue); err != nil {
+		return nil, fmt.Errorf("failed to get project task stats: %v", err)
+	}
+	return stats, nil
+}
+
+// ErrProjectNotFound is returned when a task is created in a project that doesn't exist
+var ErrProjectNotFound = errors.New("project not found, choose one of the user's projects")
+
+// ErrProjectAccessDenied is returned when a task is created or listed in a project the user is not a member of
+var ErrProjectAccessDenied = errors.New("user does not have access to this project, choose one of the user's projects")
+
+// NoTasksHint is the suggested next action shown wherever a project has no tasks
+const NoTasksHint = "💡 Напишите: добавь задачу [название]"
+
+// ErrNoCurrentProject is returned when an operation needs the user's current project but none is set
+var ErrNoCurrentProject = errors.New("no current project selected, ask the user to choose a project")
+
+// GetCurrentProjectTasks retrieves all tasks of the user's current project in the chat
+func (db *DB) GetCurrentProjectTasks(userID int, chatID int64) ([]*Task, error) {
+	project, err := db.GetCurrentProject(userID, chatID)
+	if err != nil {
+		return nil, err
+	}
+	if project == nil {
+		return nil, ErrNoCurrentProject
+	}
+
+	return db.GetProjectTasks(project.ID, userID)
+}
+
+// GetProjectTasksByStatus retrieves tasks with a given status in a specific project
+func (db *DB) GetProjectTasksByStatus(projectID, userID int, status TaskStatus) ([]*Task, error) {
+	// Check if user has access to this project
+	if _, err := db.GetUserRoleInProject(projectID, userID); err != nil {
+		if errors.Is(err, ErrNotProjectMember) {
+			return nil, ErrProjectAccessDenied
+		}
+		return nil, fmt.Errorf("failed to check project access: %v", err)
+	}
+
+	query := `
+		SELECT t.id, t.project_id, t.user_id, t.title, t.description, 
+		       t.status, t.priority, t.deadline, t.created_at, t.updated_at, 
+		       t.completed_at, p.title, ` + taskBlockedColumn + `
+		FROM tasks t
+		JOIN projects p ON t.project_id = p.id
+		WHERE t.project_id = ? AND t.status = ? AND p.deleted_at IS NULL
+		ORDER BY t.created_at DESC
+	`
+
+	rows, err := db.Query(query, projectID, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project tasks by status: %v", err)
+	}
+	defer rows.Close()
+
+	var tasks []*Task
+	for rows.Next() {
+		task := &Task{}
+		var deadline, completedAt sql.NullTime
+
+		err := rows.Scan(
+			&task.ID, &task.ProjectID, &task.UserID, &task.Title, &task.Description,
+			&task.Status, &task.Priority, &deadline, &task.CreatedAt, &task.UpdatedAt,
+			&completedAt, &task.ProjectTitle, &task.Blocked,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan task: %v", err)
+		}
+
 		if deadline.Valid {
 			task.Deadline = &deadline.Time
 		}
@@ -268,13 +642,15 @@ func (db *DB) UpdateTask(taskID, userID int, title, description string, status T
 	}
 
 	// Check if user has permission to update tasks in this project
-	userRole, err := db.GetUserRoleInProject(task.ProjectID, userID)
-	if err != nil {
-		return fmt.Errorf("failed to check permissions: %v", err)
+	if err := db.requireCapability(task.ProjectID, userID, func(c *Capabilities) bool { return c.CanEditTasks }, "edit tasks"); err != nil {
+		return err
 	}
-	if userRole == "" {
-		return fmt.Errorf("no access to project")
+
+	title, err = sanitizeTitle(title, maxTaskTitleLength)
+	if err != nil {
+		return err
 	}
+	description = sanitizeDescription(description)
 
 	// Set completed_at if status is changing to done
 	var completedAt *time.Time
@@ -293,9 +669,24 @@ func (db *DB) UpdateTask(taskID, userID int, title, description string, status T
 		WHERE id = ?
 	`
 
-	_, err = db.Exec(query, title, description, status, priority, deadline, completedAt, taskID)
+	err = db.WithTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(query, title, description, status, priority, deadline, completedAt, taskID)
+		if err != nil {
+			return fmt.Errorf("failed to update task: %v", err)
+		}
+		if status != task.Status {
+			return insertStatusChange(tx, taskID, userID, task.Status, status)
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to update task: %v", err)
+		return err
+	}
+	InvalidateProjectTasks(task.ProjectID)
+
+	if status != task.Status {
+		db.logActivity(userID, task.ProjectID, &taskID, ActivityTaskStatusChanged,
+			ActivityDetails{From: string(task.Status), To: string(status)})
 	}
 
 	return nil
@@ -311,7 +702,70 @@ func (db *DB) UpdateTaskStatus(taskID, userID int, status TaskStatus) error {
 	if task == nil {
 		return fmt.Errorf("task not found or no access")
 	}
+	if err := db.requireCapability(task.ProjectID, userID, func(c *Capabilities) bool { return c.CanChangeStatus }, "change task status"); err != nil {
+		return err
+	}
 
+	if err := db.setTaskStatus(task, userID, status); err != nil {
+		return err
+	}
+
+	if status != task.Status {
+		db.logActivity(userID, task.ProjectID, &taskID, ActivityTaskStatusChanged,
+			ActivityDetails{From: string(task.Status), To: string(status)})
+	}
+
+	return nil
+}
+
+// SetTaskDeadline sets or, with a nil deadline, removes the deadline of a task.
+// Other fields including status and completed_at are left as they are
+func (db *DB) SetTaskDeadline(taskID, userID int, deadline *time.Time) error {
+	task, err := db.GetTaskByID(taskID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get task: %v", err)
+	}
+	if task == nil {
+		return fmt.Errorf("task not found or no access")
+	}
+	if err := db.requireCapability(task.ProjectID, userID, func(c *Capabilities) bool { return c.CanEditTasks }, "edit tasks"); err != nil {
+		return err
+	}
+
+	_, err = db.Exec("UPDATE tasks SET deadline = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", deadline, taskID)
+	if err != nil {
+		return fmt.Errorf("failed to update task deadline: %v", err)
+	}
+	InvalidateProjectTasks(task.ProjectID)
+
+	return nil
+}
+
+// SetTaskPriority changes only the priority of a task, other fields are left as they are
+func (db *DB) SetTaskPriority(taskID, userID int, priority TaskPriority) error {
+	task, err := db.GetTaskByID(taskID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get task: %v", err)
+	}
+	if task == nil {
+		return fmt.Errorf("task not found or no access")
+	}
+	if err := db.requireCapability(task.ProjectID, userID, func(c *Capabilities) bool { return c.CanEditTasks }, "edit tasks"); err != nil {
+		return err
+	}
+
+	_, err = db.Exec("UPDATE tasks SET priority = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", priority, taskID)
+	if err != nil {
+		return fmt.Errorf("failed to update task priority: %v", err)
+	}
+	InvalidateProjectTasks(task.ProjectID)
+
+	return nil
+}
+
+// setTaskStatus changes the status of a task without permission checks or activity logging.
+// The change is recorded in the task's status history as made by userID
+func (db *DB) setTaskStatus(task *Task, userID int, status TaskStatus) error {
 	// Set completed_at if status is changing to done
 	var completedAt *time.Time
 	if status == TaskDone && task.Status != TaskDone {
@@ -327,11 +781,56 @@ func (db *DB) UpdateTaskStatus(taskID, userID int, status TaskStatus) error {
 		WHERE id = ?
 	`
 
-	_, err = db.Exec(query, status, completedAt, taskID)
+	err := db.WithTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(query, status, completedAt, task.ID); err != nil {
+			return fmt.Errorf("failed to update task status: %v", err)
+		}
+		if status != task.Status {
+			return insertStatusChange(tx, task.ID, userID, task.Status, status)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	InvalidateProjectTasks(task.ProjectID)
+
+	return nil
+}
+
+// IsTerminal reports whether the status ends the task's lifecycle (done or cancelled)
+func (s TaskStatus) IsTerminal() bool {
+	return s == TaskDone || s == TaskCancelled
+}
+
+// ReopenTask moves a done or cancelled task back to an open status and records it in the
+// activity log. completed_at is cleared by setTaskStatus
+func (db *DB) ReopenTask(taskID, userID int, toStatus TaskStatus) error {
+	if toStatus.IsTerminal() {
+		return fmt.Errorf("cannot reopen task to status %s", toStatus)
+	}
+
+	task, err := db.GetTaskByID(taskID, userID)
 	if err != nil {
-		return fmt.Errorf("failed to update task status: %v", err)
+		return fmt.Errorf("failed to get task: %v", err)
+	}
+	if task == nil {
+		return fmt.Errorf("task not found or no access")
+	}
+	if !task.Status.IsTerminal() {
+		return fmt.Errorf("task is not completed or cancelled")
+	}
+
+	if err := db.requireCapability(task.ProjectID, userID, func(c *Capabilities) bool { return c.CanChangeStatus }, "change task status"); err != nil {
+		return err
+	}
+	if err := db.setTaskStatus(task, userID, toStatus); err != nil {
+		return err
 	}
 
+	db.logActivity(userID, task.ProjectID, &taskID, ActivityTaskReopened,
+		ActivityDetails{From: string(task.Status), To: string(toStatus)})
+
 	return nil
 }
 
@@ -346,41 +845,292 @@ func (db *DB) DeleteTask(taskID, userID int) error {
 		return fmt.Errorf("task not found or no access")
 	}
 
-	// Check if user has permission to delete tasks in this project
-	userRole, err := db.GetUserRoleInProject(task.ProjectID, userID)
+	// Owners and admins delete any task, members only their own
+	canDelete := func(c *Capabilities) bool {
+		return c.CanDeleteAnyTask || (c.CanDeleteOwnTasks && task.UserID == userID)
+	}
+	if err := db.requireCapability(task.ProjectID, userID, canDelete, "delete this task"); err != nil {
+		return err
+	}
+
+	_, err = db.Exec("DELETE FROM tasks WHERE id = ?", taskID)
 	if err != nil {
+		return fmt.Errorf("failed to delete task: %v", err)
+	}
+	InvalidateProjectTasks(task.ProjectID)
+
+	// Keep a snapshot so /undo can restore the task
+	db.logActivity(userID, task.ProjectID, nil, ActivityTaskDeleted, ActivityDetails{Task: task})
+
+	return nil
+}
+
+// MoveTask moves a task to another project. The user must be able to edit tasks in the current
+// project and create tasks in the new one. Dependencies only link tasks of one project, so a task
+// with dependencies in either direction is not moved until they are removed
+func (db *DB) MoveTask(taskID, userID, newProjectID int) error {
+	task, err := db.GetTaskByID(taskID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get task: %v", err)
+	}
+	if task == nil {
+		return fmt.Errorf("task not found or no access")
+	}
+	if task.ProjectID == newProjectID {
+		return fmt.Errorf("task is already in this project")
+	}
+
+	exists, err := db.ProjectExists(newProjectID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrProjectNotFound
+	}
+	if _, err := db.GetUserRoleInProject(newProjectID, userID); err != nil {
+		if errors.Is(err, ErrNotProjectMember) {
+			return ErrProjectAccessDenied
+		}
 		return fmt.Errorf("failed to check permissions: %v", err)
 	}
 
-	// Only owners, admins, or task creator can delete tasks
-	if userRole != RoleOwner && userRole != RoleAdmin && task.UserID != userID {
-		return fmt.Errorf("insufficient permissions to delete task")
+	if err := db.requireCapability(task.ProjectID, userID, func(c *Capabilities) bool { return c.CanEditTasks }, "move tasks out of this project"); err != nil {
+		return err
+	}
+	if err := db.requireCapability(newProjectID, userID, func(c *Capabilities) bool { return c.CanCreateTasks }, "move tasks into this project"); err != nil {
+		return err
 	}
 
-	_, err = db.Exec("DELETE FROM tasks WHERE id = ?", taskID)
+	if err := db.moveTask(taskID, newProjectID); err != nil {
+		return err
+	}
+
+	db.logActivity(userID, newProjectID, &taskID, ActivityTaskMoved,
+		ActivityDetails{From: strconv.Itoa(task.ProjectID), To: strconv.Itoa(newProjectID)})
+
+	return nil
+}
+
+// moveTask changes the project of a task without permission checks or activity logging.
+// It fails if the task has dependencies, they can't span projects
+func (db *DB) moveTask(taskID, newProjectID int) error {
+	var oldProjectID int
+	err := db.WithTx(func(tx *sql.Tx) error {
+		err := tx.QueryRow("SELECT project_id FROM tasks WHERE id = ? FOR UPDATE", taskID).Scan(&oldProjectID)
+		if err != nil {
+			return fmt.Errorf("failed to get task project: %v", err)
+		}
+
+		var dependencyCount int
+		err = tx.QueryRow(
+			"SELECT COUNT(*) FROM task_dependencies WHERE task_id = ? OR depends_on_task_id = ?",
+			taskID, taskID,
+		).Scan(&dependencyCount)
+		if err != nil {
+			return fmt.Errorf("failed to check task dependencies: %v", err)
+		}
+		if dependencyCount > 0 {
+			return fmt.Errorf("task has dependencies in its project, remove them before moving")
+		}
+
+		_, err = tx.Exec("UPDATE tasks SET project_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", newProjectID, taskID)
+		if err != nil {
+			return fmt.Errorf("failed to move task: %v", err)
+		}
+
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to delete task: %v", err)
+		return err
 	}
 
+	InvalidateProjectTasks(oldProjectID)
+	InvalidateProjectTasks(newProjectID)
 	return nil
 }
 
-// GetTasksWithDeadline retrieves tasks that have deadlines (for notifications)
+// ShiftProjectDeadlines moves every deadline of the project's tasks by delta, a negative delta
+// pulls them in. Tasks without a deadline are left alone. Returns how many deadlines were shifted
+func (db *DB) ShiftProjectDeadlines(projectID, userID int, delta time.Duration) (int, error) {
+	if delta/time.Second == 0 {
+		return 0, fmt.Errorf("shift must be at least one second")
+	}
+	if _, err := db.GetUserRoleInProject(projectID, userID); err != nil {
+		if errors.Is(err, ErrNotProjectMember) {
+			return 0, ErrProjectAccessDenied
+		}
+		return 0, fmt.Errorf("failed to check permissions: %v", err)
+	}
+	if err := db.requireCapability(projectID, userID, func(c *Capabilities) bool { return c.CanEditProject }, "shift project deadlines"); err != nil {
+		return 0, err
+	}
+
+	var shifted int
+	err := db.WithTx(func(tx *sql.Tx) error {
+		// Lock the rows so the count matches what the update changes
+		err := tx.QueryRow(
+			"SELECT COUNT(*) FROM tasks WHERE project_id = ? AND deadline IS NOT NULL FOR UPDATE",
+			projectID,
+		).Scan(&shifted)
+		if err != nil {
+			return fmt.Errorf("failed to count task deadlines: %v", err)
+		}
+
+		query := `
+			UPDATE tasks
+			SET deadline = deadline + INTERVAL ? SECOND, updated_at = CURRENT_TIMESTAMP
+			WHERE project_id = ? AND deadline IS NOT NULL
+		`
+
+		if _, err := tx.Exec(query, int64(delta/time.Second), projectID); err != nil {
+			return fmt.Errorf("failed to shift task deadlines: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	InvalidateProjectTasks(projectID)
+
+	return shifted, nil
+}
+
+// restoreTask re-inserts a deleted task from its snapshot under the same ID.
+// Dependencies and attachments were removed with the task and are not restored
+func (db *DB) restoreTask(task *Task) error {
+	query := `
+		INSERT INTO tasks (id, project_id, user_id, title, description, status, priority,
+		                   deadline, created_at, completed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := db.Exec(query, task.ID, task.ProjectID, task.UserID, task.Title, task.Description,
+		task.Status, task.Priority, task.Deadline, task.CreatedAt, task.CompletedAt)
+	if err != nil {
+		return fmt.Errorf("failed to restore task: %v", err)
+	}
+	InvalidateProjectTasks(task.ProjectID)
+
+	return nil
+}
+
+// GetTasksWithDeadline retrieves tasks that have deadlines (for notifications).
+// Tasks from projects muted by the user are skipped
 func (db *DB) GetTasksWithDeadline(userID int, daysBefore int) ([]*Task, error) {
+	loc := time.Local
+	if prefs, err := db.GetUserPreferences(userID); err == nil {
+		loc = prefs.Location()
+	}
+	return db.GetTasksWithDeadlineAt(userID, daysBefore, time.Now(), loc)
+}
+
+// GetProjectTasksWithDeadline retrieves open tasks of one project due by the end of the day
+// daysBefore days from now in the user's timezone. Unlike the user-wide variant it ignores mute
+// settings, the user asked about this project explicitly
+func (db *DB) GetProjectTasksWithDeadline(projectID, userID int, daysBefore int) ([]*Task, error) {
+	userRole, err := db.GetUserRoleInProject(projectID, userID)
+	if err == ErrNotProjectMember || (err == nil && userRole == "") {
+		return nil, ErrProjectAccessDenied
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to check project access: %v", err)
+	}
+
+	loc := time.Local
+	if prefs, err := db.GetUserPreferences(userID); err == nil {
+		loc = prefs.Location()
+	}
+
 	query := `
 		SELECT t.id, t.project_id, t.user_id, t.title, t.description, 
 		       t.status, t.priority, t.deadline, t.created_at, t.updated_at, 
-		       t.completed_at, p.title
+		       t.completed_at, p.title, ` + taskBlockedColumn + `
+		FROM tasks t
+		JOIN projects p ON t.project_id = p.id
+		WHERE t.project_id = ? AND t.deadline IS NOT NULL AND p.deleted_at IS NULL
+		      AND t.deadline <= ?
+		      AND t.status NOT IN ('done', 'cancelled')
+		ORDER BY t.deadline ASC
+	`
+
+	rows, err := db.Query(query, projectID, deadlineCutoff(time.Now(), daysBefore, loc))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project tasks with deadline: %v", err)
+	}
+	defer rows.Close()
+
+	var tasks []*Task
+	for rows.Next() {
+		task := &Task{}
+		var deadline, completedAt sql.NullTime
+
+		err := rows.Scan(
+			&task.ID, &task.ProjectID, &task.UserID, &task.Title, &task.Description,
+			&task.Status, &task.Priority, &deadline, &task.CreatedAt, &task.UpdatedAt,
+			&completedAt, &task.ProjectTitle, &task.Blocked,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan task: %v", err)
+		}
+
+		if deadline.Valid {
+			task.Deadline = &deadline.Time
+		}
+		if completedAt.Valid {
+			task.CompletedAt = &completedAt.Time
+		}
+
+		tasks = append(tasks, task)
+	}
+
+	return tasks, nil
+}
+
+// deadlineCutoff returns the end of the day daysBefore days after now in the user's timezone.
+// Deadlines are stored as the user's wall-clock time without a zone, so the cutoff is too
+func deadlineCutoff(now time.Time, daysBefore int, loc *time.Location) time.Time {
+	if loc == nil {
+		loc = time.Local
+	}
+	local := now.In(loc).AddDate(0, 0, daysBefore)
+	return time.Date(local.Year(), local.Month(), local.Day(), 23, 59, 59, 0, time.UTC)
+}
+
+// GetTasksWithDeadlineAt retrieves open tasks due by the end of the day daysBefore days
+// after now in the user's timezone, leaving out projects the user muted. It backs deadline
+// notifications, the cutoff is computed here instead of by the DB clock
+func (db *DB) GetTasksWithDeadlineAt(userID int, daysBefore int, now time.Time, loc *time.Location) ([]*Task, error) {
+	return db.getTasksWithDeadlineAt(userID, daysBefore, now, loc, true)
+}
+
+// GetUpcomingTasksAt is GetTasksWithDeadlineAt for an explicit question of the user. Muting only
+// silences notifications, so tasks of muted projects are included
+func (db *DB) GetUpcomingTasksAt(userID int, daysBefore int, now time.Time, loc *time.Location) ([]*Task, error) {
+	return db.getTasksWithDeadlineAt(userID, daysBefore, now, loc, false)
+}
+
+func (db *DB) getTasksWithDeadlineAt(userID int, daysBefore int, now time.Time, loc *time.Location, skipMuted bool) ([]*Task, error) {
+	mutedFilter := ""
+	if skipMuted {
+		mutedFilter = "AND (pn.muted IS NULL OR pn.muted = FALSE)"
+	}
+
+	query := `
+		SELECT t.id, t.project_id, t.user_id, t.title, t.description, 
+		       t.status, t.priority, t.deadline, t.created_at, t.updated_at, 
+		       t.completed_at, p.title, ` + taskBlockedColumn + `
 		FROM tasks t
 		JOIN projects p ON t.project_id = p.id
 		JOIN project_users pu ON p.id = pu.project_id
-		WHERE pu.user_id = ? AND t.deadline IS NOT NULL 
-		      AND t.deadline <= DATE_ADD(NOW(), INTERVAL ? DAY)
+		LEFT JOIN project_notifications pn ON pn.project_id = p.id AND pn.user_id = pu.user_id
+		WHERE pu.user_id = ? AND t.deadline IS NOT NULL AND p.deleted_at IS NULL
+		      AND t.deadline <= ?
 		      AND t.status NOT IN ('done', 'cancelled')
+		      ` + mutedFilter + `
 		ORDER BY t.deadline ASC
 	`
 
-	rows, err := db.Query(query, userID, daysBefore)
+	rows, err := db.Query(query, userID, deadlineCutoff(now, daysBefore, loc))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get tasks with deadline: %v", err)
 	}
@@ -394,7 +1144,7 @@ func (db *DB) GetTasksWithDeadline(userID int, daysBefore int) ([]*Task, error)
 		err := rows.Scan(
 			&task.ID, &task.ProjectID, &task.UserID, &task.Title, &task.Description,
 			&task.Status, &task.Priority, &deadline, &task.CreatedAt, &task.UpdatedAt,
-			&completedAt, &task.ProjectTitle,
+			&completedAt, &task.ProjectTitle, &task.Blocked,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan task: %v", err)
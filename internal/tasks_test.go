@@ -0,0 +1,677 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParseTaskPriority(t *testing.T) {
+	tests := []struct {
+		text       string
+		want       TaskPriority
+		recognized bool
+	}{
+		{"urgent", PriorityUrgent, true},
+		{" HIGH ", PriorityHigh, true},
+		{"low", PriorityLow, true},
+		{"medium", PriorityMedium, true},
+		{"это срочно", PriorityUrgent, true},
+		{"Срочная", PriorityUrgent, true},
+		{"горит!", PriorityUrgent, true},
+		{"critical bug", PriorityUrgent, true},
+		{"ASAP please", PriorityUrgent, true},
+		{"важно", PriorityHigh, true},
+		{"высокий", PriorityHigh, true},
+		{"important", PriorityHigh, true},
+		{"неважно", PriorityLow, true},
+		{"не важно", PriorityLow, true},
+		{"не срочно", PriorityLow, true},
+		{"not urgent", PriorityLow, true},
+		{"Not Important", PriorityLow, true},
+		{"no rush", PriorityLow, true},
+		{"non-urgent fix", PriorityLow, true},
+		{"unimportant", PriorityLow, true},
+		{"not critical", PriorityLow, true},
+		{"низкий", PriorityLow, true},
+		{"low priority please", PriorityLow, true},
+		{"minor", PriorityLow, true},
+		{"обычный", PriorityMedium, true},
+		{"средний", PriorityMedium, true},
+		{"normal", PriorityMedium, true},
+		{"", PriorityMedium, false},
+		{"когда-нибудь", PriorityMedium, false},
+		{"p1", PriorityMedium, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, recognized := ParseTaskPriority(tt.text)
+			if got != tt.want || recognized != tt.recognized {
+				t.Errorf("ParseTaskPriority(%q) = %q, %v, want %q, %v", tt.text, got, recognized, tt.want, tt.recognized)
+			}
+		})
+	}
+}
+
+func TestDeadlineCutoff(t *testing.T) {
+	moscow := time.FixedZone("MSK", 3*60*60)
+	// 22:30 UTC is already the next day in Moscow
+	now := time.Date(2024, 3, 10, 22, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		daysBefore int
+		loc        *time.Location
+		want       time.Time
+	}{
+		{"today in UTC", 0, time.UTC, time.Date(2024, 3, 10, 23, 59, 59, 0, time.UTC)},
+		{"week in UTC", 7, time.UTC, time.Date(2024, 3, 17, 23, 59, 59, 0, time.UTC)},
+		{"today in user's zone", 0, moscow, time.Date(2024, 3, 11, 23, 59, 59, 0, time.UTC)},
+		{"tomorrow in user's zone", 1, moscow, time.Date(2024, 3, 12, 23, 59, 59, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := deadlineCutoff(now, tt.daysBefore, tt.loc); !got.Equal(tt.want) {
+				t.Errorf("deadlineCutoff() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpcomingTasksIncludeMutedProjects(t *testing.T) {
+	db := openTestDB(t)
+	user := createTestUser(t, db, "member")
+
+	project, err := db.CreateProject(user.ID, 0, "Заглушенный проект", "")
+	if err != nil {
+		t.Fatalf("CreateProject() error = %v", err)
+	}
+	deadline := time.Now().Add(time.Hour)
+	task, err := db.CreateTask(project.ID, user.ID, "Срочная задача", "", PriorityHigh, &deadline)
+	if err != nil {
+		t.Fatalf("CreateTask() error = %v", err)
+	}
+	if err := db.SetProjectMuted(user.ID, project.ID, true); err != nil {
+		t.Fatalf("SetProjectMuted() error = %v", err)
+	}
+
+	contains := func(tasks []*Task) bool {
+		for _, tt := range tasks {
+			if tt.ID == task.ID {
+				return true
+			}
+		}
+		return false
+	}
+
+	notified, err := db.GetTasksWithDeadlineAt(user.ID, 1, time.Now(), time.Local)
+	if err != nil {
+		t.Fatalf("GetTasksWithDeadlineAt() error = %v", err)
+	}
+	if contains(notified) {
+		t.Errorf("GetTasksWithDeadlineAt() returned a task of a muted project")
+	}
+
+	upcoming, err := db.GetUpcomingTasksAt(user.ID, 1, time.Now(), time.Local)
+	if err != nil {
+		t.Fatalf("GetUpcomingTasksAt() error = %v", err)
+	}
+	if !contains(upcoming) {
+		t.Errorf("GetUpcomingTasksAt() left out a task of a muted project")
+	}
+}
+
+func TestTaskListsShowBlocked(t *testing.T) {
+	db := openTestDB(t)
+	user := createTestUser(t, db, "member")
+
+	project, err := db.CreateProject(user.ID, 0, "Проект с зависимостями", "")
+	if err != nil {
+		t.Fatalf("CreateProject() error = %v", err)
+	}
+	deadline := time.Now().Add(time.Hour)
+	first, err := db.CreateTask(project.ID, user.ID, "Сначала", "", PriorityMedium, &deadline)
+	if err != nil {
+		t.Fatalf("CreateTask() error = %v", err)
+	}
+	second, err := db.CreateTask(project.ID, user.ID, "Потом", "", PriorityMedium, &deadline)
+	if err != nil {
+		t.Fatalf("CreateTask() error = %v", err)
+	}
+	if err := db.AddTaskDependency(second.ID, first.ID, user.ID); err != nil {
+		t.Fatalf("AddTaskDependency() error = %v", err)
+	}
+
+	blocked := func(tasks []*Task, id int) bool {
+		t.Helper()
+		for _, task := range tasks {
+			if task.ID == id {
+				return task.Blocked
+			}
+		}
+		t.Fatalf("task #%d is not listed", id)
+		return false
+	}
+
+	lists := []struct {
+		name string
+		get  func() ([]*Task, error)
+	}{
+		{"GetProjectTasksWithDeadline", func() ([]*Task, error) { return db.GetProjectTasksWithDeadline(project.ID, user.ID, 1) }},
+		{"GetUpcomingTasksAt", func() ([]*Task, error) { return db.GetUpcomingTasksAt(user.ID, 1, time.Now(), time.Local) }},
+		{"getUserDayViewAt", func() ([]*Task, error) {
+			view, err := db.getUserDayViewAt(user.ID, time.Now(), time.Local)
+			if err != nil {
+				return nil, err
+			}
+			return view.Tasks(), nil
+		}},
+		{"getActiveProjectTasksWithin", func() ([]*Task, error) { return db.getActiveProjectTasksWithin(user.ID, "t.created_at", 1) }},
+	}
+
+	for _, list := range lists {
+		tasks, err := list.get()
+		if err != nil {
+			t.Fatalf("%s() error = %v", list.name, err)
+		}
+		if blocked(tasks, first.ID) || !blocked(tasks, second.ID) {
+			t.Errorf("%s(): blocked = %v, %v, want false, true", list.name, blocked(tasks, first.ID), blocked(tasks, second.ID))
+		}
+	}
+
+	task, err := db.GetTaskByID(second.ID, user.ID)
+	if err != nil {
+		t.Fatalf("GetTaskByID() error = %v", err)
+	}
+	if !task.Blocked {
+		t.Errorf("GetTaskByID() blocked = false, want true")
+	}
+}
+
+func TestRecentlyCompletedSkipsUnknownCompletion(t *testing.T) {
+	db := openTestDB(t)
+	user := createTestUser(t, db, "member")
+
+	project, err := db.CreateProject(user.ID, 0, "Завершённые задачи", "")
+	if err != nil {
+		t.Fatalf("CreateProject() error = %v", err)
+	}
+	recent, err := db.CreateTask(project.ID, user.ID, "Только что", "", PriorityMedium, nil)
+	if err != nil {
+		t.Fatalf("CreateTask() error = %v", err)
+	}
+	legacy, err := db.CreateTask(project.ID, user.ID, "Давно", "", PriorityMedium, nil)
+	if err != nil {
+		t.Fatalf("CreateTask() error = %v", err)
+	}
+	for _, task := range []*Task{recent, legacy} {
+		if err := db.UpdateTaskStatus(task.ID, user.ID, TaskDone); err != nil {
+			t.Fatalf("UpdateTaskStatus() error = %v", err)
+		}
+	}
+	// Done before completion times were recorded
+	if _, err := db.Exec("UPDATE tasks SET completed_at = NULL WHERE id = ?", legacy.ID); err != nil {
+		t.Fatalf("failed to clear completed_at: %v", err)
+	}
+
+	tasks, err := db.GetRecentlyCompletedTasks(user.ID, 1)
+	if err != nil {
+		t.Fatalf("GetRecentlyCompletedTasks() error = %v", err)
+	}
+	if len(tasks) != 1 || tasks[0].ID != recent.ID {
+		t.Errorf("GetRecentlyCompletedTasks() = %d tasks, want only #%d", len(tasks), recent.ID)
+	}
+}
+
+func TestShiftProjectDeadlines(t *testing.T) {
+	db := openTestDB(t)
+	owner := createTestUser(t, db, "owner")
+	member := createTestUser(t, db, "member")
+
+	project, err := db.CreateProject(owner.ID, 0, "Сдвиг дедлайнов", "")
+	if err != nil {
+		t.Fatalf("CreateProject() error = %v", err)
+	}
+	if err := db.AddUserToProject(project.ID, member.ID, owner.ID, RoleMember); err != nil {
+		t.Fatalf("AddUserToProject() error = %v", err)
+	}
+
+	first := time.Date(2030, 3, 10, 18, 0, 0, 0, time.UTC)
+	second := time.Date(2030, 4, 1, 9, 30, 0, 0, time.UTC)
+	var tasks []*Task
+	for _, deadline := range []*time.Time{&first, nil, &second} {
+		task, err := db.CreateTask(project.ID, owner.ID, "Задача", "", PriorityMedium, deadline)
+		if err != nil {
+			t.Fatalf("CreateTask() error = %v", err)
+		}
+		tasks = append(tasks, task)
+	}
+
+	if _, err := db.ShiftProjectDeadlines(project.ID, member.ID, 24*time.Hour); err == nil {
+		t.Errorf("ShiftProjectDeadlines() by a member succeeded")
+	}
+
+	tests := []struct {
+		name  string
+		delta time.Duration
+		want  []*time.Time
+	}{
+		{"a week later", 7 * 24 * time.Hour, []*time.Time{ptrTime(first.AddDate(0, 0, 7)), nil, ptrTime(second.AddDate(0, 0, 7))}},
+		{"back by ten days", -10 * 24 * time.Hour, []*time.Time{ptrTime(first.AddDate(0, 0, -3)), nil, ptrTime(second.AddDate(0, 0, -3))}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shifted, err := db.ShiftProjectDeadlines(project.ID, owner.ID, tt.delta)
+			if err != nil {
+				t.Fatalf("ShiftProjectDeadlines() error = %v", err)
+			}
+			if shifted != 2 {
+				t.Errorf("ShiftProjectDeadlines() = %d, want 2", shifted)
+			}
+
+			for i, task := range tasks {
+				got, err := db.GetTaskByID(task.ID, owner.ID)
+				if err != nil {
+					t.Fatalf("GetTaskByID() error = %v", err)
+				}
+				switch {
+				case tt.want[i] == nil && got.Deadline != nil:
+					t.Errorf("task %d deadline = %v, want none", i, got.Deadline)
+				case tt.want[i] != nil && (got.Deadline == nil || !got.Deadline.Equal(*tt.want[i])):
+					t.Errorf("task %d deadline = %v, want %v", i, got.Deadline, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// ptrTime returns a pointer to t
+func ptrTime(t time.Time) *time.Time {
+	return &t
+}
+
+func TestSetTaskPriorityKeepsOtherFields(t *testing.T) {
+	db := openTestDB(t)
+	owner := createTestUser(t, db, "owner")
+	viewer := createTestUser(t, db, "viewer")
+
+	project, err := db.CreateProject(owner.ID, 0, "Приоритеты", "")
+	if err != nil {
+		t.Fatalf("CreateProject() error = %v", err)
+	}
+	if err := db.AddUserToProject(project.ID, viewer.ID, owner.ID, RoleViewer); err != nil {
+		t.Fatalf("AddUserToProject() error = %v", err)
+	}
+	deadline := time.Date(2030, 5, 1, 18, 0, 0, 0, time.UTC)
+	task, err := db.CreateTask(project.ID, owner.ID, "Релиз", "Собрать и выложить", PriorityLow, &deadline)
+	if err != nil {
+		t.Fatalf("CreateTask() error = %v", err)
+	}
+	if err := db.UpdateTaskStatus(task.ID, owner.ID, TaskInProgress); err != nil {
+		t.Fatalf("UpdateTaskStatus() error = %v", err)
+	}
+
+	if err := db.SetTaskPriority(task.ID, viewer.ID, PriorityUrgent); err == nil {
+		t.Errorf("SetTaskPriority() by a viewer succeeded")
+	}
+	if err := db.SetTaskPriority(task.ID, owner.ID, PriorityUrgent); err != nil {
+		t.Fatalf("SetTaskPriority() error = %v", err)
+	}
+
+	got, err := db.GetTaskByID(task.ID, owner.ID)
+	if err != nil {
+		t.Fatalf("GetTaskByID() error = %v", err)
+	}
+	if got.Priority != PriorityUrgent {
+		t.Errorf("Priority = %s, want %s", got.Priority, PriorityUrgent)
+	}
+	if got.Title != "Релиз" || got.Description != "Собрать и выложить" || got.Status != TaskInProgress {
+		t.Errorf("task = %q %q %s, want the title, description and status unchanged", got.Title, got.Description, got.Status)
+	}
+	if got.Deadline == nil || !got.Deadline.Equal(deadline) {
+		t.Errorf("Deadline = %v, want %v", got.Deadline, deadline)
+	}
+}
+
+func TestCreateTaskProjectErrors(t *testing.T) {
+	db := openTestDB(t)
+	owner := createTestUser(t, db, "owner")
+	stranger := createTestUser(t, db, "stranger")
+
+	project, err := db.CreateProject(owner.ID, 0, "Задачи", "")
+	if err != nil {
+		t.Fatalf("CreateProject() error = %v", err)
+	}
+	deleted, err := db.CreateProject(owner.ID, 0, "Удалённый", "")
+	if err != nil {
+		t.Fatalf("CreateProject() error = %v", err)
+	}
+	if err := db.DeleteProject(deleted.ID, owner.ID); err != nil {
+		t.Fatalf("DeleteProject() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		projectID int
+		userID    int
+		wantErr   error
+	}{
+		{"member creates the task", project.ID, owner.ID, nil},
+		{"project does not exist", -1, owner.ID, ErrProjectNotFound},
+		{"deleted project does not exist", deleted.ID, owner.ID, ErrProjectNotFound},
+		{"no access to an existing project", project.ID, stranger.ID, ErrProjectAccessDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task, err := db.CreateTask(tt.projectID, tt.userID, "Новая задача", "", PriorityMedium, nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CreateTask() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && task.ProjectID != tt.projectID {
+				t.Errorf("task created in project %d, want %d", task.ProjectID, tt.projectID)
+			}
+		})
+	}
+}
+
+func TestReopenTask(t *testing.T) {
+	db := openTestDB(t)
+	owner := createTestUser(t, db, "owner")
+
+	project, err := db.CreateProject(owner.ID, 0, "Переоткрытие", "")
+	if err != nil {
+		t.Fatalf("CreateProject() error = %v", err)
+	}
+	task, err := db.CreateTask(project.ID, owner.ID, "Готовая задача", "", PriorityMedium, nil)
+	if err != nil {
+		t.Fatalf("CreateTask() error = %v", err)
+	}
+	if err := db.UpdateTaskStatus(task.ID, owner.ID, TaskDone); err != nil {
+		t.Fatalf("UpdateTaskStatus() error = %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		status        TaskStatus
+		wantErr       bool
+		wantStatus    TaskStatus
+		wantCompleted bool
+	}{
+		{"terminal target refused", TaskCancelled, true, TaskDone, true},
+		{"reopened to in progress", TaskInProgress, false, TaskInProgress, false},
+		{"open task can't be reopened", TaskTodo, true, TaskInProgress, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := db.ReopenTask(task.ID, owner.ID, tt.status)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReopenTask() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			got, err := db.GetTaskByID(task.ID, owner.ID)
+			if err != nil {
+				t.Fatalf("GetTaskByID() error = %v", err)
+			}
+			if got.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", got.Status, tt.wantStatus)
+			}
+			if (got.CompletedAt != nil) != tt.wantCompleted {
+				t.Errorf("completed_at = %v, want set %v", got.CompletedAt, tt.wantCompleted)
+			}
+		})
+	}
+
+	var reopened int
+	if err := db.QueryRow("SELECT COUNT(*) FROM activity_log WHERE task_id = ? AND action = ?",
+		task.ID, ActivityTaskReopened).Scan(&reopened); err != nil {
+		t.Fatalf("failed to count activity: %v", err)
+	}
+	if reopened != 1 {
+		t.Errorf("logged %d reopens, want 1", reopened)
+	}
+}
+
+func TestMoveTaskPermissions(t *testing.T) {
+	db := openTestDB(t)
+	owner := createTestUser(t, db, "owner")
+	mover := createTestUser(t, db, "mover")
+
+	// noRole leaves the mover out of a project
+	const noRole ProjectRole = ""
+
+	tests := []struct {
+		name       string
+		sourceRole ProjectRole
+		targetRole ProjectRole
+		dependency bool
+		wantErr    error // nil with wantMoved false is any other error
+		wantMoved  bool
+	}{
+		{"member of both", RoleMember, RoleMember, false, nil, true},
+		{"admin of source, member of target", RoleAdmin, RoleMember, false, nil, true},
+		{"viewer of source", RoleViewer, RoleMember, false, nil, false},
+		{"viewer of target", RoleMember, RoleViewer, false, nil, false},
+		{"not a member of source", noRole, RoleMember, false, nil, false},
+		{"not a member of target", RoleMember, noRole, false, ErrProjectAccessDenied, false},
+		{"task with dependencies", RoleMember, RoleMember, true, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			projects := make([]*Project, 2)
+			for i, role := range []ProjectRole{tt.sourceRole, tt.targetRole} {
+				project, err := db.CreateProject(owner.ID, 0, fmt.Sprintf("%s %d", tt.name, i), "")
+				if err != nil {
+					t.Fatalf("CreateProject() error = %v", err)
+				}
+				if role != noRole {
+					if err := db.AddUserToProject(project.ID, mover.ID, owner.ID, role); err != nil {
+						t.Fatalf("AddUserToProject() error = %v", err)
+					}
+				}
+				projects[i] = project
+			}
+			source, target := projects[0], projects[1]
+
+			task, err := db.CreateTask(source.ID, owner.ID, "Не в том проекте", "", PriorityMedium, nil)
+			if err != nil {
+				t.Fatalf("CreateTask() error = %v", err)
+			}
+			if tt.dependency {
+				blocker, err := db.CreateTask(source.ID, owner.ID, "Сначала эта", "", PriorityMedium, nil)
+				if err != nil {
+					t.Fatalf("CreateTask() error = %v", err)
+				}
+				if err := db.AddTaskDependency(task.ID, blocker.ID, owner.ID); err != nil {
+					t.Fatalf("AddTaskDependency() error = %v", err)
+				}
+			}
+
+			err = db.MoveTask(task.ID, mover.ID, target.ID)
+			if tt.wantMoved && err != nil {
+				t.Fatalf("MoveTask() error = %v", err)
+			}
+			if !tt.wantMoved && err == nil {
+				t.Fatalf("MoveTask() succeeded, want an error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("MoveTask() error = %v, want %v", err, tt.wantErr)
+			}
+
+			moved, err := db.GetTaskByID(task.ID, owner.ID)
+			if err != nil {
+				t.Fatalf("GetTaskByID() error = %v", err)
+			}
+			wantProject := source.ID
+			if tt.wantMoved {
+				wantProject = target.ID
+			}
+			if moved.ProjectID != wantProject {
+				t.Errorf("task is in project %d, want %d", moved.ProjectID, wantProject)
+			}
+		})
+	}
+}
+
+func TestSetTaskDeadlineKeepsOtherFields(t *testing.T) {
+	db := openTestDB(t)
+	owner := createTestUser(t, db, "owner")
+
+	project, err := db.CreateProject(owner.ID, 0, "Дедлайны", "")
+	if err != nil {
+		t.Fatalf("CreateProject() error = %v", err)
+	}
+	task, err := db.CreateTask(project.ID, owner.ID, "Отчёт", "Квартальный отчёт", PriorityHigh, nil)
+	if err != nil {
+		t.Fatalf("CreateTask() error = %v", err)
+	}
+	if err := db.UpdateTaskStatus(task.ID, owner.ID, TaskDone); err != nil {
+		t.Fatalf("UpdateTaskStatus() error = %v", err)
+	}
+	done, err := db.GetTaskByID(task.ID, owner.ID)
+	if err != nil {
+		t.Fatalf("GetTaskByID() error = %v", err)
+	}
+
+	deadline := time.Date(2030, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		deadline *time.Time
+	}{
+		{"deadline set", &deadline},
+		{"deadline cleared", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := db.SetTaskDeadline(task.ID, owner.ID, tt.deadline); err != nil {
+				t.Fatalf("SetTaskDeadline() error = %v", err)
+			}
+
+			got, err := db.GetTaskByID(task.ID, owner.ID)
+			if err != nil {
+				t.Fatalf("GetTaskByID() error = %v", err)
+			}
+			if (got.Deadline == nil) != (tt.deadline == nil) || (got.Deadline != nil && !got.Deadline.Equal(*tt.deadline)) {
+				t.Errorf("Deadline = %v, want %v", got.Deadline, tt.deadline)
+			}
+			if got.Title != "Отчёт" || got.Description != "Квартальный отчёт" || got.Priority != PriorityHigh {
+				t.Errorf("task = %q %q %s, want the title, description and priority unchanged", got.Title, got.Description, got.Priority)
+			}
+			if got.Status != TaskDone || got.CompletedAt == nil || !got.CompletedAt.Equal(*done.CompletedAt) {
+				t.Errorf("status %s completed at %v, want done at %v", got.Status, got.CompletedAt, done.CompletedAt)
+			}
+		})
+	}
+}
+
+func TestGetTasksByStatusDeadlineOrder(t *testing.T) {
+	db := openTestDB(t)
+	owner := createTestUser(t, db, "owner")
+
+	project, err := db.CreateProject(owner.ID, 0, "Что дальше", "")
+	if err != nil {
+		t.Fatalf("CreateProject() error = %v", err)
+	}
+
+	created := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	soon := time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)
+	later := soon.AddDate(0, 0, 7)
+	// Tasks in creation order, each created an hour after the previous one
+	tasks := []struct {
+		title    string
+		status   TaskStatus
+		deadline *time.Time
+	}{
+		{"без срока, старая", TaskTodo, nil},
+		{"позже", TaskTodo, &later},
+		{"без срока, новая", TaskTodo, nil},
+		{"скоро", TaskTodo, &soon},
+		{"готова раньше", TaskDone, &soon},
+		{"готова позже", TaskDone, nil},
+	}
+	ids := make(map[string]int)
+	for i, tt := range tasks {
+		task, err := db.CreateTask(project.ID, owner.ID, tt.title, "", PriorityMedium, tt.deadline)
+		if err != nil {
+			t.Fatalf("CreateTask() error = %v", err)
+		}
+		if _, err := db.Exec("UPDATE tasks SET status = ?, created_at = ? WHERE id = ?",
+			tt.status, created.Add(time.Duration(i)*time.Hour), task.ID); err != nil {
+			t.Fatalf("failed to set up task %q: %v", tt.title, err)
+		}
+		ids[tt.title] = task.ID
+	}
+	InvalidateProjectTasks(project.ID)
+
+	tests := []struct {
+		status TaskStatus
+		want   []string
+	}{
+		// Earliest deadline first, tasks without one last and newest first among them
+		{TaskTodo, []string{"скоро", "позже", "без срока, новая", "без срока, старая"}},
+		// Terminal statuses keep the newest-first order
+		{TaskDone, []string{"готова позже", "готова раньше"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.status), func(t *testing.T) {
+			got, err := db.GetTasksByStatus(owner.ID, tt.status)
+			if err != nil {
+				t.Fatalf("GetTasksByStatus() error = %v", err)
+			}
+			gotIDs, wantIDs := []int{}, []int{}
+			for _, task := range got {
+				gotIDs = append(gotIDs, task.ID)
+			}
+			for _, title := range tt.want {
+				wantIDs = append(wantIDs, ids[title])
+			}
+			if fmt.Sprint(gotIDs) != fmt.Sprint(wantIDs) {
+				t.Errorf("GetTasksByStatus(%s) = %v, want %v (%v)", tt.status, gotIDs, wantIDs, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetProjectTasksByStatusAccess(t *testing.T) {
+	db := openTestDB(t)
+	owner := createTestUser(t, db, "owner")
+	stranger := createTestUser(t, db, "stranger")
+
+	project, err := db.CreateProject(owner.ID, 0, "Статусы", "")
+	if err != nil {
+		t.Fatalf("CreateProject() error = %v", err)
+	}
+	if _, err := db.CreateTask(project.ID, owner.ID, "Задача", "", PriorityMedium, nil); err != nil {
+		t.Fatalf("CreateTask() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		userID    int
+		wantTasks int
+		wantErr   error
+	}{
+		{"member", owner.ID, 1, nil},
+		{"non-member", stranger.ID, 0, ErrProjectAccessDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tasks, err := db.GetProjectTasksByStatus(project.ID, tt.userID, TaskTodo)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetProjectTasksByStatus() error = %v, want %v", err, tt.wantErr)
+			}
+			if len(tasks) != tt.wantTasks {
+				t.Errorf("GetProjectTasksByStatus() returned %d tasks, want %d", len(tasks), tt.wantTasks)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// maxTelegramRetryAfter caps how long a 429 may hold a request, longer waits give up instead
+const maxTelegramRetryAfter = 60 * time.Second
+
+// TelegramRetryClient is the HTTP client of the bot. It retries Telegram API calls that failed
+// with a network error, a 5xx or a 429, so Send, Request and GetFile ride out short outages
+// without changes at the call sites. A 429 waits retry_after as Telegram asks. Methods that send
+// something are not retried after a network error or timeout: Telegram may have delivered it
+// before the connection broke, and sending it again would post a duplicate
+type TelegramRetryClient struct {
+	client   tgbotapi.HTTPClient
+	attempts int
+	backoff  time.Duration
+	timeout  time.Duration // Per attempt, 0 is no limit; getUpdates long polling is never limited
+}
+
+// NewTelegramRetryClient wraps client, trying each call up to attempts times and waiting backoff
+// before the first retry, doubled for each next one
+func NewTelegramRetryClient(client tgbotapi.HTTPClient, attempts int, backoff, timeout time.Duration) *TelegramRetryClient {
+	if attempts < 1 {
+		attempts = 1
+	}
+	if backoff < 0 {
+		backoff = 0
+	}
+	if timeout < 0 {
+		timeout = 0
+	}
+	return &TelegramRetryClient{
+		client:   client,
+		attempts: attempts,
+		backoff:  backoff,
+		timeout:  timeout,
+	}
+}
+
+// telegramErrorBody is the part of a failed Telegram API response needed to retry it
+type telegramErrorBody struct {
+	Parameters struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+// Do sends the request, retrying it while attempts are left. The last response or error is
+// returned as it came, the library turns it into the usual API error
+func (c *TelegramRetryClient) Do(req *http.Request) (*http.Response, error) {
+	method := req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:]
+	backoff := c.backoff
+
+	for attempt := 1; ; attempt++ {
+		resp, err := c.do(req, method)
+
+		wait := backoff
+		switch {
+		case err != nil && !isIdempotentTelegramMethod(method):
+			log.Printf("❌ Telegram %s failed, not retrying to avoid a duplicate: %v", method, err)
+			return resp, err
+		case err != nil:
+		case resp.StatusCode == http.StatusTooManyRequests:
+			wait = telegramRetryAfter(resp, backoff)
+		case resp.StatusCode >= 500:
+		default:
+			return resp, nil
+		}
+
+		// Uploads stream their body and can't be sent twice
+		canResend := req.Body == nil || req.GetBody != nil
+		if attempt >= c.attempts || !canResend || wait > maxTelegramRetryAfter {
+			if err != nil {
+				log.Printf("❌ Telegram %s failed after %d attempts: %v", method, attempt, err)
+			} else {
+				log.Printf("❌ Telegram %s failed after %d attempts: HTTP %d", method, attempt, resp.StatusCode)
+			}
+			return resp, err
+		}
+
+		if err != nil {
+			log.Printf("⚠️ Telegram %s failed (attempt %d/%d), retrying in %v: %v", method, attempt, c.attempts, wait, err)
+		} else {
+			log.Printf("⚠️ Telegram %s failed (attempt %d/%d), retrying in %v: HTTP %d", method, attempt, c.attempts, wait, resp.StatusCode)
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		time.Sleep(wait)
+		backoff *= 2
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("failed to resend %s: %v", method, err)
+			}
+			req.Body = body
+		}
+	}
+}
+
+// isIdempotentTelegramMethod reports whether calling a Telegram method twice has the same effect
+// as calling it once. Reads, edits and deletions are, sending, forwarding and copying messages are not
+func isIdempotentTelegramMethod(method string) bool {
+	if method == "sendChatAction" {
+		return true
+	}
+	for _, prefix := range []string{"send", "forward", "copy"} {
+		if strings.HasPrefix(method, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// do makes one attempt with the per attempt timeout. The body is read before the timeout ends
+// so the caller gets a complete response
+func (c *TelegramRetryClient) do(req *http.Request, method string) (*http.Response, error) {
+	if c.timeout <= 0 || method == "getUpdates" {
+		return c.client.Do(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), c.timeout)
+	defer cancel()
+
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// telegramRetryAfter returns the wait a 429 response asks for, fallback if it has none.
+// The body is restored for the caller
+func telegramRetryAfter(resp *http.Response, fallback time.Duration) time.Duration {
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return fallback
+	}
+
+	var parsed telegramErrorBody
+	if json.Unmarshal(body, &parsed) != nil || parsed.Parameters.RetryAfter <= 0 {
+		return fallback
+	}
+	return time.Duration(parsed.Parameters.RetryAfter) * time.Second
+}
@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// fakeTelegramResponse is a scripted answer of fakeTelegramClient, an error or a status with a body
+type fakeTelegramResponse struct {
+	err    error
+	status int
+	body   string
+}
+
+// fakeTelegramClient answers requests with its script in order and records the bodies it got
+type fakeTelegramClient struct {
+	script []fakeTelegramResponse
+	bodies []string
+}
+
+func (c *fakeTelegramClient) Do(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		body, _ = io.ReadAll(req.Body)
+	}
+	c.bodies = append(c.bodies, string(body))
+
+	next := c.script[len(c.bodies)-1]
+	if next.err != nil {
+		return nil, next.err
+	}
+	return &http.Response{
+		StatusCode: next.status,
+		Body:       io.NopCloser(strings.NewReader(next.body)),
+		Header:     http.Header{},
+	}, nil
+}
+
+func TestTelegramRetryClient(t *testing.T) {
+	networkErr := errors.New("connection reset by peer")
+	ok := fakeTelegramResponse{status: 200, body: `{"ok":true,"result":{}}`}
+	serverError := fakeTelegramResponse{status: 502, body: `{"ok":false,"error_code":502}`}
+	tooManyRequests := fakeTelegramResponse{status: 429, body: `{"ok":false,"error_code":429,"parameters":{}}`}
+	tooLongWait := fakeTelegramResponse{status: 429, body: `{"ok":false,"error_code":429,"parameters":{"retry_after":3600}}`}
+
+	tests := []struct {
+		name       string
+		method     string
+		script     []fakeTelegramResponse
+		wantCalls  int
+		wantStatus int // 0 when an error is expected
+	}{
+		{"success", "sendMessage", []fakeTelegramResponse{ok}, 1, 200},
+		{"read retried after network error", "getFile", []fakeTelegramResponse{{err: networkErr}, ok}, 2, 200},
+		{"edit retried after network error", "editMessageText", []fakeTelegramResponse{{err: networkErr}, ok}, 2, 200},
+		{"send not retried after network error", "sendMessage", []fakeTelegramResponse{{err: networkErr}, ok}, 1, 0},
+		{"upload not retried after network error", "sendDocument", []fakeTelegramResponse{{err: networkErr}, ok}, 1, 0},
+		{"chat action retried after network error", "sendChatAction", []fakeTelegramResponse{{err: networkErr}, ok}, 2, 200},
+		{"send retried after 5xx", "sendMessage", []fakeTelegramResponse{serverError, ok}, 2, 200},
+		{"send retried after 429", "sendMessage", []fakeTelegramResponse{tooManyRequests, ok}, 2, 200},
+		{"gives up after attempts", "sendMessage", []fakeTelegramResponse{serverError, serverError, serverError}, 3, 502},
+		{"gives up on a long retry_after", "sendMessage", []fakeTelegramResponse{tooLongWait, ok}, 1, 429},
+		{"client errors not retried", "sendMessage", []fakeTelegramResponse{{status: 400, body: `{"ok":false}`}, ok}, 1, 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeTelegramClient{script: tt.script}
+			client := NewTelegramRetryClient(fake, 3, 0, 0)
+
+			req, err := http.NewRequest("POST", "https://api.telegram.org/botTOKEN/"+tt.method, strings.NewReader("chat_id=1&text=hi"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := client.Do(req)
+
+			if len(fake.bodies) != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", len(fake.bodies), tt.wantCalls)
+			}
+			for i, body := range fake.bodies {
+				if body != "chat_id=1&text=hi" {
+					t.Errorf("call %d sent body %q, want the original body", i+1, body)
+				}
+			}
+
+			if tt.wantStatus == 0 {
+				if err == nil {
+					t.Errorf("Do() error = nil, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
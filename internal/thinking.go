@@ -0,0 +1,127 @@
+package internal
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ThinkingPlaceholderText is shown while a slow AI response is being generated
+const ThinkingPlaceholderText = "🤔 Думаю над вашим запросом..."
+
+// thinkingPlaceholderDelay is how long the AI may take before the placeholder is sent, 0 disables it
+var thinkingPlaceholderDelay time.Duration
+
+// SetThinkingPlaceholderDelay enables the thinking placeholder after delay, non-positive values disable it
+func SetThinkingPlaceholderDelay(delay time.Duration) {
+	if delay < 0 {
+		delay = 0
+	}
+	thinkingPlaceholderDelay = delay
+}
+
+// ThinkingPlaceholder is a message sent when the AI hasn't answered within thinkingPlaceholderDelay.
+// The first reply replaces it, otherwise it is deleted. Methods are no-ops on a nil placeholder (disabled)
+type ThinkingPlaceholder struct {
+	bot    *tgbotapi.BotAPI
+	chatID int64
+	timer  *time.Timer
+
+	mu        sync.Mutex
+	messageID int  // Sent placeholder, 0 if it wasn't sent
+	closed    bool // Stopped, the timer must not send the placeholder anymore
+}
+
+// StartThinkingPlaceholder schedules the placeholder, returns nil when placeholders are disabled
+func StartThinkingPlaceholder(bot *tgbotapi.BotAPI, chatID int64) *ThinkingPlaceholder {
+	if thinkingPlaceholderDelay <= 0 {
+		return nil
+	}
+
+	p := &ThinkingPlaceholder{bot: bot, chatID: chatID}
+	p.timer = time.AfterFunc(thinkingPlaceholderDelay, p.send)
+	return p
+}
+
+// send posts the placeholder unless the placeholder was stopped meanwhile
+func (p *ThinkingPlaceholder) send() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+
+	sent, err := p.bot.Send(tgbotapi.NewMessage(p.chatID, ThinkingPlaceholderText))
+	if err != nil {
+		log.Printf("Failed to send thinking placeholder: %v", err)
+		return
+	}
+	p.messageID = sent.MessageID
+}
+
+// Stop keeps the placeholder from being sent, call it once the AI has answered.
+// A placeholder already sent stays until ReplaceWith or Remove
+func (p *ThinkingPlaceholder) Stop() {
+	if p == nil {
+		return
+	}
+	p.timer.Stop()
+
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+}
+
+// ReplaceWith edits the placeholder into text formatted like SendReply and returns its message ID.
+// Returns 0 if there is no placeholder to replace (disabled, not sent or already replaced), the
+// caller sends text then
+func (p *ThinkingPlaceholder) ReplaceWith(text string) int {
+	if p == nil {
+		return 0
+	}
+	p.Stop()
+
+	p.mu.Lock()
+	messageID := p.messageID
+	p.messageID = 0
+	p.mu.Unlock()
+
+	if messageID == 0 {
+		return 0
+	}
+
+	editMsg := tgbotapi.NewEditMessageText(p.chatID, messageID, MarkdownToTelegramHTML(text))
+	editMsg.ParseMode = tgbotapi.ModeHTML
+	if _, err := p.bot.Send(editMsg); err != nil {
+		log.Printf("Failed to replace thinking placeholder: %v", err)
+		p.delete(messageID)
+		return 0
+	}
+	return messageID
+}
+
+// Remove deletes the placeholder if it is still shown, safe to call after ReplaceWith
+func (p *ThinkingPlaceholder) Remove() {
+	if p == nil {
+		return
+	}
+	p.Stop()
+
+	p.mu.Lock()
+	messageID := p.messageID
+	p.messageID = 0
+	p.mu.Unlock()
+
+	if messageID != 0 {
+		p.delete(messageID)
+	}
+}
+
+// delete removes a sent placeholder message
+func (p *ThinkingPlaceholder) delete(messageID int) {
+	if _, err := p.bot.Request(tgbotapi.NewDeleteMessage(p.chatID, messageID)); err != nil {
+		log.Printf("Failed to delete thinking placeholder: %v", err)
+	}
+}
@@ -0,0 +1,189 @@
+package internal
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// undoHandlers reverse each action of the activity log that /undo supports
+var undoHandlers = map[ActivityAction]func(db *DB, userID int, activity *Activity) (string, error){
+	ActivityTaskCreated:       undoTaskCreated,
+	ActivityTaskStatusChanged: undoTaskStatusChange,
+	ActivityTaskReopened:      undoTaskStatusChange,
+	ActivityTaskDeleted:       undoTaskDeleted,
+	ActivityProjectReopened:   undoProjectReopened,
+	ActivityProjectDeleted:    undoProjectDeleted,
+	ActivityTaskMoved:         undoTaskMoved,
+}
+
+// UndoLastAction reverses the user's most recent action from the activity log and
+// returns a message describing the result. An entry that can't be reversed is marked undone
+// anyway, so the next /undo moves on to the previous action instead of failing on it again
+func UndoLastAction(db *DB, userID int) (string, error) {
+	activity, err := db.GetLastActivity(userID)
+	if err != nil {
+		return "", err
+	}
+	if activity == nil {
+		return "🤷 Нечего отменять", nil
+	}
+
+	undo, ok := undoHandlers[activity.Action]
+	if !ok {
+		if err := db.MarkActivityUndone(activity.ID); err != nil {
+			return "", err
+		}
+		return "⚠️ Последнее действие нельзя отменить", nil
+	}
+
+	message, err := undo(db, userID, activity)
+	if err != nil {
+		log.Printf("❌ Failed to undo activity %d (%s) of user %d, skipping it: %v", activity.ID, activity.Action, userID, err)
+		if err := db.MarkActivityUndone(activity.ID); err != nil {
+			return "", err
+		}
+		return "⚠️ Последнее действие отменить не удалось, оно пропущено. Следующая /undo отменит предыдущее", nil
+	}
+
+	if err := db.MarkActivityUndone(activity.ID); err != nil {
+		return "", err
+	}
+	log.Printf("↩️ User %d undid activity %d (%s)", userID, activity.ID, activity.Action)
+
+	return message, nil
+}
+
+// undoTaskCreated deletes a task the user just created
+func undoTaskCreated(db *DB, userID int, activity *Activity) (string, error) {
+	if activity.TaskID == nil {
+		return "", fmt.Errorf("activity %d has no task", activity.ID)
+	}
+
+	task, err := db.GetTaskByID(*activity.TaskID, userID)
+	if err != nil {
+		return "", err
+	}
+	if task == nil {
+		return "", fmt.Errorf("task not found or no access")
+	}
+	if err := db.requireCapability(task.ProjectID, userID, func(c *Capabilities) bool { return c.CanDeleteOwnTasks }, "delete tasks"); err != nil {
+		return "", err
+	}
+
+	// Deleted directly, undoing a creation must not log a deletion that /undo would restore
+	if _, err := db.Exec("DELETE FROM tasks WHERE id = ?", task.ID); err != nil {
+		return "", fmt.Errorf("failed to delete task: %v", err)
+	}
+	InvalidateProjectTasks(task.ProjectID)
+
+	return fmt.Sprintf("↩️ Создание задачи «%s» отменено", html.EscapeString(task.Title)), nil
+}
+
+// undoTaskStatusChange sets a task back to its previous status
+func undoTaskStatusChange(db *DB, userID int, activity *Activity) (string, error) {
+	if activity.TaskID == nil || activity.Details.From == "" {
+		return "", fmt.Errorf("activity %d has no previous status", activity.ID)
+	}
+
+	task, err := db.GetTaskByID(*activity.TaskID, userID)
+	if err != nil {
+		return "", err
+	}
+	if task == nil {
+		return "", fmt.Errorf("task not found or no access")
+	}
+	if err := db.requireCapability(task.ProjectID, userID, func(c *Capabilities) bool { return c.CanChangeStatus }, "change task status"); err != nil {
+		return "", err
+	}
+
+	previous := TaskStatus(activity.Details.From)
+	if err := db.setTaskStatus(task, userID, previous); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("↩️ Задача «%s» снова в статусе %s %s", html.EscapeString(task.Title), TaskStatusEmoji(previous), previous), nil
+}
+
+// undoTaskDeleted restores a deleted task from the snapshot stored in the activity log
+func undoTaskDeleted(db *DB, userID int, activity *Activity) (string, error) {
+	task := activity.Details.Task
+	if task == nil {
+		return "", fmt.Errorf("activity %d has no task snapshot", activity.ID)
+	}
+	if err := db.requireCapability(task.ProjectID, userID, func(c *Capabilities) bool { return c.CanCreateTasks }, "create tasks"); err != nil {
+		return "", err
+	}
+
+	if err := db.restoreTask(task); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("↩️ Задача «%s» восстановлена (зависимости и вложения не восстанавливаются)", html.EscapeString(task.Title)), nil
+}
+
+// undoTaskMoved moves a task back to the project it was moved from
+func undoTaskMoved(db *DB, userID int, activity *Activity) (string, error) {
+	previousProjectID, err := strconv.Atoi(activity.Details.From)
+	if activity.TaskID == nil || err != nil {
+		return "", fmt.Errorf("activity %d has no previous project", activity.ID)
+	}
+
+	task, err := db.GetTaskByID(*activity.TaskID, userID)
+	if err != nil {
+		return "", err
+	}
+	if task == nil {
+		return "", fmt.Errorf("task not found or no access")
+	}
+	if err := db.requireCapability(task.ProjectID, userID, func(c *Capabilities) bool { return c.CanEditTasks }, "move tasks out of this project"); err != nil {
+		return "", err
+	}
+	if err := db.requireCapability(previousProjectID, userID, func(c *Capabilities) bool { return c.CanCreateTasks }, "move tasks into this project"); err != nil {
+		return "", err
+	}
+
+	if err := db.moveTask(task.ID, previousProjectID); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("↩️ Задача «%s» возвращена в проект #%d", html.EscapeString(task.Title), previousProjectID), nil
+}
+
+// undoProjectReopened sets a reopened project back to its previous status
+func undoProjectReopened(db *DB, userID int, activity *Activity) (string, error) {
+	if activity.Details.From == "" {
+		return "", fmt.Errorf("activity %d has no previous status", activity.ID)
+	}
+
+	previous := ProjectStatus(activity.Details.From)
+	if err := db.UpdateProjectStatus(activity.ProjectID, userID, previous); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("↩️ Проект снова в статусе %s", previous), nil
+}
+
+// undoProjectDeleted restores a project the user deleted
+func undoProjectDeleted(db *DB, userID int, activity *Activity) (string, error) {
+	if err := db.RestoreProject(activity.ProjectID, userID); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("↩️ Проект #%d восстановлен вместе с задачами", activity.ProjectID), nil
+}
+
+// SendUndo handles the /undo command
+func SendUndo(bot *tgbotapi.BotAPI, db *DB, chatID int64, userID int) {
+	message, err := UndoLastAction(db, userID)
+	if err != nil {
+		log.Printf("❌ Error undoing last action of user %d: %v", userID, err)
+		SendReply(bot, chatID, "❌ Не удалось отменить последнее действие")
+		return
+	}
+
+	SendReply(bot, chatID, message)
+}
@@ -0,0 +1,30 @@
+package internal
+
+import "testing"
+
+func TestUndoableActionsHaveHandlers(t *testing.T) {
+	undoable := make(map[ActivityAction]bool)
+	for _, action := range undoableActions {
+		if undoable[action] {
+			t.Errorf("action %s is listed twice in undoableActions", action)
+		}
+		undoable[action] = true
+		if _, ok := undoHandlers[action]; !ok {
+			t.Errorf("undoable action %s has no undo handler", action)
+		}
+	}
+
+	for action := range undoHandlers {
+		if !undoable[action] {
+			t.Errorf("action %s has an undo handler but GetLastActivity skips it", action)
+		}
+	}
+}
+
+func TestAuditActionsAreNotUndoable(t *testing.T) {
+	for _, action := range undoableActions {
+		if action == ActivityRoleChanged {
+			t.Errorf("role changes are an audit trail and must not be undoable")
+		}
+	}
+}
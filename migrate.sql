@@ -1,15 +1,11 @@
 -- Migration script for improved project management schema
 -- Creates projects table without user_id and project_users table for user-project relationships with roles
+-- Safe to re-run: existing tables and their data are kept
 
 USE teamwork;
 
--- Drop existing projects table if it exists (clean start)
-DROP TABLE IF EXISTS project_users;
-
-DROP TABLE IF EXISTS projects;
-
 -- Create projects table (without user_id - projects can have multiple users)
-CREATE TABLE projects (
+CREATE TABLE IF NOT EXISTS projects (
     id INT AUTO_INCREMENT PRIMARY KEY,
     title VARCHAR(255) NOT NULL,
     description TEXT,
@@ -27,7 +23,7 @@ CREATE TABLE projects (
 );
 
 -- Create project_users table for many-to-many relationship with roles
-CREATE TABLE project_users (
+CREATE TABLE IF NOT EXISTS project_users (
     id INT AUTO_INCREMENT PRIMARY KEY,
     project_id INT NOT NULL,
     user_id INT NOT NULL,
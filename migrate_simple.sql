@@ -7,6 +7,22 @@ USE teamwork;
 SET FOREIGN_KEY_CHECKS = 0;
 
 -- Drop all tables in correct order (to avoid foreign key constraints)
+DROP TABLE IF EXISTS user_chat_state;
+
+DROP TABLE IF EXISTS js_errors;
+
+DROP TABLE IF EXISTS task_status_history;
+
+DROP TABLE IF EXISTS task_attachments;
+
+DROP TABLE IF EXISTS activity_log;
+
+DROP TABLE IF EXISTS user_preferences;
+
+DROP TABLE IF EXISTS task_dependencies;
+
+DROP TABLE IF EXISTS project_notifications;
+
 DROP TABLE IF EXISTS tasks;
 
 DROP TABLE IF EXISTS messages;
@@ -47,8 +63,10 @@ CREATE TABLE projects (
     ) DEFAULT 'planning',
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP NULL,
     INDEX idx_status (status),
-    INDEX idx_created_at (created_at)
+    INDEX idx_created_at (created_at),
+    INDEX idx_deleted_at (deleted_at)
 );
 
 -- Recreate project_users table
@@ -63,12 +81,15 @@ CREATE TABLE project_users (
         'viewer'
     ) DEFAULT 'member',
     joined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_viewed_at TIMESTAMP NULL,
+    last_used_at TIMESTAMP NULL,
     FOREIGN KEY (project_id) REFERENCES projects (id) ON DELETE CASCADE,
     FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
     UNIQUE KEY unique_project_user (project_id, user_id),
     INDEX idx_project_id (project_id),
     INDEX idx_user_id (user_id),
-    INDEX idx_role (role)
+    INDEX idx_role (role),
+    INDEX idx_user_last_used (user_id, last_used_at)
 );
 
 -- Recreate messages table
@@ -76,14 +97,16 @@ CREATE TABLE messages (
     id INT AUTO_INCREMENT PRIMARY KEY,
     user_id INT NOT NULL,
     chat_id BIGINT NOT NULL,
-    role ENUM('user', 'assistant') NOT NULL,
+    tg_message_id INT NULL,
+    role ENUM('user', 'assistant', 'system', 'function') NOT NULL,
     content TEXT NOT NULL,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
     INDEX idx_chat_id (chat_id),
     INDEX idx_user_id (user_id),
     INDEX idx_created_at (created_at),
-    INDEX idx_chat_created (chat_id, created_at)
+    INDEX idx_chat_created (chat_id, created_at),
+    INDEX idx_chat_tg_message (chat_id, tg_message_id)
 );
 
 -- Recreate tasks table
@@ -122,6 +145,108 @@ CREATE TABLE tasks (
     INDEX idx_user_status (user_id, status)
 );
 
+-- Recreate project_notifications table
+CREATE TABLE project_notifications (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    project_id INT NOT NULL,
+    muted BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (project_id) REFERENCES projects (id) ON DELETE CASCADE,
+    UNIQUE KEY unique_user_project (user_id, project_id),
+    INDEX idx_project_id (project_id)
+);
+
+-- Recreate task_dependencies table
+CREATE TABLE task_dependencies (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    task_id INT NOT NULL,
+    depends_on_task_id INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (task_id) REFERENCES tasks (id) ON DELETE CASCADE,
+    FOREIGN KEY (depends_on_task_id) REFERENCES tasks (id) ON DELETE CASCADE,
+    UNIQUE KEY unique_task_dependency (task_id, depends_on_task_id),
+    INDEX idx_depends_on_task_id (depends_on_task_id)
+);
+
+-- Recreate user_preferences table
+CREATE TABLE user_preferences (
+    user_id INT PRIMARY KEY,
+    language VARCHAR(8) NOT NULL DEFAULT 'ru',
+    timezone VARCHAR(64) NOT NULL DEFAULT 'Europe/Moscow',
+    digest_enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    preferred_provider VARCHAR(16) NOT NULL DEFAULT '',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- Recreate activity_log table
+CREATE TABLE activity_log (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    project_id INT NOT NULL,
+    task_id INT NULL,
+    action VARCHAR(50) NOT NULL,
+    details TEXT,
+    undone BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (project_id) REFERENCES projects (id) ON DELETE CASCADE,
+    FOREIGN KEY (task_id) REFERENCES tasks (id) ON DELETE CASCADE,
+    INDEX idx_project_created (project_id, created_at)
+);
+
+-- Recreate task_attachments table
+CREATE TABLE task_attachments (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    task_id INT NOT NULL,
+    user_id INT NOT NULL,
+    file_id VARCHAR(255) NOT NULL,
+    file_name VARCHAR(255) NOT NULL DEFAULT '',
+    file_type ENUM('photo', 'document') NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (task_id) REFERENCES tasks (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    INDEX idx_task_id (task_id)
+);
+
+-- Recreate task_status_history table
+CREATE TABLE task_status_history (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    task_id INT NOT NULL,
+    user_id INT NOT NULL,
+    from_status VARCHAR(20) NOT NULL,
+    to_status VARCHAR(20) NOT NULL,
+    changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (task_id) REFERENCES tasks (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    INDEX idx_task_changed (task_id, changed_at)
+);
+
+-- Recreate js_errors table
+CREATE TABLE js_errors (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    kind VARCHAR(32) NOT NULL,
+    error TEXT NOT NULL,
+    code TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    INDEX idx_kind_created (kind, created_at)
+);
+
+-- Recreate user_chat_state table
+CREATE TABLE user_chat_state (
+    user_id INT NOT NULL,
+    chat_id BIGINT NOT NULL,
+    current_project_id INT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, chat_id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (current_project_id) REFERENCES projects (id) ON DELETE SET NULL
+);
+
 -- Add foreign key constraints that reference other tables
 ALTER TABLE users
 ADD FOREIGN KEY (current_project_id) REFERENCES projects (id) ON DELETE SET NULL;
\ No newline at end of file
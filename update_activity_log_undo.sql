@@ -0,0 +1,7 @@
+-- Add undone flag to activity_log
+-- /undo marks reversed entries so the next /undo moves on to the previous action
+
+USE teamwork;
+
+ALTER TABLE activity_log
+ADD COLUMN undone BOOLEAN NOT NULL DEFAULT FALSE AFTER details;
@@ -0,0 +1,7 @@
+-- Allow internal message roles in messages table
+-- 'system' stores internal notes (errors), 'function' stores JavaScript output results
+
+USE teamwork;
+
+ALTER TABLE messages
+MODIFY COLUMN role ENUM('user', 'assistant', 'system', 'function') NOT NULL;
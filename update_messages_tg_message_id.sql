@@ -0,0 +1,10 @@
+-- Add Telegram message ID of sent bot messages to messages
+-- Lets a stored bot message be found again to edit or delete it in the chat
+
+USE teamwork;
+
+ALTER TABLE messages
+ADD COLUMN tg_message_id INT NULL AFTER chat_id;
+
+ALTER TABLE messages
+ADD INDEX idx_chat_tg_message (chat_id, tg_message_id);
@@ -0,0 +1,8 @@
+-- Add last_used_at to project_users
+-- Set on current project switches and task activity, orders the recent projects quick-switch list
+
+USE teamwork;
+
+ALTER TABLE project_users
+ADD COLUMN last_used_at TIMESTAMP NULL AFTER last_viewed_at,
+ADD INDEX idx_user_last_used (user_id, last_used_at);
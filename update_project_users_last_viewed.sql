@@ -0,0 +1,7 @@
+-- Add last_viewed_at to project_users
+-- Projects with task changes after it are marked as having new activity in the projects list
+
+USE teamwork;
+
+ALTER TABLE project_users
+ADD COLUMN last_viewed_at TIMESTAMP NULL AFTER joined_at;
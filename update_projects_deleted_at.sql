@@ -0,0 +1,8 @@
+-- Add deleted_at to projects
+-- Deleted projects are hidden with their tasks until restored or purged after the retention period
+
+USE teamwork;
+
+ALTER TABLE projects
+ADD COLUMN deleted_at TIMESTAMP NULL AFTER updated_at,
+ADD INDEX idx_deleted_at (deleted_at);
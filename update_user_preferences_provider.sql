@@ -0,0 +1,7 @@
+-- Add preferred AI provider to user_preferences
+-- Empty means the bot's default provider from AI_PROVIDER
+
+USE teamwork;
+
+ALTER TABLE user_preferences
+ADD COLUMN preferred_provider VARCHAR(16) NOT NULL DEFAULT '' AFTER digest_enabled;